@@ -89,15 +89,32 @@ func run(ctx context.Context) error {
 	captureEngine := capture.NewPacketCaptureEngine(logger.WithComponent("capture").Logger)
 	captureEngine.SetMetricsCollector(metricsCollector)
 
+	// Log capture engine lifecycle events
+	engineEvents, unsubscribe := captureEngine.Subscribe(0)
+	defer unsubscribe()
+	go logEngineEvents(logger.WithComponent("capture"), engineEvents)
+
+	// Build the packet processing pipeline
+	packetPipeline, err := newPipeline(cfg, logger, interfaceManager, metricsCollector)
+	if err != nil {
+		return fmt.Errorf("failed to initialize packet pipeline: %w", err)
+	}
+
 	// Start packet capture
 	if err := captureEngine.StartCapture(interfaceName); err != nil {
 		return fmt.Errorf("failed to start packet capture: %w", err)
 	}
 
+	// Process captured packets until shutdown
+	pipelineDone := make(chan struct{})
+	go func() {
+		defer close(pipelineDone)
+		packetPipeline.run(ctx, captureEngine.PacketChannel())
+	}()
+
 	logger.WithComponent("main").Info("Application initialized successfully")
 
 	// TODO: In future stories, add:
-	// - Flow processing
 	// - Web server and API
 	// - WebSocket handler
 	// - Metrics HTTP endpoint
@@ -113,8 +130,26 @@ func run(ctx context.Context) error {
 			logger.WithComponent("main").Error(fmt.Sprintf("Error stopping capture engine: %v", err))
 		}
 	}
+	<-pipelineDone
 
 	logger.WithComponent("main").Info("Application shutdown complete")
 
 	return nil
 }
+
+func logEngineEvents(l *logger.Logger, events <-chan capture.EngineEvent) {
+	for event := range events {
+		fields := make(map[string]any, len(event.Details)+1)
+		for k, v := range event.Details {
+			fields[k] = v
+		}
+		fields["event"] = string(event.Type)
+
+		switch event.Type {
+		case capture.EventInterfaceLost, capture.EventRingOverrun, capture.EventPollError:
+			l.WithFields(fields).Warn("capture engine event")
+		default:
+			l.WithFields(fields).Info("capture engine event")
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/classify"
+	"github.com/Karias-sys/Traffic_Monitor/internal/config"
+	"github.com/Karias-sys/Traffic_Monitor/internal/flow"
+	"github.com/Karias-sys/Traffic_Monitor/internal/metrics"
+	"github.com/Karias-sys/Traffic_Monitor/internal/neighbor"
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/dhcp"
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/dns"
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/http"
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/quic"
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/tls"
+	"github.com/Karias-sys/Traffic_Monitor/internal/stream"
+	"github.com/Karias-sys/Traffic_Monitor/pkg/logger"
+)
+
+// flowWorkBuffer is how many observations each flow worker may fall
+// behind the capture loop by.
+const flowWorkBuffer = 1024
+
+// pipeline takes captured packets through decoding, fragment reassembly,
+// flow tracking and the protocol analyzers. It is driven from a single
+// goroutine by run, which hands the flow table's share of each packet to
+// flow workers: one per CPU, each owning the table shards its flows hash
+// to, so that the table is updated in parallel without lock contention.
+type pipeline struct {
+	logger      *logger.Logger
+	decoder     *capture.Decoder
+	reassembler *capture.Reassembler
+	interfaces  *capture.InterfaceManager
+	flows       *flow.Table
+	streams     *stream.Assembler
+	quic        *quic.Analyzer
+	dns         *dns.Store
+	dhcp        *dhcp.Inventory
+	neighbors   *neighbor.Table
+	metrics     *metrics.SystemMetricsCollector
+	flowWork    []chan flowWork
+	flowWorkers sync.WaitGroup
+
+	dissect         bool
+	format          capture.DissectFormat
+	packet          capture.ParsedPacket
+	datagram        capture.ParsedPacket
+	cleanupInterval time.Duration
+}
+
+func newPipeline(cfg *config.Config, l *logger.Logger, interfaces *capture.InterfaceManager, collector *metrics.SystemMetricsCollector) (*pipeline, error) {
+	rules, err := classify.RulesFromConfig(cfg.ClassifierRules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid classifier rules: %w", err)
+	}
+	eviction, err := flow.ParseEvictionPolicy(cfg.FlowEviction)
+	if err != nil {
+		return nil, err
+	}
+	dhcpConfig := dhcp.DefaultInventoryConfig()
+	for _, server := range cfg.DHCPAuthorizedServers {
+		ip, err := netip.ParseAddr(server)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DHCP authorized server: %w", err)
+		}
+		dhcpConfig.AuthorizedServers = append(dhcpConfig.AuthorizedServers, ip)
+	}
+
+	p := &pipeline{
+		logger: l,
+		decoder: capture.NewDecoder(capture.ParseOptions{
+			MaxTunnelDepth:  cfg.MaxTunnelDepth,
+			VerifyChecksums: cfg.VerifyChecksums,
+		}),
+		reassembler: capture.NewReassembler(capture.ReassemblyConfig{
+			Timeout:   cfg.FragmentTimeout,
+			MaxMemory: cfg.FragmentMemory,
+		}),
+		interfaces: interfaces,
+		flows: flow.NewTableWithConfig(l.WithComponent("flow").Logger, flow.TableConfig{
+			MaxFlows:       cfg.MaxFlows,
+			FlowTimeout:    cfg.FlowTimeout,
+			Shards:         cfg.FlowShards,
+			EvictionPolicy: eviction,
+		}),
+		streams:         stream.NewAssembler(stream.DefaultAssemblerConfig()),
+		quic:            quic.NewAnalyzer(l.WithComponent("quic").Logger),
+		dns:             dns.NewStore(l.WithComponent("dns").Logger),
+		dhcp:            dhcp.NewInventoryWithConfig(l.WithComponent("dhcp").Logger, dhcpConfig),
+		neighbors:       neighbor.NewTable(l.WithComponent("neighbor").Logger),
+		metrics:         collector,
+		cleanupInterval: cfg.CleanupInterval,
+	}
+
+	if cfg.Dissect != "" {
+		p.format, err = capture.ParseDissectFormat(strings.ToLower(cfg.Dissect))
+		if err != nil {
+			return nil, err
+		}
+		p.dissect = true
+	}
+
+	p.flows.SetClassifier(classify.NewClassifierWithConfig(l.WithComponent("classify").Logger, classify.ClassifierConfig{
+		ServicesFile: cfg.ServicesFile,
+		Rules:        rules,
+	}))
+	p.flows.SetResolver(p.dns)
+	// Ended flows are only exported for a handler, so one that would log
+	// nothing is left out.
+	if flowLogger := l.WithComponent("flow"); flowLogger.Enabled(context.Background(), slog.LevelDebug) {
+		p.flows.OnEnd(func(f flow.NetworkFlow, reason flow.EndReason) {
+			flowLogger.Debug("flow ended",
+				slog.String("flow", f.Key.String()),
+				slog.String("reason", reason.String()),
+				slog.String("tcp_state", f.TCPState.String()),
+				slog.String("application", f.Application.App),
+				slog.Uint64("bytes", f.Bytes),
+				slog.Uint64("packets", f.Packets))
+		})
+	}
+
+	// The inventory warns about rogue servers itself; this records every
+	// server as it appears.
+	p.dhcp.OnServer(func(server dhcp.Server) {
+		l.WithComponent("dhcp").Info("DHCP server discovered",
+			slog.String("ip", server.IP),
+			slog.String("mac", server.MAC),
+			slog.Bool("authorized", server.Authorized),
+			slog.Bool("rogue", server.Rogue))
+	})
+
+	tlsAnalyzer := tls.NewAnalyzer(l.WithComponent("tls").Logger)
+	tlsAnalyzer.OnHandshake(func(key stream.ConnectionKey, hs *tls.Handshake) {
+		p.annotate(capture.IPProtoTCP, key, handshakeMetadata(classify.AppTLS, hs), handshakeTLS(hs))
+	})
+	p.quic.OnHandshake(func(key stream.ConnectionKey, info *quic.Info) {
+		p.annotate(capture.IPProtoUDP, key, handshakeMetadata(classify.AppQUIC, info.Handshake), handshakeTLS(info.Handshake))
+	})
+	httpAnalyzer := http.NewAnalyzer(l.WithComponent("http").Logger)
+	httpAnalyzer.OnTransaction(func(txn *http.Transaction) {
+		md := classify.Metadata{Protocol: classify.AppHTTP}
+		if txn.Request != nil {
+			md.Hostname = stripPort(txn.Request.Host)
+		}
+		p.annotate(capture.IPProtoTCP, txn.Connection, md, nil)
+	})
+	p.streams.Register(tlsAnalyzer.ConsumerFactory)
+	p.streams.Register(httpAnalyzer.ConsumerFactory)
+	p.streams.Register(p.dns.ConsumerFactory)
+
+	p.flowWork = make([]chan flowWork, min(runtime.GOMAXPROCS(0), p.flows.GetStatistics().Shards))
+	for i := range p.flowWork {
+		p.flowWork[i] = make(chan flowWork, flowWorkBuffer)
+	}
+
+	return p, nil
+}
+
+// flowWork is what a flow worker applies to the table: an observation, or
+// an analyzer's annotation of a connection when annotation is set.
+type flowWork struct {
+	observation flow.Observation
+	annotation  *annotation
+}
+
+type annotation struct {
+	protocol uint8
+	client   netip.AddrPort
+	server   netip.AddrPort
+	metadata classify.Metadata
+	tls      *flow.TLSInfo
+}
+
+// annotate has the worker that owns the connection's flows annotate them,
+// after the packets already handed to it, which include the one that
+// created the flow.
+func (p *pipeline) annotate(protocol uint8, key stream.ConnectionKey, md classify.Metadata, info *flow.TLSInfo) {
+	a := &annotation{
+		protocol: protocol,
+		client:   netip.AddrPortFrom(key.ClientIP, key.ClientPort),
+		server:   netip.AddrPortFrom(key.ServerIP, key.ServerPort),
+		metadata: md,
+		tls:      info,
+	}
+	worker := p.flows.Partition(flow.EndpointKey(protocol, a.client, a.server), len(p.flowWork))
+	p.flowWork[worker] <- flowWork{annotation: a}
+}
+
+// applyFlows is a flow worker.
+func (p *pipeline) applyFlows(work <-chan flowWork) {
+	defer p.flowWorkers.Done()
+	for w := range work {
+		if a := w.annotation; a != nil {
+			p.flows.Annotate(a.protocol, a.client, a.server, a.metadata, a.tls)
+			continue
+		}
+		p.flows.Apply(&w.observation)
+	}
+}
+
+// handshakeMetadata describes a TLS handshake, carried over TCP or inside
+// QUIC; hs may be nil.
+func handshakeMetadata(protocol string, hs *tls.Handshake) classify.Metadata {
+	md := classify.Metadata{Protocol: protocol}
+	if hs != nil {
+		md.Hostname = hs.ServerName
+		if len(hs.ALPN) > 0 {
+			md.ALPN = hs.ALPN[0]
+		}
+	}
+	return md
+}
+
+// handshakeTLS is the flow's record of a TLS handshake; hs may be nil, and
+// the version and cipher are only known once the server's hello was seen.
+func handshakeTLS(hs *tls.Handshake) *flow.TLSInfo {
+	if hs == nil {
+		return nil
+	}
+	info := &flow.TLSInfo{
+		JA3:      hs.JA3,
+		JA3Hash:  hs.JA3Hash,
+		JA4:      hs.JA4,
+		JA3S:     hs.JA3S,
+		JA3SHash: hs.JA3SHash,
+	}
+	if hs.Server != nil {
+		info.Version = hs.Version.String()
+		info.Cipher = hs.Cipher.String()
+	}
+	return info
+}
+
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// run processes packets until ctx is done or the channel is closed,
+// expiring idle state every cleanup interval.
+func (p *pipeline) run(ctx context.Context, packets <-chan capture.RawPacket) {
+	p.flowWorkers.Add(len(p.flowWork))
+	for _, work := range p.flowWork {
+		go p.applyFlows(work)
+	}
+
+	ticker := time.NewTicker(p.cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.shutdown()
+			return
+		case now := <-ticker.C:
+			p.expire(now)
+		case raw, ok := <-packets:
+			if !ok {
+				p.shutdown()
+				return
+			}
+			p.process(&raw)
+		}
+	}
+}
+
+func (p *pipeline) process(raw *capture.RawPacket) {
+	packet := &p.packet
+	// Decode failures keep the layers decoded before them, which is
+	// still worth tracking.
+	_ = p.decoder.DecodeRaw(raw, packet)
+
+	if p.dissect {
+		if err := packet.Dissect(os.Stdout, p.format, raw.Data); err != nil {
+			p.logger.WithComponent("dissect").Error(fmt.Sprintf("Error printing packet: %v", err))
+			p.dissect = false
+		}
+	}
+
+	p.neighbors.ObservePacket(packet, raw.Timestamp)
+	p.interfaces.ObserveDiscovery(raw.Interface, packet, raw.Timestamp)
+
+	if inner := packet.Innermost(); inner.IsFragment() {
+		if !p.reassembler.Reassemble(packet, raw.Timestamp, &p.datagram) {
+			return
+		}
+		packet = &p.datagram
+	}
+
+	if o, ok := p.flows.Observation(raw.Interface, packet, raw.Timestamp); ok {
+		p.flowWork[p.flows.Partition(o.Key, len(p.flowWork))] <- flowWork{observation: o}
+	}
+
+	inner := packet.Innermost()
+	p.streams.Assemble(inner, raw.Timestamp)
+	p.quic.ObservePacket(inner, raw.Timestamp)
+	p.dns.ObservePacket(inner, raw.Timestamp)
+	p.dhcp.ObservePacket(inner, raw.Timestamp)
+}
+
+// expire ages out idle state and pushes the decoder and flow table
+// statistics to the metrics collector, once every cleanup interval.
+func (p *pipeline) expire(now time.Time) {
+	p.flows.Expire(now)
+	p.streams.Expire(now)
+	p.reassembler.Expire(now)
+	p.quic.Expire(now)
+	p.dns.Expire(now)
+	p.dhcp.Expire(now)
+	p.neighbors.Expire(now)
+
+	if p.metrics != nil {
+		p.decoder.ReportMetrics(p.metrics)
+		p.flows.ReportMetrics(p.metrics)
+	}
+}
+
+// shutdown delivers what the stream analyzers still hold and ends every
+// flow so that its final state is reported.
+func (p *pipeline) shutdown() {
+	p.streams.FlushAll()
+	for _, work := range p.flowWork {
+		close(work)
+	}
+	p.flowWorkers.Wait()
+	p.flows.Flush()
+
+	stats := p.flows.GetStatistics()
+	p.logger.WithComponent("flow").Info(fmt.Sprintf("Tracked %d flows over %d packets", stats.FlowsCreated, stats.Packets))
+}
@@ -0,0 +1,78 @@
+package capture
+
+import (
+	"encoding/binary"
+	"net/netip"
+)
+
+// ARPPacket is an ARP message. The address fields are only filled in for
+// Ethernet hardware addresses and IPv4 or IPv6 protocol addresses.
+type ARPPacket struct {
+	HardwareType uint16     `json:"hardware_type"`
+	ProtocolType uint16     `json:"protocol_type"`
+	HardwareSize uint8      `json:"hardware_size"`
+	ProtocolSize uint8      `json:"protocol_size"`
+	Operation    uint16     `json:"operation"`
+	SenderMAC    MACAddr    `json:"sender_mac"`
+	SenderIP     netip.Addr `json:"sender_ip"`
+	TargetMAC    MACAddr    `json:"target_mac"`
+	TargetIP     netip.Addr `json:"target_ip"`
+}
+
+const (
+	ARPHeaderSize = 8
+
+	ARPHardwareEthernet = 1
+
+	ARPOperationRequest = 1
+	ARPOperationReply   = 2
+)
+
+// IsGratuitous reports whether the packet announces the sender's own
+// address, i.e. a request or reply where sender and target IP match.
+func (a *ARPPacket) IsGratuitous() bool {
+	return a.SenderIP.IsValid() && a.SenderIP == a.TargetIP
+}
+
+// IsProbe reports whether the packet is an RFC 5227 address probe, which
+// carries an unspecified sender IP and must not be used to learn neighbors.
+func (a *ARPPacket) IsProbe() bool {
+	return a.Operation == ARPOperationRequest && a.SenderIP.IsUnspecified()
+}
+
+func parseARPPacket(arp *ARPPacket, data []byte) (int, error) {
+	if len(data) < ARPHeaderSize {
+		return 0, decodeError(LayerARP, DecodeTruncated, "insufficient data for ARP header: need %d, got %d", ARPHeaderSize, len(data))
+	}
+
+	*arp = ARPPacket{
+		HardwareType: binary.BigEndian.Uint16(data[0:2]),
+		ProtocolType: binary.BigEndian.Uint16(data[2:4]),
+		HardwareSize: data[4],
+		ProtocolSize: data[5],
+		Operation:    binary.BigEndian.Uint16(data[6:8]),
+	}
+
+	hlen := int(arp.HardwareSize)
+	plen := int(arp.ProtocolSize)
+	length := ARPHeaderSize + 2*hlen + 2*plen
+	if len(data) < length {
+		return 0, decodeError(LayerARP, DecodeTruncated, "insufficient data for ARP packet: need %d, got %d", length, len(data))
+	}
+
+	senderHW := data[ARPHeaderSize:]
+	senderProto := senderHW[hlen:]
+	targetHW := senderProto[plen:]
+	targetProto := targetHW[hlen:]
+
+	if hlen == len(MACAddr{}) {
+		arp.SenderMAC = MACAddr(senderHW[:hlen])
+		arp.TargetMAC = MACAddr(targetHW[:hlen])
+	}
+	if plen == 4 || plen == 16 {
+		arp.SenderIP, _ = netip.AddrFromSlice(senderProto[:plen])
+		arp.TargetIP, _ = netip.AddrFromSlice(targetProto[:plen])
+	}
+
+	return length, nil
+}
@@ -0,0 +1,216 @@
+package capture
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// ChecksumStatus is the outcome of verifying one layer's checksum.
+type ChecksumStatus uint8
+
+const (
+	ChecksumUnchecked ChecksumStatus = iota
+	ChecksumValid
+	ChecksumInvalid
+	// ChecksumAbsent is a UDP datagram sent with a zero checksum.
+	ChecksumAbsent
+	// ChecksumOffloaded is an outbound segment captured before the NIC
+	// filled in its checksum.
+	ChecksumOffloaded
+	// ChecksumIncomplete covers segments that cannot be verified from the
+	// captured bytes: truncated by the snap length, fragmented, or
+	// segmentation-offload super-packets with no usable IP length.
+	ChecksumIncomplete
+)
+
+func (s ChecksumStatus) String() string {
+	switch s {
+	case ChecksumUnchecked:
+		return "unchecked"
+	case ChecksumValid:
+		return "valid"
+	case ChecksumInvalid:
+		return "invalid"
+	case ChecksumAbsent:
+		return "absent"
+	case ChecksumOffloaded:
+		return "offloaded"
+	case ChecksumIncomplete:
+		return "incomplete"
+	default:
+		return fmt.Sprintf("checksum_status(%d)", uint8(s))
+	}
+}
+
+func (s ChecksumStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Checksums holds the verification result of each checksummed layer of a
+// packet. ICMP covers both ICMP and ICMPv6. All fields stay
+// ChecksumUnchecked unless ParseOptions.VerifyChecksums is set.
+type Checksums struct {
+	IPv4 ChecksumStatus `json:"ipv4"`
+	TCP  ChecksumStatus `json:"tcp"`
+	UDP  ChecksumStatus `json:"udp"`
+	ICMP ChecksumStatus `json:"icmp"`
+}
+
+type ChecksumStatistics struct {
+	IPv4Invalid uint64 `json:"ipv4_invalid"`
+	TCPInvalid  uint64 `json:"tcp_invalid"`
+	UDPInvalid  uint64 `json:"udp_invalid"`
+	ICMPInvalid uint64 `json:"icmp_invalid"`
+	Offloaded   uint64 `json:"offloaded"`
+}
+
+type checksumCounters struct {
+	ipv4Invalid atomic.Uint64
+	tcpInvalid  atomic.Uint64
+	udpInvalid  atomic.Uint64
+	icmpInvalid atomic.Uint64
+	offloaded   atomic.Uint64
+}
+
+// count adds the results of packet and any packets decapsulated from it.
+func (c *checksumCounters) count(packet *ParsedPacket) {
+	for p := packet; p != nil; p = p.Inner {
+		sums := p.Checksums
+		if sums.IPv4 == ChecksumInvalid {
+			c.ipv4Invalid.Add(1)
+		}
+		if sums.TCP == ChecksumInvalid {
+			c.tcpInvalid.Add(1)
+		}
+		if sums.UDP == ChecksumInvalid {
+			c.udpInvalid.Add(1)
+		}
+		if sums.ICMP == ChecksumInvalid {
+			c.icmpInvalid.Add(1)
+		}
+		if sums.TCP == ChecksumOffloaded || sums.UDP == ChecksumOffloaded {
+			c.offloaded.Add(1)
+		}
+	}
+}
+
+func (c *checksumCounters) snapshot() ChecksumStatistics {
+	return ChecksumStatistics{
+		IPv4Invalid: c.ipv4Invalid.Load(),
+		TCPInvalid:  c.tcpInvalid.Load(),
+		UDPInvalid:  c.udpInvalid.Load(),
+		ICMPInvalid: c.icmpInvalid.Load(),
+		Offloaded:   c.offloaded.Load(),
+	}
+}
+
+// verifyIPv4Checksum checks the header checksum over the header bytes.
+func (p *ParsedPacket) verifyIPv4Checksum(header []byte) {
+	if !p.state.verifyChecksums {
+		return
+	}
+	p.Checksums.IPv4 = checksumResult(checksumAdd(0, header))
+}
+
+// verifyTransportChecksum checks the TCP, UDP, ICMP or ICMPv6 checksum of the
+// segment starting at data[start], using the packet's own IP header for the
+// pseudo-header and segment length.
+func (p *ParsedPacket) verifyTransportChecksum(protocol uint8, data []byte, start int) ChecksumStatus {
+	if !p.state.verifyChecksums {
+		return ChecksumUnchecked
+	}
+
+	// Offload only ever defers TCP and UDP checksums.
+	if protocol == IPProtoTCP || protocol == IPProtoUDP {
+		if p.state.checksumOffloaded {
+			return ChecksumOffloaded
+		}
+		if p.state.checksumVerified {
+			return ChecksumValid
+		}
+	}
+
+	var sum uint64
+	var length int
+
+	switch {
+	case p.IPv4 != nil:
+		if p.IPv4.Flags&ipv4FlagMoreFragments != 0 || p.IPv4.FragOffset != 0 {
+			return ChecksumIncomplete
+		}
+		length = int(p.IPv4.Length) - int(p.IPv4.IHL)*4
+		if protocol != IPProtoICMP {
+			src, dst := p.IPv4.SrcIP.As4(), p.IPv4.DstIP.As4()
+			sum = checksumAdd(sum, src[:])
+			sum = checksumAdd(sum, dst[:])
+			sum += uint64(protocol) + uint64(length)
+		}
+	case p.IPv6 != nil:
+		// With a routing header the pseudo-header uses the final
+		// destination, which is not tracked.
+		if p.IPv6.Fragment != nil || p.IPv6.hasExtensionHeader(IPv6ExtRouting) {
+			return ChecksumIncomplete
+		}
+		length = int(p.IPv6.PayloadLen) - (p.IPv6.UpperLayerOffset - IPv6HeaderSize)
+		src, dst := p.IPv6.SrcIP.As16(), p.IPv6.DstIP.As16()
+		sum = checksumAdd(sum, src[:])
+		sum = checksumAdd(sum, dst[:])
+		sum += uint64(protocol) + uint64(length)
+	default:
+		return ChecksumUnchecked
+	}
+
+	if length <= 0 || start+length > len(data) {
+		return ChecksumIncomplete
+	}
+
+	segment := data[start : start+length]
+	// A zero UDP checksum means none was computed. IPv6 forbids it except
+	// for tunnel protocols (RFC 6935), so it is reported rather than
+	// counted as invalid.
+	if protocol == IPProtoUDP && segment[6] == 0 && segment[7] == 0 {
+		return ChecksumAbsent
+	}
+
+	return checksumResult(checksumAdd(sum, segment))
+}
+
+func (h *IPv6Header) hasExtensionHeader(headerType uint8) bool {
+	for _, ext := range h.ExtensionHeaders {
+		if ext.Type == headerType {
+			return true
+		}
+	}
+	return false
+}
+
+// checksumAdd adds data to a ones' complement sum as big-endian 16-bit
+// words, padding an odd trailing byte with zero.
+func checksumAdd(sum uint64, data []byte) uint64 {
+	n := len(data) &^ 1
+	for i := 0; i < n; i += 2 {
+		sum += uint64(data[i])<<8 | uint64(data[i+1])
+	}
+	if len(data)&1 != 0 {
+		sum += uint64(data[len(data)-1]) << 8
+	}
+	return sum
+}
+
+// checksumResult folds a sum that includes the transmitted checksum; a
+// correct checksum folds to all ones.
+func checksumResult(sum uint64) ChecksumStatus {
+	if checksumFold(sum) == 0xFFFF {
+		return ChecksumValid
+	}
+	return ChecksumInvalid
+}
+
+// checksumFold folds a ones' complement sum to 16 bits. The checksum to
+// transmit is its complement.
+func checksumFold(sum uint64) uint16 {
+	for sum>>16 != 0 {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return uint16(sum)
+}
@@ -0,0 +1,118 @@
+package capture
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// DecodeErrorReason classifies why a layer failed to decode.
+type DecodeErrorReason uint8
+
+const (
+	// DecodeTruncated means the frame ended inside the layer's header.
+	DecodeTruncated DecodeErrorReason = iota
+	// DecodeBadLength means a length field is impossible for the layer.
+	DecodeBadLength
+	// DecodeBadVersion means the layer carries a version this package does
+	// not understand, or the wrong one for how it was reached.
+	DecodeBadVersion
+	// DecodeUnsupported means a valid header uses a feature or exceeds a
+	// limit that this package does not decode.
+	DecodeUnsupported
+	decodeReasonCount
+)
+
+func (r DecodeErrorReason) String() string {
+	switch r {
+	case DecodeTruncated:
+		return "truncated"
+	case DecodeBadLength:
+		return "bad_length"
+	case DecodeBadVersion:
+		return "bad_version"
+	case DecodeUnsupported:
+		return "unsupported"
+	default:
+		return fmt.Sprintf("decode_reason(%d)", uint8(r))
+	}
+}
+
+func (r DecodeErrorReason) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// DecodeError reports the layer that stopped decoding and why. The layers
+// decoded before it are still filled in.
+type DecodeError struct {
+	Layer  LayerType         `json:"layer"`
+	Reason DecodeErrorReason `json:"reason"`
+	Detail string            `json:"detail"`
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Layer, e.Reason, e.Detail)
+}
+
+func decodeError(layer LayerType, reason DecodeErrorReason, format string, args ...any) error {
+	return &DecodeError{Layer: layer, Reason: reason, Detail: fmt.Sprintf(format, args...)}
+}
+
+type DecodeStatistics struct {
+	PacketsDecoded uint64 `json:"packets_decoded"`
+	PacketsFailed  uint64 `json:"packets_failed"`
+	// Failures counts failed layers by layer name and then reason, e.g.
+	// Failures["tcp"]["truncated"]. Layers inside tunnels are included.
+	Failures  map[string]map[string]uint64 `json:"failures"`
+	Checksums ChecksumStatistics           `json:"checksums"`
+}
+
+// DecodeMetricsCollector receives decoder statistics; it is implemented by
+// the metrics collector.
+type DecodeMetricsCollector interface {
+	UpdateDecodeMetrics(packetsDecoded, packetsFailed uint64,
+		failures map[string]map[string]uint64, checksumErrors map[string]uint64)
+}
+
+type decodeCounters struct {
+	decoded  atomic.Uint64
+	failed   atomic.Uint64
+	failures [layerCount][decodeReasonCount]atomic.Uint64
+}
+
+// count records one decoded frame and the errors of it and any packets
+// decapsulated from it.
+func (c *decodeCounters) count(packet *ParsedPacket) {
+	c.decoded.Add(1)
+
+	failed := false
+	for p := packet; p != nil; p = p.Inner {
+		if p.Err != nil && p.Err.Layer < layerCount && p.Err.Reason < decodeReasonCount {
+			c.failures[p.Err.Layer][p.Err.Reason].Add(1)
+			failed = true
+		}
+	}
+	if failed {
+		c.failed.Add(1)
+	}
+}
+
+func (c *decodeCounters) snapshot() DecodeStatistics {
+	stats := DecodeStatistics{
+		PacketsDecoded: c.decoded.Load(),
+		PacketsFailed:  c.failed.Load(),
+		Failures:       make(map[string]map[string]uint64),
+	}
+	for layer := LayerType(0); layer < layerCount; layer++ {
+		for reason := DecodeErrorReason(0); reason < decodeReasonCount; reason++ {
+			n := c.failures[layer][reason].Load()
+			if n == 0 {
+				continue
+			}
+			if stats.Failures[layer.String()] == nil {
+				stats.Failures[layer.String()] = make(map[string]uint64)
+			}
+			stats.Failures[layer.String()][reason.String()] = n
+		}
+	}
+	return stats
+}
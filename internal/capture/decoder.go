@@ -0,0 +1,293 @@
+package capture
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// MACAddr is a hardware address held by value, so unlike net.HardwareAddr it
+// does not alias the packet buffer and can be retained or used as a map key.
+type MACAddr [6]byte
+
+func (m MACAddr) String() string {
+	return net.HardwareAddr(m[:]).String()
+}
+
+func (m MACAddr) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// HardwareAddr returns a copy of the address as a net.HardwareAddr.
+func (m MACAddr) HardwareAddr() net.HardwareAddr {
+	return append(net.HardwareAddr(nil), m[:]...)
+}
+
+func (m MACAddr) IsBroadcast() bool {
+	return m == MACAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+}
+
+type LayerType uint8
+
+const (
+	LayerEthernet LayerType = iota
+	LayerLinuxSLL
+	LayerLoopback
+	LayerVLAN
+	LayerMPLS
+	LayerARP
+	LayerLLDP
+	LayerCDP
+	LayerIPv4
+	LayerIPv6
+	LayerIPv6Fragment
+	LayerTCP
+	LayerUDP
+	LayerICMP
+	LayerICMPv6
+	LayerTunnel
+	LayerPayload
+	layerCount
+)
+
+var layerNames = [layerCount]string{
+	LayerEthernet:     "ethernet",
+	LayerLinuxSLL:     "linux_sll",
+	LayerLoopback:     "loopback",
+	LayerVLAN:         "vlan",
+	LayerMPLS:         "mpls",
+	LayerARP:          "arp",
+	LayerLLDP:         "lldp",
+	LayerCDP:          "cdp",
+	LayerIPv4:         "ipv4",
+	LayerIPv6:         "ipv6",
+	LayerIPv6Fragment: "ipv6_fragment",
+	LayerTCP:          "tcp",
+	LayerUDP:          "udp",
+	LayerICMP:         "icmp",
+	LayerICMPv6:       "icmpv6",
+	LayerTunnel:       "tunnel",
+	LayerPayload:      "payload",
+}
+
+func (l LayerType) String() string {
+	if l < layerCount {
+		return layerNames[l]
+	}
+	return fmt.Sprintf("layer(%d)", uint8(l))
+}
+
+func (l LayerType) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// LayerSet records which layers a Decode call filled in.
+type LayerSet uint64
+
+func (s LayerSet) Has(layer LayerType) bool {
+	return s&(1<<layer) != 0
+}
+
+func (s *LayerSet) add(layer LayerType) {
+	*s |= 1 << layer
+}
+
+// Layers returns the decoded layers in wire order.
+func (s LayerSet) Layers() []LayerType {
+	var layers []LayerType
+	for l := LayerType(0); l < layerCount; l++ {
+		if s.Has(l) {
+			layers = append(layers, l)
+		}
+	}
+	return layers
+}
+
+func (s LayerSet) String() string {
+	names := make([]string, 0, layerCount)
+	for _, l := range s.Layers() {
+		names = append(names, l.String())
+	}
+	return strings.Join(names, ",")
+}
+
+// Decoder decodes frames into caller-owned ParsedPacket values. The header
+// structs a ParsedPacket points to live inside it and are reused by the next
+// Decode, so once a packet's slices have grown to fit the traffic, decoding
+// performs no heap allocation. A Decoder may be shared between goroutines; a
+// ParsedPacket may not.
+type Decoder struct {
+	options   ParseOptions
+	counters  decodeCounters
+	checksums checksumCounters
+}
+
+// decodeState is what a packet needs to know about the Decode call filling
+// it in.
+type decodeState struct {
+	linkType          LinkType
+	tunnelDepth       int
+	maxTunnelDepth    int
+	verifyChecksums   bool
+	checksumOffloaded bool
+	checksumVerified  bool
+}
+
+func NewDecoder(options ParseOptions) *Decoder {
+	return &Decoder{options: options}
+}
+
+// Decode parses a frame of the options' link type, Ethernet unless set, into
+// packet, replacing whatever it held.
+// A layer that fails to decode ends decoding: the layers before it are kept
+// and the failure is returned as a *DecodeError, also left in packet.Err.
+// Failures inside a tunnel only set Err on the Inner packet. Payload and
+// TCPOption.Data alias data, everything else is copied.
+func (d *Decoder) Decode(data []byte, packet *ParsedPacket) error {
+	return d.decode(data, packet, decodeState{
+		linkType:        d.options.LinkType,
+		maxTunnelDepth:  d.options.MaxTunnelDepth,
+		verifyChecksums: d.options.VerifyChecksums,
+	})
+}
+
+// DecodeRaw is Decode for a captured frame. It uses the frame's link type
+// and what the kernel reported about checksum offload, so that outbound
+// segments are not counted as bad.
+func (d *Decoder) DecodeRaw(raw *RawPacket, packet *ParsedPacket) error {
+	return d.decode(raw.Data, packet, decodeState{
+		linkType:          raw.LinkType,
+		maxTunnelDepth:    d.options.MaxTunnelDepth,
+		verifyChecksums:   d.options.VerifyChecksums,
+		checksumOffloaded: raw.ChecksumOffloaded,
+		checksumVerified:  raw.ChecksumVerified,
+	})
+}
+
+// DecodeStatistics returns the number of frames decoded and the decode
+// failures seen since the decoder was created.
+func (d *Decoder) DecodeStatistics() DecodeStatistics {
+	stats := d.counters.snapshot()
+	stats.Checksums = d.checksums.snapshot()
+	return stats
+}
+
+// ReportMetrics pushes the current statistics to collector.
+func (d *Decoder) ReportMetrics(collector DecodeMetricsCollector) {
+	stats := d.DecodeStatistics()
+	collector.UpdateDecodeMetrics(stats.PacketsDecoded, stats.PacketsFailed, stats.Failures, map[string]uint64{
+		"ipv4": stats.Checksums.IPv4Invalid,
+		"tcp":  stats.Checksums.TCPInvalid,
+		"udp":  stats.Checksums.UDPInvalid,
+		"icmp": stats.Checksums.ICMPInvalid,
+	})
+}
+
+// ChecksumStatistics returns the number of bad and offloaded checksums seen
+// since the decoder was created.
+func (d *Decoder) ChecksumStatistics() ChecksumStatistics {
+	return d.checksums.snapshot()
+}
+
+func (d *Decoder) decode(data []byte, packet *ParsedPacket, state decodeState) error {
+	packet.reset(state)
+	packet.decodeLink(state.linkType, data)
+
+	d.counters.count(packet)
+	if state.verifyChecksums {
+		d.checksums.count(packet)
+	}
+
+	if packet.Err != nil {
+		return packet.Err
+	}
+	return nil
+}
+
+// decodeFrame decodes an Ethernet frame into the reset packet.
+func (p *ParsedPacket) decodeFrame(data []byte) {
+	if err := parseEthernetHeader(&p.ethernet, data); err != nil {
+		p.setError(err)
+		return
+	}
+	p.Ethernet = &p.ethernet
+	p.addLayer(LayerEthernet, 0, EthernetHeaderSize)
+	offset := EthernetHeaderSize
+
+	if err := parseEtherTypePayload(p, p.ethernet.EtherType, data, &offset); err != nil {
+		p.setError(err)
+		return
+	}
+	p.setPayload(data, offset)
+}
+
+// setError records a layer parser's error; they all return *DecodeError.
+func (p *ParsedPacket) setError(err error) {
+	p.Err, _ = err.(*DecodeError)
+}
+
+// reset clears the packet for reuse while keeping its storage and the
+// capacity of its slices.
+func (p *ParsedPacket) reset(state decodeState) {
+	p.Layers = 0
+	p.Ethernet = nil
+	p.LinuxSLL = nil
+	p.Loopback = nil
+	p.VLANs = p.VLANs[:0]
+	p.MPLS = p.MPLS[:0]
+	p.IPv4 = nil
+	p.IPv6 = nil
+	p.TCP = nil
+	p.UDP = nil
+	p.ICMP = nil
+	p.ICMPv6 = nil
+	p.ARP = nil
+	p.Discovery = nil
+	p.Tunnel = nil
+	p.Inner = nil
+	p.Payload = nil
+	p.Checksums = Checksums{}
+	p.Err = nil
+	p.fragment = fragmentInfo{}
+	p.end = 0
+	p.base = 0
+	p.bounded = 0
+	p.state = state
+}
+
+func (p *ParsedPacket) setPayload(data []byte, offset int) {
+	if p.end != 0 {
+		data = data[:p.end]
+	}
+	if offset < len(data) {
+		p.Payload = data[offset:]
+		p.addLayer(LayerPayload, offset, len(data))
+	}
+}
+
+// addLayer records a decoded layer and the bytes it spans in the data being
+// decoded. Repeated layers, such as stacked VLAN tags, extend the span.
+func (p *ParsedPacket) addLayer(layer LayerType, start, end int) {
+	if p.bounded.Has(layer) {
+		p.bounds[layer].end = p.base + end
+	} else {
+		p.bounds[layer] = layerBounds{start: p.base + start, end: p.base + end}
+		p.bounded.add(layer)
+	}
+	p.Layers.add(layer)
+}
+
+// innerPacket returns the reusable packet that decapsulated frames are
+// decoded into, allocating it the first time a tunnel is seen.
+func (p *ParsedPacket) innerPacket() *ParsedPacket {
+	if p.inner == nil {
+		p.inner = &ParsedPacket{}
+	}
+	// The NIC's verdict only covers the outer segment, while offload may
+	// have deferred the inner one as well.
+	state := p.state
+	state.tunnelDepth++
+	state.checksumVerified = false
+	p.inner.reset(state)
+	return p.inner
+}
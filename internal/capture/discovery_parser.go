@@ -0,0 +1,290 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// DiscoveryProtocol is a link-layer discovery protocol announcing the
+// device at the other end of a link.
+type DiscoveryProtocol uint8
+
+const (
+	DiscoveryLLDP DiscoveryProtocol = iota + 1
+	DiscoveryCDP
+)
+
+func (p DiscoveryProtocol) String() string {
+	switch p {
+	case DiscoveryLLDP:
+		return "lldp"
+	case DiscoveryCDP:
+		return "cdp"
+	default:
+		return fmt.Sprintf("discovery_protocol(%d)", uint8(p))
+	}
+}
+
+func (p DiscoveryProtocol) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// LinkDiscovery is an LLDP or CDP advertisement. CDP has no separate chassis
+// ID, so its device ID fills both ChassisID and SystemName. IDs that are MAC
+// or network addresses are rendered in their usual text form.
+type LinkDiscovery struct {
+	Protocol            DiscoveryProtocol `json:"protocol"`
+	ChassisID           string            `json:"chassis_id"`
+	PortID              string            `json:"port_id"`
+	PortDescription     string            `json:"port_description"`
+	SystemName          string            `json:"system_name"`
+	SystemDescription   string            `json:"system_description"`
+	Platform            string            `json:"platform"`
+	ManagementAddresses []netip.Addr      `json:"management_addresses"`
+	VLANID              uint16            `json:"vlan_id"` // port VLAN for LLDP, native VLAN for CDP
+	TTL                 time.Duration     `json:"ttl"`
+}
+
+const (
+	EtherTypeLLDP = 0x88CC
+
+	// maxIEEE8023Length is the largest 802.3 length field; larger values
+	// in that position are EtherTypes.
+	maxIEEE8023Length = 1500
+
+	LLCSNAPHeaderSize = 8
+	CDPHeaderSize     = 4
+	cdpOUI            = 0x00000C
+	cdpProtocolID     = 0x2000
+
+	lldpTLVEnd                = 0
+	lldpTLVChassisID          = 1
+	lldpTLVPortID             = 2
+	lldpTLVTTL                = 3
+	lldpTLVPortDescription    = 4
+	lldpTLVSystemName         = 5
+	lldpTLVSystemDescription  = 6
+	lldpTLVManagementAddress  = 8
+	lldpTLVOrganizational     = 127
+	lldpChassisSubtypeMAC     = 4
+	lldpChassisSubtypeNetwork = 5
+	lldpPortSubtypeMAC        = 3
+	lldpPortSubtypeNetwork    = 4
+	lldpOUI8021               = 0x0080C2
+	lldp8021SubtypePortVLAN   = 1
+
+	cdpTLVDeviceID        = 0x0001
+	cdpTLVAddresses       = 0x0002
+	cdpTLVPortID          = 0x0003
+	cdpTLVSoftwareVersion = 0x0005
+	cdpTLVPlatform        = 0x0006
+	cdpTLVNativeVLAN      = 0x000A
+	cdpTLVManagementAddrs = 0x0016
+
+	// IANA address family numbers, as used by LLDP network addresses.
+	addressFamilyIPv4 = 1
+	addressFamilyIPv6 = 2
+)
+
+// parseLLDPPacket decodes an LLDP data unit up to its End TLV and returns its
+// length.
+func parseLLDPPacket(d *LinkDiscovery, data []byte) (int, error) {
+	resetDiscovery(d, DiscoveryLLDP)
+
+	offset := 0
+	for {
+		if len(data)-offset < 2 {
+			if offset == len(data) {
+				return offset, nil
+			}
+			return 0, decodeError(LayerLLDP, DecodeTruncated, "insufficient data for LLDP TLV header at offset %d", offset)
+		}
+		header := binary.BigEndian.Uint16(data[offset:])
+		tlvType, length := header>>9, int(header&0x1ff)
+		offset += 2
+		if len(data)-offset < length {
+			return 0, decodeError(LayerLLDP, DecodeTruncated, "insufficient data for LLDP TLV %d: need %d, got %d", tlvType, length, len(data)-offset)
+		}
+		value := data[offset : offset+length]
+		offset += length
+
+		switch tlvType {
+		case lldpTLVEnd:
+			return offset, nil
+		case lldpTLVChassisID:
+			d.ChassisID = lldpID(value, lldpChassisSubtypeMAC, lldpChassisSubtypeNetwork)
+		case lldpTLVPortID:
+			d.PortID = lldpID(value, lldpPortSubtypeMAC, lldpPortSubtypeNetwork)
+		case lldpTLVTTL:
+			if len(value) >= 2 {
+				d.TTL = time.Duration(binary.BigEndian.Uint16(value)) * time.Second
+			}
+		case lldpTLVPortDescription:
+			d.PortDescription = discoveryString(value)
+		case lldpTLVSystemName:
+			d.SystemName = discoveryString(value)
+		case lldpTLVSystemDescription:
+			d.SystemDescription = discoveryString(value)
+		case lldpTLVManagementAddress:
+			// The address string length counts the family subtype.
+			if len(value) >= 2 && len(value) >= 1+int(value[0]) && value[0] > 0 {
+				if addr, ok := familyAddr(value[1], value[2:1+int(value[0])]); ok {
+					d.ManagementAddresses = append(d.ManagementAddresses, addr)
+				}
+			}
+		case lldpTLVOrganizational:
+			if len(value) >= 6 && uint32(value[0])<<16|uint32(value[1])<<8|uint32(value[2]) == lldpOUI8021 &&
+				value[3] == lldp8021SubtypePortVLAN {
+				d.VLANID = binary.BigEndian.Uint16(value[4:6])
+			}
+		}
+	}
+}
+
+// lldpID renders a chassis or port ID, whose subtype says whether it is a
+// MAC address, a network address or a string.
+func lldpID(value []byte, macSubtype, networkSubtype uint8) string {
+	if len(value) < 1 {
+		return ""
+	}
+	subtype, id := value[0], value[1:]
+	switch {
+	case subtype == macSubtype && len(id) == len(MACAddr{}):
+		return MACAddr(id).String()
+	case subtype == networkSubtype && len(id) > 1:
+		if addr, ok := familyAddr(id[0], id[1:]); ok {
+			return addr.String()
+		}
+	}
+	return discoveryString(id)
+}
+
+func familyAddr(family uint8, data []byte) (netip.Addr, bool) {
+	switch {
+	case family == addressFamilyIPv4 && len(data) == 4:
+		return netip.AddrFrom4([4]byte(data)), true
+	case family == addressFamilyIPv6 && len(data) == 16:
+		return netip.AddrFrom16([16]byte(data)), true
+	}
+	return netip.Addr{}, false
+}
+
+// isCDP reports whether an 802.3 frame's LLC/SNAP header announces CDP.
+func isCDP(data []byte) bool {
+	return len(data) >= LLCSNAPHeaderSize && data[0] == 0xAA && data[1] == 0xAA && data[2] == 0x03 &&
+		uint32(data[3])<<16|uint32(data[4])<<8|uint32(data[5]) == cdpOUI &&
+		binary.BigEndian.Uint16(data[6:8]) == cdpProtocolID
+}
+
+// parseCDPPacket decodes a CDP message following its LLC/SNAP header and
+// returns its length.
+func parseCDPPacket(d *LinkDiscovery, data []byte) (int, error) {
+	if len(data) < CDPHeaderSize {
+		return 0, decodeError(LayerCDP, DecodeTruncated, "insufficient data for CDP header: need %d, got %d", CDPHeaderSize, len(data))
+	}
+	resetDiscovery(d, DiscoveryCDP)
+	d.TTL = time.Duration(data[1]) * time.Second
+
+	var addresses, management []netip.Addr
+	offset := CDPHeaderSize
+	for offset < len(data) {
+		if len(data)-offset < 4 {
+			return 0, decodeError(LayerCDP, DecodeTruncated, "insufficient data for CDP TLV header at offset %d", offset)
+		}
+		tlvType := binary.BigEndian.Uint16(data[offset:])
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if length < 4 {
+			return 0, decodeError(LayerCDP, DecodeBadLength, "invalid CDP TLV %d length: %d", tlvType, length)
+		}
+		if len(data)-offset < length {
+			return 0, decodeError(LayerCDP, DecodeTruncated, "insufficient data for CDP TLV %d: need %d, got %d", tlvType, length, len(data)-offset)
+		}
+		value := data[offset+4 : offset+length]
+		offset += length
+
+		switch tlvType {
+		case cdpTLVDeviceID:
+			d.ChassisID = discoveryString(value)
+			d.SystemName = d.ChassisID
+		case cdpTLVPortID:
+			d.PortID = discoveryString(value)
+		case cdpTLVSoftwareVersion:
+			d.SystemDescription = discoveryString(value)
+		case cdpTLVPlatform:
+			d.Platform = discoveryString(value)
+		case cdpTLVNativeVLAN:
+			if len(value) >= 2 {
+				d.VLANID = binary.BigEndian.Uint16(value)
+			}
+		case cdpTLVAddresses:
+			addresses = cdpAddresses(addresses, value)
+		case cdpTLVManagementAddrs:
+			management = cdpAddresses(management, value)
+		}
+	}
+
+	// Prefer the dedicated management addresses over the interface ones,
+	// which CDP only falls back to.
+	if len(management) == 0 {
+		management = addresses
+	}
+	d.ManagementAddresses = append(d.ManagementAddresses, management...)
+	return offset, nil
+}
+
+var cdpIPv6Protocol = []byte{0xAA, 0xAA, 0x03, 0x00, 0x00, 0x00, 0x86, 0xDD}
+
+// cdpAddresses appends the IPv4 and IPv6 entries of a CDP address list.
+func cdpAddresses(addresses []netip.Addr, value []byte) []netip.Addr {
+	if len(value) < 4 {
+		return addresses
+	}
+	count := binary.BigEndian.Uint32(value)
+	value = value[4:]
+	for ; count > 0; count-- {
+		// Protocol type and length, protocol, address length and address.
+		if len(value) < 2 || len(value) < 2+int(value[1])+2 {
+			break
+		}
+		protocol := value[2 : 2+int(value[1])]
+		value = value[2+len(protocol):]
+		length := int(binary.BigEndian.Uint16(value))
+		if len(value) < 2+length {
+			break
+		}
+		raw := value[2 : 2+length]
+		value = value[2+length:]
+
+		switch {
+		case len(protocol) == 1 && protocol[0] == 0xCC && length == 4:
+			addresses = append(addresses, netip.AddrFrom4([4]byte(raw)))
+		case string(protocol) == string(cdpIPv6Protocol) && length == 16:
+			addresses = append(addresses, netip.AddrFrom16([16]byte(raw)))
+		}
+	}
+	return addresses
+}
+
+// resetDiscovery clears d for reuse, keeping the capacity of its address
+// slice.
+func resetDiscovery(d *LinkDiscovery, protocol DiscoveryProtocol) {
+	*d = LinkDiscovery{
+		Protocol:            protocol,
+		ManagementAddresses: d.ManagementAddresses[:0],
+	}
+}
+
+// discoveryString turns an advertised string into something safe to log:
+// trailing NULs are dropped and control characters replaced.
+func discoveryString(data []byte) string {
+	s := strings.TrimRight(string(data), "\x00")
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return '?'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,840 @@
+package capture
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// DissectFormat selects how Dissect renders a packet.
+type DissectFormat uint8
+
+const (
+	// DissectSummary is one line per packet, like tshark's default output.
+	DissectSummary DissectFormat = iota
+	// DissectTree lists every decoded field, layer by layer, like
+	// tshark -V.
+	DissectTree
+	// DissectHex is the summary line followed by a hex and ASCII dump of
+	// the frame, split where each layer begins.
+	DissectHex
+	// DissectJSON is the packet's JSON encoding on a single line.
+	DissectJSON
+)
+
+func (f DissectFormat) String() string {
+	switch f {
+	case DissectSummary:
+		return "summary"
+	case DissectTree:
+		return "tree"
+	case DissectHex:
+		return "hex"
+	case DissectJSON:
+		return "json"
+	default:
+		return fmt.Sprintf("dissect_format(%d)", uint8(f))
+	}
+}
+
+func (f DissectFormat) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// ParseDissectFormat returns the format with the given name.
+func ParseDissectFormat(name string) (DissectFormat, error) {
+	for f := DissectSummary; f <= DissectJSON; f++ {
+		if f.String() == name {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown dissect format %q (want summary, tree, hex or json)", name)
+}
+
+// Dissect writes the packet, decoded from data, to w in the given format.
+func (p *ParsedPacket) Dissect(w io.Writer, format DissectFormat, data []byte) error {
+	var out string
+	switch format {
+	case DissectSummary:
+		out = p.Summary() + "\n"
+	case DissectTree:
+		out = p.Tree()
+	case DissectHex:
+		out = p.Summary() + "\n" + p.HexDump(data)
+	case DissectJSON:
+		encoded, err := json.Marshal(p)
+		if err != nil {
+			return fmt.Errorf("failed to encode packet: %w", err)
+		}
+		out = string(encoded) + "\n"
+	default:
+		return fmt.Errorf("unknown dissect format: %s", format)
+	}
+	_, err := io.WriteString(w, out)
+	return err
+}
+
+// Summary describes the packet on one line: the VLAN tags, MPLS labels and
+// tunnels it passed through in brackets, then the innermost packet's
+// endpoints, protocol and identifying fields. Decode errors and bad
+// checksums are flagged at the end.
+func (p *ParsedPacket) Summary() string {
+	var b strings.Builder
+	var flags []string
+	for current := p; current != nil; current = current.Inner {
+		for _, tag := range current.VLANs {
+			fmt.Fprintf(&b, "[vlan %d] ", tag.VLANID)
+		}
+		for _, label := range current.MPLS {
+			fmt.Fprintf(&b, "[mpls %d] ", label.Label)
+		}
+		if current.Tunnel != nil && current.Inner != nil {
+			if current.Tunnel.HasID {
+				fmt.Fprintf(&b, "[%s %d] ", current.Tunnel.Type, current.Tunnel.ID)
+			} else {
+				fmt.Fprintf(&b, "[%s] ", current.Tunnel.Type)
+			}
+		}
+		flags = append(flags, current.summaryFlags()...)
+		if current.Inner == nil {
+			current.writeSummary(&b)
+		}
+	}
+	for _, flag := range flags {
+		fmt.Fprintf(&b, " [%s]", flag)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func (p *ParsedPacket) writeSummary(b *strings.Builder) {
+	src, dst := p.addresses()
+
+	switch {
+	case p.TCP != nil:
+		tcp := p.TCP
+		fmt.Fprintf(b, "%s -> %s TCP [%s] Seq=%d", netip.AddrPortFrom(src, tcp.SrcPort), netip.AddrPortFrom(dst, tcp.DstPort),
+			tcpFlagsString(tcp.Flags), tcp.SeqNum)
+		if tcp.Flags&TCPFlagACK != 0 {
+			fmt.Fprintf(b, " Ack=%d", tcp.AckNum)
+		}
+		fmt.Fprintf(b, " Win=%d Len=%d", tcp.Window, len(p.Payload))
+	case p.UDP != nil:
+		fmt.Fprintf(b, "%s -> %s UDP Len=%d", netip.AddrPortFrom(src, p.UDP.SrcPort), netip.AddrPortFrom(dst, p.UDP.DstPort), len(p.Payload))
+	case p.ICMP != nil || p.ICMPv6 != nil:
+		icmp, name := p.ICMP, "ICMP"
+		if p.ICMPv6 != nil {
+			icmp, name = p.ICMPv6, "ICMPv6"
+		}
+		fmt.Fprintf(b, "%s -> %s %s %s", src, dst, name, icmpTypeName(icmp.Type, p.ICMPv6 != nil))
+		if icmp.Code != 0 {
+			fmt.Fprintf(b, " code=%d", icmp.Code)
+		}
+		if icmp.ID != 0 || icmp.Sequence != 0 {
+			fmt.Fprintf(b, " id=0x%04x seq=%d", icmp.ID, icmp.Sequence)
+		}
+		if icmp.MTU != 0 {
+			fmt.Fprintf(b, " mtu=%d", icmp.MTU)
+		}
+	case p.IPv4 != nil:
+		fmt.Fprintf(b, "%s -> %s IPv4 %s", src, dst, ipProtoString(p.IPv4.Protocol))
+		if p.IPv4.Flags&ipv4FlagMoreFragments != 0 || p.IPv4.FragOffset != 0 {
+			fmt.Fprintf(b, " fragment id=0x%04x off=%d", p.IPv4.ID, int(p.IPv4.FragOffset)*8)
+		}
+	case p.IPv6 != nil:
+		fmt.Fprintf(b, "%s -> %s IPv6 %s", src, dst, ipProtoString(p.IPv6.UpperLayerProtocol))
+		if frag := p.IPv6.Fragment; frag != nil {
+			fmt.Fprintf(b, " fragment id=0x%08x off=%d", frag.Identification, int(frag.FragmentOffset)*8)
+		}
+	case p.ARP != nil:
+		arp := p.ARP
+		switch arp.Operation {
+		case ARPOperationRequest:
+			fmt.Fprintf(b, "ARP Who has %s? Tell %s", arp.TargetIP, arp.SenderIP)
+		case ARPOperationReply:
+			fmt.Fprintf(b, "ARP %s is at %s", arp.SenderIP, arp.SenderMAC)
+		default:
+			fmt.Fprintf(b, "ARP op=%d %s -> %s", arp.Operation, arp.SenderIP, arp.TargetIP)
+		}
+	case p.Discovery != nil:
+		d := p.Discovery
+		fmt.Fprintf(b, "%s Chassis=%s Port=%s", strings.ToUpper(d.Protocol.String()), d.ChassisID, d.PortID)
+		if d.SystemName != "" && d.SystemName != d.ChassisID {
+			fmt.Fprintf(b, " System=%s", d.SystemName)
+		}
+		fmt.Fprintf(b, " TTL=%s", d.TTL)
+	case p.Ethernet != nil:
+		fmt.Fprintf(b, "%s -> %s Ethernet %s", p.Ethernet.SrcMAC, p.Ethernet.DstMAC, etherTypeString(p.lastEtherType()))
+		if len(p.Payload) > 0 {
+			fmt.Fprintf(b, " Len=%d", len(p.Payload))
+		}
+	case p.LinuxSLL != nil:
+		fmt.Fprintf(b, "Linux SLL %s %s", sllPacketTypeName(p.LinuxSLL.PacketType), etherTypeString(p.lastEtherType()))
+	case p.Loopback != nil:
+		fmt.Fprintf(b, "Loopback family=%d", p.Loopback.Family)
+	default:
+		b.WriteString("(no layers decoded)")
+	}
+}
+
+// summaryFlags lists what went wrong decoding the packet itself.
+func (p *ParsedPacket) summaryFlags() []string {
+	var flags []string
+	for _, sum := range []struct {
+		name   string
+		status ChecksumStatus
+	}{
+		{"ipv4", p.Checksums.IPv4},
+		{"tcp", p.Checksums.TCP},
+		{"udp", p.Checksums.UDP},
+		{"icmp", p.Checksums.ICMP},
+	} {
+		if sum.status == ChecksumInvalid {
+			flags = append(flags, "bad "+sum.name+" checksum")
+		}
+	}
+	if p.Err != nil {
+		flags = append(flags, "malformed "+p.Err.Error())
+	}
+	return flags
+}
+
+func (p *ParsedPacket) addresses() (src, dst netip.Addr) {
+	switch {
+	case p.IPv4 != nil:
+		return p.IPv4.SrcIP, p.IPv4.DstIP
+	case p.IPv6 != nil:
+		return p.IPv6.SrcIP, p.IPv6.DstIP
+	}
+	return netip.Addr{}, netip.Addr{}
+}
+
+// lastEtherType is the type of whatever follows the link header and any
+// VLAN tags.
+func (p *ParsedPacket) lastEtherType() uint16 {
+	if n := len(p.VLANs); n > 0 {
+		return p.VLANs[n-1].EtherType
+	}
+	switch {
+	case p.Ethernet != nil:
+		return p.Ethernet.EtherType
+	case p.LinuxSLL != nil:
+		return p.LinuxSLL.Protocol
+	}
+	return 0
+}
+
+// treeWriter indents the lines of a dissection tree, four spaces a level.
+type treeWriter struct {
+	strings.Builder
+}
+
+func (t *treeWriter) line(level int, format string, args ...any) {
+	t.WriteString(strings.Repeat("    ", level))
+	fmt.Fprintf(&t.Builder, format, args...)
+	t.WriteByte('\n')
+}
+
+// Tree lists every decoded field, with a heading for each layer in wire order
+// and its fields indented below. Packets decapsulated from a tunnel follow
+// the tunnel header.
+func (p *ParsedPacket) Tree() string {
+	var t treeWriter
+	p.writeTree(&t)
+	return t.String()
+}
+
+func (p *ParsedPacket) writeTree(t *treeWriter) {
+	if eth := p.Ethernet; eth != nil {
+		t.line(0, "Ethernet II, Src: %s, Dst: %s", eth.SrcMAC, eth.DstMAC)
+		t.line(1, "Destination: %s", eth.DstMAC)
+		t.line(1, "Source: %s", eth.SrcMAC)
+		if eth.EtherType <= maxIEEE8023Length {
+			t.line(1, "Length: %d", eth.EtherType)
+		} else {
+			t.line(1, "Type: %s", etherTypeString(eth.EtherType))
+		}
+	}
+
+	if sll := p.LinuxSLL; sll != nil {
+		t.line(0, "Linux cooked capture, %s", sllPacketTypeName(sll.PacketType))
+		t.line(1, "Packet type: %s (%d)", sllPacketTypeName(sll.PacketType), sll.PacketType)
+		t.line(1, "Link-layer address type: %d", sll.ARPHRD)
+		t.line(1, "Link-layer address length: %d", sll.AddressSize)
+		t.line(1, "Source: %s", net.HardwareAddr(sll.Address[:min(int(sll.AddressSize), len(sll.Address))]))
+		t.line(1, "Protocol: %s", etherTypeString(sll.Protocol))
+	}
+
+	if lo := p.Loopback; lo != nil {
+		t.line(0, "Null/Loopback, Family: %d", lo.Family)
+		t.line(1, "Family: %d", lo.Family)
+	}
+
+	for _, tag := range p.VLANs {
+		name := "802.1Q Virtual LAN"
+		if tag.TPID != EtherTypeVLAN {
+			name = "802.1ad Service VLAN"
+		}
+		t.line(0, "%s, PRI: %d, DEI: %t, ID: %d", name, tag.Priority, tag.DropEligible, tag.VLANID)
+		t.line(1, "TPID: %s", etherTypeString(tag.TPID))
+		t.line(1, "Priority: %d", tag.Priority)
+		t.line(1, "Drop eligible: %t", tag.DropEligible)
+		t.line(1, "ID: %d", tag.VLANID)
+		t.line(1, "Type: %s", etherTypeString(tag.EtherType))
+	}
+
+	for _, label := range p.MPLS {
+		t.line(0, "MultiProtocol Label Switching, Label: %d, TC: %d, S: %t, TTL: %d",
+			label.Label, label.TrafficClass, label.BottomOfStack, label.TTL)
+		t.line(1, "Label: %d", label.Label)
+		t.line(1, "Traffic class: %d", label.TrafficClass)
+		t.line(1, "Bottom of stack: %t", label.BottomOfStack)
+		t.line(1, "TTL: %d", label.TTL)
+	}
+
+	if arp := p.ARP; arp != nil {
+		t.line(0, "Address Resolution Protocol (%s)", arpOperationName(arp.Operation))
+		t.line(1, "Hardware type: %d", arp.HardwareType)
+		t.line(1, "Protocol type: %s", etherTypeString(arp.ProtocolType))
+		t.line(1, "Hardware size: %d", arp.HardwareSize)
+		t.line(1, "Protocol size: %d", arp.ProtocolSize)
+		t.line(1, "Opcode: %s (%d)", arpOperationName(arp.Operation), arp.Operation)
+		t.line(1, "Gratuitous: %t", arp.IsGratuitous())
+		t.line(1, "Probe: %t", arp.IsProbe())
+		t.line(1, "Sender MAC address: %s", arp.SenderMAC)
+		t.line(1, "Sender IP address: %s", arp.SenderIP)
+		t.line(1, "Target MAC address: %s", arp.TargetMAC)
+		t.line(1, "Target IP address: %s", arp.TargetIP)
+	}
+
+	if d := p.Discovery; d != nil {
+		name := "Link Layer Discovery Protocol"
+		if d.Protocol == DiscoveryCDP {
+			name = "Cisco Discovery Protocol"
+		}
+		t.line(0, "%s, Chassis: %s, Port: %s", name, d.ChassisID, d.PortID)
+		t.line(1, "Chassis ID: %s", d.ChassisID)
+		t.line(1, "Port ID: %s", d.PortID)
+		t.line(1, "Port description: %s", d.PortDescription)
+		t.line(1, "System name: %s", d.SystemName)
+		t.line(1, "System description: %s", d.SystemDescription)
+		t.line(1, "Platform: %s", d.Platform)
+		for _, addr := range d.ManagementAddresses {
+			t.line(1, "Management address: %s", addr)
+		}
+		t.line(1, "VLAN ID: %d", d.VLANID)
+		t.line(1, "TTL: %s", d.TTL)
+	}
+
+	if ip := p.IPv4; ip != nil {
+		t.line(0, "Internet Protocol Version 4, Src: %s, Dst: %s", ip.SrcIP, ip.DstIP)
+		t.line(1, "Version: %d", ip.Version)
+		t.line(1, "Header length: %d bytes (%d)", int(ip.IHL)*4, ip.IHL)
+		t.line(1, "Type of service: 0x%02x (DSCP: %d, ECN: %d)", ip.ToS, ip.ToS>>2, ip.ToS&0x03)
+		t.line(1, "Total length: %d", ip.Length)
+		t.line(1, "Identification: 0x%04x (%d)", ip.ID, ip.ID)
+		t.line(1, "Flags: 0x%x%s", ip.Flags, ipv4FlagsString(ip.Flags))
+		t.line(1, "Fragment offset: %d (%d bytes)", ip.FragOffset, int(ip.FragOffset)*8)
+		t.line(1, "Time to live: %d", ip.TTL)
+		t.line(1, "Protocol: %s", ipProtoString(ip.Protocol))
+		t.line(1, "Header checksum: 0x%04x [%s]", ip.Checksum, p.Checksums.IPv4)
+		t.line(1, "Source address: %s", ip.SrcIP)
+		t.line(1, "Destination address: %s", ip.DstIP)
+	}
+
+	if ip := p.IPv6; ip != nil {
+		writeIPv6Tree(t, 0, ip)
+	}
+
+	if tcp := p.TCP; tcp != nil {
+		t.line(0, "Transmission Control Protocol, Src Port: %d, Dst Port: %d, Seq: %d, Ack: %d, Len: %d",
+			tcp.SrcPort, tcp.DstPort, tcp.SeqNum, tcp.AckNum, len(p.Payload))
+		writeTCPTree(t, 1, tcp, p.Checksums.TCP)
+	}
+
+	if udp := p.UDP; udp != nil {
+		t.line(0, "User Datagram Protocol, Src Port: %d, Dst Port: %d", udp.SrcPort, udp.DstPort)
+		t.line(1, "Source port: %d", udp.SrcPort)
+		t.line(1, "Destination port: %d", udp.DstPort)
+		t.line(1, "Length: %d", udp.Length)
+		t.line(1, "Checksum: 0x%04x [%s]", udp.Checksum, p.Checksums.UDP)
+	}
+
+	if icmp := p.ICMP; icmp != nil {
+		t.line(0, "Internet Control Message Protocol, %s", icmpTypeName(icmp.Type, false))
+		writeICMPTree(t, 1, icmp, false, p.Checksums.ICMP)
+	}
+
+	if icmp := p.ICMPv6; icmp != nil {
+		t.line(0, "Internet Control Message Protocol v6, %s", icmpTypeName(icmp.Type, true))
+		writeICMPTree(t, 1, icmp, true, p.Checksums.ICMP)
+	}
+
+	if tunnel := p.Tunnel; tunnel != nil {
+		t.line(0, "Tunnel: %s", tunnel.Type)
+		t.line(1, "Type: %s", tunnel.Type)
+		if tunnel.HasID {
+			t.line(1, "%s: %d", tunnelIDName(tunnel.Type), tunnel.ID)
+		}
+		t.line(1, "Protocol: %s", etherTypeString(tunnel.Protocol))
+		if tunnel.Type == TunnelGRE || tunnel.Type == TunnelERSPAN {
+			t.line(1, "GRE flags: 0x%04x", tunnel.GREFlags)
+		}
+		if tunnel.HasSequence {
+			t.line(1, "GRE sequence: %d", tunnel.GRESequence)
+		}
+		if tunnel.Type == TunnelERSPAN {
+			t.line(1, "ERSPAN version: %d", tunnel.ERSPANVersion)
+			t.line(1, "ERSPAN VLAN: %d", tunnel.ERSPANVLAN)
+		}
+		if tunnel.Type == TunnelGENEVE {
+			t.line(1, "Options length: %d", tunnel.OptionsLength)
+		}
+		t.line(1, "Header length: %d", tunnel.HeaderLength)
+	}
+
+	if p.Inner != nil {
+		p.Inner.writeTree(t)
+	} else if len(p.Payload) > 0 {
+		t.line(0, "Data (%d bytes)", len(p.Payload))
+		t.line(1, "Data: %s", truncatedHex(p.Payload, 64))
+	}
+
+	if p.Err != nil {
+		t.line(0, "[Malformed packet: %s]", p.Err)
+	}
+}
+
+func writeIPv6Tree(t *treeWriter, level int, ip *IPv6Header) {
+	t.line(level, "Internet Protocol Version 6, Src: %s, Dst: %s", ip.SrcIP, ip.DstIP)
+	t.line(level+1, "Version: %d", ip.Version)
+	t.line(level+1, "Traffic class: 0x%02x (DSCP: %d, ECN: %d)", ip.TrafficClass, ip.TrafficClass>>2, ip.TrafficClass&0x03)
+	t.line(level+1, "Flow label: 0x%05x", ip.FlowLabel)
+	t.line(level+1, "Payload length: %d", ip.PayloadLen)
+	t.line(level+1, "Next header: %s", ipProtoString(ip.NextHeader))
+	t.line(level+1, "Hop limit: %d", ip.HopLimit)
+	t.line(level+1, "Source address: %s", ip.SrcIP)
+	t.line(level+1, "Destination address: %s", ip.DstIP)
+	for _, ext := range ip.ExtensionHeaders {
+		t.line(level+1, "Extension header: %s, %d bytes", ipProtoString(ext.Type), ext.Length)
+		if ext.Type == IPv6ExtFragment && ip.Fragment != nil {
+			frag := ip.Fragment
+			t.line(level+2, "Next header: %s", ipProtoString(frag.NextHeader))
+			t.line(level+2, "Offset: %d (%d bytes)", frag.FragmentOffset, int(frag.FragmentOffset)*8)
+			t.line(level+2, "More fragments: %t", frag.MoreFragments)
+			t.line(level+2, "Identification: 0x%08x", frag.Identification)
+		}
+	}
+	t.line(level+1, "Upper layer: %s at offset %d", ipProtoString(ip.UpperLayerProtocol), ip.UpperLayerOffset)
+}
+
+func writeTCPTree(t *treeWriter, level int, tcp *TCPHeader, checksum ChecksumStatus) {
+	t.line(level, "Source port: %d", tcp.SrcPort)
+	t.line(level, "Destination port: %d", tcp.DstPort)
+	t.line(level, "Sequence number: %d", tcp.SeqNum)
+	t.line(level, "Acknowledgment number: %d", tcp.AckNum)
+	t.line(level, "Header length: %d bytes (%d)", int(tcp.DataOffset)*4, tcp.DataOffset)
+	t.line(level, "Flags: 0x%02x [%s]", tcp.Flags, tcpFlagsString(tcp.Flags))
+	t.line(level, "Window: %d", tcp.Window)
+	t.line(level, "Checksum: 0x%04x [%s]", tcp.Checksum, checksum)
+	t.line(level, "Urgent pointer: %d", tcp.UrgentPtr)
+
+	options := &tcp.Options
+	if len(options.Kinds) == 0 {
+		return
+	}
+	t.line(level, "Options: (%d bytes)", int(tcp.DataOffset)*4-TCPHeaderMinSize)
+	if options.HasMSS {
+		t.line(level+1, "Maximum segment size: %d", options.MSS)
+	}
+	if options.HasWindowScale {
+		t.line(level+1, "Window scale: %d (multiply by %d)", options.WindowScale, 1<<min(options.WindowScale, 14))
+	}
+	if options.SACKPermitted {
+		t.line(level+1, "SACK permitted")
+	}
+	for _, block := range options.SACKBlocks {
+		t.line(level+1, "SACK: %d-%d", block.Left, block.Right)
+	}
+	if options.HasTimestamps {
+		t.line(level+1, "Timestamps: TSval %d, TSecr %d", options.TSVal, options.TSEcr)
+	}
+	for _, option := range options.Unknown {
+		t.line(level+1, "Kind %d: %s", option.Kind, truncatedHex(option.Data, 32))
+	}
+	kinds := make([]string, len(options.Kinds))
+	for i, kind := range options.Kinds {
+		kinds[i] = fmt.Sprint(kind)
+	}
+	t.line(level+1, "Kinds: %s", strings.Join(kinds, ","))
+	if options.Malformed {
+		t.line(level+1, "[Malformed options]")
+	}
+}
+
+func writeICMPTree(t *treeWriter, level int, icmp *ICMPHeader, v6 bool, checksum ChecksumStatus) {
+	t.line(level, "Type: %d (%s)", icmp.Type, icmpTypeName(icmp.Type, v6))
+	t.line(level, "Code: %d", icmp.Code)
+	t.line(level, "Checksum: 0x%04x [%s]", icmp.Checksum, checksum)
+	if icmp.ID != 0 || icmp.Sequence != 0 {
+		t.line(level, "Identifier: 0x%04x (%d)", icmp.ID, icmp.ID)
+		t.line(level, "Sequence: %d", icmp.Sequence)
+	}
+	if icmp.MTU != 0 {
+		t.line(level, "MTU: %d", icmp.MTU)
+	}
+	if icmp.Gateway.IsValid() {
+		t.line(level, "Gateway: %s", icmp.Gateway)
+	}
+
+	quote := icmp.Embedded
+	if quote == nil {
+		return
+	}
+	t.line(level, "Quoted datagram, %s", ipProtoString(quote.Protocol))
+	if ip := quote.IPv4; ip != nil {
+		t.line(level+1, "IPv4: %s -> %s, ID 0x%04x, TTL %d, Protocol %s", ip.SrcIP, ip.DstIP, ip.ID, ip.TTL, ipProtoString(ip.Protocol))
+	}
+	if ip := quote.IPv6; ip != nil {
+		t.line(level+1, "IPv6: %s -> %s, Hop limit %d, Next header %s", ip.SrcIP, ip.DstIP, ip.HopLimit, ipProtoString(ip.UpperLayerProtocol))
+	}
+	if tcp := quote.TCP; tcp != nil {
+		t.line(level+1, "TCP: %d -> %d, Seq %d", tcp.SrcPort, tcp.DstPort, tcp.SeqNum)
+	}
+	if udp := quote.UDP; udp != nil {
+		t.line(level+1, "UDP: %d -> %d, Length %d", udp.SrcPort, udp.DstPort, udp.Length)
+	}
+	if inner := quote.ICMP; inner != nil {
+		t.line(level+1, "ICMP: %s, ID 0x%04x, Sequence %d", icmpTypeName(inner.Type, v6), inner.ID, inner.Sequence)
+	}
+}
+
+// dumpSpan is a layer's bytes in a hex dump.
+type dumpSpan struct {
+	label      string
+	start, end int
+}
+
+// HexDump renders data, the bytes the packet was decoded from, as rows of 16
+// bytes in hex and ASCII. Every layer starts a new block headed by its name
+// and size, so that the boundaries between headers stand out. Bytes outside
+// every layer, such as Ethernet padding, are shown as the trailer.
+func (p *ParsedPacket) HexDump(data []byte) string {
+	spans := p.dumpSpans(nil, "", len(data))
+
+	// Split the data wherever a layer starts or ends and label each piece
+	// with the innermost layer covering it: the one starting last, and of
+	// those the shortest.
+	cuts := []int{0, len(data)}
+	for _, s := range spans {
+		cuts = append(cuts, s.start, s.end)
+	}
+	sort.Ints(cuts)
+
+	var pieces []dumpSpan
+	for i := 0; i+1 < len(cuts); i++ {
+		start, end := cuts[i], cuts[i+1]
+		if start == end {
+			continue
+		}
+		owner := -1
+		for j, s := range spans {
+			if s.start > start || s.end < end {
+				continue
+			}
+			if owner < 0 || s.start > spans[owner].start ||
+				(s.start == spans[owner].start && s.end-s.start < spans[owner].end-spans[owner].start) {
+				owner = j
+			}
+		}
+		label := "trailer"
+		if owner >= 0 {
+			label = spans[owner].label
+		}
+		if n := len(pieces); n > 0 && pieces[n-1].label == label {
+			pieces[n-1].end = end
+			continue
+		}
+		pieces = append(pieces, dumpSpan{label: label, start: start, end: end})
+	}
+
+	var b strings.Builder
+	for _, piece := range pieces {
+		fmt.Fprintf(&b, "%s (%d bytes)\n", piece.label, piece.end-piece.start)
+		writeHexRows(&b, data, piece.start, piece.end)
+	}
+	return b.String()
+}
+
+// dumpSpans collects the bounds of the decoded layers, clipped to the data
+// length; decapsulated layers are prefixed with "inner".
+func (p *ParsedPacket) dumpSpans(spans []dumpSpan, prefix string, length int) []dumpSpan {
+	for _, layer := range p.Layers.Layers() {
+		start, end, ok := p.Bounds(layer)
+		end = min(end, length)
+		if !ok || start >= end {
+			continue
+		}
+		spans = append(spans, dumpSpan{label: prefix + layer.String(), start: start, end: end})
+	}
+	if p.Inner != nil {
+		spans = p.Inner.dumpSpans(spans, prefix+"inner ", length)
+	}
+	return spans
+}
+
+func writeHexRows(b *strings.Builder, data []byte, start, end int) {
+	for row := start; row < end; row += 16 {
+		chunk := data[row:min(row+16, end)]
+		fmt.Fprintf(b, "%04x  ", row)
+		for i := 0; i < 16; i++ {
+			if i < len(chunk) {
+				fmt.Fprintf(b, "%02x ", chunk[i])
+			} else {
+				b.WriteString("   ")
+			}
+			if i == 7 {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteByte(' ')
+		for _, c := range chunk {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			b.WriteByte(c)
+		}
+		b.WriteByte('\n')
+	}
+}
+
+// packetJSON is the JSON form of a ParsedPacket, listing the decoded layers
+// by name and leaving out those that are absent.
+type packetJSON struct {
+	Layers        []LayerType     `json:"layers"`
+	Ethernet      *EthernetHeader `json:"ethernet,omitempty"`
+	LinuxSLL      *LinuxSLLHeader `json:"linux_sll,omitempty"`
+	Loopback      *LoopbackHeader `json:"loopback,omitempty"`
+	VLANs         []VLANTag       `json:"vlans,omitempty"`
+	MPLS          []MPLSLabel     `json:"mpls,omitempty"`
+	ARP           *ARPPacket      `json:"arp,omitempty"`
+	Discovery     *LinkDiscovery  `json:"discovery,omitempty"`
+	IPv4          *IPv4Header     `json:"ipv4,omitempty"`
+	IPv6          *IPv6Header     `json:"ipv6,omitempty"`
+	TCP           *TCPHeader      `json:"tcp,omitempty"`
+	UDP           *UDPHeader      `json:"udp,omitempty"`
+	ICMP          *ICMPHeader     `json:"icmp,omitempty"`
+	ICMPv6        *ICMPHeader     `json:"icmpv6,omitempty"`
+	Tunnel        *TunnelHeader   `json:"tunnel,omitempty"`
+	Inner         *ParsedPacket   `json:"inner,omitempty"`
+	PayloadLength int             `json:"payload_length"`
+	Payload       []byte          `json:"payload,omitempty"`
+	Checksums     Checksums       `json:"checksums"`
+	Error         *DecodeError    `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes every decoded field of the packet and of any packet
+// decapsulated from it. The payload is base64 encoded.
+func (p *ParsedPacket) MarshalJSON() ([]byte, error) {
+	layers := p.Layers.Layers()
+	if layers == nil {
+		layers = []LayerType{}
+	}
+	return json.Marshal(packetJSON{
+		Layers:        layers,
+		Ethernet:      p.Ethernet,
+		LinuxSLL:      p.LinuxSLL,
+		Loopback:      p.Loopback,
+		VLANs:         p.VLANs,
+		MPLS:          p.MPLS,
+		ARP:           p.ARP,
+		Discovery:     p.Discovery,
+		IPv4:          p.IPv4,
+		IPv6:          p.IPv6,
+		TCP:           p.TCP,
+		UDP:           p.UDP,
+		ICMP:          p.ICMP,
+		ICMPv6:        p.ICMPv6,
+		Tunnel:        p.Tunnel,
+		Inner:         p.Inner,
+		PayloadLength: len(p.Payload),
+		Payload:       p.Payload,
+		Checksums:     p.Checksums,
+		Error:         p.Err,
+	})
+}
+
+var etherTypeNames = map[uint16]string{
+	EtherTypeIPv4:                "IPv4",
+	EtherTypeIPv6:                "IPv6",
+	EtherTypeARP:                 "ARP",
+	EtherTypeVLAN:                "802.1Q",
+	EtherTypeQinQ:                "802.1ad",
+	EtherTypeQinQLegacy:          "802.1QinQ",
+	EtherTypeMPLSUnicast:         "MPLS",
+	EtherTypeMPLSMulticast:       "MPLS multicast",
+	EtherTypeLLDP:                "LLDP",
+	EtherTypeTransparentBridging: "Transparent Ethernet Bridging",
+	EtherTypeERSPANTypeII:        "ERSPAN type II",
+	EtherTypeERSPANTypeIII:       "ERSPAN type III",
+}
+
+func etherTypeString(etherType uint16) string {
+	if name, ok := etherTypeNames[etherType]; ok {
+		return fmt.Sprintf("%s (0x%04x)", name, etherType)
+	}
+	return fmt.Sprintf("0x%04x", etherType)
+}
+
+var ipProtoNames = map[uint8]string{
+	IPProtoICMP:               "ICMP",
+	IPProtoTCP:                "TCP",
+	IPProtoUDP:                "UDP",
+	IPProtoICMPv6:             "ICMPv6",
+	IPProtoIPIP:               "IPIP",
+	IPProtoIPv6:               "IPv6",
+	IPProtoGRE:                "GRE",
+	IPv6ExtHopByHop:           "Hop-by-hop options",
+	IPv6ExtRouting:            "Routing",
+	IPv6ExtFragment:           "Fragment",
+	IPv6ExtESP:                "ESP",
+	IPv6ExtAuthentication:     "AH",
+	IPv6NoNextHeader:          "No next header",
+	IPv6ExtDestinationOptions: "Destination options",
+	IPv6ExtMobility:           "Mobility",
+	IPv6ExtHIP:                "HIP",
+	IPv6ExtShim6:              "Shim6",
+}
+
+func ipProtoString(protocol uint8) string {
+	if name, ok := ipProtoNames[protocol]; ok {
+		return fmt.Sprintf("%s (%d)", name, protocol)
+	}
+	return fmt.Sprintf("%d", protocol)
+}
+
+func tcpFlagsString(flags uint8) string {
+	names := [...]string{"FIN", "SYN", "RST", "PSH", "ACK", "URG", "ECE", "CWR"}
+	var set []string
+	for i, name := range names {
+		if flags&(1<<i) != 0 {
+			set = append(set, name)
+		}
+	}
+	if len(set) == 0 {
+		return "none"
+	}
+	return strings.Join(set, ", ")
+}
+
+func ipv4FlagsString(flags uint8) string {
+	var set []string
+	if flags&0x4 != 0 {
+		set = append(set, "reserved")
+	}
+	if flags&0x2 != 0 {
+		set = append(set, "don't fragment")
+	}
+	if flags&ipv4FlagMoreFragments != 0 {
+		set = append(set, "more fragments")
+	}
+	if len(set) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(set, ", ")
+}
+
+var icmpTypeNames = map[uint8]string{
+	ICMPv4EchoReply:        "Echo reply",
+	ICMPv4DestUnreachable:  "Destination unreachable",
+	4:                      "Source quench",
+	ICMPv4Redirect:         "Redirect",
+	ICMPv4EchoRequest:      "Echo request",
+	9:                      "Router advertisement",
+	10:                     "Router solicitation",
+	ICMPv4TimeExceeded:     "Time exceeded",
+	ICMPv4ParameterProblem: "Parameter problem",
+	13:                     "Timestamp request",
+	14:                     "Timestamp reply",
+}
+
+var icmpv6TypeNames = map[uint8]string{
+	ICMPv6DestUnreachable:  "Destination unreachable",
+	ICMPv6PacketTooBig:     "Packet too big",
+	ICMPv6TimeExceeded:     "Time exceeded",
+	ICMPv6ParameterProblem: "Parameter problem",
+	ICMPv6EchoRequest:      "Echo request",
+	ICMPv6EchoReply:        "Echo reply",
+	130:                    "Multicast listener query",
+	131:                    "Multicast listener report",
+	133:                    "Router solicitation",
+	134:                    "Router advertisement",
+	135:                    "Neighbor solicitation",
+	136:                    "Neighbor advertisement",
+	137:                    "Redirect",
+	143:                    "Multicast listener report v2",
+}
+
+func icmpTypeName(icmpType uint8, v6 bool) string {
+	names := icmpTypeNames
+	if v6 {
+		names = icmpv6TypeNames
+	}
+	if name, ok := names[icmpType]; ok {
+		return name
+	}
+	return fmt.Sprintf("type %d", icmpType)
+}
+
+func arpOperationName(operation uint16) string {
+	switch operation {
+	case ARPOperationRequest:
+		return "request"
+	case ARPOperationReply:
+		return "reply"
+	default:
+		return fmt.Sprintf("operation %d", operation)
+	}
+}
+
+func sllPacketTypeName(packetType uint16) string {
+	switch packetType {
+	case 0:
+		return "unicast to us"
+	case 1:
+		return "broadcast"
+	case 2:
+		return "multicast"
+	case 3:
+		return "unicast to another host"
+	case 4:
+		return "sent by us"
+	default:
+		return fmt.Sprintf("packet type %d", packetType)
+	}
+}
+
+func tunnelIDName(tunnelType TunnelType) string {
+	switch tunnelType {
+	case TunnelVXLAN, TunnelGENEVE:
+		return "VNI"
+	case TunnelGRE:
+		return "Key"
+	case TunnelERSPAN:
+		return "Session ID"
+	default:
+		return "ID"
+	}
+}
+
+// truncatedHex renders up to limit bytes of data in hex.
+func truncatedHex(data []byte, limit int) string {
+	if len(data) <= limit {
+		return hex.EncodeToString(data)
+	}
+	return hex.EncodeToString(data[:limit]) + "..."
+}
@@ -21,22 +21,34 @@ var (
 	ErrSocketCreation   = errors.New("failed to create AF_PACKET socket")
 	ErrRingSetup        = errors.New("failed to setup ring buffer")
 	ErrInterfaceBind    = errors.New("failed to bind socket to interface")
+	ErrFilterAttach     = errors.New("failed to attach BPF filter")
+	ErrLinkType         = errors.New("failed to read interface link type")
 )
 
+const healthCheckInterval = time.Second
+
 type RawPacket struct {
 	Timestamp time.Time
 	Interface int
+	LinkType  LinkType
 	Data      []byte
 	Length    uint32
+
+	// ChecksumOffloaded is set for outbound frames whose transport checksum
+	// is left for the NIC to fill in, so the captured value is meaningless.
+	// ChecksumVerified is set when the receiving NIC already validated it.
+	ChecksumOffloaded bool
+	ChecksumVerified  bool
 }
 
 type CaptureStatistics struct {
-	PacketsReceived    uint64
-	PacketsDropped     uint64
-	RingUtilization    float64
-	LastPacketTime     time.Time
-	BytesReceived      uint64
-	ErrorCount         uint64
+	PacketsReceived uint64
+	PacketsDropped  uint64
+	RingUtilization float64
+	LastPacketTime  time.Time
+	BytesReceived   uint64
+	ErrorCount      uint64
+	EventsDropped   uint64
 }
 
 type MetricsCollector interface {
@@ -45,41 +57,47 @@ type MetricsCollector interface {
 }
 
 type PacketCaptureEngine struct {
-	mu                *sync.RWMutex
-	logger            *slog.Logger
-	socket            int
-	interfaceIndex    int
-	interfaceName     string
-	running           bool
-	ringBuffer        *RingBuffer
-	packetChannel     chan RawPacket
-	ctx               context.Context
-	cancel            context.CancelFunc
-	statistics        CaptureStatistics
-	statisticsMu      *sync.RWMutex
-	metricsCollector  MetricsCollector
-	captureStartTime  time.Time
+	mu               *sync.RWMutex
+	logger           *slog.Logger
+	socket           int
+	interfaceIndex   int
+	interfaceName    string
+	linkType         LinkType
+	running          bool
+	ringBuffer       *RingBuffer
+	packetChannel    chan RawPacket
+	ctx              context.Context
+	cancel           context.CancelFunc
+	loopDone         chan struct{}
+	statistics       CaptureStatistics
+	statisticsMu     *sync.RWMutex
+	metricsCollector MetricsCollector
+	captureStartTime time.Time
+	events           *eventBus
+	filter           []BPFInstruction
+	interfaceLost    bool
 }
 
 type EngineConfig struct {
-	RingBlockSize    uint32
-	RingFrameCount   uint32
+	RingBlockSize     uint32
+	RingFrameCount    uint32
 	ChannelBufferSize int
 }
 
 func NewPacketCaptureEngine(logger *slog.Logger) *PacketCaptureEngine {
 	return &PacketCaptureEngine{
-		mu:             &sync.RWMutex{},
-		logger:         logger,
-		socket:         -1,
-		packetChannel:  make(chan RawPacket, 1000),
-		statisticsMu:   &sync.RWMutex{},
+		mu:            &sync.RWMutex{},
+		logger:        logger,
+		socket:        -1,
+		packetChannel: make(chan RawPacket, 1000),
+		statisticsMu:  &sync.RWMutex{},
+		events:        newEventBus(),
 	}
 }
 
 func (e *PacketCaptureEngine) StartCapture(interfaceName string) error {
 	return e.StartCaptureWithConfig(interfaceName, EngineConfig{
-		RingBlockSize:     32 * 1024 * 1024,
+		RingBlockSize:     32 * 1024,
 		RingFrameCount:    1024,
 		ChannelBufferSize: 1000,
 	})
@@ -97,7 +115,7 @@ func (e *PacketCaptureEngine) StartCaptureWithConfig(interfaceName string, confi
 
 	interfaceIndex, err := e.getInterfaceIndex(interfaceName)
 	if err != nil {
-		e.logger.Error("failed to get interface index", 
+		e.logger.Error("failed to get interface index",
 			slog.String("interface", interfaceName),
 			slog.String("error", err.Error()))
 		return fmt.Errorf("failed to get interface index for %s: %w", interfaceName, err)
@@ -114,18 +132,34 @@ func (e *PacketCaptureEngine) StartCaptureWithConfig(interfaceName string, confi
 		}
 	}()
 
-	if err = e.setupTPACKETv3(socket); err != nil {
+	// Attached before binding, so that no unfiltered packets reach the ring.
+	if len(e.filter) > 0 {
+		if err = attachFilter(socket, e.filter); err != nil {
+			e.logger.Error("failed to attach BPF filter", slog.String("error", err.Error()))
+			return fmt.Errorf("%w: %v", ErrFilterAttach, err)
+		}
+	}
+
+	if err = e.setupTPACKETv3(socket, config); err != nil {
 		e.logger.Error("failed to setup TPACKETv3", slog.String("error", err.Error()))
 		return fmt.Errorf("%w: %v", ErrRingSetup, err)
 	}
 
 	if err = e.bindSocket(socket, interfaceIndex); err != nil {
-		e.logger.Error("failed to bind socket to interface", 
+		e.logger.Error("failed to bind socket to interface",
 			slog.String("interface", interfaceName),
 			slog.String("error", err.Error()))
 		return fmt.Errorf("%w: interface %s: %v", ErrInterfaceBind, interfaceName, err)
 	}
 
+	linkType, err := e.getLinkType(socket, interfaceName)
+	if err != nil {
+		e.logger.Error("failed to read interface link type",
+			slog.String("interface", interfaceName),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%w: interface %s: %v", ErrLinkType, interfaceName, err)
+	}
+
 	ringBuffer, err := NewRingBuffer(socket, config.RingBlockSize, config.RingFrameCount, e.logger)
 	if err != nil {
 		e.logger.Error("failed to create ring buffer", slog.String("error", err.Error()))
@@ -137,10 +171,13 @@ func (e *PacketCaptureEngine) StartCaptureWithConfig(interfaceName string, confi
 	e.socket = socket
 	e.interfaceIndex = interfaceIndex
 	e.interfaceName = interfaceName
+	e.linkType = linkType
 	e.ringBuffer = ringBuffer
 	e.ctx = ctx
 	e.cancel = cancel
+	e.loopDone = make(chan struct{})
 	e.running = true
+	e.interfaceLost = false
 	e.captureStartTime = time.Now()
 
 	if config.ChannelBufferSize > 0 {
@@ -149,11 +186,20 @@ func (e *PacketCaptureEngine) StartCaptureWithConfig(interfaceName string, confi
 
 	e.resetStatistics()
 
-	go e.captureLoop()
+	go e.captureLoop(interfaceName)
 
 	e.logger.Info("packet capture started successfully",
 		slog.String("interface", interfaceName),
-		slog.Int("interface_index", interfaceIndex))
+		slog.Int("interface_index", interfaceIndex),
+		slog.String("link_type", linkType.String()))
+
+	e.publishEvent(interfaceName, EventCaptureStarted, map[string]any{
+		"interface_index":  interfaceIndex,
+		"link_type":        linkType.String(),
+		"ring_block_size":  config.RingBlockSize,
+		"ring_frame_count": config.RingFrameCount,
+		"filter_length":    len(e.filter),
+	})
 
 	return nil
 }
@@ -170,6 +216,9 @@ func (e *PacketCaptureEngine) StopCapture() error {
 
 	e.cancel()
 	e.running = false
+	// The loop polls with a timeout, so it notices the cancellation
+	// promptly; it must be gone before the ring and channel it uses are.
+	<-e.loopDone
 
 	if e.ringBuffer != nil {
 		if err := e.ringBuffer.Close(); err != nil {
@@ -188,6 +237,15 @@ func (e *PacketCaptureEngine) StopCapture() error {
 	close(e.packetChannel)
 	e.packetChannel = make(chan RawPacket, 1000)
 
+	stats := e.GetStatistics()
+	e.publishEvent(e.interfaceName, EventCaptureStopped, map[string]any{
+		"packets_received": stats.PacketsReceived,
+		"packets_dropped":  stats.PacketsDropped,
+		"bytes_received":   stats.BytesReceived,
+		"error_count":      stats.ErrorCount,
+		"uptime_seconds":   time.Since(e.captureStartTime).Seconds(),
+	})
+
 	e.logger.Info("packet capture stopped")
 	return nil
 }
@@ -203,6 +261,8 @@ func (e *PacketCaptureEngine) GetStatistics() CaptureStatistics {
 	stats := e.statistics
 	e.statisticsMu.RUnlock()
 
+	stats.EventsDropped = e.events.droppedCount()
+
 	if e.ringBuffer != nil {
 		stats.RingUtilization = e.ringBuffer.GetUtilization()
 	}
@@ -222,6 +282,60 @@ func (e *PacketCaptureEngine) SetMetricsCollector(collector MetricsCollector) {
 	e.metricsCollector = collector
 }
 
+// Subscribe registers a listener for engine lifecycle events. The returned
+// function unsubscribes and closes the channel. Events are dropped rather
+// than blocking capture when the channel buffer is full.
+func (e *PacketCaptureEngine) Subscribe(bufferSize int) (<-chan EngineEvent, func()) {
+	return e.events.subscribe(bufferSize)
+}
+
+// SetFilter installs a classic BPF program on the capture socket. The filter
+// is kept across restarts; an empty program removes it.
+func (e *PacketCaptureEngine) SetFilter(program []BPFInstruction) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.running {
+		var err error
+		if len(program) == 0 {
+			err = detachFilter(e.socket)
+		} else {
+			err = attachFilter(e.socket, program)
+		}
+		if err != nil {
+			e.logger.Error("failed to update BPF filter", slog.String("error", err.Error()))
+			return fmt.Errorf("%w: %v", ErrFilterAttach, err)
+		}
+	}
+
+	previous := len(e.filter)
+	e.filter = append([]BPFInstruction(nil), program...)
+
+	e.logger.Info("capture filter changed",
+		slog.Int("previous_length", previous),
+		slog.Int("filter_length", len(program)))
+
+	e.publishEvent(e.interfaceName, EventFilterChanged, map[string]any{
+		"previous_length": previous,
+		"filter_length":   len(program),
+		"applied":         e.running,
+	})
+
+	return nil
+}
+
+// publishEvent publishes an event about the named capture interface. The
+// name is passed in rather than read from the engine, whose fields the
+// capture loop cannot lock while StopCapture holds e.mu waiting for it.
+func (e *PacketCaptureEngine) publishEvent(interfaceName string, eventType EngineEventType, details map[string]any) {
+	e.events.publish(EngineEvent{
+		Type:      eventType,
+		Timestamp: time.Now(),
+		Interface: interfaceName,
+		Details:   details,
+	})
+}
+
 func (e *PacketCaptureEngine) getInterfaceIndex(interfaceName string) (int, error) {
 	iface, err := net.InterfaceByName(interfaceName)
 	if err != nil {
@@ -230,8 +344,10 @@ func (e *PacketCaptureEngine) getInterfaceIndex(interfaceName string) (int, erro
 	return iface.Index, nil
 }
 
+// createSocket opens a packet socket that receives nothing until bindSocket
+// names the protocol, so that the filter and ring are in place first.
 func (e *PacketCaptureEngine) createSocket() (int, error) {
-	socket, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(unix.ETH_P_ALL))
+	socket, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, 0)
 	if err != nil {
 		return -1, fmt.Errorf("socket creation failed: %w", err)
 	}
@@ -239,19 +355,20 @@ func (e *PacketCaptureEngine) createSocket() (int, error) {
 	return socket, nil
 }
 
-func (e *PacketCaptureEngine) setupTPACKETv3(socket int) error {
-	version := int(3)
-	if err := unix.SetsockoptInt(socket, unix.SOL_PACKET, unix.PACKET_VERSION, version); err != nil {
+func (e *PacketCaptureEngine) setupTPACKETv3(socket int, config EngineConfig) error {
+	if err := unix.SetsockoptInt(socket, unix.SOL_PACKET, unix.PACKET_VERSION, unix.TPACKET_V3); err != nil {
 		return fmt.Errorf("failed to set PACKET_VERSION: %w", err)
 	}
 
+	// The ring geometry must match what NewRingBuffer maps afterwards.
+	const frameSize = 2048
 	req := &tpacketReq3{
-		blockSize:       32 * 1024,
-		blockNum:        1024,
-		frameSize:       2048,
-		frameNum:        1024 * 16,
-		retireBlkTov:    100,
-		sizeofPriv:      0,
+		blockSize:      config.RingBlockSize,
+		blockNum:       config.RingFrameCount,
+		frameSize:      frameSize,
+		frameNum:       config.RingBlockSize / frameSize * config.RingFrameCount,
+		retireBlkTov:   100,
+		sizeofPriv:     0,
 		featureReqWord: 0,
 	}
 
@@ -265,7 +382,7 @@ func (e *PacketCaptureEngine) setupTPACKETv3(socket int) error {
 
 func (e *PacketCaptureEngine) bindSocket(socket int, interfaceIndex int) error {
 	addr := &unix.SockaddrLinklayer{
-		Protocol: unix.ETH_P_ALL,
+		Protocol: htons(unix.ETH_P_ALL),
 		Ifindex:  interfaceIndex,
 	}
 
@@ -276,9 +393,32 @@ func (e *PacketCaptureEngine) bindSocket(socket int, interfaceIndex int) error {
 	return nil
 }
 
-func (e *PacketCaptureEngine) captureLoop() {
+// getLinkType reads the hardware type of the interface a packet socket is
+// bound to, which decides how its frames are decoded. Hardware types it
+// does not know are decoded as Ethernet, which most of them carry.
+func (e *PacketCaptureEngine) getLinkType(socket int, interfaceName string) (LinkType, error) {
+	sa, err := unix.Getsockname(socket)
+	if err != nil {
+		return 0, fmt.Errorf("getsockname failed: %w", err)
+	}
+	ll, ok := sa.(*unix.SockaddrLinklayer)
+	if !ok {
+		return 0, fmt.Errorf("unexpected socket address %T", sa)
+	}
+	linkType, ok := LinkTypeFromARPHRD(ll.Hatype)
+	if !ok {
+		e.logger.Warn("unknown interface hardware type, decoding as ethernet",
+			slog.String("interface", interfaceName),
+			slog.Int("arphrd", int(ll.Hatype)))
+		return LinkTypeEthernet, nil
+	}
+	return linkType, nil
+}
+
+func (e *PacketCaptureEngine) captureLoop(interfaceName string) {
 	e.logger.Debug("starting capture loop")
 	defer e.logger.Debug("capture loop ended")
+	defer close(e.loopDone)
 
 	pollFds := []unix.PollFd{
 		{
@@ -287,21 +427,43 @@ func (e *PacketCaptureEngine) captureLoop() {
 		},
 	}
 
+	lastHealthCheck := time.Now()
+	consecutivePollErrors := 0
+
 	for {
 		select {
 		case <-e.ctx.Done():
 			return
 		default:
+			if time.Since(lastHealthCheck) >= healthCheckInterval {
+				e.checkInterfaceHealth(interfaceName)
+				e.checkRingOverrun(interfaceName)
+				lastHealthCheck = time.Now()
+			}
+
 			ready, err := unix.Poll(pollFds, 100)
 			if err != nil {
 				if err == unix.EINTR {
 					continue
 				}
+				consecutivePollErrors++
 				e.updateErrorCount()
 				e.logger.Error("poll failed", slog.String("error", err.Error()))
+				e.publishEvent(interfaceName, EventPollError, map[string]any{
+					"error":       err.Error(),
+					"consecutive": consecutivePollErrors,
+				})
 				time.Sleep(10 * time.Millisecond)
 				continue
 			}
+			consecutivePollErrors = 0
+
+			if ready > 0 && pollFds[0].Revents&(unix.POLLERR|unix.POLLHUP|unix.POLLNVAL) != 0 {
+				e.updateErrorCount()
+				e.publishEvent(interfaceName, EventPollError, map[string]any{
+					"revents": pollFds[0].Revents,
+				})
+			}
 
 			if ready > 0 && pollFds[0].Revents&unix.POLLIN != 0 {
 				if err := e.processRingBuffer(); err != nil {
@@ -313,17 +475,75 @@ func (e *PacketCaptureEngine) captureLoop() {
 	}
 }
 
+// checkInterfaceHealth reports transitions of the bound interface between
+// up/running and missing/down. It runs on the capture goroutine only.
+func (e *PacketCaptureEngine) checkInterfaceHealth(interfaceName string) {
+	iface, err := net.InterfaceByIndex(e.interfaceIndex)
+	healthy := err == nil && iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagRunning != 0
+
+	switch {
+	case !healthy && !e.interfaceLost:
+		e.interfaceLost = true
+		details := map[string]any{"interface_index": e.interfaceIndex}
+		if err != nil {
+			details["error"] = err.Error()
+		} else {
+			details["flags"] = iface.Flags.String()
+		}
+		e.logger.Warn("capture interface lost", slog.String("interface", interfaceName))
+		e.publishEvent(interfaceName, EventInterfaceLost, details)
+	case healthy && e.interfaceLost:
+		e.interfaceLost = false
+		e.logger.Info("capture interface recovered", slog.String("interface", interfaceName))
+		e.publishEvent(interfaceName, EventInterfaceRecovered, map[string]any{
+			"interface_index": e.interfaceIndex,
+			"flags":           iface.Flags.String(),
+		})
+	}
+}
+
+// checkRingOverrun reads and resets the kernel's PACKET_STATISTICS counters;
+// drops there mean the ring filled up before userspace released blocks.
+func (e *PacketCaptureEngine) checkRingOverrun(interfaceName string) {
+	stats, err := unix.GetsockoptTpacketStatsV3(e.socket, unix.SOL_PACKET, unix.PACKET_STATISTICS)
+	if err != nil {
+		e.logger.Debug("failed to read packet statistics", slog.String("error", err.Error()))
+		return
+	}
+
+	if stats.Drops == 0 {
+		return
+	}
+
+	e.statisticsMu.Lock()
+	e.statistics.PacketsDropped += uint64(stats.Drops)
+	e.statisticsMu.Unlock()
+
+	e.logger.Warn("ring buffer overrun",
+		slog.Uint64("dropped", uint64(stats.Drops)),
+		slog.Uint64("packets", uint64(stats.Packets)))
+
+	e.publishEvent(interfaceName, EventRingOverrun, map[string]any{
+		"dropped":            stats.Drops,
+		"packets":            stats.Packets,
+		"freeze_queue_count": stats.Freeze_q_cnt,
+	})
+}
+
 func (e *PacketCaptureEngine) processRingBuffer() error {
-	return e.ringBuffer.ProcessPackets(func(data []byte, timestamp time.Time) {
+	return e.ringBuffer.ProcessFrames(func(data []byte, info FrameInfo) {
 		if len(data) == 0 {
 			return
 		}
-		
+
 		packet := RawPacket{
-			Timestamp: timestamp,
-			Interface: e.interfaceIndex,
-			Data:      make([]byte, len(data)),
-			Length:    uint32(len(data)),
+			Timestamp:         info.Timestamp,
+			Interface:         e.interfaceIndex,
+			LinkType:          e.linkType,
+			Data:              make([]byte, len(data)),
+			Length:            uint32(len(data)),
+			ChecksumOffloaded: info.Status&unix.TP_STATUS_CSUMNOTREADY != 0,
+			ChecksumVerified:  info.Status&unix.TP_STATUS_CSUM_VALID != 0,
 		}
 		copy(packet.Data, data)
 
@@ -342,7 +562,7 @@ func (e *PacketCaptureEngine) updatePacketStatistics(packet RawPacket) {
 	e.statistics.PacketsReceived++
 	e.statistics.BytesReceived += uint64(packet.Length)
 	e.statistics.LastPacketTime = packet.Timestamp
-	
+
 	stats := e.statistics
 	e.statisticsMu.Unlock()
 
@@ -381,14 +601,29 @@ func (e *PacketCaptureEngine) resetStatistics() {
 	e.statistics = CaptureStatistics{}
 }
 
+func attachFilter(socket int, program []BPFInstruction) error {
+	filter := make([]unix.SockFilter, len(program))
+	for i, ins := range program {
+		filter[i] = unix.SockFilter{Code: ins.Code, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
 
+	prog := &unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	return unix.SetsockoptSockFprog(socket, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, prog)
+}
+
+func detachFilter(socket int) error {
+	return unix.SetsockoptInt(socket, unix.SOL_SOCKET, unix.SO_DETACH_FILTER, 0)
+}
 
 type tpacketReq3 struct {
-	blockSize       uint32
-	blockNum        uint32
-	frameSize       uint32
-	frameNum        uint32
-	retireBlkTov    uint32
-	sizeofPriv      uint32
-	featureReqWord  uint32
-}
\ No newline at end of file
+	blockSize      uint32
+	blockNum       uint32
+	frameSize      uint32
+	frameNum       uint32
+	retireBlkTov   uint32
+	sizeofPriv     uint32
+	featureReqWord uint32
+}
@@ -15,17 +15,22 @@ var (
 type RawPacket struct {
 	Timestamp time.Time
 	Interface int
+	LinkType  LinkType
 	Data      []byte
 	Length    uint32
+
+	ChecksumOffloaded bool
+	ChecksumVerified  bool
 }
 
 type CaptureStatistics struct {
-	PacketsReceived    uint64
-	PacketsDropped     uint64
-	RingUtilization    float64
-	LastPacketTime     time.Time
-	BytesReceived      uint64
-	ErrorCount         uint64
+	PacketsReceived uint64
+	PacketsDropped  uint64
+	RingUtilization float64
+	LastPacketTime  time.Time
+	BytesReceived   uint64
+	ErrorCount      uint64
+	EventsDropped   uint64
 }
 
 type MetricsCollector interface {
@@ -35,11 +40,13 @@ type MetricsCollector interface {
 
 type PacketCaptureEngine struct {
 	logger *slog.Logger
+	events *eventBus
 }
 
 func NewPacketCaptureEngine(logger *slog.Logger) *PacketCaptureEngine {
 	return &PacketCaptureEngine{
 		logger: logger,
+		events: newEventBus(),
 	}
 }
 
@@ -66,4 +73,12 @@ func (e *PacketCaptureEngine) IsRunning() bool {
 
 func (e *PacketCaptureEngine) SetMetricsCollector(collector MetricsCollector) {
 	// No-op on unsupported platforms
-}
\ No newline at end of file
+}
+
+func (e *PacketCaptureEngine) Subscribe(bufferSize int) (<-chan EngineEvent, func()) {
+	return e.events.subscribe(bufferSize)
+}
+
+func (e *PacketCaptureEngine) SetFilter(program []BPFInstruction) error {
+	return ErrPlatformNotSupported
+}
@@ -0,0 +1,94 @@
+package capture
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type EngineEventType string
+
+const (
+	EventCaptureStarted     EngineEventType = "capture_started"
+	EventCaptureStopped     EngineEventType = "capture_stopped"
+	EventInterfaceLost      EngineEventType = "interface_lost"
+	EventInterfaceRecovered EngineEventType = "interface_recovered"
+	EventRingOverrun        EngineEventType = "ring_overrun"
+	EventPollError          EngineEventType = "poll_error"
+	EventFilterChanged      EngineEventType = "filter_changed"
+)
+
+const defaultEventBufferSize = 64
+
+type EngineEvent struct {
+	Type      EngineEventType `json:"type"`
+	Timestamp time.Time       `json:"timestamp"`
+	Interface string          `json:"interface"`
+	Details   map[string]any  `json:"details,omitempty"`
+}
+
+// eventBus fans engine events out to subscribers. Publishing never blocks the
+// capture path: events for a subscriber whose buffer is full are dropped and
+// counted.
+type eventBus struct {
+	mu          *sync.RWMutex
+	subscribers map[uint64]chan EngineEvent
+	nextID      uint64
+	dropped     atomic.Uint64
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		mu:          &sync.RWMutex{},
+		subscribers: make(map[uint64]chan EngineEvent),
+	}
+}
+
+func (b *eventBus) subscribe(bufferSize int) (<-chan EngineEvent, func()) {
+	if bufferSize <= 0 {
+		bufferSize = defaultEventBufferSize
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	ch := make(chan EngineEvent, bufferSize)
+	b.subscribers[id] = ch
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if sub, ok := b.subscribers[id]; ok {
+				delete(b.subscribers, id)
+				close(sub)
+			}
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+func (b *eventBus) publish(event EngineEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+}
+
+func (b *eventBus) droppedCount() uint64 {
+	return b.dropped.Load()
+}
@@ -0,0 +1,10 @@
+package capture
+
+// BPFInstruction is a single classic BPF instruction, laid out like the
+// kernel's struct sock_filter.
+type BPFInstruction struct {
+	Code uint16
+	Jt   uint8
+	Jf   uint8
+	K    uint32
+}
@@ -0,0 +1,188 @@
+package capture
+
+import (
+	"encoding/binary"
+	"net/netip"
+)
+
+// ICMPHeader holds an ICMP or ICMPv6 message header. Which of the optional
+// fields are set depends on Type: ID and Sequence for echo messages, MTU for
+// "fragmentation needed" and "packet too big", Gateway for IPv4 redirects and
+// Embedded for error messages that quote the offending datagram.
+type ICMPHeader struct {
+	Type     uint8               `json:"type"`
+	Code     uint8               `json:"code"`
+	Checksum uint16              `json:"checksum"`
+	ID       uint16              `json:"id"`
+	Sequence uint16              `json:"sequence"`
+	MTU      uint32              `json:"mtu"`
+	Gateway  netip.Addr          `json:"gateway"`
+	Embedded *ICMPEmbeddedPacket `json:"embedded,omitempty"`
+}
+
+// ICMPEmbeddedPacket is the start of the original datagram quoted by an ICMP
+// error. Only the first 8 bytes of the transport header are guaranteed to be
+// present, so TCP carries ports and sequence number only unless more was
+// quoted.
+type ICMPEmbeddedPacket struct {
+	IPv4     *IPv4Header `json:"ipv4,omitempty"`
+	IPv6     *IPv6Header `json:"ipv6,omitempty"`
+	Protocol uint8       `json:"protocol"`
+	TCP      *TCPHeader  `json:"tcp,omitempty"`
+	UDP      *UDPHeader  `json:"udp,omitempty"`
+	ICMP     *ICMPHeader `json:"icmp,omitempty"`
+}
+
+// icmpQuote is the storage behind ICMPHeader.Embedded.
+type icmpQuote struct {
+	packet ICMPEmbeddedPacket
+	ipv4   IPv4Header
+	ipv6   IPv6Header
+	tcp    TCPHeader
+	udp    UDPHeader
+	icmp   ICMPHeader
+}
+
+const (
+	ICMPHeaderSize = 8
+
+	ICMPv4EchoReply        = 0
+	ICMPv4DestUnreachable  = 3
+	ICMPv4Redirect         = 5
+	ICMPv4EchoRequest      = 8
+	ICMPv4TimeExceeded     = 11
+	ICMPv4ParameterProblem = 12
+
+	ICMPv4CodeFragmentationNeeded = 4
+
+	ICMPv6DestUnreachable  = 1
+	ICMPv6PacketTooBig     = 2
+	ICMPv6TimeExceeded     = 3
+	ICMPv6ParameterProblem = 4
+	ICMPv6EchoRequest      = 128
+	ICMPv6EchoReply        = 129
+)
+
+// parseICMPHeader decodes an ICMP or ICMPv6 header, decoding the datagram
+// quoted by an error message into quote when one is given.
+func parseICMPHeader(icmp *ICMPHeader, data []byte, v6 bool, quote *icmpQuote) (int, error) {
+	if len(data) < ICMPHeaderSize {
+		layer := LayerICMP
+		if v6 {
+			layer = LayerICMPv6
+		}
+		return 0, decodeError(layer, DecodeTruncated, "insufficient data for ICMP header: need %d, got %d", ICMPHeaderSize, len(data))
+	}
+
+	*icmp = ICMPHeader{
+		Type:     data[0],
+		Code:     data[1],
+		Checksum: binary.BigEndian.Uint16(data[2:4]),
+	}
+	rest := data[4:8]
+
+	isError := false
+	if v6 {
+		switch icmp.Type {
+		case ICMPv6EchoRequest, ICMPv6EchoReply:
+			icmp.ID = binary.BigEndian.Uint16(rest[0:2])
+			icmp.Sequence = binary.BigEndian.Uint16(rest[2:4])
+		case ICMPv6PacketTooBig:
+			icmp.MTU = binary.BigEndian.Uint32(rest)
+			isError = true
+		case ICMPv6DestUnreachable, ICMPv6TimeExceeded, ICMPv6ParameterProblem:
+			isError = true
+		}
+	} else {
+		switch icmp.Type {
+		case ICMPv4EchoRequest, ICMPv4EchoReply:
+			icmp.ID = binary.BigEndian.Uint16(rest[0:2])
+			icmp.Sequence = binary.BigEndian.Uint16(rest[2:4])
+		case ICMPv4DestUnreachable:
+			if icmp.Code == ICMPv4CodeFragmentationNeeded {
+				icmp.MTU = uint32(binary.BigEndian.Uint16(rest[2:4]))
+			}
+			isError = true
+		case ICMPv4Redirect:
+			icmp.Gateway = netip.AddrFrom4([4]byte(rest))
+			isError = true
+		case ICMPv4TimeExceeded, ICMPv4ParameterProblem:
+			isError = true
+		}
+	}
+
+	if isError && quote != nil && len(data) > ICMPHeaderSize {
+		// A malformed quote does not invalidate the ICMP header itself.
+		if err := parseICMPEmbedded(quote, data[ICMPHeaderSize:], v6); err == nil {
+			icmp.Embedded = &quote.packet
+		}
+	}
+
+	return ICMPHeaderSize, nil
+}
+
+func parseICMPEmbedded(quote *icmpQuote, data []byte, v6 bool) error {
+	embedded := &quote.packet
+	*embedded = ICMPEmbeddedPacket{}
+	offset := 0
+
+	if v6 {
+		ipv6 := &quote.ipv6
+		ipOffset, err := parseIPv6Header(ipv6, data)
+		if err != nil {
+			return err
+		}
+		extOffset, err := parseIPv6ExtensionHeaders(ipv6, data[ipOffset:])
+		if err != nil {
+			return err
+		}
+		embedded.IPv6 = ipv6
+		embedded.Protocol = ipv6.UpperLayerProtocol
+		offset = ipOffset + extOffset
+		if ipv6.Fragment != nil && ipv6.Fragment.FragmentOffset != 0 {
+			return nil
+		}
+	} else {
+		ipv4 := &quote.ipv4
+		ipOffset, err := parseIPv4Header(ipv4, data)
+		if err != nil {
+			return err
+		}
+		embedded.IPv4 = ipv4
+		embedded.Protocol = ipv4.Protocol
+		offset = ipOffset
+		if ipv4.FragOffset != 0 {
+			return nil
+		}
+	}
+
+	transport := data[offset:]
+	switch embedded.Protocol {
+	case IPProtoTCP:
+		if _, err := parseTCPHeader(&quote.tcp, transport); err == nil {
+			embedded.TCP = &quote.tcp
+		} else if len(transport) >= 8 {
+			quote.tcp = TCPHeader{
+				SrcPort: binary.BigEndian.Uint16(transport[0:2]),
+				DstPort: binary.BigEndian.Uint16(transport[2:4]),
+				SeqNum:  binary.BigEndian.Uint32(transport[4:8]),
+				Options: quote.tcp.Options.reset(),
+			}
+			embedded.TCP = &quote.tcp
+		}
+	case IPProtoUDP:
+		if _, err := parseUDPHeader(&quote.udp, transport); err == nil {
+			embedded.UDP = &quote.udp
+		}
+	case IPProtoICMP, IPProtoICMPv6:
+		if len(transport) >= ICMPHeaderSize {
+			// Quoted ICMP messages are never errors themselves, and no
+			// quote storage is passed, so this cannot recurse further.
+			if _, err := parseICMPHeader(&quote.icmp, transport[:ICMPHeaderSize], v6, nil); err == nil {
+				embedded.ICMP = &quote.icmp
+			}
+		}
+	}
+
+	return nil
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"net/netip"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
@@ -30,8 +33,33 @@ type InterfaceInfo struct {
 	IsRunning    bool
 	IsLoopback   bool
 	Statistics   InterfaceStats
+	Neighbors    []LinkNeighbor
 }
 
+// LinkNeighbor is a device that announced itself over LLDP or CDP on an
+// interface, typically the switch port the interface is plugged into.
+type LinkNeighbor struct {
+	LinkDiscovery
+	SourceMAC MACAddr
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// expired reports whether the advertisement's TTL ran out at now.
+func (n *LinkNeighbor) expired(now time.Time) bool {
+	return now.After(n.LastSeen.Add(n.TTL))
+}
+
+type neighborKey struct {
+	protocol  DiscoveryProtocol
+	chassisID string
+	portID    string
+}
+
+// maxNeighborsPerInterface bounds the neighbors remembered per interface; a
+// switch port normally has one, a hub or a misbehaving peer many.
+const maxNeighborsPerInterface = 64
+
 type InterfaceStats struct {
 	RxBytes   uint64
 	RxPackets uint64
@@ -42,13 +70,109 @@ type InterfaceStats struct {
 }
 
 type InterfaceManager struct {
-	logger *slog.Logger
+	mu        *sync.RWMutex
+	logger    *slog.Logger
+	neighbors map[int]map[neighborKey]*LinkNeighbor
 }
 
 func NewInterfaceManager(logger *slog.Logger) *InterfaceManager {
 	return &InterfaceManager{
-		logger: logger,
+		mu:        &sync.RWMutex{},
+		logger:    logger,
+		neighbors: make(map[int]map[neighborKey]*LinkNeighbor),
+	}
+}
+
+// ObserveDiscovery records the LLDP or CDP neighbor announced by a packet
+// captured on the interface with the given index. Packets without a
+// discovery layer are ignored, and a zero TTL withdraws the neighbor.
+func (im *InterfaceManager) ObserveDiscovery(ifIndex int, packet *ParsedPacket, timestamp time.Time) {
+	if packet == nil || packet.Discovery == nil {
+		return
+	}
+	d := packet.Discovery
+	key := neighborKey{protocol: d.Protocol, chassisID: d.ChassisID, portID: d.PortID}
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	neighbors := im.neighbors[ifIndex]
+	if d.TTL == 0 {
+		delete(neighbors, key)
+		return
+	}
+	if neighbors == nil {
+		neighbors = make(map[neighborKey]*LinkNeighbor)
+		im.neighbors[ifIndex] = neighbors
 	}
+
+	n, exists := neighbors[key]
+	if !exists {
+		for k, old := range neighbors {
+			if old.expired(timestamp) {
+				delete(neighbors, k)
+			}
+		}
+		if len(neighbors) >= maxNeighborsPerInterface {
+			im.evictOldestNeighbor(neighbors)
+		}
+		n = &LinkNeighbor{FirstSeen: timestamp}
+		neighbors[key] = n
+		im.logger.Info("discovered link neighbor",
+			slog.Int("interface", ifIndex),
+			slog.String("protocol", d.Protocol.String()),
+			slog.String("chassis_id", d.ChassisID),
+			slog.String("port_id", d.PortID),
+			slog.String("system_name", d.SystemName))
+	}
+
+	// The packet's address slice is reused by the next decode.
+	n.LinkDiscovery = *d
+	n.ManagementAddresses = append([]netip.Addr(nil), d.ManagementAddresses...)
+	if packet.Ethernet != nil {
+		n.SourceMAC = packet.Ethernet.SrcMAC
+	}
+	if timestamp.After(n.LastSeen) {
+		n.LastSeen = timestamp
+	}
+}
+
+func (im *InterfaceManager) evictOldestNeighbor(neighbors map[neighborKey]*LinkNeighbor) {
+	var oldestKey neighborKey
+	var oldest *LinkNeighbor
+	for k, n := range neighbors {
+		if oldest == nil || n.LastSeen.Before(oldest.LastSeen) {
+			oldestKey, oldest = k, n
+		}
+	}
+	delete(neighbors, oldestKey)
+}
+
+// Neighbors returns the unexpired LLDP and CDP neighbors seen on the
+// interface with the given index, ordered by protocol, chassis and port.
+func (im *InterfaceManager) Neighbors(ifIndex int) []LinkNeighbor {
+	now := time.Now()
+
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+
+	var result []LinkNeighbor
+	for _, n := range im.neighbors[ifIndex] {
+		if !n.expired(now) {
+			result = append(result, *n)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := &result[i], &result[j]
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		if a.ChassisID != b.ChassisID {
+			return a.ChassisID < b.ChassisID
+		}
+		return a.PortID < b.PortID
+	})
+	return result
 }
 
 func (im *InterfaceManager) GetAllInterfaces() ([]InterfaceInfo, error) {
@@ -88,6 +212,7 @@ func (im *InterfaceManager) GetAllInterfaces() ([]InterfaceInfo, error) {
 		} else {
 			info.Statistics = stats
 		}
+		info.Neighbors = im.Neighbors(iface.Index)
 
 		interfaceList = append(interfaceList, info)
 	}
@@ -209,6 +334,7 @@ func (im *InterfaceManager) buildInterfaceInfo(iface *net.Interface) (*Interface
 	} else {
 		info.Statistics = stats
 	}
+	info.Neighbors = im.Neighbors(iface.Index)
 
 	return info, nil
 }
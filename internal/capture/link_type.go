@@ -0,0 +1,202 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// LinkType is the framing of captured packets, which depends on the
+// interface they were captured on. The zero value is Ethernet.
+type LinkType uint8
+
+const (
+	LinkTypeEthernet LinkType = iota
+	// LinkTypeRaw packets start directly with an IPv4 or IPv6 header, as on
+	// tun, WireGuard and other point-to-point interfaces.
+	LinkTypeRaw
+	// LinkTypeNull packets start with the 4-byte host-order address family
+	// of BSD loopback interfaces.
+	LinkTypeNull
+	// LinkTypeLinuxSLL packets start with a Linux cooked capture header.
+	LinkTypeLinuxSLL
+)
+
+func (t LinkType) String() string {
+	switch t {
+	case LinkTypeEthernet:
+		return "ethernet"
+	case LinkTypeRaw:
+		return "raw"
+	case LinkTypeNull:
+		return "null"
+	case LinkTypeLinuxSLL:
+		return "linux_sll"
+	default:
+		return fmt.Sprintf("link_type(%d)", uint8(t))
+	}
+}
+
+func (t LinkType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Linux ARPHRD_* hardware types of the interfaces packets are captured on.
+const (
+	ARPHRDEther    = 1
+	ARPHRDPPP      = 512
+	ARPHRDRawIP    = 519
+	ARPHRDTunnel   = 768
+	ARPHRDTunnel6  = 769
+	ARPHRDLoopback = 772
+	ARPHRDSit      = 776
+	ARPHRDIPGRE    = 778
+	ARPHRDIP6GRE   = 823
+	ARPHRDNone     = 0xFFFE
+)
+
+// LinkTypeFromARPHRD returns the framing of packets read from a packet
+// socket on an interface of the given hardware type. Linux loopback frames
+// carry an Ethernet header with zero addresses; PPP and IP tunnel devices
+// deliver bare IP packets. It returns false for hardware types it does not
+// know, which the capture engine decodes as Ethernet.
+func LinkTypeFromARPHRD(hatype uint16) (LinkType, bool) {
+	switch hatype {
+	case ARPHRDEther, ARPHRDLoopback:
+		return LinkTypeEthernet, true
+	case ARPHRDNone, ARPHRDRawIP, ARPHRDPPP, ARPHRDTunnel, ARPHRDTunnel6, ARPHRDSit, ARPHRDIPGRE, ARPHRDIP6GRE:
+		return LinkTypeRaw, true
+	default:
+		return 0, false
+	}
+}
+
+// LinuxSLLHeader is the Linux cooked capture header, which replaces the link
+// header of packets captured on the "any" device or on interfaces without
+// one.
+type LinuxSLLHeader struct {
+	PacketType  uint16  `json:"packet_type"` // to us, broadcast, multicast, to another host or outgoing
+	ARPHRD      uint16  `json:"arphrd"`
+	AddressSize uint16  `json:"address_size"`
+	Address     [8]byte `json:"address"`  // sender link-layer address, AddressSize bytes used
+	Protocol    uint16  `json:"protocol"` // EtherType of the payload
+}
+
+// LoopbackHeader is the BSD loopback (DLT_NULL) header.
+type LoopbackHeader struct {
+	Family uint32 `json:"family"`
+}
+
+const (
+	LinuxSLLHeaderSize = 16
+	LoopbackHeaderSize = 4
+
+	// Address family values found in loopback headers. IPv6 differs between
+	// the systems writing them.
+	loopbackFamilyIPv4        = 2
+	loopbackFamilyIPv6Linux   = 10
+	loopbackFamilyIPv6BSD     = 24
+	loopbackFamilyIPv6FreeBSD = 28
+	loopbackFamilyIPv6Darwin  = 30
+)
+
+// decodeLink decodes a packet of the given link type into the reset packet.
+func (p *ParsedPacket) decodeLink(linkType LinkType, data []byte) {
+	switch linkType {
+	case LinkTypeRaw:
+		p.decodeRawIP(data)
+	case LinkTypeNull:
+		p.decodeLoopback(data)
+	case LinkTypeLinuxSLL:
+		p.decodeLinuxSLL(data)
+	default:
+		p.decodeFrame(data)
+	}
+}
+
+// decodeRawIP decodes a bare IPv4 or IPv6 packet, told apart by the version
+// nibble.
+func (p *ParsedPacket) decodeRawIP(data []byte) {
+	if len(data) == 0 {
+		p.setError(decodeError(LayerIPv4, DecodeTruncated, "empty raw IP packet"))
+		return
+	}
+
+	var etherType uint16
+	switch version := data[0] >> 4; version {
+	case 4:
+		etherType = EtherTypeIPv4
+	case 6:
+		etherType = EtherTypeIPv6
+	default:
+		p.setError(decodeError(LayerIPv4, DecodeBadVersion, "invalid raw IP version: %d", version))
+		return
+	}
+
+	offset := 0
+	if err := parseEtherTypePayload(p, etherType, data, &offset); err != nil {
+		p.setError(err)
+		return
+	}
+	p.setPayload(data, offset)
+}
+
+func (p *ParsedPacket) decodeLoopback(data []byte) {
+	if len(data) < LoopbackHeaderSize {
+		p.setError(decodeError(LayerLoopback, DecodeTruncated, "insufficient data for loopback header: need %d, got %d", LoopbackHeaderSize, len(data)))
+		return
+	}
+	// The family is in the byte order of the capturing host, which small
+	// values give away.
+	family := binary.LittleEndian.Uint32(data)
+	if family&0xFFFF0000 != 0 {
+		family = binary.BigEndian.Uint32(data)
+	}
+	p.loopback = LoopbackHeader{Family: family}
+	p.Loopback = &p.loopback
+	p.addLayer(LayerLoopback, 0, LoopbackHeaderSize)
+	offset := LoopbackHeaderSize
+
+	var etherType uint16
+	switch family {
+	case loopbackFamilyIPv4:
+		etherType = EtherTypeIPv4
+	case loopbackFamilyIPv6Linux, loopbackFamilyIPv6BSD, loopbackFamilyIPv6FreeBSD, loopbackFamilyIPv6Darwin:
+		etherType = EtherTypeIPv6
+	default:
+		p.setPayload(data, offset)
+		return
+	}
+
+	if err := parseEtherTypePayload(p, etherType, data, &offset); err != nil {
+		p.setError(err)
+		return
+	}
+	p.setPayload(data, offset)
+}
+
+func (p *ParsedPacket) decodeLinuxSLL(data []byte) {
+	if len(data) < LinuxSLLHeaderSize {
+		p.setError(decodeError(LayerLinuxSLL, DecodeTruncated, "insufficient data for Linux cooked header: need %d, got %d", LinuxSLLHeaderSize, len(data)))
+		return
+	}
+	p.linuxSLL = LinuxSLLHeader{
+		PacketType:  binary.BigEndian.Uint16(data[0:2]),
+		ARPHRD:      binary.BigEndian.Uint16(data[2:4]),
+		AddressSize: binary.BigEndian.Uint16(data[4:6]),
+		Address:     [8]byte(data[6:14]),
+		Protocol:    binary.BigEndian.Uint16(data[14:16]),
+	}
+	p.LinuxSLL = &p.linuxSLL
+	p.addLayer(LayerLinuxSLL, 0, LinuxSLLHeaderSize)
+	offset := LinuxSLLHeaderSize
+
+	// Small protocol values are Linux ETH_P_* codes for frames without an
+	// EtherType, such as 802.2 LLC, rather than 802.3 lengths.
+	if p.linuxSLL.Protocol > maxIEEE8023Length {
+		if err := parseEtherTypePayload(p, p.linuxSLL.Protocol, data, &offset); err != nil {
+			p.setError(err)
+			return
+		}
+	}
+	p.setPayload(data, offset)
+}
@@ -1,71 +1,192 @@
-//go:build linux
-
 package capture
 
 import (
 	"encoding/binary"
 	"fmt"
-	"net"
+	"net/netip"
+	"strings"
 )
 
 type EthernetHeader struct {
-	DstMAC    net.HardwareAddr
-	SrcMAC    net.HardwareAddr
-	EtherType uint16
+	DstMAC    MACAddr `json:"dst_mac"`
+	SrcMAC    MACAddr `json:"src_mac"`
+	EtherType uint16  `json:"ether_type"`
+}
+
+// VLANTag is one 802.1Q or 802.1ad tag. EtherType is the type of the
+// encapsulated frame that follows the tag.
+type VLANTag struct {
+	TPID         uint16 `json:"tpid"`
+	Priority     uint8  `json:"priority"`
+	DropEligible bool   `json:"drop_eligible"`
+	VLANID       uint16 `json:"vlan_id"`
+	EtherType    uint16 `json:"ether_type"`
+}
+
+type MPLSLabel struct {
+	Label         uint32 `json:"label"`
+	TrafficClass  uint8  `json:"traffic_class"`
+	BottomOfStack bool   `json:"bottom_of_stack"`
+	TTL           uint8  `json:"ttl"`
 }
 
 type IPv4Header struct {
-	Version    uint8
-	IHL        uint8
-	ToS        uint8
-	Length     uint16
-	ID         uint16
-	Flags      uint8
-	FragOffset uint16
-	TTL        uint8
-	Protocol   uint8
-	Checksum   uint16
-	SrcIP      net.IP
-	DstIP      net.IP
+	Version    uint8      `json:"version"`
+	IHL        uint8      `json:"ihl"`
+	ToS        uint8      `json:"tos"`
+	Length     uint16     `json:"length"`
+	ID         uint16     `json:"id"`
+	Flags      uint8      `json:"flags"`
+	FragOffset uint16     `json:"frag_offset"`
+	TTL        uint8      `json:"ttl"`
+	Protocol   uint8      `json:"protocol"`
+	Checksum   uint16     `json:"checksum"`
+	SrcIP      netip.Addr `json:"src_ip"`
+	DstIP      netip.Addr `json:"dst_ip"`
 }
 
 type IPv6Header struct {
-	Version      uint8
-	TrafficClass uint8
-	FlowLabel    uint32
-	PayloadLen   uint16
-	NextHeader   uint8
-	HopLimit     uint8
-	SrcIP        net.IP
-	DstIP        net.IP
+	Version      uint8      `json:"version"`
+	TrafficClass uint8      `json:"traffic_class"`
+	FlowLabel    uint32     `json:"flow_label"`
+	PayloadLen   uint16     `json:"payload_len"`
+	NextHeader   uint8      `json:"next_header"`
+	HopLimit     uint8      `json:"hop_limit"`
+	SrcIP        netip.Addr `json:"src_ip"`
+	DstIP        netip.Addr `json:"dst_ip"`
+
+	// Extension header chain, in wire order. UpperLayerProtocol is the
+	// protocol that follows the last extension header and UpperLayerOffset
+	// its offset from the start of the IPv6 header.
+	ExtensionHeaders   []IPv6ExtensionHeader `json:"extension_headers"`
+	Fragment           *IPv6FragmentHeader   `json:"fragment,omitempty"`
+	UpperLayerProtocol uint8                 `json:"upper_layer_protocol"`
+	UpperLayerOffset   int                   `json:"upper_layer_offset"`
+
+	fragment IPv6FragmentHeader
+}
+
+type IPv6ExtensionHeader struct {
+	Type   uint8 `json:"type"`
+	Length int   `json:"length"`
+}
+
+type IPv6FragmentHeader struct {
+	NextHeader     uint8  `json:"next_header"`
+	FragmentOffset uint16 `json:"fragment_offset"`
+	MoreFragments  bool   `json:"more_fragments"`
+	Identification uint32 `json:"identification"`
 }
 
 type TCPHeader struct {
-	SrcPort    uint16
-	DstPort    uint16
-	SeqNum     uint32
-	AckNum     uint32
-	DataOffset uint8
-	Flags      uint8
-	Window     uint16
-	Checksum   uint16
-	UrgentPtr  uint16
+	SrcPort    uint16     `json:"src_port"`
+	DstPort    uint16     `json:"dst_port"`
+	SeqNum     uint32     `json:"seq_num"`
+	AckNum     uint32     `json:"ack_num"`
+	DataOffset uint8      `json:"data_offset"`
+	Flags      uint8      `json:"flags"`
+	Window     uint16     `json:"window"`
+	Checksum   uint16     `json:"checksum"`
+	UrgentPtr  uint16     `json:"urgent_ptr"`
+	Options    TCPOptions `json:"options"`
 }
 
 type UDPHeader struct {
-	SrcPort  uint16
-	DstPort  uint16
-	Length   uint16
-	Checksum uint16
+	SrcPort  uint16 `json:"src_port"`
+	DstPort  uint16 `json:"dst_port"`
+	Length   uint16 `json:"length"`
+	Checksum uint16 `json:"checksum"`
 }
 
+// ParsedPacket is a decoded frame. Layers tells which of the header fields
+// were filled in; the headers themselves are stored inside the packet and
+// reused when it is passed to Decoder.Decode again.
 type ParsedPacket struct {
-	Ethernet *EthernetHeader
-	IPv4     *IPv4Header
-	IPv6     *IPv6Header
-	TCP      *TCPHeader
-	UDP      *UDPHeader
-	Payload  []byte
+	Layers    LayerSet
+	Ethernet  *EthernetHeader
+	LinuxSLL  *LinuxSLLHeader
+	Loopback  *LoopbackHeader
+	VLANs     []VLANTag
+	MPLS      []MPLSLabel
+	IPv4      *IPv4Header
+	IPv6      *IPv6Header
+	TCP       *TCPHeader
+	UDP       *UDPHeader
+	ICMP      *ICMPHeader
+	ICMPv6    *ICMPHeader
+	ARP       *ARPPacket
+	Discovery *LinkDiscovery // LLDP or CDP advertisement, as told by Layers
+	Tunnel    *TunnelHeader
+	Inner     *ParsedPacket // decapsulated packet when Tunnel is set
+	Payload   []byte        // bytes after the last decoded header, including any Inner packet
+
+	Checksums Checksums
+	Err       *DecodeError // layer that stopped decoding, nil if none did
+
+	state decodeState
+
+	ethernet  EthernetHeader
+	linuxSLL  LinuxSLLHeader
+	loopback  LoopbackHeader
+	ipv4      IPv4Header
+	ipv6      IPv6Header
+	tcp       TCPHeader
+	udp       UDPHeader
+	icmp      ICMPHeader
+	icmpQuote icmpQuote
+	arp       ARPPacket
+	discovery LinkDiscovery
+	tunnel    TunnelHeader
+	inner     *ParsedPacket
+	fragment  fragmentInfo
+	end       int // end of the IP datagram in the decoded data, 0 if unknown
+
+	// Where each layer lies in the outermost packet's data; base is where
+	// this packet starts in it.
+	base    int
+	bounds  [layerCount]layerBounds
+	bounded LayerSet
+}
+
+type layerBounds struct {
+	start, end int
+}
+
+// Has reports whether the layer was decoded.
+func (p *ParsedPacket) Has(layer LayerType) bool {
+	return p.Layers.Has(layer)
+}
+
+// Bounds returns where a decoded layer lies in the data given to Decode,
+// for a decapsulated packet the outermost packet's data. Stacked VLAN tags
+// and MPLS labels are spanned together, and the IPv6 layer includes its
+// extension headers. ok is false for layers not decoded from that data, such
+// as the link layers copied onto a reassembled datagram, whose other layers
+// are relative to the rebuilt datagram.
+func (p *ParsedPacket) Bounds(layer LayerType) (start, end int, ok bool) {
+	if layer >= layerCount || !p.bounded.Has(layer) {
+		return 0, 0, false
+	}
+	return p.bounds[layer].start, p.bounds[layer].end, true
+}
+
+type ParseOptions struct {
+	// MaxTunnelDepth limits how many levels of encapsulation are decoded
+	// into Inner packets. Zero disables decapsulation.
+	MaxTunnelDepth int
+
+	// VerifyChecksums fills in ParsedPacket.Checksums.
+	VerifyChecksums bool
+
+	// LinkType is the framing of the data given to Decoder.Decode. Captured
+	// packets carry their own.
+	LinkType LinkType
+}
+
+func DefaultParseOptions() ParseOptions {
+	return ParseOptions{
+		MaxTunnelDepth: 4,
+	}
 }
 
 const (
@@ -73,155 +194,379 @@ const (
 	EtherTypeIPv6 = 0x86DD
 	EtherTypeARP  = 0x0806
 
-	IPProtoTCP  = 6
-	IPProtoUDP  = 17
-	IPProtoICMP = 1
+	EtherTypeVLAN          = 0x8100
+	EtherTypeQinQ          = 0x88A8
+	EtherTypeQinQLegacy    = 0x9100
+	EtherTypeMPLSUnicast   = 0x8847
+	EtherTypeMPLSMulticast = 0x8848
+
+	IPProtoTCP    = 6
+	IPProtoUDP    = 17
+	IPProtoICMP   = 1
+	IPProtoICMPv6 = 58
+
+	IPv6ExtHopByHop           = 0
+	IPv6ExtRouting            = 43
+	IPv6ExtFragment           = 44
+	IPv6ExtESP                = 50
+	IPv6ExtAuthentication     = 51
+	IPv6NoNextHeader          = 59
+	IPv6ExtDestinationOptions = 60
+	IPv6ExtMobility           = 135
+	IPv6ExtHIP                = 139
+	IPv6ExtShim6              = 140
 
 	EthernetHeaderSize = 14
 	IPv4HeaderMinSize  = 20
 	IPv6HeaderSize     = 40
 	TCPHeaderMinSize   = 20
 	UDPHeaderSize      = 8
+
+	IPv6FragmentHeaderSize  = 8
+	maxIPv6ExtensionHeaders = 16
+
+	VLANTagSize   = 4
+	MPLSLabelSize = 4
+	maxVLANTags   = 8
+	maxMPLSLabels = 16
+
+	ipv4FlagMoreFragments = 0x1
+
+	TCPFlagFIN = 0x01
+	TCPFlagSYN = 0x02
+	TCPFlagRST = 0x04
+	TCPFlagPSH = 0x08
+	TCPFlagACK = 0x10
+	TCPFlagURG = 0x20
+	TCPFlagECE = 0x40
+	TCPFlagCWR = 0x80
 )
 
 func ParsePacket(data []byte) (*ParsedPacket, error) {
-	if len(data) < EthernetHeaderSize {
-		return nil, fmt.Errorf("packet too short for Ethernet header: %d bytes", len(data))
-	}
+	return ParsePacketWithOptions(data, DefaultParseOptions())
+}
 
+// ParsePacketWithOptions decodes data into a newly allocated packet. Use a
+// Decoder to decode into reused packets instead. On a *DecodeError the
+// partially decoded packet is returned with it, unless not even the Ethernet
+// header could be decoded.
+func ParsePacketWithOptions(data []byte, opts ParseOptions) (*ParsedPacket, error) {
 	packet := &ParsedPacket{}
-	offset := 0
+	err := NewDecoder(opts).Decode(data, packet)
+	if packet.Layers == 0 {
+		return nil, err
+	}
+	return packet, err
+}
 
-	ethernet, err := parseEthernetHeader(data[offset:])
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse Ethernet header: %w", err)
+// parseEtherTypePayload decodes whatever follows an EtherType field, peeling
+// off any stacked VLAN tags and MPLS labels before the network layer. Unknown
+// EtherTypes are left for the caller to report as payload.
+func parseEtherTypePayload(packet *ParsedPacket, etherType uint16, data []byte, offset *int) error {
+	for {
+		if *offset >= len(data) {
+			return nil
+		}
+
+		switch etherType {
+		case EtherTypeVLAN, EtherTypeQinQ, EtherTypeQinQLegacy:
+			if len(packet.VLANs) >= maxVLANTags {
+				return decodeError(LayerVLAN, DecodeUnsupported, "too many VLAN tags: more than %d", maxVLANTags)
+			}
+			tag, err := parseVLANTag(data[*offset:], etherType)
+			if err != nil {
+				return err
+			}
+			packet.VLANs = append(packet.VLANs, tag)
+			packet.addLayer(LayerVLAN, *offset, *offset+VLANTagSize)
+			*offset += VLANTagSize
+			etherType = tag.EtherType
+		case EtherTypeMPLSUnicast, EtherTypeMPLSMulticast:
+			return parseMPLSPacket(packet, data, offset)
+		case EtherTypeIPv4:
+			return parseIPv4Packet(packet, data, offset)
+		case EtherTypeIPv6:
+			return parseIPv6Packet(packet, data, offset)
+		case EtherTypeARP:
+			arpOffset, err := parseARPPacket(&packet.arp, data[*offset:])
+			if err != nil {
+				return err
+			}
+			packet.ARP = &packet.arp
+			packet.addLayer(LayerARP, *offset, *offset+arpOffset)
+			*offset += arpOffset
+			return nil
+		case EtherTypeLLDP:
+			length, err := parseLLDPPacket(&packet.discovery, data[*offset:])
+			if err != nil {
+				return err
+			}
+			packet.Discovery = &packet.discovery
+			packet.addLayer(LayerLLDP, *offset, *offset+length)
+			*offset += length
+			return nil
+		default:
+			if etherType <= maxIEEE8023Length {
+				return parseLLCPacket(packet, etherType, data, offset)
+			}
+			return nil
+		}
 	}
-	packet.Ethernet = ethernet
-	offset += EthernetHeaderSize
+}
 
-	if offset >= len(data) {
-		return packet, nil
+func parseVLANTag(data []byte, tpid uint16) (VLANTag, error) {
+	if len(data) < VLANTagSize {
+		return VLANTag{}, decodeError(LayerVLAN, DecodeTruncated, "insufficient data for VLAN tag: need %d, got %d", VLANTagSize, len(data))
 	}
 
-	switch ethernet.EtherType {
-	case EtherTypeIPv4:
-		if err := parseIPv4Packet(packet, data, &offset); err != nil {
-			return packet, nil // Return partial packet on parse error
+	tci := binary.BigEndian.Uint16(data[0:2])
+	return VLANTag{
+		TPID:         tpid,
+		Priority:     uint8(tci >> 13),
+		DropEligible: tci&0x1000 != 0,
+		VLANID:       tci & 0x0FFF,
+		EtherType:    binary.BigEndian.Uint16(data[2:4]),
+	}, nil
+}
+
+// parseMPLSPacket decodes the label stack and, since MPLS carries no payload
+// type, guesses IPv4 or IPv6 from the version nibble after the bottom label.
+func parseMPLSPacket(packet *ParsedPacket, data []byte, offset *int) error {
+	for {
+		if len(packet.MPLS) >= maxMPLSLabels {
+			return decodeError(LayerMPLS, DecodeUnsupported, "too many MPLS labels: more than %d", maxMPLSLabels)
 		}
-	case EtherTypeIPv6:
-		if err := parseIPv6Packet(packet, data, &offset); err != nil {
-			return packet, nil // Return partial packet on parse error
+		if len(data)-*offset < MPLSLabelSize {
+			return decodeError(LayerMPLS, DecodeTruncated, "insufficient data for MPLS label: need %d, got %d", MPLSLabelSize, len(data)-*offset)
 		}
-	default:
-		// Unknown ethernet type, add remaining data as payload
-		if offset < len(data) {
-			packet.Payload = data[offset:]
+
+		entry := binary.BigEndian.Uint32(data[*offset : *offset+MPLSLabelSize])
+		label := MPLSLabel{
+			Label:         entry >> 12,
+			TrafficClass:  uint8((entry >> 9) & 0x07),
+			BottomOfStack: entry&0x100 != 0,
+			TTL:           uint8(entry),
+		}
+		packet.MPLS = append(packet.MPLS, label)
+		packet.addLayer(LayerMPLS, *offset, *offset+MPLSLabelSize)
+		*offset += MPLSLabelSize
+
+		if label.BottomOfStack {
+			break
 		}
 	}
 
-	if offset < len(data) {
-		packet.Payload = data[offset:]
+	if *offset >= len(data) {
+		return nil
 	}
 
-	return packet, nil
+	switch data[*offset] >> 4 {
+	case 4:
+		return parseIPv4Packet(packet, data, offset)
+	case 6:
+		return parseIPv6Packet(packet, data, offset)
+	}
+	return nil
 }
 
 func parseIPv4Packet(packet *ParsedPacket, data []byte, offset *int) error {
-	ipv4, ipOffset, err := parseIPv4Header(data[*offset:])
+	ipOffset, err := parseIPv4Header(&packet.ipv4, data[*offset:])
 	if err != nil {
 		return err
 	}
+	ipv4 := &packet.ipv4
 	packet.IPv4 = ipv4
+	packet.addLayer(LayerIPv4, *offset, *offset+ipOffset)
+	packet.verifyIPv4Checksum(data[*offset : *offset+ipOffset])
+	data = packet.trimToDatagram(data, *offset, int(ipv4.Length))
+
+	if ipv4.Flags&ipv4FlagMoreFragments != 0 || ipv4.FragOffset != 0 {
+		packet.recordIPv4Fragment(data[*offset:], ipOffset)
+	}
 	*offset += ipOffset
 
 	if *offset >= len(data) {
 		return nil
 	}
 
-	switch ipv4.Protocol {
-	case IPProtoTCP:
-		tcp, tcpOffset, err := parseTCPHeader(data[*offset:])
-		if err != nil {
-			return err
-		}
-		packet.TCP = tcp
-		*offset += tcpOffset
-	case IPProtoUDP:
-		udp, udpOffset, err := parseUDPHeader(data[*offset:])
-		if err != nil {
-			return err
-		}
-		packet.UDP = udp
-		*offset += udpOffset
+	// Only the first fragment carries the upper-layer header.
+	if ipv4.FragOffset != 0 {
+		return nil
 	}
-	return nil
+
+	return parseTransportLayer(packet, packet.ipv4.Protocol, data, offset)
 }
 
 func parseIPv6Packet(packet *ParsedPacket, data []byte, offset *int) error {
-	ipv6, ipOffset, err := parseIPv6Header(data[*offset:])
+	start := *offset
+	ipOffset, err := parseIPv6Header(&packet.ipv6, data[*offset:])
 	if err != nil {
 		return err
 	}
+	ipv6 := &packet.ipv6
 	packet.IPv6 = ipv6
+	packet.addLayer(LayerIPv6, start, start+ipOffset)
+	// A zero payload length is either a jumbogram or segmentation offload;
+	// both leave the frame length to go by.
+	if ipv6.PayloadLen != 0 {
+		data = packet.trimToDatagram(data, *offset, IPv6HeaderSize+int(ipv6.PayloadLen))
+	}
 	*offset += ipOffset
 
+	extOffset, err := parseIPv6ExtensionHeaders(ipv6, data[*offset:])
+	*offset += extOffset
+	// The IPv6 layer spans its extension headers, the fragment header
+	// among them.
+	packet.addLayer(LayerIPv6, start, *offset)
+	if ipv6.Fragment != nil {
+		fragmentStart := start + IPv6HeaderSize
+		for _, ext := range ipv6.ExtensionHeaders {
+			if ext.Type == IPv6ExtFragment {
+				break
+			}
+			fragmentStart += ext.Length
+		}
+		packet.addLayer(LayerIPv6Fragment, fragmentStart, fragmentStart+IPv6FragmentHeaderSize)
+	}
+	if err != nil {
+		return err
+	}
+	if ipv6.Fragment != nil {
+		packet.recordIPv6Fragment(data[start:])
+	}
+
 	if *offset >= len(data) {
 		return nil
 	}
 
-	switch ipv6.NextHeader {
+	// Only the first fragment carries the upper-layer header.
+	if ipv6.Fragment != nil && ipv6.Fragment.FragmentOffset != 0 {
+		return nil
+	}
+
+	return parseTransportLayer(packet, ipv6.UpperLayerProtocol, data, offset)
+}
+
+// parseLLCPacket decodes the LLC/SNAP payload of an 802.3 frame, whose
+// EtherType field holds the payload length. Only CDP is decoded; other
+// payloads are left for the caller to report.
+func parseLLCPacket(packet *ParsedPacket, length uint16, data []byte, offset *int) error {
+	data = packet.trimToDatagram(data, *offset, int(length))
+	if !isCDP(data[*offset:]) {
+		return nil
+	}
+	start := *offset
+	*offset += LLCSNAPHeaderSize
+	cdpLength, err := parseCDPPacket(&packet.discovery, data[*offset:])
+	if err != nil {
+		return err
+	}
+	packet.Discovery = &packet.discovery
+	packet.addLayer(LayerCDP, start, *offset+cdpLength)
+	*offset += cdpLength
+	return nil
+}
+
+// trimToDatagram drops what follows an IP datagram of length bytes starting
+// at data[start], such as the padding of a minimum-size Ethernet frame, so
+// that it is not decoded as payload. A zero length, left by segmentation
+// offload, keeps the frame length.
+func (p *ParsedPacket) trimToDatagram(data []byte, start, length int) []byte {
+	if length == 0 || start+length >= len(data) {
+		return data
+	}
+	p.end = start + length
+	return data[:p.end]
+}
+
+func parseTransportLayer(packet *ParsedPacket, protocol uint8, data []byte, offset *int) error {
+	start := *offset
+
+	switch protocol {
 	case IPProtoTCP:
-		tcp, tcpOffset, err := parseTCPHeader(data[*offset:])
+		tcpOffset, err := parseTCPHeader(&packet.tcp, data[*offset:])
 		if err != nil {
 			return err
 		}
-		packet.TCP = tcp
+		packet.TCP = &packet.tcp
+		packet.addLayer(LayerTCP, start, start+tcpOffset)
+		packet.Checksums.TCP = packet.verifyTransportChecksum(protocol, data, start)
 		*offset += tcpOffset
 	case IPProtoUDP:
-		udp, udpOffset, err := parseUDPHeader(data[*offset:])
+		udpOffset, err := parseUDPHeader(&packet.udp, data[*offset:])
 		if err != nil {
 			return err
 		}
-		packet.UDP = udp
+		packet.UDP = &packet.udp
+		packet.addLayer(LayerUDP, start, start+udpOffset)
+		packet.Checksums.UDP = packet.verifyTransportChecksum(protocol, data, start)
 		*offset += udpOffset
+		return parseUDPTunnel(packet, &packet.udp, data, offset)
+	case IPProtoICMP:
+		icmpOffset, err := parseICMPHeader(&packet.icmp, data[*offset:], false, &packet.icmpQuote)
+		if err != nil {
+			return err
+		}
+		packet.ICMP = &packet.icmp
+		packet.addLayer(LayerICMP, start, start+icmpOffset)
+		packet.Checksums.ICMP = packet.verifyTransportChecksum(protocol, data, start)
+		*offset += icmpOffset
+	case IPProtoICMPv6:
+		icmpOffset, err := parseICMPHeader(&packet.icmp, data[*offset:], true, &packet.icmpQuote)
+		if err != nil {
+			return err
+		}
+		packet.ICMPv6 = &packet.icmp
+		packet.addLayer(LayerICMPv6, start, start+icmpOffset)
+		packet.Checksums.ICMP = packet.verifyTransportChecksum(protocol, data, start)
+		*offset += icmpOffset
+	case IPProtoIPIP, IPProtoIPv6, IPProtoGRE:
+		return parseIPTunnel(packet, protocol, data, offset)
 	}
 	return nil
 }
 
-func parseEthernetHeader(data []byte) (*EthernetHeader, error) {
+func parseEthernetHeader(eth *EthernetHeader, data []byte) error {
 	if len(data) < EthernetHeaderSize {
-		return nil, fmt.Errorf("insufficient data for Ethernet header: need %d, got %d", EthernetHeaderSize, len(data))
+		return decodeError(LayerEthernet, DecodeTruncated, "insufficient data for Ethernet header: need %d, got %d", EthernetHeaderSize, len(data))
 	}
 
-	eth := &EthernetHeader{
-		DstMAC:    make(net.HardwareAddr, 6),
-		SrcMAC:    make(net.HardwareAddr, 6),
+	*eth = EthernetHeader{
+		DstMAC:    MACAddr(data[0:6]),
+		SrcMAC:    MACAddr(data[6:12]),
 		EtherType: binary.BigEndian.Uint16(data[12:14]),
 	}
 
-	copy(eth.DstMAC, data[0:6])
-	copy(eth.SrcMAC, data[6:12])
-
-	return eth, nil
+	return nil
 }
 
-func parseIPv4Header(data []byte) (*IPv4Header, int, error) {
+func parseIPv4Header(ipv4 *IPv4Header, data []byte) (int, error) {
 	if len(data) < IPv4HeaderMinSize {
-		return nil, 0, fmt.Errorf("insufficient data for IPv4 header: need %d, got %d", IPv4HeaderMinSize, len(data))
+		return 0, decodeError(LayerIPv4, DecodeTruncated, "insufficient data for IPv4 header: need %d, got %d", IPv4HeaderMinSize, len(data))
+	}
+
+	if version := data[0] >> 4; version != 4 {
+		return 0, decodeError(LayerIPv4, DecodeBadVersion, "invalid IPv4 version: %d", version)
 	}
 
 	ihl := data[0] & 0x0F
 	headerLength := int(ihl) * 4
 
 	if headerLength < IPv4HeaderMinSize {
-		return nil, 0, fmt.Errorf("invalid IPv4 header length: %d", headerLength)
+		return 0, decodeError(LayerIPv4, DecodeBadLength, "invalid IPv4 header length: %d", headerLength)
 	}
 
 	if len(data) < headerLength {
-		return nil, 0, fmt.Errorf("insufficient data for IPv4 header: need %d, got %d", headerLength, len(data))
+		return 0, decodeError(LayerIPv4, DecodeTruncated, "insufficient data for IPv4 header: need %d, got %d", headerLength, len(data))
 	}
 
-	ipv4 := &IPv4Header{
+	// Zero is left by segmentation offload on outbound super-packets.
+	totalLength := int(binary.BigEndian.Uint16(data[2:4]))
+	if totalLength != 0 && totalLength < headerLength {
+		return 0, decodeError(LayerIPv4, DecodeBadLength, "IPv4 total length %d shorter than header length %d", totalLength, headerLength)
+	}
+
+	*ipv4 = IPv4Header{
 		Version:    (data[0] & 0xF0) >> 4,
 		IHL:        ihl,
 		ToS:        data[1],
@@ -232,49 +577,130 @@ func parseIPv4Header(data []byte) (*IPv4Header, int, error) {
 		TTL:        data[8],
 		Protocol:   data[9],
 		Checksum:   binary.BigEndian.Uint16(data[10:12]),
-		SrcIP:      net.IP(data[12:16]),
-		DstIP:      net.IP(data[16:20]),
+		SrcIP:      netip.AddrFrom4([4]byte(data[12:16])),
+		DstIP:      netip.AddrFrom4([4]byte(data[16:20])),
 	}
 
-	return ipv4, headerLength, nil
+	return headerLength, nil
 }
 
-func parseIPv6Header(data []byte) (*IPv6Header, int, error) {
+func parseIPv6Header(ipv6 *IPv6Header, data []byte) (int, error) {
 	if len(data) < IPv6HeaderSize {
-		return nil, 0, fmt.Errorf("insufficient data for IPv6 header: need %d, got %d", IPv6HeaderSize, len(data))
+		return 0, decodeError(LayerIPv6, DecodeTruncated, "insufficient data for IPv6 header: need %d, got %d", IPv6HeaderSize, len(data))
+	}
+
+	if version := data[0] >> 4; version != 6 {
+		return 0, decodeError(LayerIPv6, DecodeBadVersion, "invalid IPv6 version: %d", version)
 	}
 
-	ipv6 := &IPv6Header{
+	*ipv6 = IPv6Header{
 		Version:      (data[0] & 0xF0) >> 4,
 		TrafficClass: ((data[0] & 0x0F) << 4) | ((data[1] & 0xF0) >> 4),
 		FlowLabel:    (uint32(data[1]&0x0F) << 16) | (uint32(data[2]) << 8) | uint32(data[3]),
 		PayloadLen:   binary.BigEndian.Uint16(data[4:6]),
 		NextHeader:   data[6],
 		HopLimit:     data[7],
-		SrcIP:        net.IP(data[8:24]),
-		DstIP:        net.IP(data[24:40]),
+		SrcIP:        netip.AddrFrom16([16]byte(data[8:24])),
+		DstIP:        netip.AddrFrom16([16]byte(data[24:40])),
+
+		ExtensionHeaders: ipv6.ExtensionHeaders[:0],
 	}
 
-	return ipv6, IPv6HeaderSize, nil
+	return IPv6HeaderSize, nil
 }
 
-func parseTCPHeader(data []byte) (*TCPHeader, int, error) {
+// parseIPv6ExtensionHeaders walks the extension header chain that follows the
+// fixed IPv6 header and records the upper-layer protocol and offset. It
+// returns the number of bytes consumed by the chain. ESP and "no next header"
+// end the walk since nothing after them can be decoded.
+func parseIPv6ExtensionHeaders(ipv6 *IPv6Header, data []byte) (int, error) {
+	next := ipv6.NextHeader
+	offset := 0
+
+	for i := 0; i < maxIPv6ExtensionHeaders; i++ {
+		var length int
+
+		switch next {
+		case IPv6ExtHopByHop, IPv6ExtRouting, IPv6ExtDestinationOptions,
+			IPv6ExtMobility, IPv6ExtHIP, IPv6ExtShim6:
+			if len(data)-offset < 2 {
+				return offset, decodeError(LayerIPv6, DecodeTruncated, "insufficient data for IPv6 extension header %d", next)
+			}
+			length = (int(data[offset+1]) + 1) * 8
+		case IPv6ExtAuthentication:
+			if len(data)-offset < 2 {
+				return offset, decodeError(LayerIPv6, DecodeTruncated, "insufficient data for IPv6 authentication header")
+			}
+			length = (int(data[offset+1]) + 2) * 4
+		case IPv6ExtFragment:
+			if len(data)-offset < IPv6FragmentHeaderSize {
+				return offset, decodeError(LayerIPv6Fragment, DecodeTruncated, "insufficient data for IPv6 fragment header: need %d, got %d",
+					IPv6FragmentHeaderSize, len(data)-offset)
+			}
+			length = IPv6FragmentHeaderSize
+		default:
+			ipv6.UpperLayerProtocol = next
+			ipv6.UpperLayerOffset = IPv6HeaderSize + offset
+			return offset, nil
+		}
+
+		if len(data)-offset < length {
+			return offset, decodeError(LayerIPv6, DecodeTruncated, "insufficient data for IPv6 extension header %d: need %d, got %d",
+				next, length, len(data)-offset)
+		}
+
+		header := data[offset : offset+length]
+		if next == IPv6ExtFragment {
+			fragOffset := binary.BigEndian.Uint16(header[2:4])
+			ipv6.fragment = IPv6FragmentHeader{
+				NextHeader:     header[0],
+				FragmentOffset: fragOffset >> 3,
+				MoreFragments:  fragOffset&0x1 != 0,
+				Identification: binary.BigEndian.Uint32(header[4:8]),
+			}
+			ipv6.Fragment = &ipv6.fragment
+
+			// What follows a later fragment is the middle of the
+			// datagram, not another header.
+			if ipv6.fragment.FragmentOffset != 0 {
+				ipv6.ExtensionHeaders = append(ipv6.ExtensionHeaders, IPv6ExtensionHeader{
+					Type:   next,
+					Length: length,
+				})
+				ipv6.UpperLayerProtocol = header[0]
+				ipv6.UpperLayerOffset = IPv6HeaderSize + offset + length
+				return offset + length, nil
+			}
+		}
+
+		ipv6.ExtensionHeaders = append(ipv6.ExtensionHeaders, IPv6ExtensionHeader{
+			Type:   next,
+			Length: length,
+		})
+		next = header[0]
+		offset += length
+	}
+
+	return offset, decodeError(LayerIPv6, DecodeUnsupported, "too many IPv6 extension headers: more than %d", maxIPv6ExtensionHeaders)
+}
+
+func parseTCPHeader(tcp *TCPHeader, data []byte) (int, error) {
 	if len(data) < TCPHeaderMinSize {
-		return nil, 0, fmt.Errorf("insufficient data for TCP header: need %d, got %d", TCPHeaderMinSize, len(data))
+		return 0, decodeError(LayerTCP, DecodeTruncated, "insufficient data for TCP header: need %d, got %d", TCPHeaderMinSize, len(data))
 	}
 
 	dataOffset := (data[12] & 0xF0) >> 4
 	headerLength := int(dataOffset) * 4
 
 	if headerLength < TCPHeaderMinSize {
-		return nil, 0, fmt.Errorf("invalid TCP header length: %d", headerLength)
+		return 0, decodeError(LayerTCP, DecodeBadLength, "invalid TCP header length: %d", headerLength)
 	}
 
 	if len(data) < headerLength {
-		return nil, 0, fmt.Errorf("insufficient data for TCP header: need %d, got %d", headerLength, len(data))
+		return 0, decodeError(LayerTCP, DecodeTruncated, "insufficient data for TCP header: need %d, got %d", headerLength, len(data))
 	}
 
-	tcp := &TCPHeader{
+	*tcp = TCPHeader{
 		SrcPort:    binary.BigEndian.Uint16(data[0:2]),
 		DstPort:    binary.BigEndian.Uint16(data[2:4]),
 		SeqNum:     binary.BigEndian.Uint32(data[4:8]),
@@ -284,57 +710,113 @@ func parseTCPHeader(data []byte) (*TCPHeader, int, error) {
 		Window:     binary.BigEndian.Uint16(data[14:16]),
 		Checksum:   binary.BigEndian.Uint16(data[16:18]),
 		UrgentPtr:  binary.BigEndian.Uint16(data[18:20]),
+		Options:    tcp.Options.reset(),
 	}
 
-	return tcp, headerLength, nil
+	if headerLength > TCPHeaderMinSize {
+		parseTCPOptions(&tcp.Options, data[TCPHeaderMinSize:headerLength])
+	}
+
+	return headerLength, nil
 }
 
-func parseUDPHeader(data []byte) (*UDPHeader, int, error) {
+func parseUDPHeader(udp *UDPHeader, data []byte) (int, error) {
 	if len(data) < UDPHeaderSize {
-		return nil, 0, fmt.Errorf("insufficient data for UDP header: need %d, got %d", UDPHeaderSize, len(data))
+		return 0, decodeError(LayerUDP, DecodeTruncated, "insufficient data for UDP header: need %d, got %d", UDPHeaderSize, len(data))
 	}
 
-	udp := &UDPHeader{
+	*udp = UDPHeader{
 		SrcPort:  binary.BigEndian.Uint16(data[0:2]),
 		DstPort:  binary.BigEndian.Uint16(data[2:4]),
 		Length:   binary.BigEndian.Uint16(data[4:6]),
 		Checksum: binary.BigEndian.Uint16(data[6:8]),
 	}
 
-	return udp, UDPHeaderSize, nil
+	// Zero is used by IPv6 jumbograms.
+	if udp.Length != 0 && udp.Length < UDPHeaderSize {
+		return 0, decodeError(LayerUDP, DecodeBadLength, "invalid UDP length: %d", udp.Length)
+	}
+
+	return UDPHeaderSize, nil
 }
 
 func (p *ParsedPacket) String() string {
 	result := "Packet:\n"
-	
+
 	if p.Ethernet != nil {
 		result += fmt.Sprintf("  Ethernet: %s -> %s (Type: 0x%04x)\n",
 			p.Ethernet.SrcMAC, p.Ethernet.DstMAC, p.Ethernet.EtherType)
 	}
-	
+
+	if p.LinuxSLL != nil {
+		result += fmt.Sprintf("  Linux SLL: packet type %d (ARPHRD: %d, Type: 0x%04x)\n",
+			p.LinuxSLL.PacketType, p.LinuxSLL.ARPHRD, p.LinuxSLL.Protocol)
+	}
+
+	if p.Loopback != nil {
+		result += fmt.Sprintf("  Loopback: family %d\n", p.Loopback.Family)
+	}
+
+	for _, tag := range p.VLANs {
+		result += fmt.Sprintf("  VLAN: %d (PCP: %d, Type: 0x%04x)\n",
+			tag.VLANID, tag.Priority, tag.EtherType)
+	}
+
+	for _, label := range p.MPLS {
+		result += fmt.Sprintf("  MPLS: %d (TC: %d, S: %t, TTL: %d)\n",
+			label.Label, label.TrafficClass, label.BottomOfStack, label.TTL)
+	}
+
 	if p.IPv4 != nil {
 		result += fmt.Sprintf("  IPv4: %s -> %s (Proto: %d)\n",
 			p.IPv4.SrcIP, p.IPv4.DstIP, p.IPv4.Protocol)
 	}
-	
+
 	if p.IPv6 != nil {
 		result += fmt.Sprintf("  IPv6: %s -> %s (Next: %d)\n",
 			p.IPv6.SrcIP, p.IPv6.DstIP, p.IPv6.NextHeader)
 	}
-	
+
 	if p.TCP != nil {
 		result += fmt.Sprintf("  TCP: %d -> %d (Flags: 0x%02x)\n",
 			p.TCP.SrcPort, p.TCP.DstPort, p.TCP.Flags)
 	}
-	
+
 	if p.UDP != nil {
 		result += fmt.Sprintf("  UDP: %d -> %d (Len: %d)\n",
 			p.UDP.SrcPort, p.UDP.DstPort, p.UDP.Length)
 	}
-	
+
+	if p.ICMP != nil {
+		result += fmt.Sprintf("  ICMP: type %d code %d\n", p.ICMP.Type, p.ICMP.Code)
+	}
+
+	if p.ICMPv6 != nil {
+		result += fmt.Sprintf("  ICMPv6: type %d code %d\n", p.ICMPv6.Type, p.ICMPv6.Code)
+	}
+
+	if p.ARP != nil {
+		result += fmt.Sprintf("  ARP: op %d %s (%s) -> %s (%s)\n",
+			p.ARP.Operation, p.ARP.SenderIP, p.ARP.SenderMAC, p.ARP.TargetIP, p.ARP.TargetMAC)
+	}
+
+	if p.Discovery != nil {
+		result += fmt.Sprintf("  %s: %s port %s (%s)\n",
+			strings.ToUpper(p.Discovery.Protocol.String()), p.Discovery.ChassisID, p.Discovery.PortID, p.Discovery.SystemName)
+	}
+
+	if p.Tunnel != nil {
+		result += fmt.Sprintf("  Tunnel: %s (ID: %d)\n", p.Tunnel.Type, p.Tunnel.ID)
+	}
+
 	if len(p.Payload) > 0 {
 		result += fmt.Sprintf("  Payload: %d bytes\n", len(p.Payload))
 	}
-	
+
+	if p.Inner != nil {
+		inner := strings.TrimSuffix(p.Inner.String(), "\n")
+		result += "  Inner " + strings.ReplaceAll(inner, "\n", "\n  ") + "\n"
+	}
+
 	return result
-}
\ No newline at end of file
+}
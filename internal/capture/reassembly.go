@@ -0,0 +1,532 @@
+package capture
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReassemblyConfig bounds the work and memory spent on fragments that may
+// never be completed.
+type ReassemblyConfig struct {
+	// Timeout is how long after its first fragment a datagram is given to
+	// complete.
+	Timeout time.Duration
+
+	// MaxMemory caps the fragment bytes buffered across all datagrams.
+	// The oldest datagrams are dropped to stay within it.
+	MaxMemory int
+
+	// MaxDatagrams caps the number of datagrams being reassembled.
+	MaxDatagrams int
+}
+
+type ReassemblyStatistics struct {
+	Pending     int    `json:"pending"`
+	MemoryBytes int    `json:"memory_bytes"`
+	Fragments   uint64 `json:"fragments"`
+	Reassembled uint64 `json:"reassembled"`
+	Duplicates  uint64 `json:"duplicates"`
+	Overlaps    uint64 `json:"overlaps"`
+	Oversized   uint64 `json:"oversized"`
+	Malformed   uint64 `json:"malformed"`
+	Timeouts    uint64 `json:"timeouts"`
+	Evictions   uint64 `json:"evictions"`
+}
+
+const (
+	// maxFragmentsPerDatagram bounds the per-fragment overlap search. A
+	// 64KB datagram sent over the smallest IPv6 MTU needs 54.
+	maxFragmentsPerDatagram = 128
+	maxIPDatagramPayload    = 65535
+)
+
+// fragmentInfo locates an IP fragment within the frame it was decoded from.
+// It aliases the frame and is only valid until the packet is decoded again.
+type fragmentInfo struct {
+	key    fragmentKey
+	offset int
+	more   bool
+	length int // payload length declared by the IP header
+
+	// header holds the headers that every fragment repeats: the IPv4
+	// header, or the IPv6 header and the extension headers before the
+	// fragment header. nextHeader indexes the IPv6 Next Header byte that
+	// names the fragment header.
+	header     []byte
+	nextHeader int
+	payload    []byte
+}
+
+type fragmentKey struct {
+	src, dst netip.Addr
+	protocol uint8
+	id       uint32
+
+	// Where the fragment arrived: its outermost VLAN and innermost tunnel
+	// ID, which keep apart tenants that reuse addresses.
+	vlan     uint16
+	tunnel   uint32
+	tunneled bool
+}
+
+// IsFragment reports whether the packet is a fragment of a larger IPv4 or
+// IPv6 datagram. Only the first fragment has its transport header decoded.
+func (p *ParsedPacket) IsFragment() bool {
+	return p.fragment.header != nil
+}
+
+func (p *ParsedPacket) recordIPv4Fragment(ip []byte, headerLength int) {
+	ipv4 := &p.ipv4
+	length := len(ip) - headerLength
+	if ipv4.Length != 0 {
+		length = int(ipv4.Length) - headerLength
+	}
+	end := min(headerLength+length, len(ip))
+
+	p.fragment = fragmentInfo{
+		key: fragmentKey{
+			src:      ipv4.SrcIP,
+			dst:      ipv4.DstIP,
+			protocol: ipv4.Protocol,
+			id:       uint32(ipv4.ID),
+		},
+		offset:  int(ipv4.FragOffset) * 8,
+		more:    ipv4.Flags&ipv4FlagMoreFragments != 0,
+		length:  length,
+		header:  ip[:headerLength],
+		payload: ip[headerLength:end],
+	}
+}
+
+// recordIPv6Fragment records the fragment whose IPv6 header starts ip.
+func (p *ParsedPacket) recordIPv6Fragment(ip []byte) {
+	ipv6 := &p.ipv6
+	fragmentHeader := IPv6HeaderSize
+	nextHeader := 6
+	for _, ext := range ipv6.ExtensionHeaders {
+		if ext.Type == IPv6ExtFragment {
+			break
+		}
+		nextHeader = fragmentHeader
+		fragmentHeader += ext.Length
+	}
+
+	start := fragmentHeader + IPv6FragmentHeaderSize
+	length := IPv6HeaderSize + int(ipv6.PayloadLen) - start
+	end := min(start+max(length, 0), len(ip))
+
+	p.fragment = fragmentInfo{
+		key: fragmentKey{
+			src:      ipv6.SrcIP,
+			dst:      ipv6.DstIP,
+			protocol: ipv6.fragment.NextHeader,
+			id:       ipv6.fragment.Identification,
+		},
+		offset:     int(ipv6.fragment.FragmentOffset) * 8,
+		more:       ipv6.fragment.MoreFragments,
+		length:     length,
+		header:     ip[:fragmentHeader],
+		nextHeader: nextHeader,
+		payload:    ip[start:end],
+	}
+}
+
+// Reassembler rebuilds fragmented IPv4 and IPv6 datagrams. Fragments are
+// matched on source, destination, protocol and identification, within the
+// VLAN and tunnel they arrived in. A fragment
+// that overlaps another with different data, as in evasion and teardrop
+// attacks, discards the whole datagram; exact duplicates are ignored.
+type Reassembler struct {
+	mu        *sync.Mutex
+	config    ReassemblyConfig
+	datagrams map[fragmentKey]*list.Element
+	order     *list.List // *pendingDatagram, oldest first
+	memory    int
+	stats     ReassemblyStatistics
+}
+
+type pendingDatagram struct {
+	key        fragmentKey
+	firstSeen  time.Time
+	header     []byte
+	nextHeader int
+	maxLength  int
+	total      int // payload length, -1 until the last fragment arrives
+	size       int
+	fragments  []fragment // ordered by offset, never overlapping
+}
+
+type fragment struct {
+	offset int
+	data   []byte
+}
+
+func (f fragment) end() int {
+	return f.offset + len(f.data)
+}
+
+func DefaultReassemblyConfig() ReassemblyConfig {
+	return ReassemblyConfig{
+		Timeout:      30 * time.Second,
+		MaxMemory:    4 * 1024 * 1024,
+		MaxDatagrams: 4096,
+	}
+}
+
+func NewReassembler(config ReassemblyConfig) *Reassembler {
+	defaults := DefaultReassemblyConfig()
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.MaxMemory <= 0 {
+		config.MaxMemory = defaults.MaxMemory
+	}
+	if config.MaxDatagrams <= 0 {
+		config.MaxDatagrams = defaults.MaxDatagrams
+	}
+
+	return &Reassembler{
+		mu:        &sync.Mutex{},
+		config:    config,
+		datagrams: make(map[fragmentKey]*list.Element),
+		order:     list.New(),
+	}
+}
+
+// Reassemble buffers a fragment and, when it completes its datagram, decodes
+// the reassembled datagram into out and returns true. packet is the frame
+// as decoded and the fragment its innermost packet. out keeps the layers
+// the fragment arrived under: the link layer headers and any tunnels, with
+// their own Payload left nil. The reassembled datagram is the innermost
+// packet of out and its Payload is not shared with any frame, so it may be
+// retained. Packets that are not fragments return false.
+func (r *Reassembler) Reassemble(packet *ParsedPacket, timestamp time.Time, out *ParsedPacket) bool {
+	inner := packet.Innermost()
+	if !inner.IsFragment() {
+		return false
+	}
+	frag := &inner.fragment
+	key := frag.key
+	if len(packet.VLANs) > 0 {
+		key.vlan = packet.VLANs[0].VLANID
+	}
+	for current := packet; current.Inner != nil; current = current.Inner {
+		if current.Tunnel != nil && current.Tunnel.HasID {
+			key.tunnel, key.tunneled = current.Tunnel.ID, true
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stats.Fragments++
+	r.expire(timestamp)
+
+	// A capture cut short by the snap length, or a non-final fragment
+	// whose size is not a multiple of 8, can never be placed correctly.
+	if len(frag.payload) != frag.length || (frag.more && (frag.length == 0 || frag.length%8 != 0)) {
+		r.stats.Malformed++
+		return false
+	}
+
+	d := r.lookup(key, timestamp)
+
+	// Later fragments repeat the unfragmentable headers; those of the
+	// first one are what the reassembled datagram starts with.
+	if frag.offset == 0 && d.header == nil {
+		d.setHeader(frag)
+	}
+
+	if max(frag.offset+frag.length, d.end()) > d.maxLength {
+		r.stats.Oversized++
+		r.remove(d)
+		return false
+	}
+
+	switch d.add(frag) {
+	case fragmentDuplicate:
+		r.stats.Duplicates++
+		return false
+	case fragmentOverlap:
+		r.stats.Overlaps++
+		r.remove(d)
+		return false
+	case fragmentTooMany:
+		r.stats.Malformed++
+		r.remove(d)
+		return false
+	}
+	r.memory += frag.length
+
+	if d.complete() {
+		r.remove(d)
+		r.stats.Reassembled++
+		d.decode(packet, out)
+		return true
+	}
+
+	for r.memory > r.config.MaxMemory && r.order.Len() > 0 {
+		r.remove(r.order.Front().Value.(*pendingDatagram))
+		r.stats.Evictions++
+	}
+	return false
+}
+
+// lookup finds or creates the datagram a fragment belongs to.
+func (r *Reassembler) lookup(key fragmentKey, timestamp time.Time) *pendingDatagram {
+	if element, exists := r.datagrams[key]; exists {
+		return element.Value.(*pendingDatagram)
+	}
+
+	if r.order.Len() >= r.config.MaxDatagrams {
+		r.remove(r.order.Front().Value.(*pendingDatagram))
+		r.stats.Evictions++
+	}
+
+	d := &pendingDatagram{
+		key:       key,
+		firstSeen: timestamp,
+		maxLength: maxIPDatagramPayload,
+		total:     -1,
+	}
+	r.datagrams[key] = r.order.PushBack(d)
+	return d
+}
+
+func (r *Reassembler) remove(d *pendingDatagram) {
+	element, exists := r.datagrams[d.key]
+	if !exists {
+		return
+	}
+	delete(r.datagrams, d.key)
+	r.order.Remove(element)
+	r.memory -= d.size
+}
+
+// Expire drops datagrams whose fragments have not all arrived within the
+// timeout and returns the number dropped. Reassemble also expires datagrams
+// as it goes, so this is only needed while no fragments are arriving.
+func (r *Reassembler) Expire(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.expire(now)
+}
+
+func (r *Reassembler) expire(now time.Time) int {
+	removed := 0
+	for r.order.Len() > 0 {
+		d := r.order.Front().Value.(*pendingDatagram)
+		if now.Sub(d.firstSeen) <= r.config.Timeout {
+			break
+		}
+		r.remove(d)
+		removed++
+	}
+	r.stats.Timeouts += uint64(removed)
+	return removed
+}
+
+func (r *Reassembler) GetStatistics() ReassemblyStatistics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := r.stats
+	stats.Pending = r.order.Len()
+	stats.MemoryBytes = r.memory
+	return stats
+}
+
+func (d *pendingDatagram) setHeader(frag *fragmentInfo) {
+	d.header = append([]byte(nil), frag.header...)
+	d.nextHeader = frag.nextHeader
+	if frag.key.src.Is4() {
+		d.maxLength = maxIPDatagramPayload - len(d.header)
+	} else {
+		d.maxLength = maxIPDatagramPayload - (len(d.header) - IPv6HeaderSize)
+	}
+}
+
+type fragmentResult int
+
+const (
+	fragmentAdded fragmentResult = iota
+	fragmentDuplicate
+	fragmentOverlap
+	fragmentTooMany
+)
+
+func (d *pendingDatagram) add(frag *fragmentInfo) fragmentResult {
+	end := frag.offset + frag.length
+
+	if !frag.more {
+		if d.total >= 0 && d.total != end {
+			return fragmentOverlap
+		}
+		if n := len(d.fragments); n > 0 && d.fragments[n-1].end() > end {
+			return fragmentOverlap
+		}
+		d.total = end
+	} else if d.total >= 0 && end > d.total {
+		return fragmentOverlap
+	}
+
+	if frag.length == 0 {
+		return fragmentAdded
+	}
+
+	i := sort.Search(len(d.fragments), func(i int) bool {
+		return d.fragments[i].offset >= frag.offset
+	})
+	if i < len(d.fragments) && d.fragments[i].offset == frag.offset && len(d.fragments[i].data) == frag.length {
+		if bytes.Equal(d.fragments[i].data, frag.payload) {
+			return fragmentDuplicate
+		}
+		return fragmentOverlap
+	}
+	if i > 0 && d.fragments[i-1].end() > frag.offset {
+		return fragmentOverlap
+	}
+	if i < len(d.fragments) && d.fragments[i].offset < end {
+		return fragmentOverlap
+	}
+	if len(d.fragments) >= maxFragmentsPerDatagram {
+		return fragmentTooMany
+	}
+
+	d.fragments = append(d.fragments, fragment{})
+	copy(d.fragments[i+1:], d.fragments[i:])
+	d.fragments[i] = fragment{offset: frag.offset, data: append([]byte(nil), frag.payload...)}
+	d.size += frag.length
+	return fragmentAdded
+}
+
+// end returns the end of the furthest fragment buffered so far.
+func (d *pendingDatagram) end() int {
+	if d.total >= 0 {
+		return d.total
+	}
+	if n := len(d.fragments); n > 0 {
+		return d.fragments[n-1].end()
+	}
+	return 0
+}
+
+func (d *pendingDatagram) complete() bool {
+	if d.total < 0 || d.header == nil {
+		return false
+	}
+	next := 0
+	for _, f := range d.fragments {
+		if f.offset != next {
+			return false
+		}
+		next = f.end()
+	}
+	return next == d.total
+}
+
+// decode rebuilds the datagram with the fragmentation fields cleared and
+// decodes it into out under the outer layers of packet.
+func (d *pendingDatagram) decode(packet, out *ParsedPacket) {
+	for ; packet.Inner != nil; packet = packet.Inner {
+		out.reset(packet.state)
+		out.copyTunnel(packet)
+		out.Inner = out.innerPacket()
+		out = out.Inner
+	}
+
+	datagram := make([]byte, len(d.header)+d.total)
+	copy(datagram, d.header)
+	for _, f := range d.fragments {
+		copy(datagram[len(d.header)+f.offset:], f.data)
+	}
+
+	etherType := uint16(EtherTypeIPv4)
+	if d.key.src.Is4() {
+		binary.BigEndian.PutUint16(datagram[2:4], uint16(len(datagram)))
+		datagram[6] &= 0x40 // keep DF, clear MF and the offset
+		datagram[7] = 0
+		binary.BigEndian.PutUint16(datagram[10:12], 0)
+		binary.BigEndian.PutUint16(datagram[10:12], ^checksumFold(checksumAdd(0, datagram[:len(d.header)])))
+	} else {
+		etherType = EtherTypeIPv6
+		binary.BigEndian.PutUint16(datagram[4:6], uint16(len(datagram)-IPv6HeaderSize))
+		datagram[d.nextHeader] = d.key.protocol
+	}
+
+	// The kernel's checksum verdict was for a fragment, not the datagram.
+	state := packet.state
+	state.checksumOffloaded = false
+	state.checksumVerified = false
+	out.reset(state)
+	out.copyLink(packet)
+
+	offset := 0
+	if err := parseEtherTypePayload(out, etherType, datagram, &offset); err != nil {
+		out.setError(err)
+		return
+	}
+	out.setPayload(datagram, offset)
+}
+
+// copyLink copies the link layer headers of packet.
+func (p *ParsedPacket) copyLink(packet *ParsedPacket) {
+	if packet.Ethernet != nil {
+		p.ethernet = packet.ethernet
+		p.Ethernet = &p.ethernet
+		p.Layers.add(LayerEthernet)
+	}
+	if packet.LinuxSLL != nil {
+		p.linuxSLL = packet.linuxSLL
+		p.LinuxSLL = &p.linuxSLL
+		p.Layers.add(LayerLinuxSLL)
+	}
+	if packet.Loopback != nil {
+		p.loopback = packet.loopback
+		p.Loopback = &p.loopback
+		p.Layers.add(LayerLoopback)
+	}
+	if len(packet.VLANs) > 0 {
+		p.VLANs = append(p.VLANs, packet.VLANs...)
+		p.Layers.add(LayerVLAN)
+	}
+	if len(packet.MPLS) > 0 {
+		p.MPLS = append(p.MPLS, packet.MPLS...)
+		p.Layers.add(LayerMPLS)
+	}
+}
+
+// copyTunnel copies the headers of packet that carry its Inner packet.
+func (p *ParsedPacket) copyTunnel(packet *ParsedPacket) {
+	p.copyLink(packet)
+	if packet.IPv4 != nil {
+		p.ipv4 = *packet.IPv4
+		p.IPv4 = &p.ipv4
+		p.Layers.add(LayerIPv4)
+	}
+	if packet.IPv6 != nil {
+		p.ipv6 = *packet.IPv6
+		p.ipv6.ExtensionHeaders = append([]IPv6ExtensionHeader(nil), packet.IPv6.ExtensionHeaders...)
+		if packet.IPv6.Fragment != nil {
+			p.ipv6.Fragment = &p.ipv6.fragment
+		}
+		p.IPv6 = &p.ipv6
+		p.Layers.add(LayerIPv6)
+	}
+	if packet.UDP != nil {
+		p.udp = *packet.UDP
+		p.UDP = &p.udp
+		p.Layers.add(LayerUDP)
+	}
+	if packet.Tunnel != nil {
+		p.tunnel = *packet.Tunnel
+		p.Tunnel = &p.tunnel
+		p.Layers.add(LayerTunnel)
+	}
+	p.Checksums = packet.Checksums
+}
@@ -22,6 +22,16 @@ var (
 
 type PacketHandler func(data []byte, timestamp time.Time)
 
+// FrameInfo is the per-frame metadata the kernel stores alongside each frame
+// in the ring.
+type FrameInfo struct {
+	Timestamp time.Time
+	Length    uint32 // original length on the wire
+	Status    uint32 // TP_STATUS_* flags
+}
+
+type FrameHandler func(data []byte, info FrameInfo)
+
 type RingBuffer struct {
 	mu          *sync.RWMutex
 	logger      *slog.Logger
@@ -97,6 +107,13 @@ func NewRingBuffer(socket int, blockSize, blockCount uint32, logger *slog.Logger
 }
 
 func (rb *RingBuffer) ProcessPackets(handler PacketHandler) error {
+	return rb.ProcessFrames(func(data []byte, info FrameInfo) {
+		handler(data, info.Timestamp)
+	})
+}
+
+// ProcessFrames is ProcessPackets with the kernel's frame metadata.
+func (rb *RingBuffer) ProcessFrames(handler FrameHandler) error {
 	rb.mu.RLock()
 	defer rb.mu.RUnlock()
 
@@ -140,7 +157,7 @@ func (rb *RingBuffer) ProcessPackets(handler PacketHandler) error {
 	return nil
 }
 
-func (rb *RingBuffer) processBlockPackets(blockData []byte, blockHdr *tpacketHdrV1, handler PacketHandler) (uint32, error) {
+func (rb *RingBuffer) processBlockPackets(blockData []byte, blockHdr *tpacketHdrV1, handler FrameHandler) (uint32, error) {
 	packetOffset := int(blockHdr.offsetToFirst)
 	packetsProcessed := uint32(0)
 	maxPackets := blockHdr.numPkts
@@ -172,9 +189,11 @@ func (rb *RingBuffer) processBlockPackets(blockData []byte, blockHdr *tpacketHdr
 		}
 
 		payload := packetData[payloadOffset:payloadEnd]
-		timestamp := time.Unix(int64(packetHdr.sec), int64(packetHdr.nsec))
-
-		handler(payload, timestamp)
+		handler(payload, FrameInfo{
+			Timestamp: time.Unix(int64(packetHdr.sec), int64(packetHdr.nsec)),
+			Length:    packetHdr.len,
+			Status:    packetHdr.status,
+		})
 		packetsProcessed++
 		
 		if packetHdr.nextOffset == 0 {
@@ -0,0 +1,129 @@
+package capture
+
+import (
+	"encoding/binary"
+	"encoding/json"
+)
+
+// TCPOptions holds the decoded TCP options of a segment. The Has* flags tell
+// an absent option from one carrying a zero value. Kinds lists every option
+// kind in wire order, including NOP and EOL, for fingerprinting.
+type TCPOptions struct {
+	MSS            uint16         `json:"mss"`
+	HasMSS         bool           `json:"has_mss"`
+	WindowScale    uint8          `json:"window_scale"`
+	HasWindowScale bool           `json:"has_window_scale"`
+	SACKPermitted  bool           `json:"sack_permitted"`
+	SACKBlocks     []TCPSACKBlock `json:"sack_blocks"`
+	TSVal          uint32         `json:"ts_val"`
+	TSEcr          uint32         `json:"ts_ecr"`
+	HasTimestamps  bool           `json:"has_timestamps"`
+	Unknown        []TCPOption    `json:"unknown"`
+	Kinds          []uint8        `json:"kinds"`
+	Malformed      bool           `json:"malformed"`
+}
+
+type TCPSACKBlock struct {
+	Left  uint32 `json:"left"`
+	Right uint32 `json:"right"`
+}
+
+// TCPOption is an option this package does not decode. Data aliases the
+// packet buffer.
+type TCPOption struct {
+	Kind uint8  `json:"kind"`
+	Data []byte `json:"data"`
+}
+
+const (
+	TCPOptionEOL           = 0
+	TCPOptionNOP           = 1
+	TCPOptionMSS           = 2
+	TCPOptionWindowScale   = 3
+	TCPOptionSACKPermitted = 4
+	TCPOptionSACK          = 5
+	TCPOptionTimestamps    = 8
+)
+
+// MarshalJSON renders Kinds as numbers rather than the base64 string
+// encoding/json uses for byte slices.
+func (o TCPOptions) MarshalJSON() ([]byte, error) {
+	type options TCPOptions
+	kinds := make([]int, len(o.Kinds))
+	for i, kind := range o.Kinds {
+		kinds[i] = int(kind)
+	}
+	return json.Marshal(struct {
+		options
+		Kinds []int `json:"kinds"`
+	}{options(o), kinds})
+}
+
+// reset returns empty options that keep the capacity of the slices.
+func (o *TCPOptions) reset() TCPOptions {
+	return TCPOptions{
+		SACKBlocks: o.SACKBlocks[:0],
+		Unknown:    o.Unknown[:0],
+		Kinds:      o.Kinds[:0],
+	}
+}
+
+// parseTCPOptions decodes the option bytes between the fixed TCP header and
+// the data offset. A malformed option stops decoding and sets Malformed; the
+// options decoded before it are kept.
+func parseTCPOptions(options *TCPOptions, data []byte) {
+	for offset := 0; offset < len(data); {
+		kind := data[offset]
+		options.Kinds = append(options.Kinds, kind)
+
+		switch kind {
+		case TCPOptionEOL:
+			return
+		case TCPOptionNOP:
+			offset++
+			continue
+		}
+
+		if offset+1 >= len(data) {
+			options.Malformed = true
+			return
+		}
+		length := int(data[offset+1])
+		if length < 2 || offset+length > len(data) {
+			options.Malformed = true
+			return
+		}
+		body := data[offset+2 : offset+length]
+
+		switch {
+		case kind == TCPOptionMSS && len(body) == 2:
+			options.MSS = binary.BigEndian.Uint16(body)
+			options.HasMSS = true
+		case kind == TCPOptionWindowScale && len(body) == 1:
+			options.WindowScale = body[0]
+			options.HasWindowScale = true
+		case kind == TCPOptionSACKPermitted && len(body) == 0:
+			options.SACKPermitted = true
+		case kind == TCPOptionSACK && len(body) > 0 && len(body)%8 == 0:
+			for i := 0; i < len(body); i += 8 {
+				options.SACKBlocks = append(options.SACKBlocks, TCPSACKBlock{
+					Left:  binary.BigEndian.Uint32(body[i : i+4]),
+					Right: binary.BigEndian.Uint32(body[i+4 : i+8]),
+				})
+			}
+		case kind == TCPOptionTimestamps && len(body) == 8:
+			options.TSVal = binary.BigEndian.Uint32(body[0:4])
+			options.TSEcr = binary.BigEndian.Uint32(body[4:8])
+			options.HasTimestamps = true
+		case kind == TCPOptionMSS, kind == TCPOptionWindowScale, kind == TCPOptionSACKPermitted,
+			kind == TCPOptionSACK, kind == TCPOptionTimestamps:
+			// Known kind with the wrong length.
+			options.Malformed = true
+			return
+		default:
+			options.Unknown = append(options.Unknown, TCPOption{Kind: kind, Data: body})
+		}
+
+		offset += length
+	}
+}
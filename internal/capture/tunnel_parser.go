@@ -0,0 +1,314 @@
+package capture
+
+import (
+	"encoding/binary"
+)
+
+type TunnelType string
+
+const (
+	TunnelGRE        TunnelType = "gre"
+	TunnelERSPAN     TunnelType = "erspan"
+	TunnelVXLAN      TunnelType = "vxlan"
+	TunnelGENEVE     TunnelType = "geneve"
+	TunnelIPv4InIPv4 TunnelType = "ipip"
+	TunnelIPv6InIPv4 TunnelType = "6in4"
+	TunnelIPv4InIPv6 TunnelType = "4in6"
+	TunnelIPv6InIPv6 TunnelType = "ip6ip6"
+)
+
+// TunnelHeader describes the encapsulation found in a packet; the
+// decapsulated packet is in ParsedPacket.Inner. Fields not used by Type are
+// left zero. ID is the VXLAN/GENEVE VNI, the GRE key or the ERSPAN session.
+type TunnelHeader struct {
+	Type          TunnelType `json:"type"`
+	ID            uint32     `json:"id"`
+	HasID         bool       `json:"has_id"`
+	Protocol      uint16     `json:"protocol"`
+	GREFlags      uint16     `json:"gre_flags"`
+	GRESequence   uint32     `json:"gre_sequence"`
+	HasSequence   bool       `json:"has_sequence"`
+	ERSPANVersion uint8      `json:"erspan_version"`
+	ERSPANVLAN    uint16     `json:"erspan_vlan"`
+	OptionsLength int        `json:"options_length"`
+	HeaderLength  int        `json:"header_length"`
+}
+
+const (
+	IPProtoIPIP = 4
+	IPProtoIPv6 = 41
+	IPProtoGRE  = 47
+
+	EtherTypeTransparentBridging = 0x6558
+	EtherTypeERSPANTypeII        = 0x88BE
+	EtherTypeERSPANTypeIII       = 0x22EB
+
+	VXLANPort  = 4789
+	GENEVEPort = 6081
+
+	GREHeaderMinSize    = 4
+	VXLANHeaderSize     = 8
+	GENEVEHeaderMinSize = 8
+	ERSPANIIHeaderSize  = 8
+	ERSPANIIIHeaderSize = 12
+
+	greFlagChecksum = 0x8000
+	greFlagKey      = 0x2000
+	greFlagSequence = 0x1000
+	greVersionMask  = 0x0007
+)
+
+// Innermost returns the most deeply decapsulated packet, or the packet
+// itself when it carries no tunnel.
+func (p *ParsedPacket) Innermost() *ParsedPacket {
+	current := p
+	for current.Inner != nil {
+		current = current.Inner
+	}
+	return current
+}
+
+// Tunnels returns the tunnel headers from the outermost to the innermost.
+func (p *ParsedPacket) Tunnels() []*TunnelHeader {
+	var tunnels []*TunnelHeader
+	for current := p; current != nil && current.Tunnel != nil; current = current.Inner {
+		tunnels = append(tunnels, current.Tunnel)
+	}
+	return tunnels
+}
+
+func (p *ParsedPacket) canDecapsulate() bool {
+	return p.state.tunnelDepth < p.state.maxTunnelDepth
+}
+
+func parseIPTunnel(packet *ParsedPacket, protocol uint8, data []byte, offset *int) error {
+	if !packet.canDecapsulate() {
+		return nil
+	}
+
+	switch protocol {
+	case IPProtoIPIP:
+		tunnelType := TunnelIPv4InIPv4
+		if packet.IPv6 != nil {
+			tunnelType = TunnelIPv4InIPv6
+		}
+		packet.tunnel = TunnelHeader{Type: tunnelType, Protocol: EtherTypeIPv4}
+		packet.setTunnel(*offset, *offset)
+		decapsulate(packet, EtherTypeIPv4, data, *offset)
+	case IPProtoIPv6:
+		tunnelType := TunnelIPv6InIPv4
+		if packet.IPv6 != nil {
+			tunnelType = TunnelIPv6InIPv6
+		}
+		packet.tunnel = TunnelHeader{Type: tunnelType, Protocol: EtherTypeIPv6}
+		packet.setTunnel(*offset, *offset)
+		decapsulate(packet, EtherTypeIPv6, data, *offset)
+	case IPProtoGRE:
+		return parseGRE(packet, data, offset)
+	}
+	return nil
+}
+
+func parseGRE(packet *ParsedPacket, data []byte, offset *int) error {
+	gre := data[*offset:]
+	if len(gre) < GREHeaderMinSize {
+		return decodeError(LayerTunnel, DecodeTruncated, "insufficient data for GRE header: need %d, got %d", GREHeaderMinSize, len(gre))
+	}
+
+	tunnel := &packet.tunnel
+	*tunnel = TunnelHeader{
+		Type:     TunnelGRE,
+		GREFlags: binary.BigEndian.Uint16(gre[0:2]),
+		Protocol: binary.BigEndian.Uint16(gre[2:4]),
+	}
+
+	// Version 1 is PPTP's enhanced GRE, which carries PPP rather than
+	// anything decoded here.
+	if tunnel.GREFlags&greVersionMask != 0 {
+		return nil
+	}
+
+	length := GREHeaderMinSize
+	if tunnel.GREFlags&greFlagChecksum != 0 {
+		length += 4
+	}
+	if tunnel.GREFlags&greFlagKey != 0 {
+		if len(gre) < length+4 {
+			return decodeError(LayerTunnel, DecodeTruncated, "insufficient data for GRE key")
+		}
+		tunnel.ID = binary.BigEndian.Uint32(gre[length : length+4])
+		tunnel.HasID = true
+		length += 4
+	}
+	if tunnel.GREFlags&greFlagSequence != 0 {
+		if len(gre) < length+4 {
+			return decodeError(LayerTunnel, DecodeTruncated, "insufficient data for GRE sequence number")
+		}
+		tunnel.GRESequence = binary.BigEndian.Uint32(gre[length : length+4])
+		tunnel.HasSequence = true
+		length += 4
+	}
+	if len(gre) < length {
+		return decodeError(LayerTunnel, DecodeTruncated, "insufficient data for GRE header: need %d, got %d", length, len(gre))
+	}
+
+	innerType := tunnel.Protocol
+	switch tunnel.Protocol {
+	case EtherTypeERSPANTypeII, EtherTypeERSPANTypeIII:
+		erspanLength, err := parseERSPAN(tunnel, gre[length:])
+		if err != nil {
+			return err
+		}
+		length += erspanLength
+		innerType = EtherTypeTransparentBridging
+	}
+
+	tunnel.HeaderLength = length
+	packet.setTunnel(*offset, *offset+length)
+	*offset += length
+	decapsulate(packet, innerType, data, *offset)
+	return nil
+}
+
+// parseERSPAN decodes the ERSPAN type II or III header that follows GRE and
+// reports the session ID as the tunnel ID. Type I has no header and is sent
+// with the GRE sequence bit clear.
+func parseERSPAN(tunnel *TunnelHeader, data []byte) (int, error) {
+	tunnel.Type = TunnelERSPAN
+
+	if tunnel.Protocol == EtherTypeERSPANTypeII && tunnel.GREFlags&greFlagSequence == 0 {
+		tunnel.ERSPANVersion = 0
+		return 0, nil
+	}
+
+	if len(data) < ERSPANIIHeaderSize {
+		return 0, decodeError(LayerTunnel, DecodeTruncated, "insufficient data for ERSPAN header: need %d, got %d", ERSPANIIHeaderSize, len(data))
+	}
+
+	word := binary.BigEndian.Uint32(data[0:4])
+	tunnel.ERSPANVersion = uint8(word >> 28)
+	tunnel.ERSPANVLAN = uint16(word>>16) & 0x0FFF
+	tunnel.ID = word & 0x03FF
+	tunnel.HasID = true
+
+	if tunnel.Protocol == EtherTypeERSPANTypeII {
+		return ERSPANIIHeaderSize, nil
+	}
+
+	if len(data) < ERSPANIIIHeaderSize {
+		return 0, decodeError(LayerTunnel, DecodeTruncated, "insufficient data for ERSPAN type III header: need %d, got %d", ERSPANIIIHeaderSize, len(data))
+	}
+	length := ERSPANIIIHeaderSize
+	if data[11]&0x01 != 0 { // platform-specific subheader present
+		length += 8
+		if len(data) < length {
+			return 0, decodeError(LayerTunnel, DecodeTruncated, "insufficient data for ERSPAN platform subheader")
+		}
+	}
+	return length, nil
+}
+
+func parseUDPTunnel(packet *ParsedPacket, udp *UDPHeader, data []byte, offset *int) error {
+	if !packet.canDecapsulate() {
+		return nil
+	}
+
+	switch udp.DstPort {
+	case VXLANPort:
+		return parseVXLAN(packet, data, offset)
+	case GENEVEPort:
+		return parseGENEVE(packet, data, offset)
+	}
+	return nil
+}
+
+func parseVXLAN(packet *ParsedPacket, data []byte, offset *int) error {
+	vxlan := data[*offset:]
+	if len(vxlan) < VXLANHeaderSize {
+		return decodeError(LayerTunnel, DecodeTruncated, "insufficient data for VXLAN header: need %d, got %d", VXLANHeaderSize, len(vxlan))
+	}
+
+	// Without the I flag the VNI is not valid and this is not VXLAN.
+	if vxlan[0]&0x08 == 0 {
+		return nil
+	}
+
+	packet.tunnel = TunnelHeader{
+		Type:         TunnelVXLAN,
+		ID:           binary.BigEndian.Uint32(vxlan[4:8]) >> 8,
+		HasID:        true,
+		Protocol:     EtherTypeTransparentBridging,
+		HeaderLength: VXLANHeaderSize,
+	}
+	packet.setTunnel(*offset, *offset+VXLANHeaderSize)
+	*offset += VXLANHeaderSize
+	decapsulate(packet, EtherTypeTransparentBridging, data, *offset)
+	return nil
+}
+
+func parseGENEVE(packet *ParsedPacket, data []byte, offset *int) error {
+	geneve := data[*offset:]
+	if len(geneve) < GENEVEHeaderMinSize {
+		return decodeError(LayerTunnel, DecodeTruncated, "insufficient data for GENEVE header: need %d, got %d", GENEVEHeaderMinSize, len(geneve))
+	}
+
+	if geneve[0]>>6 != 0 {
+		return decodeError(LayerTunnel, DecodeBadVersion, "unsupported GENEVE version: %d", geneve[0]>>6)
+	}
+
+	optionsLength := int(geneve[0]&0x3F) * 4
+	length := GENEVEHeaderMinSize + optionsLength
+	if len(geneve) < length {
+		return decodeError(LayerTunnel, DecodeTruncated, "insufficient data for GENEVE options: need %d, got %d", length, len(geneve))
+	}
+
+	packet.tunnel = TunnelHeader{
+		Type:          TunnelGENEVE,
+		ID:            binary.BigEndian.Uint32(geneve[4:8]) >> 8,
+		HasID:         true,
+		Protocol:      binary.BigEndian.Uint16(geneve[2:4]),
+		OptionsLength: optionsLength,
+		HeaderLength:  length,
+	}
+	packet.setTunnel(*offset, *offset+length)
+	*offset += length
+	decapsulate(packet, packet.tunnel.Protocol, data, *offset)
+	return nil
+}
+
+// decapsulate parses the encapsulated frame or datagram starting at
+// data[start] into packet.Inner. Inner parse errors are left in Inner.Err and
+// never fail the outer packet.
+func decapsulate(packet *ParsedPacket, innerType uint16, data []byte, start int) {
+	data = data[start:]
+	if len(data) == 0 {
+		return
+	}
+
+	switch innerType {
+	case EtherTypeTransparentBridging, EtherTypeIPv4, EtherTypeIPv6:
+	default:
+		return
+	}
+
+	inner := packet.innerPacket()
+	inner.base = packet.base + start
+	packet.Inner = inner
+
+	if innerType == EtherTypeTransparentBridging {
+		inner.decodeFrame(data)
+		return
+	}
+
+	offset := 0
+	if err := parseEtherTypePayload(inner, innerType, data, &offset); err != nil {
+		inner.setError(err)
+		return
+	}
+	inner.setPayload(data, offset)
+}
+
+func (p *ParsedPacket) setTunnel(start, end int) {
+	p.Tunnel = &p.tunnel
+	p.addLayer(LayerTunnel, start, end)
+}
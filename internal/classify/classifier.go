@@ -0,0 +1,347 @@
+// Package classify labels flows with the application protocol they carry,
+// combining user rules, decoded protocol metadata, payload signatures and
+// port numbers.
+package classify
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Application names. Ports only known from the services file are labelled
+// with the file's service names.
+const (
+	AppAMQP          = "amqp"
+	AppBitTorrent    = "bittorrent"
+	AppDHCP          = "dhcp"
+	AppDNS           = "dns"
+	AppElasticsearch = "elasticsearch"
+	AppFTP           = "ftp"
+	AppHTTP          = "http"
+	AppHTTP2         = "http2"
+	AppHTTP3         = "http3"
+	AppHTTPS         = "https"
+	AppIKE           = "ike"
+	AppIMAP          = "imap"
+	AppLDAP          = "ldap"
+	AppMDNS          = "mdns"
+	AppMemcached     = "memcached"
+	AppMongoDB       = "mongodb"
+	AppMQTT          = "mqtt"
+	AppMSSQL         = "mssql"
+	AppMySQL         = "mysql"
+	AppNTP           = "ntp"
+	AppPOP3          = "pop3"
+	AppPostgreSQL    = "postgresql"
+	AppQUIC          = "quic"
+	AppRDP           = "rdp"
+	AppRedis         = "redis"
+	AppSIP           = "sip"
+	AppSMB           = "smb"
+	AppSMTP          = "smtp"
+	AppSNMP          = "snmp"
+	AppSSH           = "ssh"
+	AppSTUN          = "stun"
+	AppSyslog        = "syslog"
+	AppTelnet        = "telnet"
+	AppTLS           = "tls"
+	AppWireGuard     = "wireguard"
+)
+
+// Confidence says how much a classification can be trusted.
+type Confidence uint8
+
+const (
+	ConfidenceNone Confidence = iota
+	// ConfidenceLow is a guess from a port number alone.
+	ConfidenceLow
+	// ConfidenceMedium is a payload signature that other protocols could
+	// plausibly match.
+	ConfidenceMedium
+	// ConfidenceHigh is a distinctive payload signature, a weaker one
+	// confirmed by the port, a protocol analyzer's decode or a user rule.
+	ConfidenceHigh
+)
+
+func (c Confidence) String() string {
+	switch c {
+	case ConfidenceNone:
+		return "none"
+	case ConfidenceLow:
+		return "low"
+	case ConfidenceMedium:
+		return "medium"
+	case ConfidenceHigh:
+		return "high"
+	default:
+		return fmt.Sprintf("confidence(%d)", uint8(c))
+	}
+}
+
+func (c Confidence) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// Method is what a classification was based on.
+type Method uint8
+
+const (
+	MethodNone Method = iota
+	MethodPort
+	MethodPayload
+	MethodMetadata
+	MethodRule
+)
+
+func (m Method) String() string {
+	switch m {
+	case MethodNone:
+		return "none"
+	case MethodPort:
+		return "port"
+	case MethodPayload:
+		return "payload"
+	case MethodMetadata:
+		return "metadata"
+	case MethodRule:
+		return "rule"
+	default:
+		return fmt.Sprintf("method(%d)", uint8(m))
+	}
+}
+
+func (m Method) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// Result is a flow's classification. App is empty when nothing matched.
+type Result struct {
+	App        string     `json:"app"`
+	Confidence Confidence `json:"confidence"`
+	Method     Method     `json:"method"`
+}
+
+// Metadata is what the protocol analyzers decoded from a flow.
+type Metadata struct {
+	// Protocol is the application an analyzer decoded, such as AppTLS,
+	// AppQUIC, AppHTTP, AppDNS or AppDHCP.
+	Protocol string
+	// ALPN is the negotiated application protocol, or the client's first
+	// offer when the server's answer was not seen.
+	ALPN string
+	// Hostname is the TLS server name, HTTP host or queried DNS name.
+	Hostname string
+}
+
+// Flow is what the classifier is told about a flow. The client is the side
+// believed to have opened it.
+type Flow struct {
+	Transport     uint8 // capture.IPProtoTCP or IPProtoUDP
+	ClientIP      netip.Addr
+	ServerIP      netip.Addr
+	ClientPort    uint16
+	ServerPort    uint16
+	ClientPayload []byte // start of the first payload sent by the client
+	ServerPayload []byte // start of the first payload sent by the server
+	Metadata      Metadata
+}
+
+type ClassifierConfig struct {
+	// ServicesFile names ports beyond the built-in table, in services(5)
+	// format. A missing file is skipped.
+	ServicesFile string
+	Rules        []Rule
+}
+
+type ClassifierStatistics struct {
+	Classified uint64 `json:"classified"`
+	Unknown    uint64 `json:"unknown"`
+	ByRule     uint64 `json:"by_rule"`
+	ByMetadata uint64 `json:"by_metadata"`
+	ByPayload  uint64 `json:"by_payload"`
+	ByPort     uint64 `json:"by_port"`
+	Services   int    `json:"services"`
+	Rules      int    `json:"rules"`
+}
+
+// Classifier labels flows with an application. It keeps no per-flow state,
+// so callers classify again as a flow reveals more.
+type Classifier struct {
+	mu       *sync.RWMutex
+	logger   *slog.Logger
+	config   ClassifierConfig
+	services map[portKey]string
+	stats    ClassifierStatistics
+}
+
+func DefaultClassifierConfig() ClassifierConfig {
+	return ClassifierConfig{
+		ServicesFile: "/etc/services",
+	}
+}
+
+func NewClassifier(logger *slog.Logger) *Classifier {
+	return NewClassifierWithConfig(logger, DefaultClassifierConfig())
+}
+
+func NewClassifierWithConfig(logger *slog.Logger, config ClassifierConfig) *Classifier {
+	defaults := DefaultClassifierConfig()
+	if config.ServicesFile == "" {
+		config.ServicesFile = defaults.ServicesFile
+	}
+
+	c := &Classifier{
+		mu:       &sync.RWMutex{},
+		logger:   logger,
+		config:   config,
+		services: make(map[portKey]string),
+	}
+	c.loadServices()
+	c.stats.Services = len(c.services)
+	c.stats.Rules = len(config.Rules)
+	return c
+}
+
+func (c *Classifier) loadServices() {
+	file, err := os.Open(c.config.ServicesFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.logger.Debug("services file not found", slog.String("path", c.config.ServicesFile))
+		return
+	}
+	if err != nil {
+		c.logger.Warn("failed to open services file",
+			slog.String("path", c.config.ServicesFile),
+			slog.String("error", err.Error()))
+		return
+	}
+	defer file.Close()
+
+	services, err := parseServices(file)
+	if err != nil {
+		c.logger.Warn("failed to load services file",
+			slog.String("path", c.config.ServicesFile),
+			slog.String("error", err.Error()))
+		return
+	}
+	c.services = services
+	c.logger.Debug("loaded services file",
+		slog.String("path", c.config.ServicesFile),
+		slog.Int("ports", len(services)))
+}
+
+// Classify labels a flow from the strongest evidence available: the first
+// matching rule, then analyzer metadata, then payload signatures and last
+// the port numbers.
+func (c *Classifier) Classify(flow *Flow) Result {
+	result := c.classify(flow)
+
+	c.mu.Lock()
+	switch result.Method {
+	case MethodRule:
+		c.stats.ByRule++
+	case MethodMetadata:
+		c.stats.ByMetadata++
+	case MethodPayload:
+		c.stats.ByPayload++
+	case MethodPort:
+		c.stats.ByPort++
+	}
+	if result.Method == MethodNone {
+		c.stats.Unknown++
+	} else {
+		c.stats.Classified++
+	}
+	c.mu.Unlock()
+
+	return result
+}
+
+func (c *Classifier) classify(flow *Flow) Result {
+	for i := range c.config.Rules {
+		if c.config.Rules[i].matches(flow) {
+			return Result{App: c.config.Rules[i].App, Confidence: ConfidenceHigh, Method: MethodRule}
+		}
+	}
+
+	if flow.Metadata.Protocol != "" {
+		return Result{App: metadataApp(&flow.Metadata), Confidence: ConfidenceHigh, Method: MethodMetadata}
+	}
+
+	portApp := c.portApp(flow)
+
+	if sig := matchSignature(flow); sig != nil {
+		result := Result{App: sig.app, Confidence: sig.confidence, Method: MethodPayload}
+		// TLS on an HTTPS port is as good as HTTPS.
+		if sig.app == AppTLS && portApp == AppHTTPS {
+			result.App = AppHTTPS
+		}
+		if result.App == portApp {
+			result.Confidence = ConfidenceHigh
+		}
+		return result
+	}
+
+	if portApp != "" {
+		return Result{App: portApp, Confidence: ConfidenceLow, Method: MethodPort}
+	}
+	return Result{}
+}
+
+// metadataApp refines the analyzer's protocol with the ALPN protocol it
+// carries.
+func metadataApp(md *Metadata) string {
+	switch {
+	case md.Protocol == AppTLS && (md.ALPN == "h2" || strings.HasPrefix(md.ALPN, "http/")):
+		return AppHTTPS
+	case md.Protocol == AppTLS && md.ALPN == "dot":
+		return AppDNS
+	case md.Protocol == AppQUIC && strings.HasPrefix(md.ALPN, "h3"):
+		return AppHTTP3
+	case md.Protocol == AppQUIC && md.ALPN == "doq":
+		return AppDNS
+	}
+	return md.Protocol
+}
+
+func matchSignature(flow *Flow) *signature {
+	for i := range signatures {
+		sig := &signatures[i]
+		if sig.transport != 0 && sig.transport != flow.Transport {
+			continue
+		}
+		if sig.direction != fromServer && len(flow.ClientPayload) > 0 && sig.match(flow.ClientPayload) {
+			return sig
+		}
+		if sig.direction != fromClient && len(flow.ServerPayload) > 0 && sig.match(flow.ServerPayload) {
+			return sig
+		}
+	}
+	return nil
+}
+
+// portApp names the application registered for the server port, or failing
+// that the client port in case the flow's direction was guessed wrong.
+func (c *Classifier) portApp(flow *Flow) string {
+	for _, port := range []uint16{flow.ServerPort, flow.ClientPort} {
+		key := portKey{flow.Transport, port}
+		if app, ok := builtinPorts[key]; ok {
+			return app
+		}
+		if app, ok := c.services[key]; ok {
+			return app
+		}
+	}
+	return ""
+}
+
+func (c *Classifier) GetStatistics() ClassifierStatistics {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.stats
+}
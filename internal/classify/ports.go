@@ -0,0 +1,109 @@
+package classify
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+)
+
+type portKey struct {
+	transport uint8
+	port      uint16
+}
+
+// builtinPorts names the applications NetWatch expects on well-known ports.
+// They take precedence over the services file, whose names are less
+// consistent ("domain", "ms-wbt-server").
+var builtinPorts = map[portKey]string{
+	{capture.IPProtoTCP, 20}:    AppFTP,
+	{capture.IPProtoTCP, 21}:    AppFTP,
+	{capture.IPProtoTCP, 22}:    AppSSH,
+	{capture.IPProtoTCP, 23}:    AppTelnet,
+	{capture.IPProtoTCP, 25}:    AppSMTP,
+	{capture.IPProtoTCP, 53}:    AppDNS,
+	{capture.IPProtoUDP, 53}:    AppDNS,
+	{capture.IPProtoUDP, 67}:    AppDHCP,
+	{capture.IPProtoUDP, 68}:    AppDHCP,
+	{capture.IPProtoTCP, 80}:    AppHTTP,
+	{capture.IPProtoTCP, 110}:   AppPOP3,
+	{capture.IPProtoUDP, 123}:   AppNTP,
+	{capture.IPProtoTCP, 143}:   AppIMAP,
+	{capture.IPProtoUDP, 161}:   AppSNMP,
+	{capture.IPProtoUDP, 162}:   AppSNMP,
+	{capture.IPProtoTCP, 389}:   AppLDAP,
+	{capture.IPProtoTCP, 443}:   AppHTTPS,
+	{capture.IPProtoUDP, 443}:   AppQUIC,
+	{capture.IPProtoTCP, 445}:   AppSMB,
+	{capture.IPProtoUDP, 500}:   AppIKE,
+	{capture.IPProtoUDP, 514}:   AppSyslog,
+	{capture.IPProtoUDP, 546}:   AppDHCP,
+	{capture.IPProtoUDP, 547}:   AppDHCP,
+	{capture.IPProtoTCP, 587}:   AppSMTP,
+	{capture.IPProtoTCP, 636}:   AppLDAP,
+	{capture.IPProtoTCP, 853}:   AppDNS,
+	{capture.IPProtoTCP, 993}:   AppIMAP,
+	{capture.IPProtoTCP, 995}:   AppPOP3,
+	{capture.IPProtoTCP, 1433}:  AppMSSQL,
+	{capture.IPProtoTCP, 1883}:  AppMQTT,
+	{capture.IPProtoTCP, 3306}:  AppMySQL,
+	{capture.IPProtoTCP, 3389}:  AppRDP,
+	{capture.IPProtoUDP, 3478}:  AppSTUN,
+	{capture.IPProtoUDP, 4500}:  AppIKE,
+	{capture.IPProtoTCP, 5060}:  AppSIP,
+	{capture.IPProtoUDP, 5060}:  AppSIP,
+	{capture.IPProtoUDP, 5353}:  AppMDNS,
+	{capture.IPProtoTCP, 5432}:  AppPostgreSQL,
+	{capture.IPProtoTCP, 5672}:  AppAMQP,
+	{capture.IPProtoTCP, 6379}:  AppRedis,
+	{capture.IPProtoTCP, 8080}:  AppHTTP,
+	{capture.IPProtoTCP, 8443}:  AppHTTPS,
+	{capture.IPProtoTCP, 9200}:  AppElasticsearch,
+	{capture.IPProtoTCP, 11211}: AppMemcached,
+	{capture.IPProtoTCP, 27017}: AppMongoDB,
+	{capture.IPProtoUDP, 51820}: AppWireGuard,
+}
+
+// parseServices reads port names from a services(5) file: lines of a name,
+// a port/protocol pair and optional aliases, with # comments. Only TCP and
+// UDP entries are kept; the first name given for a port wins.
+func parseServices(r io.Reader) (map[portKey]string, error) {
+	services := make(map[portKey]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		portText, protocol, ok := strings.Cut(fields[1], "/")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseUint(portText, 10, 16)
+		if err != nil {
+			continue
+		}
+
+		var transport uint8
+		switch protocol {
+		case "tcp":
+			transport = capture.IPProtoTCP
+		case "udp":
+			transport = capture.IPProtoUDP
+		default:
+			continue
+		}
+		key := portKey{transport, uint16(port)}
+		if _, exists := services[key]; !exists {
+			services[key] = strings.ToLower(fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read services: %w", err)
+	}
+	return services, nil
+}
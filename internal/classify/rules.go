@@ -0,0 +1,104 @@
+package classify
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/config"
+)
+
+// Rule is a user-defined classification. A flow matches when every field
+// that is set matches; rules override everything the classifier infers.
+type Rule struct {
+	App       string
+	Transport uint8 // capture.IPProtoTCP or IPProtoUDP, zero for either
+	PortLow   uint16
+	PortHigh  uint16       // with PortLow, a range holding either port
+	Network   netip.Prefix // holding either address
+	Host      string       // hostname, or "*.suffix" for a domain and its subdomains
+	Payload   []byte       // prefix of either direction's first payload
+}
+
+// RulesFromConfig converts the classifier rules of the configuration.
+func RulesFromConfig(rules []config.ClassifierRule) ([]Rule, error) {
+	result := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		rule := Rule{
+			App:      r.App,
+			PortLow:  r.PortLow,
+			PortHigh: r.PortHigh,
+			Host:     strings.ToLower(r.Host),
+		}
+
+		switch r.Transport {
+		case "":
+		case "tcp":
+			rule.Transport = capture.IPProtoTCP
+		case "udp":
+			rule.Transport = capture.IPProtoUDP
+		default:
+			return nil, fmt.Errorf("rule %q: unknown transport %q", r.App, r.Transport)
+		}
+
+		if r.Network != "" {
+			prefix, err := netip.ParsePrefix(r.Network)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", r.App, err)
+			}
+			rule.Network = prefix.Masked()
+		}
+
+		if r.Payload != "" {
+			payload, err := hex.DecodeString(r.Payload)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", r.App, err)
+			}
+			rule.Payload = payload
+		}
+
+		result = append(result, rule)
+	}
+	return result, nil
+}
+
+func (r *Rule) matches(flow *Flow) bool {
+	if r.Transport != 0 && r.Transport != flow.Transport {
+		return false
+	}
+
+	if r.PortHigh != 0 && !r.portMatches(flow.ServerPort) && !r.portMatches(flow.ClientPort) {
+		return false
+	}
+
+	if r.Network.IsValid() && !r.Network.Contains(flow.ServerIP.Unmap()) && !r.Network.Contains(flow.ClientIP.Unmap()) {
+		return false
+	}
+
+	if r.Host != "" && !hostMatches(r.Host, strings.ToLower(flow.Metadata.Hostname)) {
+		return false
+	}
+
+	if len(r.Payload) > 0 && !bytes.HasPrefix(flow.ClientPayload, r.Payload) && !bytes.HasPrefix(flow.ServerPayload, r.Payload) {
+		return false
+	}
+
+	return true
+}
+
+func (r *Rule) portMatches(port uint16) bool {
+	return port >= r.PortLow && port <= r.PortHigh
+}
+
+func hostMatches(pattern, host string) bool {
+	if host == "" {
+		return false
+	}
+	if domain, ok := strings.CutPrefix(pattern, "*."); ok {
+		return host == domain || strings.HasSuffix(host, "."+domain)
+	}
+	return host == pattern
+}
@@ -0,0 +1,193 @@
+package classify
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/quic"
+)
+
+type direction uint8
+
+const (
+	fromEither direction = iota
+	fromClient
+	fromServer
+)
+
+// signature recognises an application from the first payload a flow carries
+// in one direction.
+type signature struct {
+	app        string
+	confidence Confidence
+	transport  uint8 // zero for either
+	direction  direction
+	match      func(payload []byte) bool
+}
+
+// signatures are tried in order, so the specific ones come before those
+// that only check a byte or two.
+var signatures = []signature{
+	{AppSSH, ConfidenceHigh, capture.IPProtoTCP, fromEither, prefix("SSH-")},
+	{AppHTTP2, ConfidenceHigh, capture.IPProtoTCP, fromClient, prefix("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")},
+	{AppHTTP, ConfidenceHigh, capture.IPProtoTCP, fromClient, httpRequest},
+	{AppHTTP, ConfidenceHigh, capture.IPProtoTCP, fromServer, prefix("HTTP/1.")},
+	{AppTLS, ConfidenceHigh, capture.IPProtoTCP, fromClient, tlsHandshake(1)},
+	{AppTLS, ConfidenceHigh, capture.IPProtoTCP, fromServer, tlsHandshake(2)},
+	{AppSMB, ConfidenceHigh, capture.IPProtoTCP, fromEither, smb},
+	{AppPostgreSQL, ConfidenceHigh, capture.IPProtoTCP, fromClient, postgresStartup},
+	{AppRDP, ConfidenceHigh, capture.IPProtoTCP, fromClient, rdpConnectionRequest},
+	{AppMQTT, ConfidenceHigh, capture.IPProtoTCP, fromClient, mqttConnect},
+	{AppBitTorrent, ConfidenceHigh, capture.IPProtoTCP, fromEither, prefix("\x13BitTorrent protocol")},
+	{AppSMTP, ConfidenceHigh, capture.IPProtoTCP, fromClient, anyPrefix("EHLO ", "HELO ")},
+	{AppSMTP, ConfidenceHigh, capture.IPProtoTCP, fromServer, smtpGreeting},
+	{AppSIP, ConfidenceHigh, 0, fromEither, sip},
+	{AppSTUN, ConfidenceHigh, capture.IPProtoUDP, fromEither, stun},
+	{AppMySQL, ConfidenceMedium, capture.IPProtoTCP, fromServer, mysqlGreeting},
+	{AppRedis, ConfidenceMedium, capture.IPProtoTCP, fromClient, redisCommand},
+	{AppMongoDB, ConfidenceMedium, capture.IPProtoTCP, fromClient, mongoMessage},
+	{AppIMAP, ConfidenceMedium, capture.IPProtoTCP, fromServer, prefix("* OK")},
+	{AppPOP3, ConfidenceMedium, capture.IPProtoTCP, fromServer, prefix("+OK")},
+	{AppFTP, ConfidenceMedium, capture.IPProtoTCP, fromClient, anyPrefix("USER ", "AUTH TLS")},
+	{AppQUIC, ConfidenceMedium, capture.IPProtoUDP, fromClient, quicInitial},
+	{AppTLS, ConfidenceMedium, capture.IPProtoTCP, fromEither, tlsRecord},
+}
+
+func prefix(p string) func([]byte) bool {
+	return func(payload []byte) bool {
+		return bytes.HasPrefix(payload, []byte(p))
+	}
+}
+
+func anyPrefix(prefixes ...string) func([]byte) bool {
+	return func(payload []byte) bool {
+		for _, p := range prefixes {
+			if bytes.HasPrefix(payload, []byte(p)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+var httpMethods = []string{"GET ", "POST ", "HEAD ", "PUT ", "DELETE ", "OPTIONS ", "PATCH ", "CONNECT ", "TRACE "}
+
+func httpRequest(payload []byte) bool {
+	return anyPrefix(httpMethods...)(payload) && bytes.Contains(payload[:min(len(payload), 2048)], []byte(" HTTP/1."))
+}
+
+// tlsRecord matches the header of a TLS handshake record.
+func tlsRecord(payload []byte) bool {
+	return len(payload) >= 5 && payload[0] == 0x16 && payload[1] == 0x03 && payload[2] <= 0x04
+}
+
+// tlsHandshake matches a handshake record starting with the given message,
+// ClientHello or ServerHello.
+func tlsHandshake(messageType byte) func([]byte) bool {
+	return func(payload []byte) bool {
+		return tlsRecord(payload) && len(payload) >= 6 && payload[5] == messageType
+	}
+}
+
+// smb matches SMB1 or SMB2 behind the NetBIOS session header used on 445.
+func smb(payload []byte) bool {
+	return len(payload) >= 8 && payload[0] == 0x00 &&
+		(bytes.Equal(payload[4:8], []byte("\xffSMB")) || bytes.Equal(payload[4:8], []byte("\xfeSMB")))
+}
+
+// postgresStartup matches a StartupMessage for protocol 3.0, or the
+// SSLRequest and GSSENCRequest sent before one.
+func postgresStartup(payload []byte) bool {
+	if len(payload) < 8 || int(binary.BigEndian.Uint32(payload)) < 8 {
+		return false
+	}
+	switch binary.BigEndian.Uint32(payload[4:8]) {
+	case 0x00030000, 80877103, 80877104:
+		return true
+	}
+	return false
+}
+
+// rdpConnectionRequest matches a TPKT header carrying an X.224 Connection
+// Request.
+func rdpConnectionRequest(payload []byte) bool {
+	return len(payload) >= 6 && payload[0] == 0x03 && payload[1] == 0x00 && payload[5] == 0xe0
+}
+
+func mqttConnect(payload []byte) bool {
+	if len(payload) < 2 || payload[0] != 0x10 {
+		return false
+	}
+	// Skip the variable-length remaining length field.
+	i := 1
+	for i < len(payload) && i < 5 && payload[i]&0x80 != 0 {
+		i++
+	}
+	rest := payload[min(i+1, len(payload)):]
+	return bytes.HasPrefix(rest, []byte("\x00\x04MQTT")) || bytes.HasPrefix(rest, []byte("\x00\x06MQIsdp"))
+}
+
+func smtpGreeting(payload []byte) bool {
+	line, _, _ := bytes.Cut(payload, []byte("\r\n"))
+	return bytes.HasPrefix(line, []byte("220")) && bytes.Contains(line, []byte("SMTP"))
+}
+
+var sipMethods = []string{"INVITE sip:", "REGISTER sip:", "OPTIONS sip:", "ACK sip:", "BYE sip:", "CANCEL sip:", "SIP/2.0 "}
+
+func sip(payload []byte) bool {
+	return anyPrefix(sipMethods...)(payload)
+}
+
+// stun matches a STUN message by its RFC 5389 magic cookie.
+func stun(payload []byte) bool {
+	return len(payload) >= 20 && payload[0]&0xc0 == 0 && binary.BigEndian.Uint32(payload[4:8]) == 0x2112A442
+}
+
+// mysqlGreeting matches the server's protocol 10 handshake packet.
+func mysqlGreeting(payload []byte) bool {
+	if len(payload) < 6 || payload[3] != 0 || payload[4] != 0x0a {
+		return false
+	}
+	length := int(payload[0]) | int(payload[1])<<8 | int(payload[2])<<16
+	return length+4 == len(payload) || (length+4 > len(payload) && bytes.IndexByte(payload[5:], 0) > 0)
+}
+
+// redisCommand matches a RESP array of bulk strings, as clients send
+// commands.
+func redisCommand(payload []byte) bool {
+	if len(payload) < 4 || payload[0] != '*' {
+		return false
+	}
+	i := 1
+	for i < len(payload) && payload[i] >= '0' && payload[i] <= '9' {
+		i++
+	}
+	return i > 1 && bytes.HasPrefix(payload[i:], []byte("\r\n$"))
+}
+
+// mongoMessage matches the header of an OP_MSG or legacy OP_QUERY.
+func mongoMessage(payload []byte) bool {
+	if len(payload) < 16 || int(binary.LittleEndian.Uint32(payload)) < 16 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(payload[12:16]) {
+	case 2013, 2004:
+		return true
+	}
+	return false
+}
+
+// quicInitial matches a long header Initial packet of QUIC version 1 or 2.
+func quicInitial(payload []byte) bool {
+	if len(payload) < 5 || payload[0]&0xc0 != 0xc0 {
+		return false
+	}
+	switch quic.Version(binary.BigEndian.Uint32(payload[1:5])) {
+	case quic.Version1:
+		return payload[0]&0x30 == 0x00
+	case quic.Version2:
+		return payload[0]&0x30 == 0x10
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ClassifierRule labels flows with App. Every field that is set must match;
+// a rule needs at least one besides App.
+type ClassifierRule struct {
+	App       string `json:"app"`
+	Transport string `json:"transport,omitempty"` // "tcp" or "udp", empty for both
+	PortLow   uint16 `json:"port_low,omitempty"`
+	PortHigh  uint16 `json:"port_high,omitempty"`
+	Network   string `json:"network,omitempty"` // CIDR holding either endpoint
+	Host      string `json:"host,omitempty"`    // hostname, or "*.suffix" for a domain
+	Payload   string `json:"payload,omitempty"` // hex prefix of either direction's first payload
+}
+
+// ParseClassifierRules parses rules written as comma-separated key=value
+// fields, rules separated by semicolons:
+//
+//	app=billing,transport=tcp,ports=9000-9010;app=intranet,host=*.corp.example
+//
+// The keys are the rule's JSON names, with ports for a port or port range.
+func ParseClassifierRules(spec string) ([]ClassifierRule, error) {
+	var rules []ClassifierRule
+	for _, text := range strings.Split(spec, ";") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		var rule ClassifierRule
+		for _, field := range strings.Split(text, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+			if !ok {
+				return nil, fmt.Errorf("classifier rule %q: field %q is not key=value", text, field)
+			}
+			switch key {
+			case "app":
+				rule.App = value
+			case "transport":
+				rule.Transport = strings.ToLower(value)
+			case "ports":
+				low, high, isRange := strings.Cut(value, "-")
+				if !isRange {
+					high = low
+				}
+				l, err := strconv.ParseUint(low, 10, 16)
+				if err != nil {
+					return nil, fmt.Errorf("classifier rule %q: invalid port %q", text, low)
+				}
+				h, err := strconv.ParseUint(high, 10, 16)
+				if err != nil {
+					return nil, fmt.Errorf("classifier rule %q: invalid port %q", text, high)
+				}
+				rule.PortLow, rule.PortHigh = uint16(l), uint16(h)
+			case "network":
+				rule.Network = value
+			case "host":
+				rule.Host = strings.ToLower(value)
+			case "payload":
+				rule.Payload = value
+			default:
+				return nil, fmt.Errorf("classifier rule %q: unknown field %q", text, key)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
@@ -6,6 +6,7 @@ import (
 	"math"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -31,7 +32,20 @@ type Config struct {
 	ChannelBufferSize int           `json:"channel_buffer_size"`
 	FlowTimeout       time.Duration `json:"flow_timeout"`
 	MaxFlows          int           `json:"max_flows"`
+	FlowEviction      string        `json:"flow_eviction"`
+	FlowShards        int           `json:"flow_shards"`
 	CleanupInterval   time.Duration `json:"cleanup_interval"`
+	MaxTunnelDepth    int           `json:"max_tunnel_depth"`
+	VerifyChecksums   bool          `json:"verify_checksums"`
+	FragmentTimeout   time.Duration `json:"fragment_timeout"`
+	FragmentMemory    int           `json:"fragment_memory"`
+
+	// Classification configuration
+	ServicesFile    string           `json:"services_file"`
+	ClassifierRules []ClassifierRule `json:"classifier_rules"`
+
+	// Protocol analysis configuration
+	DHCPAuthorizedServers []string `json:"dhcp_authorized_servers"` // any other DHCP server answering is rogue
 
 	// Logging configuration
 	LogLevel  string `json:"log_level"`
@@ -48,7 +62,8 @@ type Config struct {
 	EnableMetrics bool   `json:"enable_metrics"`
 
 	// Development configuration
-	DevMode bool `json:"dev_mode"`
+	DevMode bool   `json:"dev_mode"`
+	Dissect string `json:"dissect"` // print every captured packet: summary, tree, hex or json
 }
 
 func Load() (*Config, error) {
@@ -148,12 +163,62 @@ func loadFromEnv(cfg *Config) error {
 		}
 	}
 
+	if flowEviction := os.Getenv("NETWATCH_FLOW_EVICTION"); flowEviction != "" {
+		cfg.FlowEviction = flowEviction
+	}
+
+	if flowShards := os.Getenv("NETWATCH_FLOW_SHARDS"); flowShards != "" {
+		if f, err := strconv.Atoi(flowShards); err == nil {
+			cfg.FlowShards = f
+		}
+	}
+
 	if cleanupInterval := os.Getenv("NETWATCH_CLEANUP_INTERVAL"); cleanupInterval != "" {
 		if c, err := time.ParseDuration(cleanupInterval); err == nil {
 			cfg.CleanupInterval = c
 		}
 	}
 
+	if maxTunnelDepth := os.Getenv("NETWATCH_MAX_TUNNEL_DEPTH"); maxTunnelDepth != "" {
+		if m, err := strconv.Atoi(maxTunnelDepth); err == nil {
+			cfg.MaxTunnelDepth = m
+		}
+	}
+
+	if verifyChecksums := os.Getenv("NETWATCH_VERIFY_CHECKSUMS"); verifyChecksums != "" {
+		if v, err := strconv.ParseBool(verifyChecksums); err == nil {
+			cfg.VerifyChecksums = v
+		}
+	}
+
+	if fragmentTimeout := os.Getenv("NETWATCH_FRAGMENT_TIMEOUT"); fragmentTimeout != "" {
+		if f, err := time.ParseDuration(fragmentTimeout); err == nil {
+			cfg.FragmentTimeout = f
+		}
+	}
+
+	if fragmentMemory := os.Getenv("NETWATCH_FRAGMENT_MEMORY"); fragmentMemory != "" {
+		if f, err := strconv.Atoi(fragmentMemory); err == nil {
+			cfg.FragmentMemory = f
+		}
+	}
+
+	if servicesFile := os.Getenv("NETWATCH_SERVICES_FILE"); servicesFile != "" {
+		cfg.ServicesFile = servicesFile
+	}
+
+	if classifierRules := os.Getenv("NETWATCH_CLASSIFIER_RULES"); classifierRules != "" {
+		rules, err := ParseClassifierRules(classifierRules)
+		if err != nil {
+			return err
+		}
+		cfg.ClassifierRules = rules
+	}
+
+	if dhcpServers := os.Getenv("NETWATCH_DHCP_AUTHORIZED_SERVERS"); dhcpServers != "" {
+		cfg.DHCPAuthorizedServers = splitList(dhcpServers)
+	}
+
 	if logLevel := os.Getenv("NETWATCH_LOG_LEVEL"); logLevel != "" {
 		cfg.LogLevel = logLevel
 	}
@@ -198,6 +263,10 @@ func loadFromEnv(cfg *Config) error {
 		}
 	}
 
+	if dissect := os.Getenv("NETWATCH_DISSECT"); dissect != "" {
+		cfg.Dissect = dissect
+	}
+
 	return nil
 }
 
@@ -220,7 +289,16 @@ func loadFromFlags(cfg *Config) error {
 	channelBufferSize := flag.Int("channel-buffer-size", cfg.ChannelBufferSize, "Packet channel buffer size")
 	flowTimeout := flag.Duration("flow-timeout", cfg.FlowTimeout, "Flow timeout duration")
 	maxFlows := flag.Int("max-flows", cfg.MaxFlows, "Maximum number of flows to track")
+	flowEviction := flag.String("flow-eviction", cfg.FlowEviction, "Flow evicted when max-flows is reached (lru, oldest, sampled_smallest)")
+	flowShards := flag.Int("flow-shards", cfg.FlowShards, "Number of independently locked flow table shards (rounded down to a power of two)")
 	cleanupInterval := flag.Duration("cleanup-interval", cfg.CleanupInterval, "Flow cleanup interval")
+	maxTunnelDepth := flag.Int("max-tunnel-depth", cfg.MaxTunnelDepth, "Maximum tunnel encapsulation depth to decode (0 disables)")
+	verifyChecksums := flag.Bool("verify-checksums", cfg.VerifyChecksums, "Verify IPv4, TCP, UDP and ICMP checksums")
+	fragmentTimeout := flag.Duration("fragment-timeout", cfg.FragmentTimeout, "Time to wait for the missing fragments of an IP datagram")
+	fragmentMemory := flag.Int("fragment-memory", cfg.FragmentMemory, "Maximum bytes buffered for IP fragment reassembly")
+	servicesFile := flag.String("services-file", cfg.ServicesFile, "services(5) file naming the ports used to classify flows")
+	classifierRules := flag.String("classifier-rules", "", "Application classification rules, e.g. app=billing,transport=tcp,ports=9000-9010;app=intranet,host=*.corp.example")
+	dhcpServers := flag.String("dhcp-authorized-servers", strings.Join(cfg.DHCPAuthorizedServers, ","), "Comma-separated DHCP server addresses; any other server answering is reported as rogue")
 	logLevel := flag.String("log-level", cfg.LogLevel, "Logging level (debug, info, warn, error)")
 	logFormat := flag.String("log-format", cfg.LogFormat, "Log format (json, text)")
 	enableAuth := flag.Bool("enable-auth", cfg.EnableAuth, "Enable authentication")
@@ -230,6 +308,7 @@ func loadFromFlags(cfg *Config) error {
 	metricsPort := flag.Int("metrics-port", cfg.MetricsPort, "Metrics endpoint port")
 	enableMetrics := flag.Bool("enable-metrics", cfg.EnableMetrics, "Enable metrics endpoint")
 	devMode := flag.Bool("dev-mode", cfg.DevMode, "Enable development mode")
+	dissect := flag.String("dissect", cfg.Dissect, "Print every captured packet (summary, tree, hex, json)")
 
 	flag.Parse()
 
@@ -249,7 +328,22 @@ func loadFromFlags(cfg *Config) error {
 	cfg.ChannelBufferSize = *channelBufferSize
 	cfg.FlowTimeout = *flowTimeout
 	cfg.MaxFlows = *maxFlows
+	cfg.FlowEviction = *flowEviction
+	cfg.FlowShards = *flowShards
 	cfg.CleanupInterval = *cleanupInterval
+	cfg.MaxTunnelDepth = *maxTunnelDepth
+	cfg.VerifyChecksums = *verifyChecksums
+	cfg.FragmentTimeout = *fragmentTimeout
+	cfg.FragmentMemory = *fragmentMemory
+	cfg.ServicesFile = *servicesFile
+	if *classifierRules != "" {
+		rules, err := ParseClassifierRules(*classifierRules)
+		if err != nil {
+			return err
+		}
+		cfg.ClassifierRules = rules
+	}
+	cfg.DHCPAuthorizedServers = splitList(*dhcpServers)
 	cfg.LogLevel = *logLevel
 	cfg.LogFormat = *logFormat
 	cfg.EnableAuth = *enableAuth
@@ -259,6 +353,18 @@ func loadFromFlags(cfg *Config) error {
 	cfg.MetricsPort = *metricsPort
 	cfg.EnableMetrics = *enableMetrics
 	cfg.DevMode = *devMode
+	cfg.Dissect = *dissect
 
 	return nil
 }
+
+// splitList reads a comma-separated list, skipping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
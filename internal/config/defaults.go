@@ -19,7 +19,16 @@ func getDefaults() *Config {
 		ChannelBufferSize: 1000,                   // Buffered channel for packet processing
 		FlowTimeout:       5 * time.Minute,        // Flow idle timeout
 		MaxFlows:          100000,                 // Maximum flows to track (memory limit consideration)
+		FlowEviction:      "lru",                  // Evict the least recently seen flow when full
+		FlowShards:        64,                     // Keeps each eviction to a fraction of the table
 		CleanupInterval:   30 * time.Second,       // Regular cleanup to maintain <5% CPU target
+		MaxTunnelDepth:    4,                      // Decapsulate nested GRE/VXLAN/GENEVE/IP-in-IP
+		VerifyChecksums:   false,                  // Checksumming every segment costs CPU; enable to diagnose links
+		FragmentTimeout:   30 * time.Second,       // Same as the Linux ipfrag_time default
+		FragmentMemory:    4 * 1024 * 1024,        // 4MB of buffered fragments
+
+		// Classification configuration
+		ServicesFile: "/etc/services", // Port names beyond the built-in table; skipped if missing
 
 		// Logging configuration
 		LogLevel:  "info", // Default to info level
@@ -37,5 +46,6 @@ func getDefaults() *Config {
 
 		// Development configuration
 		DevMode: false, // Production mode by default
+		Dissect: "",    // No packet printing by default
 	}
 }
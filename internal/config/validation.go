@@ -1,9 +1,11 @@
 package config
 
 import (
+	"encoding/hex"
 	"fmt"
 	"log/slog"
 	"net"
+	"net/netip"
 	"strings"
 )
 
@@ -34,6 +36,14 @@ func Validate(cfg *Config) error {
 		return fmt.Errorf("capture validation failed: %w", err)
 	}
 
+	if err := validateClassifier(cfg); err != nil {
+		return fmt.Errorf("classifier validation failed: %w", err)
+	}
+
+	if err := validateAnalyzers(cfg); err != nil {
+		return fmt.Errorf("analyzer validation failed: %w", err)
+	}
+
 	if err := validateLogging(cfg); err != nil {
 		return fmt.Errorf("logging validation failed: %w", err)
 	}
@@ -135,11 +145,92 @@ func validateCapture(cfg *Config) error {
 		return fmt.Errorf("max flows must not exceed 1M for memory management, got: %d", cfg.MaxFlows)
 	}
 
+	// Validate flow eviction policy
+	if cfg.FlowEviction != "" {
+		validPolicies := []string{"lru", "oldest", "sampled_smallest"}
+		validPolicy := false
+		for _, policy := range validPolicies {
+			if strings.ToLower(cfg.FlowEviction) == policy {
+				validPolicy = true
+				break
+			}
+		}
+		if !validPolicy {
+			return fmt.Errorf("invalid flow eviction policy: %s, must be one of: %v", cfg.FlowEviction, validPolicies)
+		}
+	}
+
+	// Validate flow shards (0 leaves the flow table default)
+	if cfg.FlowShards < 0 || cfg.FlowShards > 1024 {
+		return fmt.Errorf("flow shards must be between 0 and 1024, got: %d", cfg.FlowShards)
+	}
+
 	// Validate cleanup interval
 	if cfg.CleanupInterval <= 0 {
 		return fmt.Errorf("cleanup interval must be positive, got: %v", cfg.CleanupInterval)
 	}
 
+	// Validate tunnel depth (bounds per-packet decode work)
+	if cfg.MaxTunnelDepth < 0 || cfg.MaxTunnelDepth > 8 {
+		return fmt.Errorf("max tunnel depth must be between 0 and 8, got: %d", cfg.MaxTunnelDepth)
+	}
+
+	// Validate fragment reassembly limits
+	if cfg.FragmentTimeout <= 0 {
+		return fmt.Errorf("fragment timeout must be positive, got: %v", cfg.FragmentTimeout)
+	}
+	if cfg.FragmentMemory < 64*1024 {
+		return fmt.Errorf("fragment memory must be at least 64KB to hold one datagram, got: %d", cfg.FragmentMemory)
+	}
+	if cfg.FragmentMemory > 256*1024*1024 {
+		return fmt.Errorf("fragment memory must not exceed 256MB, got: %d", cfg.FragmentMemory)
+	}
+
+	return nil
+}
+
+func validateClassifier(cfg *Config) error {
+	for i, rule := range cfg.ClassifierRules {
+		if rule.App == "" {
+			return fmt.Errorf("classifier rule %d has no app", i)
+		}
+
+		if rule.Transport != "" && rule.Transport != "tcp" && rule.Transport != "udp" {
+			return fmt.Errorf("classifier rule %q: transport must be tcp or udp, got: %s", rule.App, rule.Transport)
+		}
+
+		if rule.PortLow > rule.PortHigh {
+			return fmt.Errorf("classifier rule %q: port range %d-%d is reversed", rule.App, rule.PortLow, rule.PortHigh)
+		}
+
+		if rule.Network != "" {
+			if _, err := netip.ParsePrefix(rule.Network); err != nil {
+				return fmt.Errorf("classifier rule %q: invalid network: %w", rule.App, err)
+			}
+		}
+
+		if rule.Payload != "" {
+			if _, err := hex.DecodeString(rule.Payload); err != nil {
+				return fmt.Errorf("classifier rule %q: payload must be hex: %w", rule.App, err)
+			}
+		}
+
+		// A rule matching everything would hide every other classification.
+		if rule.PortHigh == 0 && rule.Network == "" && rule.Host == "" && rule.Payload == "" {
+			return fmt.Errorf("classifier rule %q must match on ports, network, host or payload", rule.App)
+		}
+	}
+
+	return nil
+}
+
+func validateAnalyzers(cfg *Config) error {
+	for _, server := range cfg.DHCPAuthorizedServers {
+		if _, err := netip.ParseAddr(server); err != nil {
+			return fmt.Errorf("invalid DHCP authorized server %q: must be an IP address", server)
+		}
+	}
+
 	return nil
 }
 
@@ -170,6 +261,21 @@ func validateLogging(cfg *Config) error {
 		return fmt.Errorf("invalid log format: %s, must be one of: %v", cfg.LogFormat, validFormats)
 	}
 
+	// Validate packet dissection mode
+	if cfg.Dissect != "" {
+		validModes := []string{"summary", "tree", "hex", "json"}
+		validMode := false
+		for _, mode := range validModes {
+			if strings.ToLower(cfg.Dissect) == mode {
+				validMode = true
+				break
+			}
+		}
+		if !validMode {
+			return fmt.Errorf("invalid dissect mode: %s, must be one of: %v", cfg.Dissect, validModes)
+		}
+	}
+
 	return nil
 }
 
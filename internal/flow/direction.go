@@ -0,0 +1,108 @@
+package flow
+
+import (
+	"strings"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+)
+
+// Flows are stored with the initiator first; packets are counted in the
+// direction they were sent.
+const (
+	fromInitiator = 0
+	fromResponder = 1
+)
+
+// TCPFlags is the set of TCP flags seen in one direction of a flow.
+type TCPFlags uint8
+
+func (f TCPFlags) String() string {
+	names := [...]string{"FIN", "SYN", "RST", "PSH", "ACK", "URG", "ECE", "CWR"}
+	var set []string
+	for i, name := range names {
+		if f&(1<<i) != 0 {
+			set = append(set, name)
+		}
+	}
+	return strings.Join(set, ",")
+}
+
+func (f TCPFlags) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// DirectionCounters is what one side of a flow sent.
+type DirectionCounters struct {
+	Bytes        uint64   `json:"bytes"`
+	Packets      uint64   `json:"packets"`
+	PayloadBytes uint64   `json:"payload_bytes"`
+	TCPFlags     TCPFlags `json:"tcp_flags,omitempty"`
+}
+
+type direction struct {
+	counters DirectionCounters
+	payload  []byte // start of the first payload
+	fin      bool   // a FIN was sent
+}
+
+// Reverse is the key of the opposite direction.
+func (k Key) Reverse() Key {
+	k.SrcIP, k.DstIP = k.DstIP, k.SrcIP
+	k.SrcPort, k.DstPort = k.DstPort, k.SrcPort
+	return k
+}
+
+// orient turns the key of the first packet seen of a flow so that the
+// initiator comes first. A SYN or an echo message tells which side that
+// is; otherwise the side with the lower port is taken for the server, as
+// when a connection is picked up mid-stream, and guessed is set.
+func orient(key Key, o *Observation) (oriented Key, guessed bool) {
+	switch {
+	case o.tcp && o.flags&capture.TCPFlagSYN != 0:
+		if o.flags&capture.TCPFlagACK != 0 {
+			return key.Reverse(), false
+		}
+		return key, false
+	case o.echo == echoRequest:
+		return key, false
+	case o.echo == echoReply:
+		return key.Reverse(), false
+	case key.SrcPort < key.DstPort:
+		return key.Reverse(), true
+	}
+	return key, true
+}
+
+// sizes returns the length of an IP datagram and of the transport payload
+// it carries as the headers declare them, which is what was sent even when
+// the capture was cut short by the snap length.
+func sizes(packet *capture.ParsedPacket) (datagram, payload uint64) {
+	var header, ipPayload int
+	switch {
+	case packet.IPv4 != nil:
+		header = int(packet.IPv4.IHL) * 4
+		ipPayload = int(packet.IPv4.Length) - header
+	case packet.IPv6 != nil:
+		header = packet.IPv6.UpperLayerOffset
+		ipPayload = int(packet.IPv6.PayloadLen) - (header - capture.IPv6HeaderSize)
+	default:
+		return 0, 0
+	}
+
+	transport := 0
+	switch {
+	case packet.TCP != nil:
+		transport = int(packet.TCP.DataOffset) * 4
+	case packet.UDP != nil:
+		transport = capture.UDPHeaderSize
+	case packet.ICMP != nil || packet.ICMPv6 != nil:
+		transport = capture.ICMPHeaderSize
+	}
+
+	// Segmentation offload leaves the IPv4 length zero and jumbograms the
+	// IPv6 one; count what was captured instead.
+	if ipPayload < transport {
+		ipPayload = transport + len(packet.Payload)
+	}
+	return uint64(header + ipPayload), uint64(ipPayload - transport)
+}
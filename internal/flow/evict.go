@@ -0,0 +1,85 @@
+package flow
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EvictionPolicy chooses the flow dropped when a full table meets a new
+// one. Whatever the policy, closed connections go first, then connections
+// still waiting on their handshake.
+type EvictionPolicy uint8
+
+const (
+	EvictLRU             EvictionPolicy = iota // the least recently seen flow
+	EvictOldest                                // the flow that started first
+	EvictSampledSmallest                       // the fewest bytes of a random sample of flows
+)
+
+// evictionSample is how many flows the sampled smallest policy compares.
+// Keeping a shard's flows ordered by size would cost every packet a
+// reordering, so the smallest flow is approximated the way caches
+// approximate LRU: by the smallest of a few flows picked at random. It is
+// not the smallest of the shard, but rarely one of its larger flows.
+const evictionSample = 16
+
+func (p EvictionPolicy) String() string {
+	switch p {
+	case EvictLRU:
+		return "lru"
+	case EvictOldest:
+		return "oldest"
+	case EvictSampledSmallest:
+		return "sampled_smallest"
+	default:
+		return fmt.Sprintf("eviction_policy(%d)", uint8(p))
+	}
+}
+
+func (p EvictionPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// ParseEvictionPolicy reads a policy by name; an empty name is LRU.
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch strings.ToLower(name) {
+	case "", "lru":
+		return EvictLRU, nil
+	case "oldest":
+		return EvictOldest, nil
+	case "sampled_smallest":
+		return EvictSampledSmallest, nil
+	default:
+		return 0, fmt.Errorf("unknown eviction policy: %s", name)
+	}
+}
+
+// victim picks the flow of a full shard to evict for a new one.
+func (s *shard) victim(policy EvictionPolicy) *flow {
+	if f := s.queues[queueClosed].front(); f != nil {
+		return f
+	}
+	if f := s.queues[queueHandshake].front(); f != nil {
+		return f
+	}
+
+	switch policy {
+	case EvictOldest:
+		return s.created.front()
+	case EvictSampledSmallest:
+		// Map iteration starts at random, which makes the sample.
+		var smallest *flow
+		n := 0
+		for _, f := range s.flows {
+			if smallest == nil || f.bytes() < smallest.bytes() {
+				smallest = f
+			}
+			if n++; n == evictionSample {
+				break
+			}
+		}
+		return smallest
+	default:
+		return s.queues[queueOpen].front()
+	}
+}
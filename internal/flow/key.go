@@ -0,0 +1,177 @@
+// Package flow aggregates decoded packets into flows and keeps them in a
+// bounded table that ages out idle entries.
+package flow
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+)
+
+// Key identifies a flow as seen in one direction: the 5-tuple of its
+// innermost IP packet, qualified by the interface it was captured on, its
+// outermost VLAN and the ID of its innermost tunnel that has one, the
+// VXLAN or GENEVE VNI or the GRE key, which keeps apart overlay tenants
+// reusing the same addresses. Ports are zero for protocols without them;
+// ICMP echo uses the identifier as both ports so that each ping session is
+// a flow of its own.
+type Key struct {
+	Interface   int
+	VLAN        uint16
+	TunnelID    uint32
+	HasTunnelID bool
+	Protocol    uint8
+	SrcIP       netip.Addr
+	DstIP       netip.Addr
+	SrcPort     uint16
+	DstPort     uint16
+}
+
+// KeyFromPacket builds the key of a packet captured on the interface with
+// the given index. It returns false for packets without an IP layer.
+func KeyFromPacket(ifIndex int, packet *capture.ParsedPacket) (Key, bool) {
+	key := Key{Interface: ifIndex}
+	if len(packet.VLANs) > 0 {
+		key.VLAN = packet.VLANs[0].VLANID
+	}
+	for current := packet; current.Inner != nil; current = current.Inner {
+		// An ERSPAN session names a mirror, not a tenant.
+		if tunnel := current.Tunnel; tunnel != nil && tunnel.HasID && tunnel.Type != capture.TunnelERSPAN {
+			key.TunnelID, key.HasTunnelID = tunnel.ID, true
+		}
+	}
+
+	inner := packet.Innermost()
+	switch {
+	case inner.IPv4 != nil:
+		key.Protocol = inner.IPv4.Protocol
+		key.SrcIP, key.DstIP = inner.IPv4.SrcIP, inner.IPv4.DstIP
+	case inner.IPv6 != nil:
+		key.Protocol = inner.IPv6.UpperLayerProtocol
+		key.SrcIP, key.DstIP = inner.IPv6.SrcIP, inner.IPv6.DstIP
+	default:
+		return Key{}, false
+	}
+
+	switch {
+	case inner.TCP != nil:
+		key.SrcPort, key.DstPort = inner.TCP.SrcPort, inner.TCP.DstPort
+	case inner.UDP != nil:
+		key.SrcPort, key.DstPort = inner.UDP.SrcPort, inner.UDP.DstPort
+	case inner.ICMP != nil && isEcho(inner.ICMP.Type, capture.ICMPv4EchoRequest, capture.ICMPv4EchoReply):
+		key.SrcPort, key.DstPort = inner.ICMP.ID, inner.ICMP.ID
+	case inner.ICMPv6 != nil && isEcho(inner.ICMPv6.Type, capture.ICMPv6EchoRequest, capture.ICMPv6EchoReply):
+		key.SrcPort, key.DstPort = inner.ICMPv6.ID, inner.ICMPv6.ID
+	}
+	return key, true
+}
+
+func isEcho(typ, request, reply uint8) bool {
+	return typ == request || typ == reply
+}
+
+func (k Key) String() string {
+	s := ProtocolName(k.Protocol) + " " +
+		netip.AddrPortFrom(k.SrcIP, k.SrcPort).String() + " -> " +
+		netip.AddrPortFrom(k.DstIP, k.DstPort).String()
+	if k.VLAN != 0 {
+		s += " vlan " + strconv.Itoa(int(k.VLAN))
+	}
+	if k.HasTunnelID {
+		s += " tunnel " + strconv.FormatUint(uint64(k.TunnelID), 10)
+	}
+	return s + " if " + strconv.Itoa(k.Interface)
+}
+
+// Hash is a 64-bit FNV-1a hash of the key, stable across runs.
+func (k Key) Hash() uint64 {
+	h := newFNV()
+	for shift := 0; shift < 64; shift += 8 {
+		h.addByte(byte(uint64(k.Interface) >> shift))
+	}
+	h.addUint16(k.VLAN)
+	if k.HasTunnelID {
+		h.addByte(1)
+		h.addUint16(uint16(k.TunnelID >> 16))
+		h.addUint16(uint16(k.TunnelID))
+	}
+	h.addByte(k.Protocol)
+	h.addAddr(k.SrcIP)
+	h.addAddr(k.DstIP)
+	h.addUint16(k.SrcPort)
+	h.addUint16(k.DstPort)
+	return uint64(h)
+}
+
+// fnv accumulates a 64-bit FNV-1a hash.
+type fnv uint64
+
+func newFNV() fnv {
+	return 14695981039346656037
+}
+
+func (h *fnv) addByte(b byte) {
+	*h ^= fnv(b)
+	*h *= 1099511628211
+}
+
+func (h *fnv) addUint16(v uint16) {
+	h.addByte(byte(v >> 8))
+	h.addByte(byte(v))
+}
+
+func (h *fnv) addAddr(addr netip.Addr) {
+	for _, b := range addr.As16() {
+		h.addByte(b)
+	}
+}
+
+// tuple is a key without the capture point, ordered so that both
+// directions of a conversation share it. Analyzers report connections by
+// their addresses alone and find flows through it.
+type tuple struct {
+	protocol uint8
+	a, b     netip.AddrPort
+}
+
+func newTuple(protocol uint8, a, b netip.AddrPort) tuple {
+	if b.Compare(a) < 0 {
+		a, b = b, a
+	}
+	return tuple{protocol: protocol, a: a, b: b}
+}
+
+// hash is the same for both directions of a conversation wherever it was
+// captured, which is what the table shards flows on.
+func (t tuple) hash() uint64 {
+	h := newFNV()
+	h.addByte(t.protocol)
+	h.addAddr(t.a.Addr())
+	h.addUint16(t.a.Port())
+	h.addAddr(t.b.Addr())
+	h.addUint16(t.b.Port())
+	return uint64(h)
+}
+
+func (k Key) tuple() tuple {
+	return newTuple(k.Protocol, netip.AddrPortFrom(k.SrcIP, k.SrcPort), netip.AddrPortFrom(k.DstIP, k.DstPort))
+}
+
+// ProtocolName is the lower-case name of an IP protocol number, or the
+// number itself for protocols without one.
+func ProtocolName(protocol uint8) string {
+	switch protocol {
+	case capture.IPProtoICMP:
+		return "icmp"
+	case capture.IPProtoTCP:
+		return "tcp"
+	case capture.IPProtoUDP:
+		return "udp"
+	case capture.IPProtoICMPv6:
+		return "icmpv6"
+	default:
+		return fmt.Sprintf("ip-proto-%d", protocol)
+	}
+}
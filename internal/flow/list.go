@@ -0,0 +1,62 @@
+package flow
+
+// Flows are linked into lists through pointers of their own rather than
+// container/list elements, so that moving a flow on every packet costs no
+// allocation. Each flow is on two lists at once: the queue of its timeout,
+// in the order of its last packet, and the shard's list in the order flows
+// were created.
+const (
+	byActivity = iota
+	byAge
+	linkCount
+)
+
+type link struct {
+	prev, next *flow
+}
+
+// flowList is a doubly linked list of flows through links[by].
+type flowList struct {
+	head, tail *flow
+	len        int
+	by         int
+}
+
+func (l *flowList) front() *flow {
+	return l.head
+}
+
+func (l *flowList) pushBack(f *flow) {
+	f.links[l.by] = link{prev: l.tail}
+	if l.tail != nil {
+		l.tail.links[l.by].next = f
+	} else {
+		l.head = f
+	}
+	l.tail = f
+	l.len++
+}
+
+func (l *flowList) remove(f *flow) {
+	ln := &f.links[l.by]
+	if ln.prev != nil {
+		ln.prev.links[l.by].next = ln.next
+	} else {
+		l.head = ln.next
+	}
+	if ln.next != nil {
+		ln.next.links[l.by].prev = ln.prev
+	} else {
+		l.tail = ln.prev
+	}
+	*ln = link{}
+	l.len--
+}
+
+func (l *flowList) moveToBack(f *flow) {
+	if l.tail == f {
+		return
+	}
+	l.remove(f)
+	l.pushBack(f)
+}
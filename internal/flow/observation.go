@@ -0,0 +1,112 @@
+package flow
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+)
+
+// Observation is what the table counts of one packet. It holds nothing of
+// the packet itself, so that a capture loop that reuses its packet buffer
+// can hand observations to other goroutines to apply.
+type Observation struct {
+	Key       Key
+	Timestamp time.Time
+
+	tcp      bool
+	flags    uint8
+	echo     echo
+	datagram uint64
+	payload  uint64
+	sample   [payloadSample]byte // start of the payload
+	sampled  uint8               // bytes of sample used
+}
+
+// echo is the kind of ICMP echo message a packet carried, which tells the
+// initiator of a ping session.
+type echo uint8
+
+const (
+	echoNone echo = iota
+	echoRequest
+	echoReply
+)
+
+// Observation takes what the table counts of a packet captured on the
+// interface with the given index. It returns false for packets without
+// IP and for fragments, which it counts as such: pass the datagrams a
+// capture.Reassembler rebuilds instead.
+func (t *Table) Observation(ifIndex int, packet *capture.ParsedPacket, timestamp time.Time) (Observation, bool) {
+	if packet == nil {
+		return Observation{}, false
+	}
+
+	key, ok := KeyFromPacket(ifIndex, packet)
+	if !ok {
+		t.nonIP.Add(1)
+		return Observation{}, false
+	}
+	inner := packet.Innermost()
+	if inner.IsFragment() {
+		t.fragments.Add(1)
+		return Observation{}, false
+	}
+
+	o := Observation{Key: key, Timestamp: timestamp}
+	switch {
+	case inner.TCP != nil:
+		o.tcp, o.flags = true, inner.TCP.Flags
+	case inner.ICMP != nil:
+		o.echo = echoOf(inner.ICMP.Type, capture.ICMPv4EchoRequest, capture.ICMPv4EchoReply)
+	case inner.ICMPv6 != nil:
+		o.echo = echoOf(inner.ICMPv6.Type, capture.ICMPv6EchoRequest, capture.ICMPv6EchoReply)
+	}
+	o.datagram, o.payload = sizes(inner)
+	o.sampled = uint8(copy(o.sample[:], inner.Payload))
+	return o, true
+}
+
+func echoOf(typ, request, reply uint8) echo {
+	switch typ {
+	case request:
+		return echoRequest
+	case reply:
+		return echoReply
+	default:
+		return echoNone
+	}
+}
+
+// Apply counts an observation against its flow, creating the flow if
+// needed. It may be called from several goroutines at once, but the
+// observations of one flow are counted in the order they are applied.
+func (t *Table) Apply(o *Observation) {
+	s := t.shardOf(o.Key.tuple())
+	s.mu.Lock()
+	ended := s.observe(o)
+	s.mu.Unlock()
+
+	t.notify(ended)
+}
+
+// Partition tells which of n goroutines applying observations the flow
+// with key belongs to. Both directions of a conversation, and every flow
+// Annotate may reach with it, fall to the same goroutine, as do all the
+// flows of a shard; with no more goroutines than shards, none of them
+// waits on another's lock. Only the protocol, addresses and ports of key
+// are used.
+func (t *Table) Partition(key Key, n int) int {
+	return t.shardIndex(key.tuple()) % n
+}
+
+// EndpointKey is the key of a flow between two endpoints, for Partition.
+func EndpointKey(protocol uint8, a, b netip.AddrPort) Key {
+	return Key{
+		Protocol: protocol,
+		SrcIP:    a.Addr(),
+		DstIP:    b.Addr(),
+		SrcPort:  a.Port(),
+		DstPort:  b.Port(),
+	}
+}
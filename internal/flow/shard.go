@@ -0,0 +1,244 @@
+package flow
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/classify"
+)
+
+// shard holds the flows whose tuple hashes to it, behind a lock of its
+// own. Both directions of a conversation share a tuple, as do the flows an
+// analyzer annotates together, so every operation stays within one shard.
+type shard struct {
+	mu       sync.Mutex
+	table    *Table
+	capacity int
+	flows    map[Key]*flow
+	tuples   map[tuple]*flow // the first flow of each tuple, the rest linked through sibling
+	queues   [queueCount]flowList
+	created  flowList
+	free     *flow     // ended flows kept for reuse, linked through sibling
+	now      time.Time // latest time seen
+	stats    TableStatistics
+}
+
+// newShard sizes a shard for its share of the flows up front, so that the
+// table's memory does not grow in bursts as it fills.
+func newShard(table *Table, capacity int) *shard {
+	s := &shard{
+		table:    table,
+		capacity: capacity,
+		flows:    make(map[Key]*flow, capacity),
+		tuples:   make(map[tuple]*flow, capacity),
+		created:  flowList{by: byAge},
+	}
+	for q := range s.queues {
+		s.queues[q].by = byActivity
+	}
+	return s
+}
+
+func (s *shard) observe(o *Observation) []endedFlow {
+	key, timestamp, flags := o.Key, o.Timestamp, o.flags
+	if timestamp.After(s.now) {
+		s.now = timestamp
+	}
+
+	var ended []endedFlow
+	f, dir := s.lookup(key)
+	if f != nil && f.reused(flags) {
+		// A new connection on the ports of one that is over.
+		ended = s.end(f, EndClosed, ended)
+		f = nil
+	}
+	exists := f != nil
+	if !exists {
+		if len(s.flows) >= s.capacity {
+			victim := s.victim(s.table.config.EvictionPolicy)
+			s.stats.Evictions++
+			s.stats.EvictedPackets += victim.packets()
+			s.stats.EvictedBytes += victim.bytes()
+			ended = s.end(victim, EndEvicted, ended)
+		}
+		oriented, guessed := orient(key, o)
+		f = s.create(oriented, timestamp)
+		f.guessed = guessed
+		// A reused connection may be opened from the other end.
+		dir = fromInitiator
+		if oriented != key {
+			dir = fromResponder
+		}
+		if o.tcp {
+			f.startTCP(flags, &s.stats)
+		}
+	}
+	if o.tcp {
+		f.updateTCP(dir, flags, &s.stats)
+	}
+
+	d := &f.directions[dir]
+	d.counters.Packets++
+	d.counters.Bytes += o.datagram
+	d.counters.PayloadBytes += o.payload
+	d.counters.TCPFlags |= TCPFlags(flags)
+	if timestamp.After(f.lastSeen) {
+		f.lastSeen = timestamp
+	}
+	s.requeue(f)
+	s.stats.Packets++
+	s.stats.Bytes += o.datagram
+
+	// A flow is classified when it appears and again once either side's
+	// payload can be matched against signatures.
+	sampled := d.payload == nil && o.sampled > 0
+	if sampled {
+		d.payload = append([]byte(nil), o.sample[:o.sampled]...)
+	}
+	if !exists || sampled {
+		s.classify(f)
+	}
+
+	return ended
+}
+
+// lookup finds the flow a packet sent along key belongs to and the
+// direction it was sent in.
+func (s *shard) lookup(key Key) (*flow, int) {
+	if f, exists := s.flows[key]; exists {
+		return f, fromInitiator
+	}
+	if f, exists := s.flows[key.Reverse()]; exists {
+		return f, fromResponder
+	}
+	return nil, fromInitiator
+}
+
+func (s *shard) create(key Key, timestamp time.Time) *flow {
+	f := s.free
+	if f != nil {
+		s.free = f.sibling
+		f.sibling = nil
+	} else {
+		f = &flow{}
+	}
+	f.key, f.firstSeen, f.lastSeen = key, timestamp, timestamp
+	if resolver := s.table.resolver.Load(); resolver != nil {
+		if name, ok := (*resolver).Hostname(key.DstIP, timestamp); ok {
+			f.metadata.Hostname = name
+		}
+	}
+
+	f.queue = queueOpen
+	s.queues[queueOpen].pushBack(f)
+	s.created.pushBack(f)
+	s.flows[key] = f
+	tup := key.tuple()
+	f.sibling = s.tuples[tup]
+	s.tuples[tup] = f
+	s.stats.FlowsCreated++
+	return f
+}
+
+// remove drops a flow and keeps its memory for the next one.
+func (s *shard) remove(f *flow) {
+	delete(s.flows, f.key)
+	s.queues[f.queue].remove(f)
+	s.created.remove(f)
+
+	tup := f.key.tuple()
+	if head := s.tuples[tup]; head == f {
+		if f.sibling == nil {
+			delete(s.tuples, tup)
+		} else {
+			s.tuples[tup] = f.sibling
+		}
+	} else {
+		for prev := head; prev != nil; prev = prev.sibling {
+			if prev.sibling == f {
+				prev.sibling = f.sibling
+				break
+			}
+		}
+	}
+
+	*f = flow{sibling: s.free}
+	s.free = f
+}
+
+// requeue moves a flow that just saw a packet to the back of the queue
+// its state now belongs in.
+func (s *shard) requeue(f *flow) {
+	q := f.queueFor()
+	if q == f.queue {
+		s.queues[q].moveToBack(f)
+		return
+	}
+	s.queues[f.queue].remove(f)
+	f.queue = q
+	s.queues[q].pushBack(f)
+}
+
+// end removes a flow, counting how its connection went, and adds its final
+// state to ended. That is only taken when there are end handlers to
+// report it to: exporting a flow allocates, and a full table ends one for
+// every new one.
+func (s *shard) end(f *flow, reason EndReason, ended []endedFlow) []endedFlow {
+	f.endTCP(reason, &s.stats)
+	if s.table.handlers.Load() != nil {
+		ended = append(ended, endedFlow{f.export(s.now, s.table.config.IdleTimeout), reason})
+	}
+	s.remove(f)
+	return ended
+}
+
+func (s *shard) classify(f *flow) {
+	classifier := s.table.classifier.Load()
+	if classifier == nil {
+		return
+	}
+	f.result = classifier.Classify(&classify.Flow{
+		Transport:     f.key.Protocol,
+		ClientIP:      f.key.SrcIP,
+		ServerIP:      f.key.DstIP,
+		ClientPort:    f.key.SrcPort,
+		ServerPort:    f.key.DstPort,
+		ClientPayload: f.directions[fromInitiator].payload,
+		ServerPayload: f.directions[fromResponder].payload,
+		Metadata:      f.metadata,
+	})
+}
+
+// expire ends the flows past their timeout and returns how many there
+// were, along with those to report.
+func (s *shard) expire(now time.Time) ([]endedFlow, int) {
+	if now.After(s.now) {
+		s.now = now
+	}
+
+	var ended []endedFlow
+	n := 0
+	for q := range s.queues {
+		reason := EndIdle
+		if queue(q) == queueClosed {
+			reason = EndClosed
+		}
+		timeout := s.table.timeout(queue(q))
+		for f := s.queues[q].front(); f != nil && now.Sub(f.lastSeen) > timeout; f = s.queues[q].front() {
+			ended = s.end(f, reason, ended)
+			n++
+		}
+	}
+	s.stats.Expired += uint64(n)
+	return ended, n
+}
+
+func (s *shard) flush() []endedFlow {
+	var ended []endedFlow
+	for q := range s.queues {
+		for f := s.queues[q].front(); f != nil; f = s.queues[q].front() {
+			ended = s.end(f, EndFlushed, ended)
+		}
+	}
+	return ended
+}
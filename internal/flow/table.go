@@ -0,0 +1,588 @@
+package flow
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/classify"
+)
+
+// payloadSample is how much of a flow's first payload is kept for the
+// classifier's signatures.
+const payloadSample = 64
+
+// minShardFlows is the fewest flows a shard is made to hold. Smaller
+// shards would leave eviction choosing among too few flows.
+const minShardFlows = 1024
+
+// NetworkFlow is a snapshot of one flow. The source is the side that
+// initiated it; Bytes and Packets count both directions.
+type NetworkFlow struct {
+	Key       Key    `json:"-"`
+	FlowKey   string `json:"flow_key"`
+	Interface int    `json:"interface"`
+	VLAN      uint16 `json:"vlan,omitempty"`
+	// TunnelID is the VNI or GRE key of the innermost tunnel carrying the
+	// flow, when it has one.
+	TunnelID     *uint32       `json:"tunnel_id,omitempty"`
+	SrcIP        string        `json:"src_ip"`
+	DstIP        string        `json:"dst_ip"`
+	SrcPort      uint16        `json:"src_port"`
+	DstPort      uint16        `json:"dst_port"`
+	Protocol     uint8         `json:"protocol"`
+	ProtocolName string        `json:"protocol_name"`
+	Bytes        uint64        `json:"bytes"`
+	Packets      uint64        `json:"packets"`
+	FirstSeen    time.Time     `json:"first_seen"`
+	LastSeen     time.Time     `json:"last_seen"`
+	Duration     time.Duration `json:"duration"`
+	// Initiator and Responder count what each side sent.
+	Initiator DirectionCounters `json:"initiator"`
+	Responder DirectionCounters `json:"responder"`
+	// InitiatorGuessed is set when the flow's start was missed and the
+	// initiator was told from the ports.
+	InitiatorGuessed bool `json:"initiator_guessed,omitempty"`
+	// Status is closed once a TCP connection is over, idle once no packet
+	// was seen for the idle timeout, and active otherwise.
+	Status      FlowStatus      `json:"status"`
+	TCPState    TCPState        `json:"tcp_state,omitempty"`
+	Hostname    string          `json:"hostname,omitempty"`
+	Application classify.Result `json:"application"`
+	TLS         *TLSInfo        `json:"tls,omitempty"`
+}
+
+// TLSInfo is what the TLS handshake of a flow, carried over TCP or inside
+// QUIC, revealed. The version and cipher are those the server chose.
+type TLSInfo struct {
+	Version  string `json:"version,omitempty"`
+	Cipher   string `json:"cipher,omitempty"`
+	JA3      string `json:"ja3,omitempty"`
+	JA3Hash  string `json:"ja3_hash,omitempty"`
+	JA4      string `json:"ja4,omitempty"`
+	JA3S     string `json:"ja3s,omitempty"`
+	JA3SHash string `json:"ja3s_hash,omitempty"`
+}
+
+// merge takes the fields other has, keeping the rest.
+func (i *TLSInfo) merge(other TLSInfo) {
+	if other.Version != "" {
+		i.Version = other.Version
+	}
+	if other.Cipher != "" {
+		i.Cipher = other.Cipher
+	}
+	if other.JA3 != "" {
+		i.JA3, i.JA3Hash = other.JA3, other.JA3Hash
+	}
+	if other.JA4 != "" {
+		i.JA4 = other.JA4
+	}
+	if other.JA3S != "" {
+		i.JA3S, i.JA3SHash = other.JA3S, other.JA3SHash
+	}
+}
+
+// EndReason tells why a flow left the table.
+type EndReason uint8
+
+const (
+	EndIdle    EndReason = iota // no packet for longer than the flow timeout
+	EndEvicted                  // dropped to make room for a new flow
+	EndFlushed                  // Flush was called
+	EndClosed                   // the TCP connection was over
+)
+
+func (r EndReason) String() string {
+	switch r {
+	case EndIdle:
+		return "idle"
+	case EndEvicted:
+		return "evicted"
+	case EndFlushed:
+		return "flushed"
+	case EndClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("end_reason(%d)", uint8(r))
+	}
+}
+
+func (r EndReason) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// EndHandler is called with the final state of every flow leaving the
+// table.
+type EndHandler func(flow NetworkFlow, reason EndReason)
+
+// Resolver names the host behind an address at a given time, as dns.Store
+// does from the DNS answers it has seen.
+type Resolver interface {
+	Hostname(ip netip.Addr, now time.Time) (string, bool)
+}
+
+type TableConfig struct {
+	// MaxFlows caps the flows tracked. The cap is shared out between the
+	// shards, and a full shard evicts one of its flows to make room.
+	MaxFlows int
+
+	// FlowTimeout is how long a flow may go without a packet before
+	// Expire removes it.
+	FlowTimeout time.Duration
+
+	// IdleTimeout is how long a flow may go without a packet before it is
+	// reported idle.
+	IdleTimeout time.Duration
+
+	// HandshakeTimeout is how long a TCP connection may wait for its
+	// handshake to complete before Expire removes it.
+	HandshakeTimeout time.Duration
+
+	// ClosedTimeout is how long a closed or reset TCP connection is kept
+	// for late segments before Expire removes it.
+	ClosedTimeout time.Duration
+
+	// Shards is how many parts the table is split into, each with a lock
+	// of its own. It is rounded down to a power of two, and to no more
+	// shards than leave each minShardFlows flows.
+	Shards int
+
+	// EvictionPolicy picks the flow a full shard drops.
+	EvictionPolicy EvictionPolicy
+}
+
+type TableStatistics struct {
+	Flows          int    `json:"flows"`
+	Shards         int    `json:"shards"`
+	Packets        uint64 `json:"packets"`
+	Bytes          uint64 `json:"bytes"`
+	NonIP          uint64 `json:"non_ip"`
+	Fragments      uint64 `json:"fragments"`
+	FlowsCreated   uint64 `json:"flows_created"`
+	Expired        uint64 `json:"expired"`
+	Evictions      uint64 `json:"evictions"`
+	EvictedPackets uint64 `json:"evicted_packets"`
+	EvictedBytes   uint64 `json:"evicted_bytes"`
+	// TCP connections. A failed handshake is a SYN that never saw a
+	// SYN-ACK; an incomplete connection is one whose handshake was cut
+	// short after the SYN-ACK, or whose start was missed.
+	Handshakes       uint64 `json:"handshakes"`
+	MidStream        uint64 `json:"mid_stream"`
+	FailedHandshakes uint64 `json:"failed_handshakes"`
+	Resets           uint64 `json:"resets"`
+	ClosedFIN        uint64 `json:"closed_fin"`
+	Incomplete       uint64 `json:"incomplete"`
+}
+
+func (s *TableStatistics) add(other TableStatistics) {
+	s.Flows += other.Flows
+	s.Packets += other.Packets
+	s.Bytes += other.Bytes
+	s.FlowsCreated += other.FlowsCreated
+	s.Expired += other.Expired
+	s.Evictions += other.Evictions
+	s.EvictedPackets += other.EvictedPackets
+	s.EvictedBytes += other.EvictedBytes
+	s.Handshakes += other.Handshakes
+	s.MidStream += other.MidStream
+	s.FailedHandshakes += other.FailedHandshakes
+	s.Resets += other.Resets
+	s.ClosedFIN += other.ClosedFIN
+	s.Incomplete += other.Incomplete
+}
+
+type flow struct {
+	key        Key // initiator first
+	guessed    bool
+	midStream  bool
+	directions [2]direction
+	firstSeen  time.Time
+	lastSeen   time.Time
+	metadata   classify.Metadata
+	result     classify.Result
+	tls        TLSInfo
+	tcpState   TCPState
+	queue      queue
+	links      [linkCount]link
+	sibling    *flow
+}
+
+// queue groups flows by the timeout that applies to them, so that each
+// list stays ordered by the time of the last packet.
+type queue int
+
+const (
+	queueOpen queue = iota
+	queueHandshake
+	queueClosed
+	queueCount
+)
+
+func (f *flow) queueFor() queue {
+	switch {
+	case f.tcpState.Finished():
+		return queueClosed
+	case f.tcpState == TCPStateSynSent || f.tcpState == TCPStateSynReceived:
+		return queueHandshake
+	default:
+		return queueOpen
+	}
+}
+
+type endedFlow struct {
+	flow   NetworkFlow
+	reason EndReason
+}
+
+// Table aggregates packets into flows keyed on Key, with both directions of
+// a conversation in one flow stored under the initiator's key. Byte counts
+// are those of the innermost IP datagram, headers included.
+//
+// The table is sharded on a hash of the flow's addresses and ports. Each
+// shard has its own lock, queues and share of MaxFlows, so an eviction only
+// ever looks at one shard, and callers on several goroutines only contend
+// when their flows share a shard. The classifier, resolver and end handlers
+// are read without locking.
+type Table struct {
+	mu         *sync.Mutex // serializes OnEnd
+	logger     *slog.Logger
+	config     TableConfig
+	shards     []*shard
+	mask       uint64
+	classifier atomic.Pointer[classify.Classifier]
+	resolver   atomic.Pointer[Resolver]
+	handlers   atomic.Pointer[[]EndHandler]
+	nonIP      atomic.Uint64
+	fragments  atomic.Uint64
+}
+
+func DefaultTableConfig() TableConfig {
+	return TableConfig{
+		MaxFlows:         100000,
+		FlowTimeout:      5 * time.Minute,
+		IdleTimeout:      30 * time.Second,
+		HandshakeTimeout: 30 * time.Second,
+		ClosedTimeout:    10 * time.Second,
+		Shards:           64,
+		EvictionPolicy:   EvictLRU,
+	}
+}
+
+func NewTable(logger *slog.Logger) *Table {
+	return NewTableWithConfig(logger, DefaultTableConfig())
+}
+
+func NewTableWithConfig(logger *slog.Logger, config TableConfig) *Table {
+	defaults := DefaultTableConfig()
+	if config.MaxFlows <= 0 {
+		config.MaxFlows = defaults.MaxFlows
+	}
+	if config.FlowTimeout <= 0 {
+		config.FlowTimeout = defaults.FlowTimeout
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaults.IdleTimeout
+	}
+	if config.HandshakeTimeout <= 0 {
+		config.HandshakeTimeout = defaults.HandshakeTimeout
+	}
+	if config.ClosedTimeout <= 0 {
+		config.ClosedTimeout = defaults.ClosedTimeout
+	}
+	if config.Shards <= 0 {
+		config.Shards = defaults.Shards
+	}
+
+	shards := 1
+	for shards*2 <= config.Shards && config.MaxFlows/(shards*2) >= minShardFlows {
+		shards *= 2
+	}
+	config.Shards = shards
+
+	t := &Table{
+		mu:     &sync.Mutex{},
+		logger: logger,
+		config: config,
+		shards: make([]*shard, shards),
+		mask:   uint64(shards - 1),
+	}
+	// The remainder of the division goes to the first shards, one flow
+	// each, so that the capacities add up to MaxFlows.
+	for i := range t.shards {
+		capacity := config.MaxFlows / shards
+		if i < config.MaxFlows%shards {
+			capacity++
+		}
+		t.shards[i] = newShard(t, capacity)
+	}
+	return t
+}
+
+// SetClassifier has flows labelled with their application as they are
+// created, show their first payload and gain metadata.
+func (t *Table) SetClassifier(classifier *classify.Classifier) {
+	t.classifier.Store(classifier)
+}
+
+// SetResolver has new flows named after the host their destination
+// address was resolved from.
+func (t *Table) SetResolver(resolver Resolver) {
+	t.resolver.Store(&resolver)
+}
+
+// OnEnd registers a handler for flows leaving the table. Handlers are
+// called from whichever goroutine made the flow leave, so from several at
+// once when the table is.
+func (t *Table) OnEnd(handler EndHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var handlers []EndHandler
+	if current := t.handlers.Load(); current != nil {
+		handlers = append(handlers, *current...)
+	}
+	handlers = append(handlers, handler)
+	t.handlers.Store(&handlers)
+}
+
+func (t *Table) shardIndex(tup tuple) int {
+	h := tup.hash()
+	return int((h ^ h>>32) & t.mask)
+}
+
+func (t *Table) shardOf(tup tuple) *shard {
+	return t.shards[t.shardIndex(tup)]
+}
+
+// ObservePacket counts a packet captured on the interface with the given
+// index against its flow, creating the flow if needed. Packets without IP
+// are ignored, as are fragments: pass the datagrams a capture.Reassembler
+// rebuilds instead, which count as one packet each. It may be called from
+// several goroutines at once.
+func (t *Table) ObservePacket(ifIndex int, packet *capture.ParsedPacket, timestamp time.Time) {
+	if o, ok := t.Observation(ifIndex, packet, timestamp); ok {
+		t.Apply(&o)
+	}
+}
+
+// timeout is how long a flow in q may go without a packet.
+func (t *Table) timeout(q queue) time.Duration {
+	switch q {
+	case queueHandshake:
+		return t.config.HandshakeTimeout
+	case queueClosed:
+		return t.config.ClosedTimeout
+	default:
+		return t.config.FlowTimeout
+	}
+}
+
+// Annotate attaches what a protocol analyzer decoded to the flows between
+// two endpoints, in either direction and on any interface or VLAN, and
+// returns how many were found. Empty fields of md, and of tls when it is
+// not nil, leave what the flows already had.
+func (t *Table) Annotate(protocol uint8, a, b netip.AddrPort, md classify.Metadata, tls *TLSInfo) int {
+	tup := newTuple(protocol, a, b)
+	s := t.shardOf(tup)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for f := s.tuples[tup]; f != nil; f = f.sibling {
+		if md.Protocol != "" {
+			f.metadata.Protocol = md.Protocol
+		}
+		if md.ALPN != "" {
+			f.metadata.ALPN = md.ALPN
+		}
+		if md.Hostname != "" {
+			f.metadata.Hostname = md.Hostname
+		}
+		if tls != nil {
+			f.tls.merge(*tls)
+		}
+		s.classify(f)
+		n++
+	}
+	return n
+}
+
+// Expire removes flows without a packet for longer than their timeout and
+// returns the number removed: closed TCP connections after the closed
+// timeout, unanswered handshakes after the handshake timeout and any other
+// flow after the flow timeout.
+func (t *Table) Expire(now time.Time) int {
+	expired := 0
+	for _, s := range t.shards {
+		s.mu.Lock()
+		ended, n := s.expire(now)
+		s.mu.Unlock()
+
+		t.notify(ended)
+		expired += n
+	}
+	return expired
+}
+
+// Flush removes every flow. It is meant for shutdown, so that end handlers
+// see the flows still in progress.
+func (t *Table) Flush() {
+	for _, s := range t.shards {
+		s.mu.Lock()
+		ended := s.flush()
+		s.mu.Unlock()
+
+		t.notify(ended)
+	}
+}
+
+// notify reports the flows that ended. It is called without any shard
+// locked so that handlers may call back into the table.
+func (t *Table) notify(ended []endedFlow) {
+	if len(ended) == 0 {
+		return
+	}
+	handlers := t.handlers.Load()
+	if handlers == nil {
+		return
+	}
+	for _, e := range ended {
+		for _, handler := range *handlers {
+			handler(e.flow, e.reason)
+		}
+	}
+}
+
+// Lookup finds the flow of a packet sent along key, in either direction.
+func (t *Table) Lookup(key Key) (NetworkFlow, bool) {
+	s := t.shardOf(key.tuple())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, _ := s.lookup(key)
+	if f == nil {
+		return NetworkFlow{}, false
+	}
+	return f.export(s.now, t.config.IdleTimeout), true
+}
+
+// Flows returns a snapshot of the table, largest flows first. Each shard
+// is copied in turn, so the snapshot is not taken at a single instant.
+func (t *Table) Flows() []NetworkFlow {
+	result := make([]NetworkFlow, 0, t.Len())
+	for _, s := range t.shards {
+		s.mu.Lock()
+		for _, f := range s.flows {
+			result = append(result, f.export(s.now, t.config.IdleTimeout))
+		}
+		s.mu.Unlock()
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Bytes != result[j].Bytes {
+			return result[i].Bytes > result[j].Bytes
+		}
+		return result[i].FlowKey < result[j].FlowKey
+	})
+	return result
+}
+
+func (t *Table) Len() int {
+	n := 0
+	for _, s := range t.shards {
+		s.mu.Lock()
+		n += len(s.flows)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// MetricsCollector receives flow table statistics; it is implemented by
+// the metrics collector.
+type MetricsCollector interface {
+	UpdateFlowMetrics(flows int, flowsCreated, expired, evictions, evictedPackets, evictedBytes uint64)
+}
+
+// ReportMetrics pushes the current statistics to collector.
+func (t *Table) ReportMetrics(collector MetricsCollector) {
+	stats := t.GetStatistics()
+	collector.UpdateFlowMetrics(stats.Flows, stats.FlowsCreated, stats.Expired,
+		stats.Evictions, stats.EvictedPackets, stats.EvictedBytes)
+}
+
+func (t *Table) GetStatistics() TableStatistics {
+	stats := TableStatistics{
+		Shards:    len(t.shards),
+		NonIP:     t.nonIP.Load(),
+		Fragments: t.fragments.Load(),
+	}
+	for _, s := range t.shards {
+		s.mu.Lock()
+		shardStats := s.stats
+		shardStats.Flows = len(s.flows)
+		s.mu.Unlock()
+
+		stats.add(shardStats)
+	}
+	return stats
+}
+
+func (f *flow) packets() uint64 {
+	return f.directions[fromInitiator].counters.Packets + f.directions[fromResponder].counters.Packets
+}
+
+func (f *flow) bytes() uint64 {
+	return f.directions[fromInitiator].counters.Bytes + f.directions[fromResponder].counters.Bytes
+}
+
+// export takes a snapshot of the flow as of now.
+func (f *flow) export(now time.Time, idleTimeout time.Duration) NetworkFlow {
+	initiator := f.directions[fromInitiator].counters
+	responder := f.directions[fromResponder].counters
+	status := StatusActive
+	switch {
+	case f.tcpState.Finished():
+		status = StatusClosed
+	case now.Sub(f.lastSeen) > idleTimeout:
+		status = StatusIdle
+	}
+	nf := NetworkFlow{
+		Key:              f.key,
+		FlowKey:          fmt.Sprintf("%016x", f.key.Hash()),
+		Interface:        f.key.Interface,
+		VLAN:             f.key.VLAN,
+		SrcIP:            f.key.SrcIP.String(),
+		DstIP:            f.key.DstIP.String(),
+		SrcPort:          f.key.SrcPort,
+		DstPort:          f.key.DstPort,
+		Protocol:         f.key.Protocol,
+		ProtocolName:     ProtocolName(f.key.Protocol),
+		Bytes:            initiator.Bytes + responder.Bytes,
+		Packets:          initiator.Packets + responder.Packets,
+		FirstSeen:        f.firstSeen,
+		LastSeen:         f.lastSeen,
+		Duration:         f.lastSeen.Sub(f.firstSeen),
+		Initiator:        initiator,
+		Responder:        responder,
+		InitiatorGuessed: f.guessed,
+		Status:           status,
+		TCPState:         f.tcpState,
+		Hostname:         f.metadata.Hostname,
+		Application:      f.result,
+	}
+	if f.key.HasTunnelID {
+		id := f.key.TunnelID
+		nf.TunnelID = &id
+	}
+	if f.tls != (TLSInfo{}) {
+		tls := f.tls
+		nf.TLS = &tls
+	}
+	return nf
+}
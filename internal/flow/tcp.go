@@ -0,0 +1,167 @@
+package flow
+
+import (
+	"fmt"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+)
+
+// TCPState is where a TCP flow is in the life of its connection, as far as
+// the packets seen tell.
+type TCPState uint8
+
+const (
+	TCPStateNone        TCPState = iota // not a TCP flow
+	TCPStateSynSent                     // the initiator's SYN is unanswered
+	TCPStateSynReceived                 // the responder answered with SYN-ACK
+	TCPStateEstablished                 // the handshake completed, or was missed
+	TCPStateHalfClosed                  // one side sent FIN
+	TCPStateClosed                      // both sides sent FIN
+	TCPStateReset                       // either side sent RST
+)
+
+func (s TCPState) String() string {
+	switch s {
+	case TCPStateNone:
+		return "none"
+	case TCPStateSynSent:
+		return "syn_sent"
+	case TCPStateSynReceived:
+		return "syn_received"
+	case TCPStateEstablished:
+		return "established"
+	case TCPStateHalfClosed:
+		return "half_closed"
+	case TCPStateClosed:
+		return "closed"
+	case TCPStateReset:
+		return "reset"
+	default:
+		return fmt.Sprintf("tcp_state(%d)", uint8(s))
+	}
+}
+
+func (s TCPState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Finished reports whether the connection is over.
+func (s TCPState) Finished() bool {
+	return s == TCPStateClosed || s == TCPStateReset
+}
+
+// FlowStatus is what the dashboard shows of a flow's lifecycle.
+type FlowStatus uint8
+
+const (
+	StatusActive FlowStatus = iota // a packet was seen within the idle timeout
+	StatusIdle                     // no packet for longer than the idle timeout
+	StatusClosed                   // the TCP connection was closed or reset
+)
+
+func (s FlowStatus) String() string {
+	switch s {
+	case StatusActive:
+		return "active"
+	case StatusIdle:
+		return "idle"
+	case StatusClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("flow_status(%d)", uint8(s))
+	}
+}
+
+func (s FlowStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// startTCP sets the state of a flow from its first segment. A connection
+// picked up mid-stream is taken as established.
+func (f *flow) startTCP(flags uint8, stats *TableStatistics) {
+	switch {
+	case flags&capture.TCPFlagSYN != 0 && flags&capture.TCPFlagACK == 0:
+		f.tcpState = TCPStateSynSent
+	case flags&capture.TCPFlagSYN != 0:
+		f.tcpState = TCPStateSynReceived
+	default:
+		f.tcpState = TCPStateEstablished
+		f.midStream = true
+		stats.MidStream++
+	}
+}
+
+// updateTCP moves the connection along for a segment sent in dir.
+func (f *flow) updateTCP(dir int, flags uint8, stats *TableStatistics) {
+	if f.tcpState.Finished() {
+		return
+	}
+
+	if flags&capture.TCPFlagRST != 0 {
+		f.abortHandshake(stats)
+		f.tcpState = TCPStateReset
+		stats.Resets++
+		return
+	}
+
+	syn := flags&capture.TCPFlagSYN != 0
+	ack := flags&capture.TCPFlagACK != 0
+	switch f.tcpState {
+	case TCPStateSynSent:
+		if dir == fromResponder && syn && ack {
+			f.tcpState = TCPStateSynReceived
+		} else if dir == fromInitiator && !syn && ack {
+			// The SYN-ACK went uncaptured but the initiator carried on.
+			f.tcpState = TCPStateEstablished
+			stats.Handshakes++
+		}
+	case TCPStateSynReceived:
+		if dir == fromInitiator && !syn && ack {
+			f.tcpState = TCPStateEstablished
+			stats.Handshakes++
+		}
+	}
+
+	if flags&capture.TCPFlagFIN != 0 {
+		f.directions[dir].fin = true
+		if f.directions[fromInitiator].fin && f.directions[fromResponder].fin {
+			f.tcpState = TCPStateClosed
+			stats.ClosedFIN++
+		} else if f.tcpState == TCPStateEstablished {
+			f.tcpState = TCPStateHalfClosed
+		}
+	}
+}
+
+// endTCP counts how a connection that is leaving the table went, unless it
+// is being flushed at shutdown. A connection picked up mid-stream is
+// incomplete however it ends; one that was established and merely went
+// quiet is not counted, as it may well be alive.
+func (f *flow) endTCP(reason EndReason, stats *TableStatistics) {
+	if reason == EndFlushed {
+		return
+	}
+	if f.midStream {
+		stats.Incomplete++
+		return
+	}
+	f.abortHandshake(stats)
+}
+
+// abortHandshake counts a handshake cut short, by a reset or by leaving the
+// table: a SYN never answered failed, one answered but never acknowledged
+// is incomplete.
+func (f *flow) abortHandshake(stats *TableStatistics) {
+	switch f.tcpState {
+	case TCPStateSynSent:
+		stats.FailedHandshakes++
+	case TCPStateSynReceived:
+		stats.Incomplete++
+	}
+}
+
+// reused reports whether a segment opens a new connection on the ports of
+// one that is over.
+func (f *flow) reused(flags uint8) bool {
+	return f.tcpState.Finished() && flags&capture.TCPFlagSYN != 0 && flags&capture.TCPFlagACK == 0
+}
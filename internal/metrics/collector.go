@@ -11,6 +11,8 @@ type SystemMetricsCollector struct {
 	logger            *slog.Logger
 	captureStatistics CaptureMetrics
 	systemStatistics  SystemMetrics
+	decodeStatistics  DecodeMetrics
+	flowStatistics    FlowMetrics
 	enabled           bool
 }
 
@@ -33,9 +35,31 @@ type SystemMetrics struct {
 	LastUpdateTime     time.Time `json:"last_update_time"`
 }
 
+// DecodeMetrics counts frames the packet decoder could not fully decode,
+// keyed by layer and then by reason, and bad checksums keyed by protocol.
+type DecodeMetrics struct {
+	PacketsDecoded uint64                       `json:"packets_decoded"`
+	PacketsFailed  uint64                       `json:"packets_failed"`
+	Failures       map[string]map[string]uint64 `json:"failures"`
+	ChecksumErrors map[string]uint64            `json:"checksum_errors"`
+}
+
+// FlowMetrics counts the flows tracked by the flow table and those it had
+// to evict to make room for new ones.
+type FlowMetrics struct {
+	Flows          int    `json:"flows"`
+	FlowsCreated   uint64 `json:"flows_created"`
+	Expired        uint64 `json:"expired"`
+	Evictions      uint64 `json:"evictions"`
+	EvictedPackets uint64 `json:"evicted_packets"`
+	EvictedBytes   uint64 `json:"evicted_bytes"`
+}
+
 type AllMetrics struct {
 	Capture CaptureMetrics `json:"capture"`
 	System  SystemMetrics  `json:"system"`
+	Decode  DecodeMetrics  `json:"decode"`
+	Flow    FlowMetrics    `json:"flow"`
 	Updated time.Time      `json:"updated"`
 }
 
@@ -105,6 +129,56 @@ func (smc *SystemMetricsCollector) UpdateSystemMetrics(
 		slog.Int("goroutines", goroutineCount))
 }
 
+func (smc *SystemMetricsCollector) UpdateDecodeMetrics(
+	packetsDecoded, packetsFailed uint64,
+	failures map[string]map[string]uint64,
+	checksumErrors map[string]uint64,
+) {
+	smc.mu.Lock()
+	defer smc.mu.Unlock()
+
+	if !smc.enabled {
+		return
+	}
+
+	smc.decodeStatistics = DecodeMetrics{
+		PacketsDecoded: packetsDecoded,
+		PacketsFailed:  packetsFailed,
+		Failures:       copyFailures(failures),
+		ChecksumErrors: copyCounts(checksumErrors),
+	}
+
+	smc.logger.Debug("updated decode metrics",
+		slog.Uint64("packets_decoded", packetsDecoded),
+		slog.Uint64("packets_failed", packetsFailed))
+}
+
+func (smc *SystemMetricsCollector) UpdateFlowMetrics(
+	flows int,
+	flowsCreated, expired, evictions, evictedPackets, evictedBytes uint64,
+) {
+	smc.mu.Lock()
+	defer smc.mu.Unlock()
+
+	if !smc.enabled {
+		return
+	}
+
+	smc.flowStatistics = FlowMetrics{
+		Flows:          flows,
+		FlowsCreated:   flowsCreated,
+		Expired:        expired,
+		Evictions:      evictions,
+		EvictedPackets: evictedPackets,
+		EvictedBytes:   evictedBytes,
+	}
+
+	smc.logger.Debug("updated flow metrics",
+		slog.Int("flows", flows),
+		slog.Uint64("evictions", evictions),
+		slog.Uint64("evicted_bytes", evictedBytes))
+}
+
 func (smc *SystemMetricsCollector) GetCaptureMetrics() CaptureMetrics {
 	smc.mu.RLock()
 	defer smc.mu.RUnlock()
@@ -117,6 +191,19 @@ func (smc *SystemMetricsCollector) GetSystemMetrics() SystemMetrics {
 	return smc.systemStatistics
 }
 
+// GetDecodeMetrics returns a copy that the caller may modify.
+func (smc *SystemMetricsCollector) GetDecodeMetrics() DecodeMetrics {
+	smc.mu.RLock()
+	defer smc.mu.RUnlock()
+	return smc.decodeStatistics.copy()
+}
+
+func (smc *SystemMetricsCollector) GetFlowMetrics() FlowMetrics {
+	smc.mu.RLock()
+	defer smc.mu.RUnlock()
+	return smc.flowStatistics
+}
+
 func (smc *SystemMetricsCollector) GetAllMetrics() AllMetrics {
 	smc.mu.RLock()
 	defer smc.mu.RUnlock()
@@ -124,6 +211,8 @@ func (smc *SystemMetricsCollector) GetAllMetrics() AllMetrics {
 	return AllMetrics{
 		Capture: smc.captureStatistics,
 		System:  smc.systemStatistics,
+		Decode:  smc.decodeStatistics.copy(),
+		Flow:    smc.flowStatistics,
 		Updated: time.Now(),
 	}
 }
@@ -154,6 +243,36 @@ func (smc *SystemMetricsCollector) Reset() {
 
 	smc.captureStatistics = CaptureMetrics{}
 	smc.systemStatistics = SystemMetrics{}
+	smc.decodeStatistics = DecodeMetrics{}
+	smc.flowStatistics = FlowMetrics{}
 
 	smc.logger.Info("metrics reset")
-}
\ No newline at end of file
+}
+
+func (m DecodeMetrics) copy() DecodeMetrics {
+	m.Failures = copyFailures(m.Failures)
+	m.ChecksumErrors = copyCounts(m.ChecksumErrors)
+	return m
+}
+
+func copyFailures(failures map[string]map[string]uint64) map[string]map[string]uint64 {
+	if failures == nil {
+		return nil
+	}
+	out := make(map[string]map[string]uint64, len(failures))
+	for layer, reasons := range failures {
+		out[layer] = copyCounts(reasons)
+	}
+	return out
+}
+
+func copyCounts(counts map[string]uint64) map[string]uint64 {
+	if counts == nil {
+		return nil
+	}
+	out := make(map[string]uint64, len(counts))
+	for k, v := range counts {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,272 @@
+package neighbor
+
+import (
+	"container/list"
+	"log/slog"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+)
+
+// Entry is one learned IP to MAC binding.
+type Entry struct {
+	IP           string    `json:"ip"`
+	MAC          string    `json:"mac"`
+	PreviousMAC  string    `json:"previous_mac,omitempty"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	Observations uint64    `json:"observations"`
+	MACChanges   uint64    `json:"mac_changes"`
+	Gratuitous   uint64    `json:"gratuitous"`
+}
+
+type TableConfig struct {
+	MaxEntries int
+	EntryTTL   time.Duration
+}
+
+type TableStatistics struct {
+	Entries       int    `json:"entries"`
+	ARPRequests   uint64 `json:"arp_requests"`
+	ARPReplies    uint64 `json:"arp_replies"`
+	ARPGratuitous uint64 `json:"arp_gratuitous"`
+	ARPProbes     uint64 `json:"arp_probes"`
+	MACChanges    uint64 `json:"mac_changes"`
+	Evictions     uint64 `json:"evictions"`
+	Expired       uint64 `json:"expired"`
+}
+
+type entry struct {
+	ip           netip.Addr
+	element      *list.Element
+	mac          capture.MACAddr
+	previousMAC  capture.MACAddr
+	firstSeen    time.Time
+	lastSeen     time.Time
+	observations uint64
+	macChanges   uint64
+	gratuitous   uint64
+}
+
+// Table is a live IP to MAC neighbor table learned from observed ARP traffic.
+type Table struct {
+	mu      *sync.RWMutex
+	logger  *slog.Logger
+	config  TableConfig
+	entries map[netip.Addr]*entry
+	order   *list.List // *entry, least recently seen first
+	stats   TableStatistics
+}
+
+func DefaultTableConfig() TableConfig {
+	return TableConfig{
+		MaxEntries: 65536,
+		EntryTTL:   4 * time.Hour,
+	}
+}
+
+func NewTable(logger *slog.Logger) *Table {
+	return NewTableWithConfig(logger, DefaultTableConfig())
+}
+
+func NewTableWithConfig(logger *slog.Logger, config TableConfig) *Table {
+	defaults := DefaultTableConfig()
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = defaults.MaxEntries
+	}
+	if config.EntryTTL <= 0 {
+		config.EntryTTL = defaults.EntryTTL
+	}
+
+	return &Table{
+		mu:      &sync.RWMutex{},
+		logger:  logger,
+		config:  config,
+		entries: make(map[netip.Addr]*entry),
+		order:   list.New(),
+	}
+}
+
+// ObservePacket learns the sender binding of an Ethernet/IPv4 ARP packet.
+// Packets without ARP, probes and non-Ethernet ARP are ignored.
+func (t *Table) ObservePacket(packet *capture.ParsedPacket, timestamp time.Time) {
+	if packet == nil || packet.ARP == nil {
+		return
+	}
+	arp := packet.ARP
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch arp.Operation {
+	case capture.ARPOperationRequest:
+		t.stats.ARPRequests++
+	case capture.ARPOperationReply:
+		t.stats.ARPReplies++
+	}
+
+	if arp.HardwareType != capture.ARPHardwareEthernet || arp.ProtocolType != capture.EtherTypeIPv4 ||
+		!arp.SenderIP.Is4() {
+		return
+	}
+
+	if arp.IsProbe() {
+		t.stats.ARPProbes++
+		return
+	}
+
+	gratuitous := arp.IsGratuitous()
+	if gratuitous {
+		t.stats.ARPGratuitous++
+	}
+
+	t.learn(arp.SenderIP, arp.SenderMAC, gratuitous, timestamp)
+}
+
+func (t *Table) learn(ip netip.Addr, mac capture.MACAddr, gratuitous bool, timestamp time.Time) {
+	e, exists := t.entries[ip]
+	if !exists {
+		if len(t.entries) >= t.config.MaxEntries {
+			t.remove(t.order.Front().Value.(*entry))
+			t.stats.Evictions++
+		}
+		e = &entry{
+			ip:        ip,
+			mac:       mac,
+			firstSeen: timestamp,
+		}
+		e.element = t.order.PushBack(e)
+		t.entries[ip] = e
+		t.logger.Debug("learned neighbor",
+			slog.String("ip", ip.String()),
+			slog.String("mac", mac.String()))
+	} else {
+		t.order.MoveToBack(e.element)
+		if e.mac != mac {
+			e.previousMAC = e.mac
+			e.mac = mac
+			e.macChanges++
+			t.stats.MACChanges++
+			t.logger.Info("neighbor MAC address changed",
+				slog.String("ip", ip.String()),
+				slog.String("previous_mac", e.previousMAC.String()),
+				slog.String("mac", mac.String()))
+		}
+	}
+
+	if timestamp.After(e.lastSeen) {
+		e.lastSeen = timestamp
+	}
+	e.observations++
+	if gratuitous {
+		e.gratuitous++
+	}
+}
+
+func (t *Table) remove(e *entry) {
+	delete(t.entries, e.ip)
+	t.order.Remove(e.element)
+}
+
+// Lookup returns the binding learned for ip.
+func (t *Table) Lookup(ip netip.Addr) (Entry, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	ip = ip.Unmap()
+	e, exists := t.entries[ip]
+	if !exists {
+		return Entry{}, false
+	}
+	return e.export(ip), true
+}
+
+// LookupMAC returns every IP currently bound to the given MAC address.
+func (t *Table) LookupMAC(mac capture.MACAddr) []Entry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var result []Entry
+	for ip, e := range t.entries {
+		if e.mac == mac {
+			result = append(result, e.export(ip))
+		}
+	}
+	sortEntries(result)
+	return result
+}
+
+// Entries returns a snapshot of the table ordered by IP address.
+func (t *Table) Entries() []Entry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	result := make([]Entry, 0, len(t.entries))
+	for ip, e := range t.entries {
+		result = append(result, e.export(ip))
+	}
+	sortEntries(result)
+	return result
+}
+
+// Expire removes entries not seen within the configured TTL and returns the
+// number removed. Entries are visited least recently seen first, up to the
+// first one still fresh.
+func (t *Table) Expire(now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	removed := 0
+	for t.order.Len() > 0 {
+		e := t.order.Front().Value.(*entry)
+		if now.Sub(e.lastSeen) <= t.config.EntryTTL {
+			break
+		}
+		t.remove(e)
+		removed++
+	}
+	t.stats.Expired += uint64(removed)
+	return removed
+}
+
+func (t *Table) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.entries)
+}
+
+func (t *Table) GetStatistics() TableStatistics {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	stats := t.stats
+	stats.Entries = len(t.entries)
+	return stats
+}
+
+func (e *entry) export(ip netip.Addr) Entry {
+	out := Entry{
+		IP:           ip.String(),
+		MAC:          e.mac.String(),
+		FirstSeen:    e.firstSeen,
+		LastSeen:     e.lastSeen,
+		Observations: e.observations,
+		MACChanges:   e.macChanges,
+		Gratuitous:   e.gratuitous,
+	}
+	if e.macChanges > 0 {
+		out.PreviousMAC = e.previousMAC.String()
+	}
+	return out
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, _ := netip.ParseAddr(entries[i].IP)
+		b, _ := netip.ParseAddr(entries[j].IP)
+		return a.Less(b)
+	})
+}
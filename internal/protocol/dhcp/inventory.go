@@ -0,0 +1,683 @@
+package dhcp
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+)
+
+// Lease is one address assignment acknowledged by a server.
+type Lease struct {
+	MAC       string        `json:"mac"`
+	IP        string        `json:"ip"`
+	Hostname  string        `json:"hostname,omitempty"`
+	Server    string        `json:"server,omitempty"`
+	LeaseTime time.Duration `json:"lease_time"`
+	// FirstSeen is the acknowledgement that granted the lease, LastSeen the
+	// latest renewal.
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Expires   time.Time `json:"expires"`
+	Released  bool      `json:"released,omitempty"`
+}
+
+// Client is what DHCP revealed about one device, with its leases oldest
+// first.
+type Client struct {
+	MAC         string    `json:"mac"`
+	Hostname    string    `json:"hostname,omitempty"`
+	VendorClass string    `json:"vendor_class,omitempty"`
+	DUID        string    `json:"duid,omitempty"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Leases      []Lease   `json:"leases,omitempty"`
+}
+
+// Server is a DHCP server seen answering clients.
+type Server struct {
+	IP        string    `json:"ip"`
+	MAC       string    `json:"mac,omitempty"`
+	DUID      string    `json:"duid,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Offers    uint64    `json:"offers"`
+	Acks      uint64    `json:"acks"`
+	Naks      uint64    `json:"naks"`
+	// Authorized is set for servers in the configured list, and Rogue for
+	// the others when there is one.
+	Authorized bool `json:"authorized"`
+	Rogue      bool `json:"rogue"`
+}
+
+type InventoryConfig struct {
+	// MaxClients caps the devices tracked; the least recently seen is
+	// dropped to make room.
+	MaxClients int
+
+	// MaxLeasesPerClient caps the lease history kept per device.
+	MaxLeasesPerClient int
+
+	// MaxServers caps the servers tracked. Servers past the cap are still
+	// counted and, when rogue, logged.
+	MaxServers int
+
+	// LeaseRetention is how long expired leases, and devices without
+	// leases, are kept before Expire removes them.
+	LeaseRetention time.Duration
+
+	// AuthorizedServers are the addresses of the DHCP servers expected on
+	// the segment; DHCPv6 servers are identified by their source address.
+	// When set, any other server answering is reported as rogue.
+	AuthorizedServers []netip.Addr
+}
+
+type InventoryStatistics struct {
+	Clients        int    `json:"clients"`
+	Leases         int    `json:"leases"`
+	Servers        int    `json:"servers"`
+	RogueServers   int    `json:"rogue_servers"`
+	Messages       uint64 `json:"messages"`
+	Messages6      uint64 `json:"messages6"`
+	Acks           uint64 `json:"acks"`
+	Naks           uint64 `json:"naks"`
+	Releases       uint64 `json:"releases"`
+	DecodeErrors   uint64 `json:"decode_errors"`
+	UnknownClients uint64 `json:"unknown_clients"`
+	ServersDropped uint64 `json:"servers_dropped"`
+	Evictions      uint64 `json:"evictions"`
+	Expired        uint64 `json:"expired"`
+}
+
+// ServerHandler is called the first time a server is seen answering.
+type ServerHandler func(server Server)
+
+type client struct {
+	mac         capture.MACAddr
+	element     *list.Element
+	hostname    string
+	vendorClass string
+	duid        []byte
+	firstSeen   time.Time
+	lastSeen    time.Time
+	leases      []*lease // oldest first
+}
+
+type lease struct {
+	ip        netip.Addr
+	hostname  string
+	server    netip.Addr
+	leaseTime time.Duration
+	firstSeen time.Time
+	lastSeen  time.Time
+	expires   time.Time
+	released  bool
+}
+
+type server struct {
+	mac        capture.MACAddr
+	duid       []byte
+	firstSeen  time.Time
+	lastSeen   time.Time
+	offers     uint64
+	acks       uint64
+	naks       uint64
+	authorized bool
+	rogue      bool
+}
+
+// Inventory keeps the leases and servers learned from observed DHCPv4 and
+// DHCPv6 traffic, keyed by client MAC address.
+type Inventory struct {
+	mu       *sync.RWMutex
+	logger   *slog.Logger
+	config   InventoryConfig
+	handlers []ServerHandler
+	clients  map[capture.MACAddr]*client
+	order    *list.List // *client, least recently seen first
+	duids    map[string]capture.MACAddr
+	servers  map[netip.Addr]*server
+	stats    InventoryStatistics
+}
+
+func DefaultInventoryConfig() InventoryConfig {
+	return InventoryConfig{
+		MaxClients:         65536,
+		MaxLeasesPerClient: 16,
+		MaxServers:         256,
+		LeaseRetention:     7 * 24 * time.Hour,
+	}
+}
+
+func NewInventory(logger *slog.Logger) *Inventory {
+	return NewInventoryWithConfig(logger, DefaultInventoryConfig())
+}
+
+func NewInventoryWithConfig(logger *slog.Logger, config InventoryConfig) *Inventory {
+	defaults := DefaultInventoryConfig()
+	if config.MaxClients <= 0 {
+		config.MaxClients = defaults.MaxClients
+	}
+	if config.MaxLeasesPerClient <= 0 {
+		config.MaxLeasesPerClient = defaults.MaxLeasesPerClient
+	}
+	if config.MaxServers <= 0 {
+		config.MaxServers = defaults.MaxServers
+	}
+	if config.LeaseRetention <= 0 {
+		config.LeaseRetention = defaults.LeaseRetention
+	}
+
+	return &Inventory{
+		mu:      &sync.RWMutex{},
+		logger:  logger,
+		config:  config,
+		clients: make(map[capture.MACAddr]*client),
+		order:   list.New(),
+		duids:   make(map[string]capture.MACAddr),
+		servers: make(map[netip.Addr]*server),
+	}
+}
+
+// OnServer registers a handler for servers first seen from now on, such as
+// an alert on rogue ones.
+func (inv *Inventory) OnServer(handler ServerHandler) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.handlers = append(inv.handlers, handler)
+}
+
+// ObservePacket decodes DHCPv4 on UDP ports 67 and 68 and DHCPv6 on 546
+// and 547. Other packets are ignored.
+func (inv *Inventory) ObservePacket(packet *capture.ParsedPacket, timestamp time.Time) {
+	if packet == nil || packet.UDP == nil {
+		return
+	}
+	udp := packet.UDP
+
+	var src netip.Addr
+	switch {
+	case packet.IPv4 != nil:
+		src = packet.IPv4.SrcIP
+	case packet.IPv6 != nil:
+		src = packet.IPv6.SrcIP
+	}
+	var srcMAC capture.MACAddr
+	if packet.Ethernet != nil {
+		srcMAC = packet.Ethernet.SrcMAC
+	}
+
+	switch {
+	case isPort(udp, ServerPort, ClientPort):
+		msg, err := Decode(packet.Payload)
+		if err != nil {
+			inv.decodeError(err)
+			return
+		}
+		inv.Observe(msg, src, srcMAC, timestamp)
+	case isPort(udp, ServerPort6, ClientPort6):
+		msg, err := Decode6(packet.Payload)
+		if err != nil {
+			inv.decodeError(err)
+			return
+		}
+		inv.Observe6(msg, src, srcMAC, timestamp)
+	}
+}
+
+// isPort reports whether a datagram goes between the two ports, or from
+// and to the server port as between relays.
+func isPort(udp *capture.UDPHeader, serverPort, clientPort uint16) bool {
+	return (udp.SrcPort == serverPort || udp.SrcPort == clientPort) &&
+		(udp.DstPort == serverPort || udp.DstPort == clientPort)
+}
+
+func (inv *Inventory) decodeError(err error) {
+	inv.mu.Lock()
+	inv.stats.DecodeErrors++
+	inv.mu.Unlock()
+	inv.logger.Debug("failed to decode DHCP message", slog.String("error", err.Error()))
+}
+
+// Observe learns from a DHCPv4 message sent from src, whose frame came
+// from srcMAC.
+func (inv *Inventory) Observe(msg *Message, src netip.Addr, srcMAC capture.MACAddr, timestamp time.Time) {
+	inv.mu.Lock()
+	inv.stats.Messages++
+
+	var newServer *Server
+	serverID := msg.ServerID
+	if !serverID.IsValid() {
+		serverID = src
+	}
+	if msg.MessageType.FromServer() {
+		newServer = inv.server(serverID, srcMAC, nil, timestamp, msg.MessageType == MessageTypeOffer,
+			msg.MessageType == MessageTypeAck, msg.MessageType == MessageTypeNak)
+	}
+
+	if msg.ClientMAC != (capture.MACAddr{}) {
+		c := inv.client(msg.ClientMAC, timestamp)
+		if !msg.MessageType.FromServer() {
+			c.identify(msg.Hostname, msg.VendorClass)
+		}
+
+		switch msg.MessageType {
+		case MessageTypeAck:
+			inv.stats.Acks++
+			// An ACK to an INFORM assigns no address.
+			if msg.YourIP.IsValid() && !msg.YourIP.IsUnspecified() {
+				hostname := msg.Hostname
+				if hostname == "" {
+					hostname = c.hostname
+				}
+				inv.grant(c, msg.ClientMAC, msg.YourIP, hostname, serverID, msg.LeaseTime, timestamp)
+			}
+		case MessageTypeNak:
+			inv.stats.Naks++
+		case MessageTypeRelease:
+			inv.stats.Releases++
+			c.release(msg.ClientIP, timestamp)
+		case MessageTypeDecline:
+			c.release(msg.RequestedIP, timestamp)
+		}
+	}
+	inv.unlockAndNotify(newServer)
+}
+
+// Observe6 learns from a DHCPv6 message sent from src, whose frame came
+// from srcMAC. Clients are identified by the MAC address in their DUID,
+// or else the one their messages came from.
+func (inv *Inventory) Observe6(msg *Message6, src netip.Addr, srcMAC capture.MACAddr, timestamp time.Time) {
+	inv.mu.Lock()
+	inv.stats.Messages6++
+
+	var newServer *Server
+	fromServer := msg.MessageType.FromServer()
+	if fromServer {
+		newServer = inv.server(src, srcMAC, msg.ServerDUID, timestamp, msg.MessageType == MessageType6Advertise,
+			msg.MessageType == MessageType6Reply && msg.StatusCode == 0, msg.MessageType == MessageType6Reply && msg.StatusCode != 0)
+	}
+
+	mac, known := DUIDLinkLayerAddress(msg.ClientDUID)
+	if !known {
+		mac, known = inv.duids[string(msg.ClientDUID)]
+	}
+	// Without relays, a client's own messages come from its MAC address.
+	if !known && !fromServer && msg.Hops == 0 && len(msg.ClientDUID) > 0 && srcMAC != (capture.MACAddr{}) {
+		mac, known = srcMAC, true
+	}
+	if !known {
+		if len(msg.ClientDUID) > 0 {
+			inv.stats.UnknownClients++
+		}
+		inv.unlockAndNotify(newServer)
+		return
+	}
+
+	c := inv.client(mac, timestamp)
+	if c.duid == nil && len(msg.ClientDUID) > 0 {
+		c.duid = bytes.Clone(msg.ClientDUID)
+		inv.duids[string(c.duid)] = mac
+	}
+	if !fromServer {
+		c.identify(msg.Hostname, msg.VendorClass)
+	}
+
+	switch msg.MessageType {
+	case MessageType6Reply:
+		if msg.StatusCode != 0 {
+			inv.stats.Naks++
+			break
+		}
+		inv.stats.Acks++
+		for _, addr := range msg.Addresses {
+			if addr.ValidLifetime == 0 {
+				c.release(addr.IP, timestamp)
+				continue
+			}
+			hostname := msg.Hostname
+			if hostname == "" {
+				hostname = c.hostname
+			}
+			inv.grant(c, mac, addr.IP, hostname, src, addr.ValidLifetime, timestamp)
+		}
+	case MessageType6Release, MessageType6Decline:
+		if msg.MessageType == MessageType6Release {
+			inv.stats.Releases++
+		}
+		for _, addr := range msg.Addresses {
+			c.release(addr.IP, timestamp)
+		}
+	}
+	inv.unlockAndNotify(newServer)
+}
+
+func (inv *Inventory) unlockAndNotify(newServer *Server) {
+	handlers := inv.handlers
+	inv.mu.Unlock()
+
+	if newServer == nil {
+		return
+	}
+	for _, handler := range handlers {
+		handler(*newServer)
+	}
+}
+
+func (inv *Inventory) client(mac capture.MACAddr, timestamp time.Time) *client {
+	c, exists := inv.clients[mac]
+	if !exists {
+		if len(inv.clients) >= inv.config.MaxClients {
+			oldest := inv.order.Front().Value.(*client)
+			inv.remove(oldest.mac, oldest)
+			inv.stats.Evictions++
+		}
+		c = &client{mac: mac, firstSeen: timestamp}
+		c.element = inv.order.PushBack(c)
+		inv.clients[mac] = c
+	} else {
+		inv.order.MoveToBack(c.element)
+	}
+	if timestamp.After(c.lastSeen) {
+		c.lastSeen = timestamp
+	}
+	return c
+}
+
+func (inv *Inventory) remove(mac capture.MACAddr, c *client) {
+	delete(inv.clients, mac)
+	inv.order.Remove(c.element)
+	if c.duid != nil {
+		delete(inv.duids, string(c.duid))
+	}
+}
+
+func (c *client) identify(hostname, vendorClass string) {
+	if hostname != "" {
+		c.hostname = hostname
+	}
+	if vendorClass != "" {
+		c.vendorClass = vendorClass
+	}
+}
+
+// grant records an acknowledged lease, extending the current one when it is
+// a renewal.
+func (inv *Inventory) grant(c *client, mac capture.MACAddr, ip netip.Addr, hostname string, srv netip.Addr, leaseTime time.Duration, timestamp time.Time) {
+	for _, l := range c.leases {
+		if l.ip == ip && !l.released && !timestamp.After(l.expires) {
+			l.lastSeen = timestamp
+			l.leaseTime = leaseTime
+			l.expires = timestamp.Add(leaseTime)
+			if hostname != "" {
+				l.hostname = hostname
+			}
+			if srv.IsValid() {
+				l.server = srv
+			}
+			return
+		}
+	}
+
+	if len(c.leases) >= inv.config.MaxLeasesPerClient {
+		c.leases = slices.Delete(c.leases, 0, 1)
+	}
+	c.leases = append(c.leases, &lease{
+		ip:        ip,
+		hostname:  hostname,
+		server:    srv,
+		leaseTime: leaseTime,
+		firstSeen: timestamp,
+		lastSeen:  timestamp,
+		expires:   timestamp.Add(leaseTime),
+	})
+	inv.logger.Debug("learned DHCP lease",
+		slog.String("mac", mac.String()),
+		slog.String("ip", ip.String()),
+		slog.String("hostname", hostname))
+}
+
+func (c *client) release(ip netip.Addr, timestamp time.Time) {
+	if !ip.IsValid() {
+		return
+	}
+	for _, l := range c.leases {
+		if l.ip == ip && !l.released {
+			l.released = true
+			if timestamp.Before(l.expires) {
+				l.expires = timestamp
+			}
+		}
+	}
+}
+
+// server counts an answer from a server and returns it if it is new.
+func (inv *Inventory) server(ip netip.Addr, mac capture.MACAddr, duid []byte, timestamp time.Time, offer, ack, nak bool) *Server {
+	if !ip.IsValid() {
+		return nil
+	}
+	s, exists := inv.servers[ip]
+	if !exists {
+		s = &server{
+			mac:        mac,
+			duid:       bytes.Clone(duid),
+			firstSeen:  timestamp,
+			authorized: slices.Contains(inv.config.AuthorizedServers, ip),
+		}
+		s.rogue = len(inv.config.AuthorizedServers) > 0 && !s.authorized
+		if s.rogue {
+			inv.logger.Warn("rogue DHCP server answering",
+				slog.String("ip", ip.String()),
+				slog.String("mac", mac.String()))
+		}
+		if len(inv.servers) >= inv.config.MaxServers {
+			inv.stats.ServersDropped++
+			return nil
+		}
+		inv.servers[ip] = s
+	}
+
+	if timestamp.After(s.lastSeen) {
+		s.lastSeen = timestamp
+	}
+	switch {
+	case offer:
+		s.offers++
+	case ack:
+		s.acks++
+	case nak:
+		s.naks++
+	}
+	if exists {
+		return nil
+	}
+	out := s.export(ip)
+	return &out
+}
+
+// LookupMAC returns what is known of a device.
+func (inv *Inventory) LookupMAC(mac net.HardwareAddr) (Client, bool) {
+	if len(mac) != len(capture.MACAddr{}) {
+		return Client{}, false
+	}
+
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	c, exists := inv.clients[capture.MACAddr(mac)]
+	if !exists {
+		return Client{}, false
+	}
+	return c.export(capture.MACAddr(mac)), true
+}
+
+// LookupIP returns the most recent lease of an address that was still
+// active at the given time.
+func (inv *Inventory) LookupIP(ip netip.Addr, at time.Time) (Lease, bool) {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	ip = ip.Unmap()
+	var found *lease
+	var foundMAC capture.MACAddr
+	for mac, c := range inv.clients {
+		for _, l := range c.leases {
+			if l.ip != ip || at.Before(l.firstSeen) || at.After(l.expires) {
+				continue
+			}
+			if found == nil || l.lastSeen.After(found.lastSeen) {
+				found, foundMAC = l, mac
+			}
+		}
+	}
+	if found == nil {
+		return Lease{}, false
+	}
+	return found.export(foundMAC), true
+}
+
+// Clients returns a snapshot of the inventory ordered by MAC address.
+func (inv *Inventory) Clients() []Client {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	result := make([]Client, 0, len(inv.clients))
+	for mac, c := range inv.clients {
+		result = append(result, c.export(mac))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].MAC < result[j].MAC
+	})
+	return result
+}
+
+// Servers returns the servers seen answering, rogue ones first.
+func (inv *Inventory) Servers() []Server {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	ips := make([]netip.Addr, 0, len(inv.servers))
+	for ip := range inv.servers {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		a, b := inv.servers[ips[i]], inv.servers[ips[j]]
+		if a.rogue != b.rogue {
+			return a.rogue
+		}
+		return ips[i].Less(ips[j])
+	})
+
+	result := make([]Server, 0, len(ips))
+	for _, ip := range ips {
+		result = append(result, inv.servers[ip].export(ip))
+	}
+	return result
+}
+
+// Expire removes leases that expired more than the retention ago, and
+// devices left without leases and not seen within it. It returns the
+// number of leases removed.
+func (inv *Inventory) Expire(now time.Time) int {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	removed := 0
+	for mac, c := range inv.clients {
+		kept := c.leases[:0]
+		for _, l := range c.leases {
+			if now.Sub(l.expires) > inv.config.LeaseRetention {
+				removed++
+				continue
+			}
+			kept = append(kept, l)
+		}
+		clear(c.leases[len(kept):])
+		c.leases = kept
+		if len(c.leases) == 0 && now.Sub(c.lastSeen) > inv.config.LeaseRetention {
+			inv.remove(mac, c)
+		}
+	}
+	inv.stats.Expired += uint64(removed)
+	return removed
+}
+
+func (inv *Inventory) GetStatistics() InventoryStatistics {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	stats := inv.stats
+	stats.Clients = len(inv.clients)
+	for _, c := range inv.clients {
+		stats.Leases += len(c.leases)
+	}
+	stats.Servers = len(inv.servers)
+	for _, s := range inv.servers {
+		if s.rogue {
+			stats.RogueServers++
+		}
+	}
+	return stats
+}
+
+func (c *client) export(mac capture.MACAddr) Client {
+	out := Client{
+		MAC:         mac.String(),
+		Hostname:    c.hostname,
+		VendorClass: c.vendorClass,
+		FirstSeen:   c.firstSeen,
+		LastSeen:    c.lastSeen,
+	}
+	if c.duid != nil {
+		out.DUID = hex.EncodeToString(c.duid)
+	}
+	for _, l := range c.leases {
+		out.Leases = append(out.Leases, l.export(mac))
+	}
+	return out
+}
+
+func (l *lease) export(mac capture.MACAddr) Lease {
+	out := Lease{
+		MAC:       mac.String(),
+		IP:        l.ip.String(),
+		Hostname:  l.hostname,
+		LeaseTime: l.leaseTime,
+		FirstSeen: l.firstSeen,
+		LastSeen:  l.lastSeen,
+		Expires:   l.expires,
+		Released:  l.released,
+	}
+	if l.server.IsValid() {
+		out.Server = l.server.String()
+	}
+	return out
+}
+
+func (s *server) export(ip netip.Addr) Server {
+	out := Server{
+		IP:         ip.String(),
+		FirstSeen:  s.firstSeen,
+		LastSeen:   s.lastSeen,
+		Offers:     s.offers,
+		Acks:       s.acks,
+		Naks:       s.naks,
+		Authorized: s.authorized,
+		Rogue:      s.rogue,
+	}
+	if s.mac != (capture.MACAddr{}) {
+		out.MAC = s.mac.String()
+	}
+	if s.duid != nil {
+		out.DUID = hex.EncodeToString(s.duid)
+	}
+	return out
+}
@@ -0,0 +1,297 @@
+// Package dhcp decodes DHCPv4 and DHCPv6 messages and keeps an inventory of
+// the leases and servers they reveal.
+package dhcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+)
+
+const (
+	ServerPort = 67
+	ClientPort = 68
+
+	// HeaderSize is the fixed BOOTP part of a message, before the magic
+	// cookie and the options.
+	HeaderSize  = 236
+	magicCookie = 0x63825363
+)
+
+var (
+	ErrTruncated = errors.New("dhcp: message truncated")
+	ErrNotDHCP   = errors.New("dhcp: missing magic cookie")
+	ErrBadOption = errors.New("dhcp: malformed option")
+)
+
+type MessageType uint8
+
+const (
+	MessageTypeDiscover MessageType = 1
+	MessageTypeOffer    MessageType = 2
+	MessageTypeRequest  MessageType = 3
+	MessageTypeDecline  MessageType = 4
+	MessageTypeAck      MessageType = 5
+	MessageTypeNak      MessageType = 6
+	MessageTypeRelease  MessageType = 7
+	MessageTypeInform   MessageType = 8
+)
+
+var messageTypeNames = map[MessageType]string{
+	MessageTypeDiscover: "DISCOVER",
+	MessageTypeOffer:    "OFFER",
+	MessageTypeRequest:  "REQUEST",
+	MessageTypeDecline:  "DECLINE",
+	MessageTypeAck:      "ACK",
+	MessageTypeNak:      "NAK",
+	MessageTypeRelease:  "RELEASE",
+	MessageTypeInform:   "INFORM",
+}
+
+func (t MessageType) String() string {
+	if name, ok := messageTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("MessageType(%d)", uint8(t))
+}
+
+func (t MessageType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// FromServer reports whether messages of this type are sent by servers.
+func (t MessageType) FromServer() bool {
+	return t == MessageTypeOffer || t == MessageTypeAck || t == MessageTypeNak
+}
+
+const (
+	OptionPad                  = 0
+	OptionSubnetMask           = 1
+	OptionRouter               = 3
+	OptionDNSServers           = 6
+	OptionHostname             = 12
+	OptionDomainName           = 15
+	OptionRequestedIP          = 50
+	OptionLeaseTime            = 51
+	OptionOverload             = 52
+	OptionMessageType          = 53
+	OptionServerID             = 54
+	OptionParameterRequestList = 55
+	OptionVendorClass          = 60
+	OptionClientID             = 61
+	OptionClientFQDN           = 81
+	OptionEnd                  = 255
+)
+
+// Option is one option as found on the wire. Data aliases the message.
+type Option struct {
+	Code uint8
+	Data []byte
+}
+
+// Message is a decoded DHCPv4 message. The options NetWatch uses are
+// decoded into their own fields; all of them are kept in Options.
+type Message struct {
+	Op            uint8 // 1 for requests, 2 for replies
+	HardwareType  uint8
+	Hops          uint8
+	TransactionID uint32
+	Seconds       uint16
+	Broadcast     bool
+	ClientIP      netip.Addr // ciaddr
+	YourIP        netip.Addr // yiaddr, the address being assigned
+	NextServerIP  netip.Addr // siaddr
+	RelayIP       netip.Addr // giaddr
+	ClientMAC     capture.MACAddr
+	Options       []Option
+
+	MessageType          MessageType
+	Hostname             string
+	VendorClass          string
+	ClientID             []byte
+	RequestedIP          netip.Addr
+	ServerID             netip.Addr
+	LeaseTime            time.Duration
+	SubnetMask           netip.Addr
+	Routers              []netip.Addr
+	DNSServers           []netip.Addr
+	DomainName           string
+	ParameterRequestList []uint8
+}
+
+// Decode parses a DHCPv4 message from a UDP payload.
+func Decode(data []byte) (*Message, error) {
+	if len(data) < HeaderSize+4 {
+		return nil, ErrTruncated
+	}
+	if binary.BigEndian.Uint32(data[HeaderSize:]) != magicCookie {
+		return nil, ErrNotDHCP
+	}
+
+	m := &Message{
+		Op:            data[0],
+		HardwareType:  data[1],
+		Hops:          data[3],
+		TransactionID: binary.BigEndian.Uint32(data[4:8]),
+		Seconds:       binary.BigEndian.Uint16(data[8:10]),
+		Broadcast:     data[10]&0x80 != 0,
+		ClientIP:      netip.AddrFrom4([4]byte(data[12:16])),
+		YourIP:        netip.AddrFrom4([4]byte(data[16:20])),
+		NextServerIP:  netip.AddrFrom4([4]byte(data[20:24])),
+		RelayIP:       netip.AddrFrom4([4]byte(data[24:28])),
+	}
+	if data[1] == capture.ARPHardwareEthernet && data[2] == 6 {
+		m.ClientMAC = capture.MACAddr(data[28:34])
+	}
+
+	var err error
+	if m.Options, err = parseOptions(data[HeaderSize+4:]); err != nil {
+		return nil, err
+	}
+	// Options may overflow into the file and server name fields.
+	for _, opt := range m.Options {
+		if opt.Code != OptionOverload || len(opt.Data) != 1 {
+			continue
+		}
+		if opt.Data[0]&1 != 0 {
+			more, err := parseOptions(data[108:236])
+			if err != nil {
+				return nil, err
+			}
+			m.Options = append(m.Options, more...)
+		}
+		if opt.Data[0]&2 != 0 {
+			more, err := parseOptions(data[44:108])
+			if err != nil {
+				return nil, err
+			}
+			m.Options = append(m.Options, more...)
+		}
+		break
+	}
+
+	for _, opt := range m.Options {
+		m.decodeOption(opt)
+	}
+	return m, nil
+}
+
+func parseOptions(data []byte) ([]Option, error) {
+	var options []Option
+	for len(data) > 0 {
+		code := data[0]
+		if code == OptionEnd {
+			break
+		}
+		if code == OptionPad {
+			data = data[1:]
+			continue
+		}
+		if len(data) < 2 || len(data) < 2+int(data[1]) {
+			return nil, fmt.Errorf("%w: option %d", ErrBadOption, code)
+		}
+		options = append(options, Option{Code: code, Data: data[2 : 2+int(data[1])]})
+		data = data[2+int(data[1]):]
+	}
+	return options, nil
+}
+
+func (m *Message) decodeOption(opt Option) {
+	switch opt.Code {
+	case OptionMessageType:
+		if len(opt.Data) == 1 {
+			m.MessageType = MessageType(opt.Data[0])
+		}
+	case OptionHostname:
+		m.Hostname = cleanString(opt.Data)
+	case OptionClientFQDN:
+		// Flags and two deprecated RCODE bytes, then the name, in DNS wire
+		// format when the E flag is set.
+		if len(opt.Data) > 3 && m.Hostname == "" {
+			if opt.Data[0]&0x04 != 0 {
+				m.Hostname = wireName(opt.Data[3:])
+			} else {
+				m.Hostname = cleanString(opt.Data[3:])
+			}
+		}
+	case OptionVendorClass:
+		m.VendorClass = cleanString(opt.Data)
+	case OptionClientID:
+		m.ClientID = opt.Data
+	case OptionRequestedIP:
+		m.RequestedIP = addr4(opt.Data)
+	case OptionServerID:
+		m.ServerID = addr4(opt.Data)
+	case OptionLeaseTime:
+		if len(opt.Data) == 4 {
+			m.LeaseTime = time.Duration(binary.BigEndian.Uint32(opt.Data)) * time.Second
+		}
+	case OptionSubnetMask:
+		m.SubnetMask = addr4(opt.Data)
+	case OptionRouter:
+		m.Routers = addrs4(opt.Data)
+	case OptionDNSServers:
+		m.DNSServers = addrs4(opt.Data)
+	case OptionDomainName:
+		m.DomainName = cleanString(opt.Data)
+	case OptionParameterRequestList:
+		m.ParameterRequestList = opt.Data
+	}
+}
+
+// Option returns the first option with the given code.
+func (m *Message) Option(code uint8) ([]byte, bool) {
+	for _, opt := range m.Options {
+		if opt.Code == code {
+			return opt.Data, true
+		}
+	}
+	return nil, false
+}
+
+func addr4(data []byte) netip.Addr {
+	if len(data) != 4 {
+		return netip.Addr{}
+	}
+	return netip.AddrFrom4([4]byte(data))
+}
+
+func addrs4(data []byte) []netip.Addr {
+	var result []netip.Addr
+	for ; len(data) >= 4; data = data[4:] {
+		result = append(result, netip.AddrFrom4([4]byte(data[:4])))
+	}
+	return result
+}
+
+// cleanString turns a client-supplied string option into something safe
+// to log and display: trailing NULs, which some clients send, are dropped
+// and control characters replaced.
+func cleanString(data []byte) string {
+	s := strings.TrimRight(string(data), "\x00")
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// wireName decodes an uncompressed DNS name, as used in FQDN options.
+func wireName(data []byte) string {
+	var labels []string
+	for len(data) > 0 {
+		n := int(data[0])
+		if n == 0 || n > 63 || len(data) < 1+n {
+			break
+		}
+		labels = append(labels, cleanString(data[1:1+n]))
+		data = data[1+n:]
+	}
+	return strings.Join(labels, ".")
+}
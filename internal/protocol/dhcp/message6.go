@@ -0,0 +1,264 @@
+package dhcp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+)
+
+const (
+	ClientPort6 = 546
+	ServerPort6 = 547
+
+	// maxRelayDepth bounds the Relay-forward and Relay-reply messages
+	// unwrapped to reach the client's message; RFC 8415 allows 32 hops.
+	maxRelayDepth = 32
+)
+
+type MessageType6 uint8
+
+const (
+	MessageType6Solicit            MessageType6 = 1
+	MessageType6Advertise          MessageType6 = 2
+	MessageType6Request            MessageType6 = 3
+	MessageType6Confirm            MessageType6 = 4
+	MessageType6Renew              MessageType6 = 5
+	MessageType6Rebind             MessageType6 = 6
+	MessageType6Reply              MessageType6 = 7
+	MessageType6Release            MessageType6 = 8
+	MessageType6Decline            MessageType6 = 9
+	MessageType6Reconfigure        MessageType6 = 10
+	MessageType6InformationRequest MessageType6 = 11
+	MessageType6RelayForward       MessageType6 = 12
+	MessageType6RelayReply         MessageType6 = 13
+)
+
+var messageType6Names = map[MessageType6]string{
+	MessageType6Solicit:            "SOLICIT",
+	MessageType6Advertise:          "ADVERTISE",
+	MessageType6Request:            "REQUEST",
+	MessageType6Confirm:            "CONFIRM",
+	MessageType6Renew:              "RENEW",
+	MessageType6Rebind:             "REBIND",
+	MessageType6Reply:              "REPLY",
+	MessageType6Release:            "RELEASE",
+	MessageType6Decline:            "DECLINE",
+	MessageType6Reconfigure:        "RECONFIGURE",
+	MessageType6InformationRequest: "INFORMATION-REQUEST",
+	MessageType6RelayForward:       "RELAY-FORW",
+	MessageType6RelayReply:         "RELAY-REPL",
+}
+
+func (t MessageType6) String() string {
+	if name, ok := messageType6Names[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("MessageType6(%d)", uint8(t))
+}
+
+func (t MessageType6) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// FromServer reports whether messages of this type are sent by servers.
+func (t MessageType6) FromServer() bool {
+	return t == MessageType6Advertise || t == MessageType6Reply || t == MessageType6Reconfigure
+}
+
+const (
+	Option6ClientID     = 1
+	Option6ServerID     = 2
+	Option6IANA         = 3
+	Option6IATA         = 4
+	Option6IAAddress    = 5
+	Option6RelayMessage = 9
+	Option6StatusCode   = 13
+	Option6VendorClass  = 16
+	Option6DNSServers   = 23
+	Option6DomainList   = 24
+	Option6ClientFQDN   = 39
+)
+
+// Option6 is one DHCPv6 option as found on the wire. Data aliases the
+// message.
+type Option6 struct {
+	Code uint16
+	Data []byte
+}
+
+// Address6 is an address assigned in an IA_NA or IA_TA option.
+type Address6 struct {
+	IP                netip.Addr
+	PreferredLifetime time.Duration
+	ValidLifetime     time.Duration
+}
+
+// Message6 is a decoded DHCPv6 message. Relayed messages are unwrapped to
+// the client or server message inside; the relays are counted in Hops.
+type Message6 struct {
+	MessageType   MessageType6
+	TransactionID uint32
+	Hops          int
+	// PeerAddress is the client address given by the relay closest to the
+	// client.
+	PeerAddress netip.Addr
+	Options     []Option6
+
+	ClientDUID  []byte
+	ServerDUID  []byte
+	Addresses   []Address6
+	Hostname    string
+	VendorClass string
+	DNSServers  []netip.Addr
+	StatusCode  uint16
+}
+
+// Decode6 parses a DHCPv6 message from a UDP payload.
+func Decode6(data []byte) (*Message6, error) {
+	m := &Message6{}
+	for {
+		if len(data) < 4 {
+			return nil, ErrTruncated
+		}
+		m.MessageType = MessageType6(data[0])
+		if m.MessageType != MessageType6RelayForward && m.MessageType != MessageType6RelayReply {
+			break
+		}
+		// Hop count, link address and peer address precede the options.
+		if len(data) < 34 {
+			return nil, ErrTruncated
+		}
+		if m.Hops++; m.Hops > maxRelayDepth {
+			return nil, fmt.Errorf("%w: relayed more than %d times", ErrBadOption, maxRelayDepth)
+		}
+		m.PeerAddress = netip.AddrFrom16([16]byte(data[18:34]))
+		options, err := parseOptions6(data[34:])
+		if err != nil {
+			return nil, err
+		}
+		inner, found := findOption6(options, Option6RelayMessage)
+		if !found {
+			return nil, fmt.Errorf("%w: relay message without one relayed", ErrBadOption)
+		}
+		data = inner
+	}
+
+	m.TransactionID = uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3])
+	var err error
+	if m.Options, err = parseOptions6(data[4:]); err != nil {
+		return nil, err
+	}
+	for _, opt := range m.Options {
+		if err := m.decodeOption(opt); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func parseOptions6(data []byte) ([]Option6, error) {
+	var options []Option6
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("%w: %d stray bytes", ErrBadOption, len(data))
+		}
+		code := binary.BigEndian.Uint16(data)
+		length := int(binary.BigEndian.Uint16(data[2:]))
+		if len(data) < 4+length {
+			return nil, fmt.Errorf("%w: option %d", ErrBadOption, code)
+		}
+		options = append(options, Option6{Code: code, Data: data[4 : 4+length]})
+		data = data[4+length:]
+	}
+	return options, nil
+}
+
+func findOption6(options []Option6, code uint16) ([]byte, bool) {
+	for _, opt := range options {
+		if opt.Code == code {
+			return opt.Data, true
+		}
+	}
+	return nil, false
+}
+
+func (m *Message6) decodeOption(opt Option6) error {
+	switch opt.Code {
+	case Option6ClientID:
+		m.ClientDUID = opt.Data
+	case Option6ServerID:
+		m.ServerDUID = opt.Data
+	case Option6IANA, Option6IATA:
+		// IAID, and for IA_NA the T1 and T2 timers, before the options.
+		skip := 4
+		if opt.Code == Option6IANA {
+			skip = 12
+		}
+		if len(opt.Data) < skip {
+			return fmt.Errorf("%w: short IA option", ErrBadOption)
+		}
+		options, err := parseOptions6(opt.Data[skip:])
+		if err != nil {
+			return err
+		}
+		for _, sub := range options {
+			if sub.Code != Option6IAAddress || len(sub.Data) < 24 {
+				continue
+			}
+			m.Addresses = append(m.Addresses, Address6{
+				IP:                netip.AddrFrom16([16]byte(sub.Data[:16])),
+				PreferredLifetime: time.Duration(binary.BigEndian.Uint32(sub.Data[16:20])) * time.Second,
+				ValidLifetime:     time.Duration(binary.BigEndian.Uint32(sub.Data[20:24])) * time.Second,
+			})
+		}
+	case Option6ClientFQDN:
+		if len(opt.Data) > 1 {
+			m.Hostname = wireName(opt.Data[1:])
+		}
+	case Option6VendorClass:
+		// An enterprise number, then length-prefixed strings; the first
+		// names the vendor class.
+		if len(opt.Data) >= 6 {
+			n := int(binary.BigEndian.Uint16(opt.Data[4:6]))
+			if len(opt.Data) >= 6+n {
+				m.VendorClass = cleanString(opt.Data[6 : 6+n])
+			}
+		}
+	case Option6DNSServers:
+		for data := opt.Data; len(data) >= 16; data = data[16:] {
+			m.DNSServers = append(m.DNSServers, netip.AddrFrom16([16]byte(data[:16])))
+		}
+	case Option6StatusCode:
+		if len(opt.Data) >= 2 {
+			m.StatusCode = binary.BigEndian.Uint16(opt.Data)
+		}
+	}
+	return nil
+}
+
+// Option returns the first option with the given code.
+func (m *Message6) Option(code uint16) ([]byte, bool) {
+	return findOption6(m.Options, code)
+}
+
+// DUIDLinkLayerAddress returns the MAC address inside a DUID-LLT or DUID-LL
+// of an Ethernet interface.
+func DUIDLinkLayerAddress(duid []byte) (capture.MACAddr, bool) {
+	if len(duid) < 4 || binary.BigEndian.Uint16(duid[2:4]) != capture.ARPHardwareEthernet {
+		return capture.MACAddr{}, false
+	}
+	switch binary.BigEndian.Uint16(duid) {
+	case 1: // DUID-LLT: a time precedes the address
+		if len(duid) == 14 {
+			return capture.MACAddr(duid[8:14]), true
+		}
+	case 3: // DUID-LL
+		if len(duid) == 10 {
+			return capture.MACAddr(duid[4:10]), true
+		}
+	}
+	return capture.MACAddr{}, false
+}
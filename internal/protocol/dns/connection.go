@@ -0,0 +1,59 @@
+package dns
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/stream"
+)
+
+// tcpLengthSize is the length prefix of each DNS-over-TCP message.
+const tcpLengthSize = 2
+
+// connection is the stream.Consumer that reads the messages of one DNS
+// over TCP connection. Each direction is split into messages on its own.
+type connection struct {
+	store *Store
+	half  [2]messageReader
+}
+
+type messageReader struct {
+	done bool
+	buf  []byte // received bytes not yet split into messages
+}
+
+// ConsumerFactory is registered with a stream.Assembler to have the store
+// read DNS over TCP, whose messages may span several segments.
+func (s *Store) ConsumerFactory(key stream.ConnectionKey) stream.Consumer {
+	if !isDNSPort(key.ClientPort, key.ServerPort) {
+		return nil
+	}
+	return &connection{store: s}
+}
+
+func (c *connection) Data(dir stream.Direction, data []byte, timestamp time.Time) {
+	half := &c.half[dir]
+	if half.done {
+		return
+	}
+	half.buf = append(half.buf, data...)
+
+	buf := half.buf
+	for len(buf) >= tcpLengthSize {
+		length := int(binary.BigEndian.Uint16(buf))
+		if len(buf) < tcpLengthSize+length {
+			break
+		}
+		c.store.decode(buf[tcpLengthSize:tcpLengthSize+length], timestamp)
+		buf = buf[tcpLengthSize+length:]
+	}
+	half.buf = append(half.buf[:0], buf...)
+}
+
+// Gap stops reading a direction: the message boundaries are lost with the
+// missing bytes.
+func (c *connection) Gap(dir stream.Direction, length int) {
+	c.half[dir] = messageReader{done: true}
+}
+
+func (c *connection) Close(reason stream.CloseReason) {}
@@ -0,0 +1,555 @@
+// Package dns decodes DNS messages seen on the wire and keeps a passive DNS
+// store of the addresses they resolved.
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+type Type uint16
+
+const (
+	TypeA      Type = 1
+	TypeNS     Type = 2
+	TypeCNAME  Type = 5
+	TypeSOA    Type = 6
+	TypePTR    Type = 12
+	TypeMX     Type = 15
+	TypeTXT    Type = 16
+	TypeAAAA   Type = 28
+	TypeSRV    Type = 33
+	TypeNAPTR  Type = 35
+	TypeDNAME  Type = 39
+	TypeOPT    Type = 41
+	TypeDS     Type = 43
+	TypeRRSIG  Type = 46
+	TypeNSEC   Type = 47
+	TypeDNSKEY Type = 48
+	TypeSVCB   Type = 64
+	TypeHTTPS  Type = 65
+	TypeANY    Type = 255
+	TypeCAA    Type = 257
+)
+
+var typeNames = map[Type]string{
+	TypeA:      "A",
+	TypeNS:     "NS",
+	TypeCNAME:  "CNAME",
+	TypeSOA:    "SOA",
+	TypePTR:    "PTR",
+	TypeMX:     "MX",
+	TypeTXT:    "TXT",
+	TypeAAAA:   "AAAA",
+	TypeSRV:    "SRV",
+	TypeNAPTR:  "NAPTR",
+	TypeDNAME:  "DNAME",
+	TypeOPT:    "OPT",
+	TypeDS:     "DS",
+	TypeRRSIG:  "RRSIG",
+	TypeNSEC:   "NSEC",
+	TypeDNSKEY: "DNSKEY",
+	TypeSVCB:   "SVCB",
+	TypeHTTPS:  "HTTPS",
+	TypeANY:    "ANY",
+	TypeCAA:    "CAA",
+}
+
+// String returns the mnemonic, or the RFC 3597 TYPEnnn form for types
+// without one.
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", uint16(t))
+}
+
+func (t Type) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+type Class uint16
+
+const (
+	ClassINET  Class = 1
+	ClassCHAOS Class = 3
+	ClassANY   Class = 255
+)
+
+func (c Class) String() string {
+	switch c {
+	case ClassINET:
+		return "IN"
+	case ClassCHAOS:
+		return "CH"
+	case ClassANY:
+		return "ANY"
+	default:
+		return fmt.Sprintf("CLASS%d", uint16(c))
+	}
+}
+
+func (c Class) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+type RCode uint16
+
+const (
+	RCodeSuccess        RCode = 0
+	RCodeFormatError    RCode = 1
+	RCodeServerFailure  RCode = 2
+	RCodeNameError      RCode = 3
+	RCodeNotImplemented RCode = 4
+	RCodeRefused        RCode = 5
+	RCodeBadVersion     RCode = 16
+)
+
+var rcodeNames = map[RCode]string{
+	RCodeSuccess:        "NOERROR",
+	RCodeFormatError:    "FORMERR",
+	RCodeServerFailure:  "SERVFAIL",
+	RCodeNameError:      "NXDOMAIN",
+	RCodeNotImplemented: "NOTIMP",
+	RCodeRefused:        "REFUSED",
+	RCodeBadVersion:     "BADVERS",
+}
+
+func (r RCode) String() string {
+	if name, ok := rcodeNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", uint16(r))
+}
+
+func (r RCode) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+type Header struct {
+	ID                 uint16
+	Response           bool
+	Opcode             uint8
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	AuthenticData      bool
+	CheckingDisabled   bool
+	// RCode includes the upper bits carried by an EDNS0 OPT record.
+	RCode RCode
+
+	QuestionCount   uint16
+	AnswerCount     uint16
+	AuthorityCount  uint16
+	AdditionalCount uint16
+}
+
+type Question struct {
+	Name  string
+	Type  Type
+	Class Class
+}
+
+// ResourceRecord is one record. Data is the raw RDATA; the decoded fields
+// that apply to Type are filled in and the rest left zero. Names are
+// lower-cased and have no trailing dot; the root is "".
+type ResourceRecord struct {
+	Name  string
+	Type  Type
+	Class Class
+	TTL   uint32
+	Data  []byte
+
+	IP         netip.Addr // A, AAAA
+	Target     string     // NS, CNAME, PTR, DNAME, MX exchange, SRV and SVCB/HTTPS target
+	Preference uint16     // MX preference, SRV and SVCB/HTTPS priority
+	Weight     uint16     // SRV
+	Port       uint16     // SRV
+	Text       []string   // TXT character strings
+	SOA        *SOA
+	CAA        *CAA
+}
+
+type SOA struct {
+	MName   string
+	RName   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
+}
+
+type CAA struct {
+	Flags uint8
+	Tag   string
+	Value string
+}
+
+// EDNS is the content of an EDNS0 OPT pseudo-record (RFC 6891).
+type EDNS struct {
+	UDPSize  uint16
+	Version  uint8
+	DNSSECOK bool
+	Options  []EDNSOption
+}
+
+type EDNSOption struct {
+	Code uint16
+	Data []byte
+}
+
+const (
+	EDNSOptionClientSubnet = 8
+	EDNSOptionCookie       = 10
+	EDNSOptionPadding      = 12
+)
+
+// Message is a decoded DNS message. The OPT record is not kept among the
+// Additional records but decoded into EDNS.
+type Message struct {
+	Header     Header
+	Questions  []Question
+	Answers    []ResourceRecord
+	Authority  []ResourceRecord
+	Additional []ResourceRecord
+	EDNS       *EDNS
+}
+
+const (
+	HeaderSize = 12
+	Port       = 53
+	MDNSPort   = 5353
+
+	maxNameLength = 255
+	// maxPointers bounds compression pointer chains, so a loop fails
+	// instead of spinning.
+	maxPointers = 64
+)
+
+var (
+	ErrTruncated   = errors.New("dns: message truncated")
+	ErrBadName     = errors.New("dns: malformed name")
+	ErrBadRecord   = errors.New("dns: malformed record")
+	ErrExtraOPT    = errors.New("dns: more than one OPT record")
+	ErrBadTCPFrame = errors.New("dns: bad TCP length prefix")
+)
+
+// Decode decodes a DNS message carried over UDP. All of the returned
+// message is copied out of data.
+func Decode(data []byte) (*Message, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("%w: need %d header bytes, got %d", ErrTruncated, HeaderSize, len(data))
+	}
+
+	d := decoder{data: data, offset: HeaderSize}
+	msg := &Message{Header: decodeHeader(data)}
+
+	for i := 0; i < int(msg.Header.QuestionCount); i++ {
+		q, err := d.question()
+		if err != nil {
+			return nil, fmt.Errorf("question %d: %w", i, err)
+		}
+		msg.Questions = append(msg.Questions, q)
+	}
+
+	sections := []struct {
+		name    string
+		count   uint16
+		records *[]ResourceRecord
+	}{
+		{"answer", msg.Header.AnswerCount, &msg.Answers},
+		{"authority", msg.Header.AuthorityCount, &msg.Authority},
+		{"additional", msg.Header.AdditionalCount, &msg.Additional},
+	}
+	for _, section := range sections {
+		for i := 0; i < int(section.count); i++ {
+			rr, err := d.record()
+			if err != nil {
+				return nil, fmt.Errorf("%s record %d: %w", section.name, i, err)
+			}
+			if rr.Type == TypeOPT {
+				if msg.EDNS != nil {
+					return nil, ErrExtraOPT
+				}
+				msg.EDNS = decodeEDNS(&rr)
+				msg.Header.RCode |= RCode(rr.TTL>>24) << 4
+				continue
+			}
+			*section.records = append(*section.records, rr)
+		}
+	}
+
+	return msg, nil
+}
+
+// DecodeTCP decodes the first message of a DNS-over-TCP payload, which
+// prefixes each message with its length.
+func DecodeTCP(data []byte) (*Message, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("%w: missing length prefix", ErrBadTCPFrame)
+	}
+	length := int(binary.BigEndian.Uint16(data[0:2]))
+	if len(data)-2 < length {
+		return nil, fmt.Errorf("%w: need %d bytes, got %d", ErrTruncated, length, len(data)-2)
+	}
+	return Decode(data[2 : 2+length])
+}
+
+// QueryName returns the name asked about by the first question, or "".
+func (m *Message) QueryName() string {
+	if len(m.Questions) == 0 {
+		return ""
+	}
+	return m.Questions[0].Name
+}
+
+func decodeHeader(data []byte) Header {
+	flags := binary.BigEndian.Uint16(data[2:4])
+	return Header{
+		ID:                 binary.BigEndian.Uint16(data[0:2]),
+		Response:           flags&0x8000 != 0,
+		Opcode:             uint8(flags>>11) & 0x0F,
+		Authoritative:      flags&0x0400 != 0,
+		Truncated:          flags&0x0200 != 0,
+		RecursionDesired:   flags&0x0100 != 0,
+		RecursionAvailable: flags&0x0080 != 0,
+		AuthenticData:      flags&0x0020 != 0,
+		CheckingDisabled:   flags&0x0010 != 0,
+		RCode:              RCode(flags & 0x000F),
+		QuestionCount:      binary.BigEndian.Uint16(data[4:6]),
+		AnswerCount:        binary.BigEndian.Uint16(data[6:8]),
+		AuthorityCount:     binary.BigEndian.Uint16(data[8:10]),
+		AdditionalCount:    binary.BigEndian.Uint16(data[10:12]),
+	}
+}
+
+func decodeEDNS(rr *ResourceRecord) *EDNS {
+	edns := &EDNS{
+		UDPSize:  uint16(rr.Class),
+		Version:  uint8(rr.TTL >> 16),
+		DNSSECOK: rr.TTL&0x8000 != 0,
+	}
+	data := rr.Data
+	for len(data) >= 4 {
+		code := binary.BigEndian.Uint16(data[0:2])
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if len(data)-4 < length {
+			break
+		}
+		edns.Options = append(edns.Options, EDNSOption{Code: code, Data: data[4 : 4+length]})
+		data = data[4+length:]
+	}
+	return edns
+}
+
+type decoder struct {
+	data   []byte
+	offset int
+}
+
+func (d *decoder) question() (Question, error) {
+	name, err := d.name()
+	if err != nil {
+		return Question{}, err
+	}
+	if len(d.data)-d.offset < 4 {
+		return Question{}, ErrTruncated
+	}
+	q := Question{
+		Name:  name,
+		Type:  Type(binary.BigEndian.Uint16(d.data[d.offset:])),
+		Class: Class(binary.BigEndian.Uint16(d.data[d.offset+2:])),
+	}
+	d.offset += 4
+	return q, nil
+}
+
+func (d *decoder) record() (ResourceRecord, error) {
+	name, err := d.name()
+	if err != nil {
+		return ResourceRecord{}, err
+	}
+	if len(d.data)-d.offset < 10 {
+		return ResourceRecord{}, ErrTruncated
+	}
+	header := d.data[d.offset : d.offset+10]
+	length := int(binary.BigEndian.Uint16(header[8:10]))
+	d.offset += 10
+	if len(d.data)-d.offset < length {
+		return ResourceRecord{}, fmt.Errorf("%w: RDATA needs %d bytes, got %d", ErrTruncated, length, len(d.data)-d.offset)
+	}
+
+	rr := ResourceRecord{
+		Name:  name,
+		Type:  Type(binary.BigEndian.Uint16(header[0:2])),
+		Class: Class(binary.BigEndian.Uint16(header[2:4])),
+		TTL:   binary.BigEndian.Uint32(header[4:8]),
+		Data:  append([]byte(nil), d.data[d.offset:d.offset+length]...),
+	}
+	if err := d.rdata(&rr, d.offset); err != nil {
+		return ResourceRecord{}, fmt.Errorf("%s: %w", rr.Type, err)
+	}
+	d.offset += length
+	return rr, nil
+}
+
+// rdata decodes the RDATA of rr, which starts at data[start]. Names inside
+// it may be compressed against the whole message.
+func (d *decoder) rdata(rr *ResourceRecord, start int) error {
+	rdata := rr.Data
+	sub := decoder{data: d.data[:start+len(rdata)], offset: start}
+	var err error
+
+	switch rr.Type {
+	case TypeA:
+		if len(rdata) != 4 {
+			return ErrBadRecord
+		}
+		rr.IP = netip.AddrFrom4([4]byte(rdata))
+	case TypeAAAA:
+		if len(rdata) != 16 {
+			return ErrBadRecord
+		}
+		rr.IP = netip.AddrFrom16([16]byte(rdata))
+	case TypeNS, TypeCNAME, TypePTR, TypeDNAME:
+		rr.Target, err = sub.name()
+	case TypeMX:
+		if len(rdata) < 3 {
+			return ErrBadRecord
+		}
+		rr.Preference = binary.BigEndian.Uint16(rdata)
+		sub.offset += 2
+		rr.Target, err = sub.name()
+	case TypeSRV:
+		if len(rdata) < 7 {
+			return ErrBadRecord
+		}
+		rr.Preference = binary.BigEndian.Uint16(rdata[0:2])
+		rr.Weight = binary.BigEndian.Uint16(rdata[2:4])
+		rr.Port = binary.BigEndian.Uint16(rdata[4:6])
+		sub.offset += 6
+		rr.Target, err = sub.name()
+	case TypeSVCB, TypeHTTPS:
+		// The SvcParams after the target are left in Data.
+		if len(rdata) < 3 {
+			return ErrBadRecord
+		}
+		rr.Preference = binary.BigEndian.Uint16(rdata)
+		sub.offset += 2
+		rr.Target, err = sub.name()
+	case TypeTXT:
+		for text := rdata; len(text) > 0; {
+			n := int(text[0])
+			if len(text) < 1+n {
+				return ErrBadRecord
+			}
+			rr.Text = append(rr.Text, string(text[1:1+n]))
+			text = text[1+n:]
+		}
+	case TypeSOA:
+		soa := &SOA{}
+		if soa.MName, err = sub.name(); err != nil {
+			return err
+		}
+		if soa.RName, err = sub.name(); err != nil {
+			return err
+		}
+		fixed := sub.data[sub.offset:]
+		if len(fixed) != 20 {
+			return ErrBadRecord
+		}
+		soa.Serial = binary.BigEndian.Uint32(fixed[0:4])
+		soa.Refresh = binary.BigEndian.Uint32(fixed[4:8])
+		soa.Retry = binary.BigEndian.Uint32(fixed[8:12])
+		soa.Expire = binary.BigEndian.Uint32(fixed[12:16])
+		soa.Minimum = binary.BigEndian.Uint32(fixed[16:20])
+		rr.SOA = soa
+	case TypeCAA:
+		if len(rdata) < 2 || len(rdata) < 2+int(rdata[1]) {
+			return ErrBadRecord
+		}
+		tagEnd := 2 + int(rdata[1])
+		rr.CAA = &CAA{
+			Flags: rdata[0],
+			Tag:   string(rdata[2:tagEnd]),
+			Value: string(rdata[tagEnd:]),
+		}
+	}
+	return err
+}
+
+// name decodes a possibly compressed domain name at the decoder's offset
+// and advances past it.
+func (d *decoder) name() (string, error) {
+	var b strings.Builder
+	offset := d.offset
+	end := -1 // where the decoder continues once a pointer has been followed
+	pointers := 0
+	length := 0
+
+	for {
+		if offset >= len(d.data) {
+			return "", ErrTruncated
+		}
+		n := int(d.data[offset])
+
+		switch n & 0xC0 {
+		case 0x00:
+			if n == 0 {
+				if end < 0 {
+					end = offset + 1
+				}
+				d.offset = end
+				return b.String(), nil
+			}
+			if offset+1+n > len(d.data) {
+				return "", ErrTruncated
+			}
+			length += n + 1
+			if length > maxNameLength {
+				return "", fmt.Errorf("%w: longer than %d bytes", ErrBadName, maxNameLength)
+			}
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			writeLabel(&b, d.data[offset+1:offset+1+n])
+			offset += 1 + n
+		case 0xC0:
+			if offset+2 > len(d.data) {
+				return "", ErrTruncated
+			}
+			if pointers++; pointers > maxPointers {
+				return "", fmt.Errorf("%w: compression loop", ErrBadName)
+			}
+			if end < 0 {
+				end = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(d.data[offset:]) & 0x3FFF)
+		default:
+			return "", fmt.Errorf("%w: unsupported label type 0x%02x", ErrBadName, n&0xC0)
+		}
+	}
+}
+
+// writeLabel appends a label lower-cased, escaping dots and bytes that are
+// not printable so that names cannot be confused with one another.
+func writeLabel(b *strings.Builder, label []byte) {
+	for _, c := range label {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			b.WriteByte(c + 'a' - 'A')
+		case c == '.' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x21 || c > 0x7E:
+			fmt.Fprintf(b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
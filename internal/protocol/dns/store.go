@@ -0,0 +1,371 @@
+package dns
+
+import (
+	"container/list"
+	"log/slog"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+)
+
+// Resolution is one name an address was seen to resolve from.
+type Resolution struct {
+	IP           string    `json:"ip"`
+	Name         string    `json:"name"`
+	Canonical    string    `json:"canonical,omitempty"`
+	TTL          uint32    `json:"ttl"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	Expires      time.Time `json:"expires"`
+	Observations uint64    `json:"observations"`
+}
+
+type StoreConfig struct {
+	// MaxAddresses caps the addresses held; the least recently resolved
+	// is evicted to make room.
+	MaxAddresses int
+
+	// MaxNamesPerAddress caps the names kept for one address, such as a
+	// CDN edge serving many sites. The least recently seen is dropped.
+	MaxNamesPerAddress int
+
+	// MinRetention keeps answers for at least this long after they were
+	// last seen, even if their TTL is shorter: connections commonly
+	// outlive the TTL of the lookup that started them.
+	MinRetention time.Duration
+}
+
+type StoreStatistics struct {
+	Addresses     int    `json:"addresses"`
+	Queries       uint64 `json:"queries"`
+	Responses     uint64 `json:"responses"`
+	NameErrors    uint64 `json:"name_errors"`
+	DecodeErrors  uint64 `json:"decode_errors"`
+	AddressAnswer uint64 `json:"address_answers"`
+	Evictions     uint64 `json:"evictions"`
+	Expired       uint64 `json:"expired"`
+}
+
+type resolution struct {
+	name         string
+	canonical    string
+	ttl          uint32
+	firstSeen    time.Time
+	lastSeen     time.Time
+	expires      time.Time
+	observations uint64
+}
+
+type address struct {
+	ip          netip.Addr
+	resolutions []*resolution // most recently seen first
+}
+
+// Store is a passive DNS store: it maps addresses seen in A and AAAA
+// answers back to the names that were queried for them.
+type Store struct {
+	mu        *sync.RWMutex
+	logger    *slog.Logger
+	config    StoreConfig
+	addresses map[netip.Addr]*list.Element
+	order     *list.List // *address, least recently resolved first
+	stats     StoreStatistics
+}
+
+func DefaultStoreConfig() StoreConfig {
+	return StoreConfig{
+		MaxAddresses:       262144,
+		MaxNamesPerAddress: 16,
+		MinRetention:       time.Hour,
+	}
+}
+
+func NewStore(logger *slog.Logger) *Store {
+	return NewStoreWithConfig(logger, DefaultStoreConfig())
+}
+
+func NewStoreWithConfig(logger *slog.Logger, config StoreConfig) *Store {
+	defaults := DefaultStoreConfig()
+	if config.MaxAddresses <= 0 {
+		config.MaxAddresses = defaults.MaxAddresses
+	}
+	if config.MaxNamesPerAddress <= 0 {
+		config.MaxNamesPerAddress = defaults.MaxNamesPerAddress
+	}
+	if config.MinRetention < 0 {
+		config.MinRetention = defaults.MinRetention
+	}
+
+	return &Store{
+		mu:        &sync.RWMutex{},
+		logger:    logger,
+		config:    config,
+		addresses: make(map[netip.Addr]*list.Element),
+		order:     list.New(),
+	}
+}
+
+// ObservePacket decodes DNS over UDP to or from port 53 or the mDNS port
+// and records the addresses any response resolved. DNS over TCP is read
+// from reassembled streams instead; see ConsumerFactory.
+func (s *Store) ObservePacket(packet *capture.ParsedPacket, timestamp time.Time) {
+	if packet == nil || packet.UDP == nil || len(packet.Payload) == 0 {
+		return
+	}
+	if isDNSPort(packet.UDP.SrcPort, packet.UDP.DstPort) {
+		s.decode(packet.Payload, timestamp)
+	}
+}
+
+func (s *Store) decode(data []byte, timestamp time.Time) {
+	msg, err := Decode(data)
+	if err != nil {
+		s.mu.Lock()
+		s.stats.DecodeErrors++
+		s.mu.Unlock()
+		s.logger.Debug("failed to decode DNS message", slog.String("error", err.Error()))
+		return
+	}
+	s.Observe(msg, timestamp)
+}
+
+func isDNSPort(src, dst uint16) bool {
+	return src == Port || dst == Port || src == MDNSPort || dst == MDNSPort
+}
+
+// Observe records the A and AAAA answers of a response under the name of
+// its question, following any CNAME chain in between.
+func (s *Store) Observe(msg *Message, timestamp time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !msg.Header.Response {
+		s.stats.Queries++
+		return
+	}
+	s.stats.Responses++
+	if msg.Header.RCode == RCodeNameError {
+		s.stats.NameErrors++
+	}
+
+	// mDNS answers are unsolicited and carry no question.
+	query := msg.QueryName()
+	for _, rr := range msg.Answers {
+		if rr.Type != TypeA && rr.Type != TypeAAAA {
+			continue
+		}
+		name := query
+		if name == "" || !resolvesTo(msg.Answers, name, rr.Name) {
+			name = rr.Name
+		}
+		canonical := ""
+		if rr.Name != name {
+			canonical = rr.Name
+		}
+		s.learn(rr.IP.Unmap(), name, canonical, rr.TTL, timestamp)
+		s.stats.AddressAnswer++
+	}
+}
+
+// resolvesTo reports whether name leads to target through the CNAME
+// records among answers.
+func resolvesTo(answers []ResourceRecord, name, target string) bool {
+	for hops := 0; hops <= len(answers); hops++ {
+		if name == target {
+			return true
+		}
+		next := ""
+		for _, rr := range answers {
+			if rr.Type == TypeCNAME && rr.Name == name {
+				next = rr.Target
+				break
+			}
+		}
+		if next == "" {
+			return false
+		}
+		name = next
+	}
+	return false
+}
+
+func (s *Store) learn(ip netip.Addr, name, canonical string, ttl uint32, timestamp time.Time) {
+	expires := timestamp.Add(max(time.Duration(ttl)*time.Second, s.config.MinRetention))
+
+	element, exists := s.addresses[ip]
+	if exists {
+		s.order.MoveToBack(element)
+	} else {
+		if s.order.Len() >= s.config.MaxAddresses {
+			s.remove(s.order.Front())
+			s.stats.Evictions++
+		}
+		element = s.order.PushBack(&address{ip: ip})
+		s.addresses[ip] = element
+	}
+	a := element.Value.(*address)
+	resolutions := a.resolutions
+
+	for i, r := range resolutions {
+		if r.name != name {
+			continue
+		}
+		r.canonical = canonical
+		r.ttl = ttl
+		r.observations++
+		if timestamp.After(r.lastSeen) {
+			r.lastSeen = timestamp
+		}
+		if expires.After(r.expires) {
+			r.expires = expires
+		}
+		copy(resolutions[1:i+1], resolutions[:i])
+		resolutions[0] = r
+		return
+	}
+
+	r := &resolution{
+		name:         name,
+		canonical:    canonical,
+		ttl:          ttl,
+		firstSeen:    timestamp,
+		lastSeen:     timestamp,
+		expires:      expires,
+		observations: 1,
+	}
+	if len(resolutions) >= s.config.MaxNamesPerAddress {
+		resolutions = resolutions[:len(resolutions)-1]
+	}
+	a.resolutions = append([]*resolution{r}, resolutions...)
+
+	s.logger.Debug("learned DNS resolution",
+		slog.String("ip", ip.String()),
+		slog.String("name", name))
+}
+
+func (s *Store) remove(element *list.Element) {
+	delete(s.addresses, element.Value.(*address).ip)
+	s.order.Remove(element)
+}
+
+// resolutions returns the names ip resolved from, most recently seen
+// first.
+func (s *Store) resolutions(ip netip.Addr) []*resolution {
+	element, exists := s.addresses[ip]
+	if !exists {
+		return nil
+	}
+	return element.Value.(*address).resolutions
+}
+
+// Lookup returns the names ip was resolved from, most recently seen first.
+func (s *Store) Lookup(ip netip.Addr) []Resolution {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ip = ip.Unmap()
+	resolutions := s.resolutions(ip)
+	result := make([]Resolution, 0, len(resolutions))
+	for _, r := range resolutions {
+		result = append(result, r.export(ip))
+	}
+	return result
+}
+
+// Hostname returns the name ip was most recently resolved from among
+// those not expired by now, for labelling flows.
+func (s *Store) Hostname(ip netip.Addr, now time.Time) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.resolutions(ip.Unmap()) {
+		if !now.After(r.expires) {
+			return r.name, true
+		}
+	}
+	return "", false
+}
+
+// Entries returns every resolution ordered by address and then by name.
+func (s *Store) Entries() []Resolution {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []Resolution
+	for element := s.order.Front(); element != nil; element = element.Next() {
+		a := element.Value.(*address)
+		for _, r := range a.resolutions {
+			result = append(result, r.export(a.ip))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, _ := netip.ParseAddr(result[i].IP)
+		b, _ := netip.ParseAddr(result[j].IP)
+		if a != b {
+			return a.Less(b)
+		}
+		return strings.Compare(result[i].Name, result[j].Name) < 0
+	})
+	return result
+}
+
+// Expire removes resolutions past their expiry and returns the number
+// removed.
+func (s *Store) Expire(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for element := s.order.Front(); element != nil; {
+		next := element.Next()
+		a := element.Value.(*address)
+		kept := a.resolutions[:0]
+		for _, r := range a.resolutions {
+			if now.After(r.expires) {
+				removed++
+				continue
+			}
+			kept = append(kept, r)
+		}
+		if len(kept) == 0 {
+			s.remove(element)
+		} else {
+			a.resolutions = kept
+		}
+		element = next
+	}
+	s.stats.Expired += uint64(removed)
+	return removed
+}
+
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.addresses)
+}
+
+func (s *Store) GetStatistics() StoreStatistics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := s.stats
+	stats.Addresses = len(s.addresses)
+	return stats
+}
+
+func (r *resolution) export(ip netip.Addr) Resolution {
+	return Resolution{
+		IP:           ip.String(),
+		Name:         r.name,
+		Canonical:    r.canonical,
+		TTL:          r.ttl,
+		FirstSeen:    r.firstSeen,
+		LastSeen:     r.lastSeen,
+		Expires:      r.expires,
+		Observations: r.observations,
+	}
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"slices"
+	"time"
+)
+
+// rateWindow is the span, in one-second buckets, request rates are
+// averaged over.
+const rateWindow = 60
+
+type aggregate struct {
+	requests    uint64
+	responses   uint64
+	statusCodes map[int]uint64
+
+	// buckets[s%rateWindow] counts the requests of Unix second s, as long
+	// as seconds[s%rateWindow] is s.
+	buckets [rateWindow]uint64
+	seconds [rateWindow]int64
+
+	latencies []time.Duration // ring of the most recent samples
+	next      int
+}
+
+func newAggregate(samples int) *aggregate {
+	return &aggregate{
+		statusCodes: make(map[int]uint64),
+		latencies:   make([]time.Duration, 0, samples),
+	}
+}
+
+func (a *aggregate) request(timestamp time.Time) {
+	a.requests++
+	second := timestamp.Unix()
+	i := second % rateWindow
+	if a.seconds[i] != second {
+		a.seconds[i] = second
+		a.buckets[i] = 0
+	}
+	a.buckets[i]++
+}
+
+func (a *aggregate) response(txn *Transaction) {
+	a.responses++
+	a.statusCodes[txn.Response.StatusCode]++
+	if txn.Request == nil {
+		return
+	}
+	if len(a.latencies) < cap(a.latencies) {
+		a.latencies = append(a.latencies, txn.Latency)
+		return
+	}
+	a.latencies[a.next] = txn.Latency
+	a.next = (a.next + 1) % len(a.latencies)
+}
+
+func (a *aggregate) rate(now time.Time) float64 {
+	var total uint64
+	current := now.Unix()
+	for i, second := range a.seconds {
+		if second > current-rateWindow && second <= current {
+			total += a.buckets[i]
+		}
+	}
+	return float64(total) / rateWindow
+}
+
+func (a *aggregate) percentiles() LatencyPercentiles {
+	if len(a.latencies) == 0 {
+		return LatencyPercentiles{}
+	}
+	sorted := slices.Clone(a.latencies)
+	slices.Sort(sorted)
+	// Nearest rank: the smallest sample at or above p percent of them.
+	at := func(p int) time.Duration {
+		return sorted[(len(sorted)*p+99)/100-1]
+	}
+	return LatencyPercentiles{
+		Samples: len(sorted),
+		P50:     at(50),
+		P90:     at(90),
+		P99:     at(99),
+		Max:     sorted[len(sorted)-1],
+	}
+}
+
+func (a *aggregate) export(stats RequestStatistics, now time.Time) RequestStatistics {
+	stats.Requests = a.requests
+	stats.Responses = a.responses
+	stats.RequestRate = a.rate(now)
+	stats.StatusCodes = make(map[int]uint64, len(a.statusCodes))
+	for code, count := range a.statusCodes {
+		stats.StatusCodes[code] = count
+	}
+	stats.Latency = a.percentiles()
+	return stats
+}
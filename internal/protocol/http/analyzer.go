@@ -0,0 +1,284 @@
+package http
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/stream"
+)
+
+type AnalyzerConfig struct {
+	// MaxHosts and MaxEndpoints cap the hosts and the host, method and
+	// path combinations aggregated. Traffic to new ones past the cap is
+	// counted only in the totals.
+	MaxHosts     int
+	MaxEndpoints int
+
+	// MaxHeaderSize caps a header block; longer ones stop the parsing of
+	// that direction.
+	MaxHeaderSize int
+
+	// MaxPipelined caps the requests awaiting a response on one
+	// connection.
+	MaxPipelined int
+
+	// LatencySamples is how many of the most recent latencies each host and
+	// endpoint keeps for its percentiles.
+	LatencySamples int
+}
+
+type AnalyzerStatistics struct {
+	Connections      uint64 `json:"connections"`
+	Requests         uint64 `json:"requests"`
+	Responses        uint64 `json:"responses"`
+	Unanswered       uint64 `json:"unanswered"`
+	NotHTTP          uint64 `json:"not_http"`
+	ParseErrors      uint64 `json:"parse_errors"`
+	HostsDropped     uint64 `json:"hosts_dropped"`
+	EndpointsDropped uint64 `json:"endpoints_dropped"`
+}
+
+// RequestStatistics aggregates the traffic of a host, or of one endpoint
+// on it when Method and Path are set.
+type RequestStatistics struct {
+	Host      string `json:"host"`
+	Method    string `json:"method,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Requests  uint64 `json:"requests"`
+	Responses uint64 `json:"responses"`
+	// RequestRate is requests per second over the last minute.
+	RequestRate float64            `json:"request_rate"`
+	StatusCodes map[int]uint64     `json:"status_codes"`
+	Latency     LatencyPercentiles `json:"latency"`
+}
+
+type LatencyPercentiles struct {
+	Samples int           `json:"samples"`
+	P50     time.Duration `json:"p50"`
+	P90     time.Duration `json:"p90"`
+	P99     time.Duration `json:"p99"`
+	Max     time.Duration `json:"max"`
+}
+
+// TransactionHandler is called for every response, paired with its
+// request when that was seen.
+type TransactionHandler func(txn *Transaction)
+
+// Analyzer follows HTTP/1.x connections from a stream.Assembler. HTTP is
+// recognised by content rather than port.
+type Analyzer struct {
+	mu        *sync.RWMutex
+	logger    *slog.Logger
+	config    AnalyzerConfig
+	handlers  []TransactionHandler
+	hosts     map[string]*aggregate
+	endpoints map[endpointKey]*aggregate
+	stats     AnalyzerStatistics
+}
+
+type endpointKey struct {
+	host   string
+	method string
+	path   string
+}
+
+func DefaultAnalyzerConfig() AnalyzerConfig {
+	return AnalyzerConfig{
+		MaxHosts:       1024,
+		MaxEndpoints:   4096,
+		MaxHeaderSize:  16 * 1024,
+		MaxPipelined:   64,
+		LatencySamples: 128,
+	}
+}
+
+func NewAnalyzer(logger *slog.Logger) *Analyzer {
+	return NewAnalyzerWithConfig(logger, DefaultAnalyzerConfig())
+}
+
+func NewAnalyzerWithConfig(logger *slog.Logger, config AnalyzerConfig) *Analyzer {
+	defaults := DefaultAnalyzerConfig()
+	if config.MaxHosts <= 0 {
+		config.MaxHosts = defaults.MaxHosts
+	}
+	if config.MaxEndpoints <= 0 {
+		config.MaxEndpoints = defaults.MaxEndpoints
+	}
+	if config.MaxHeaderSize <= 0 {
+		config.MaxHeaderSize = defaults.MaxHeaderSize
+	}
+	if config.MaxPipelined <= 0 {
+		config.MaxPipelined = defaults.MaxPipelined
+	}
+	if config.LatencySamples <= 0 {
+		config.LatencySamples = defaults.LatencySamples
+	}
+
+	return &Analyzer{
+		mu:        &sync.RWMutex{},
+		logger:    logger,
+		config:    config,
+		hosts:     make(map[string]*aggregate),
+		endpoints: make(map[endpointKey]*aggregate),
+	}
+}
+
+// OnTransaction registers a handler for transactions completed from now
+// on.
+func (a *Analyzer) OnTransaction(handler TransactionHandler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.handlers = append(a.handlers, handler)
+}
+
+// ConsumerFactory is registered with a stream.Assembler to have the
+// analyzer follow new connections.
+func (a *Analyzer) ConsumerFactory(key stream.ConnectionKey) stream.Consumer {
+	a.mu.Lock()
+	a.stats.Connections++
+	a.mu.Unlock()
+	return &connection{analyzer: a, key: key}
+}
+
+// hostOf names the host a request went to, falling back to the server
+// address when there was no Host header.
+func hostOf(key stream.ConnectionKey, req *Request) string {
+	if req != nil && req.Host != "" {
+		return req.Host
+	}
+	return key.ServerIP.String()
+}
+
+func (a *Analyzer) onRequest(key stream.ConnectionKey, req *Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.stats.Requests++
+	host := hostOf(key, req)
+	if agg := a.host(host); agg != nil {
+		agg.request(req.Timestamp)
+	}
+	if agg := a.endpoint(endpointKey{host: host, method: req.Method, path: req.Path}); agg != nil {
+		agg.request(req.Timestamp)
+	}
+}
+
+func (a *Analyzer) onTransaction(txn *Transaction) {
+	a.mu.Lock()
+	a.stats.Responses++
+	host := hostOf(txn.Connection, txn.Request)
+	if agg := a.host(host); agg != nil {
+		agg.response(txn)
+	}
+	if txn.Request != nil {
+		if agg := a.endpoint(endpointKey{host: host, method: txn.Request.Method, path: txn.Request.Path}); agg != nil {
+			agg.response(txn)
+		}
+	}
+	handlers := a.handlers
+	a.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(txn)
+	}
+}
+
+func (a *Analyzer) host(host string) *aggregate {
+	agg, exists := a.hosts[host]
+	if !exists {
+		if len(a.hosts) >= a.config.MaxHosts {
+			a.stats.HostsDropped++
+			return nil
+		}
+		agg = newAggregate(a.config.LatencySamples)
+		a.hosts[host] = agg
+	}
+	return agg
+}
+
+func (a *Analyzer) endpoint(key endpointKey) *aggregate {
+	agg, exists := a.endpoints[key]
+	if !exists {
+		if len(a.endpoints) >= a.config.MaxEndpoints {
+			a.stats.EndpointsDropped++
+			return nil
+		}
+		agg = newAggregate(a.config.LatencySamples)
+		a.endpoints[key] = agg
+	}
+	return agg
+}
+
+func (a *Analyzer) unanswered(n int) {
+	if n == 0 {
+		return
+	}
+	a.mu.Lock()
+	a.stats.Unanswered += uint64(n)
+	a.mu.Unlock()
+}
+
+func (a *Analyzer) notHTTP() {
+	a.mu.Lock()
+	a.stats.NotHTTP++
+	a.mu.Unlock()
+}
+
+func (a *Analyzer) parseError(key stream.ConnectionKey, err error) {
+	a.mu.Lock()
+	a.stats.ParseErrors++
+	a.mu.Unlock()
+	a.logger.Debug("failed to parse HTTP message",
+		slog.String("connection", key.String()),
+		slog.String("error", err.Error()))
+}
+
+// Hosts returns the statistics of every host, busiest first. Rates are
+// taken over the minute before now.
+func (a *Analyzer) Hosts(now time.Time) []RequestStatistics {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	result := make([]RequestStatistics, 0, len(a.hosts))
+	for host, agg := range a.hosts {
+		result = append(result, agg.export(RequestStatistics{Host: host}, now))
+	}
+	sortByRequests(result)
+	return result
+}
+
+// Endpoints returns the statistics of every endpoint, busiest first.
+func (a *Analyzer) Endpoints(now time.Time) []RequestStatistics {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	result := make([]RequestStatistics, 0, len(a.endpoints))
+	for key, agg := range a.endpoints {
+		result = append(result, agg.export(RequestStatistics{Host: key.host, Method: key.method, Path: key.path}, now))
+	}
+	sortByRequests(result)
+	return result
+}
+
+func sortByRequests(stats []RequestStatistics) {
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Requests != stats[j].Requests {
+			return stats[i].Requests > stats[j].Requests
+		}
+		if stats[i].Host != stats[j].Host {
+			return stats[i].Host < stats[j].Host
+		}
+		if stats[i].Path != stats[j].Path {
+			return stats[i].Path < stats[j].Path
+		}
+		return stats[i].Method < stats[j].Method
+	})
+}
+
+func (a *Analyzer) GetStatistics() AnalyzerStatistics {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.stats
+}
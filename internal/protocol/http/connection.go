@@ -0,0 +1,325 @@
+package http
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/stream"
+)
+
+type parseState int
+
+const (
+	stateHead parseState = iota
+	stateBody
+	stateChunkSize
+	stateChunkData
+	stateTrailer
+	stateUntilClose
+	stateStopped
+)
+
+type role int
+
+const (
+	roleUnknown role = iota
+	roleRequests
+	roleResponses
+)
+
+// connection is the stream.Consumer following one HTTP/1.x connection.
+// Each direction is parsed on its own; responses are paired with requests
+// in order, which also covers pipelining.
+type connection struct {
+	analyzer *Analyzer
+	key      stream.ConnectionKey
+	half     [2]halfParser
+	pending  []*pendingRequest
+}
+
+type pendingRequest struct {
+	request *Request
+	end     time.Time // when the last byte of the request arrived
+}
+
+type halfParser struct {
+	role      role
+	state     parseState
+	buf       []byte // the header block or chunk line being collected
+	remaining int64
+	start     time.Time
+	messages  int
+	// request is the request whose body is being read, so that its end
+	// can be recorded.
+	request *pendingRequest
+}
+
+func (c *connection) Data(dir stream.Direction, data []byte, timestamp time.Time) {
+	p := &c.half[dir]
+	for len(data) > 0 && p.state != stateStopped {
+		switch p.state {
+		case stateHead:
+			data = c.readHead(p, data, timestamp)
+		case stateBody, stateChunkData:
+			n := min(p.remaining, int64(len(data)))
+			p.remaining -= n
+			data = data[n:]
+			if p.remaining == 0 {
+				c.endBody(p, timestamp)
+			}
+		case stateChunkSize, stateTrailer:
+			var line []byte
+			var ok bool
+			if line, data, ok = c.readLine(p, data); ok {
+				c.chunkLine(p, line, timestamp)
+			}
+		case stateUntilClose:
+			data = nil
+		}
+	}
+}
+
+// readHead collects a header block and returns the data following it.
+func (c *connection) readHead(p *halfParser, data []byte, timestamp time.Time) []byte {
+	if len(p.buf) == 0 {
+		// Stray line breaks between messages are allowed.
+		data = bytes.TrimLeft(data, "\r\n")
+		if len(data) == 0 {
+			return nil
+		}
+		p.start = timestamp
+	}
+
+	searchFrom := max(0, len(p.buf)-3)
+	p.buf = append(p.buf, data...)
+	end, next := headEnd(p.buf, searchFrom)
+	if end < 0 {
+		if len(p.buf) > c.analyzer.config.MaxHeaderSize {
+			c.stop(p, ErrBadHeader)
+		}
+		return nil
+	}
+
+	block, rest := p.buf[:end], p.buf[next:]
+	p.buf = nil
+	c.onHead(p, block, timestamp)
+	return rest
+}
+
+// headEnd finds the blank line ending a header block, returning where the
+// block ends and where the data after the blank line starts.
+func headEnd(buf []byte, from int) (int, int) {
+	for i := from; i < len(buf); i++ {
+		if buf[i] != '\n' {
+			continue
+		}
+		if i+1 < len(buf) && buf[i+1] == '\n' {
+			return i, i + 2
+		}
+		if i+2 < len(buf) && buf[i+1] == '\r' && buf[i+2] == '\n' {
+			return i, i + 3
+		}
+	}
+	return -1, -1
+}
+
+func (c *connection) readLine(p *halfParser, data []byte) ([]byte, []byte, bool) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		p.buf = append(p.buf, data...)
+		if len(p.buf) > c.analyzer.config.MaxHeaderSize {
+			c.stop(p, ErrBadHeader)
+		}
+		return nil, nil, false
+	}
+	line := bytes.TrimSuffix(append(p.buf, data[:i]...), []byte("\r"))
+	p.buf = nil
+	return line, data[i+1:], true
+}
+
+func (c *connection) chunkLine(p *halfParser, line []byte, timestamp time.Time) {
+	if p.state == stateTrailer {
+		if len(line) == 0 {
+			c.endMessage(p, timestamp)
+		}
+		return
+	}
+
+	size := string(line)
+	if semicolon := strings.IndexByte(size, ';'); semicolon >= 0 {
+		size = size[:semicolon]
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(size), 16, 64)
+	if err != nil || n < 0 {
+		c.stop(p, ErrBadHeader)
+		return
+	}
+	if n == 0 {
+		p.state = stateTrailer
+		return
+	}
+	// The chunk is followed by a line break.
+	p.remaining = n + 2
+	p.state = stateChunkData
+}
+
+func (c *connection) onHead(p *halfParser, block []byte, timestamp time.Time) {
+	h, err := parseHead(block)
+	if err == nil && p.role == roleUnknown {
+		if isVersion(h.line[0]) {
+			p.role = roleResponses
+		} else {
+			p.role = roleRequests
+		}
+	}
+	if err != nil {
+		c.stop(p, err)
+		return
+	}
+
+	if p.role == roleRequests {
+		c.onRequest(p, h, timestamp)
+	} else {
+		c.onResponse(p, h, timestamp)
+	}
+}
+
+func (c *connection) onRequest(p *halfParser, h *head, timestamp time.Time) {
+	req, err := h.request()
+	if err != nil {
+		c.stop(p, err)
+		return
+	}
+	req.Timestamp = p.start
+	p.messages++
+
+	if len(c.pending) >= c.analyzer.config.MaxPipelined {
+		c.pending = c.pending[1:]
+		c.analyzer.unanswered(1)
+	}
+	p.request = &pendingRequest{request: req}
+	c.pending = append(c.pending, p.request)
+	c.analyzer.onRequest(c.key, req)
+
+	switch {
+	case h.chunked:
+		p.state = stateChunkSize
+	case h.contentLength > 0:
+		p.state = stateBody
+		p.remaining = h.contentLength
+	default:
+		c.endMessage(p, timestamp)
+	}
+}
+
+func (c *connection) onResponse(p *halfParser, h *head, timestamp time.Time) {
+	resp, err := h.response()
+	if err != nil {
+		c.stop(p, err)
+		return
+	}
+	resp.Timestamp = p.start
+	p.messages++
+
+	// Interim responses precede the real one.
+	if resp.StatusCode < 200 && resp.StatusCode != 101 {
+		c.endMessage(p, timestamp)
+		return
+	}
+
+	txn := &Transaction{Connection: c.key, Response: resp}
+	if len(c.pending) > 0 {
+		pending := c.pending[0]
+		c.pending = c.pending[1:]
+		txn.Request = pending.request
+		// A server may answer before the request body is complete.
+		if !pending.end.IsZero() && pending.end.Before(resp.Timestamp) {
+			txn.Latency = resp.Timestamp.Sub(pending.end)
+		}
+	}
+	c.analyzer.onTransaction(txn)
+
+	// The connection no longer carries HTTP after an upgrade or a tunnel.
+	if resp.StatusCode == 101 || (txn.Request != nil && txn.Request.Method == "CONNECT" && resp.StatusCode < 300) {
+		c.half[stream.ClientToServer].state = stateStopped
+		c.half[stream.ServerToClient].state = stateStopped
+		return
+	}
+
+	switch {
+	case txn.Request != nil && txn.Request.Method == "HEAD",
+		resp.StatusCode == 204, resp.StatusCode == 304:
+		c.endMessage(p, timestamp)
+	case h.chunked:
+		p.state = stateChunkSize
+	case h.contentLength > 0:
+		p.state = stateBody
+		p.remaining = h.contentLength
+	case h.contentLength == 0:
+		c.endMessage(p, timestamp)
+	default:
+		p.state = stateUntilClose
+	}
+}
+
+// endBody moves on once a body or a chunk of one has been read.
+func (c *connection) endBody(p *halfParser, timestamp time.Time) {
+	if p.state == stateChunkData {
+		p.state = stateChunkSize
+		return
+	}
+	c.endMessage(p, timestamp)
+}
+
+func (c *connection) endMessage(p *halfParser, timestamp time.Time) {
+	if p.request != nil {
+		p.request.end = timestamp
+		p.request = nil
+	}
+	p.state = stateHead
+	p.remaining = 0
+}
+
+// stop gives up on a direction. A direction whose first message does not
+// parse is not HTTP at all.
+func (c *connection) stop(p *halfParser, err error) {
+	if p.messages == 0 {
+		c.analyzer.notHTTP()
+	} else {
+		c.analyzer.parseError(c.key, err)
+	}
+	p.state = stateStopped
+	p.buf = nil
+	p.request = nil
+}
+
+func (c *connection) Gap(dir stream.Direction, length int) {
+	p := &c.half[dir]
+	switch p.state {
+	case stateUntilClose, stateStopped:
+		return
+	case stateBody, stateChunkData:
+		if p.remaining >= int64(length) {
+			p.remaining -= int64(length)
+			if p.remaining == 0 {
+				c.endBody(p, p.start)
+			}
+			return
+		}
+	}
+	// Sync is lost: what follows cannot be told apart from message bodies.
+	p.state = stateStopped
+	p.buf = nil
+	p.request = nil
+	if p.role == roleRequests {
+		c.analyzer.unanswered(len(c.pending))
+		c.pending = nil
+	}
+}
+
+func (c *connection) Close(reason stream.CloseReason) {
+	c.analyzer.unanswered(len(c.pending))
+	c.pending = nil
+}
@@ -0,0 +1,172 @@
+// Package http extracts request and response metadata from plaintext
+// HTTP/1.x streams and aggregates it per host and endpoint.
+package http
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/stream"
+)
+
+type Request struct {
+	Method    string `json:"method"`
+	Target    string `json:"target"`
+	Host      string `json:"host,omitempty"`
+	Path      string `json:"path"`
+	Version   string `json:"version"`
+	UserAgent string `json:"user_agent,omitempty"`
+	// ContentLength is -1 when the body is chunked or absent.
+	ContentLength int64     `json:"content_length"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+type Response struct {
+	Version       string    `json:"version"`
+	StatusCode    int       `json:"status_code"`
+	Reason        string    `json:"reason,omitempty"`
+	ContentType   string    `json:"content_type,omitempty"`
+	ContentLength int64     `json:"content_length"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// Transaction is a response paired with the request it answers. Request is
+// nil when the request was missed; Latency runs from the end of the request
+// to the start of the response.
+type Transaction struct {
+	Connection stream.ConnectionKey `json:"connection"`
+	Request    *Request             `json:"request,omitempty"`
+	Response   *Response            `json:"response"`
+	Latency    time.Duration        `json:"latency"`
+}
+
+var (
+	ErrNotHTTP   = errors.New("http: not an HTTP/1.x message")
+	ErrBadHeader = errors.New("http: malformed header")
+)
+
+// head is the part of a message's header block the analyzer uses.
+type head struct {
+	line          [3]string
+	host          string
+	userAgent     string
+	contentType   string
+	contentLength int64
+	chunked       bool
+}
+
+// parseHead splits a header block, without its terminating blank line,
+// into the start line and the fields of interest.
+func parseHead(block []byte) (*head, error) {
+	lines := bytes.Split(block, []byte("\n"))
+	start := strings.TrimSuffix(string(lines[0]), "\r")
+
+	h := &head{contentLength: -1}
+	parts := strings.SplitN(start, " ", 3)
+	if len(parts) < 2 {
+		return nil, ErrNotHTTP
+	}
+	copy(h.line[:], parts)
+
+	for _, line := range lines[1:] {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) == 0 {
+			continue
+		}
+		colon := bytes.IndexByte(line, ':')
+		if colon <= 0 {
+			return nil, ErrBadHeader
+		}
+		value := string(bytes.TrimSpace(line[colon+1:]))
+
+		switch strings.ToLower(string(line[:colon])) {
+		case "host":
+			h.host = strings.ToLower(value)
+		case "user-agent":
+			h.userAgent = value
+		case "content-type":
+			h.contentType = value
+		case "content-length":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return nil, ErrBadHeader
+			}
+			h.contentLength = n
+		case "transfer-encoding":
+			h.chunked = strings.HasSuffix(strings.ToLower(value), "chunked")
+		}
+	}
+	return h, nil
+}
+
+func isVersion(s string) bool {
+	return strings.HasPrefix(s, "HTTP/1.")
+}
+
+func isMethod(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'A' || s[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *head) request() (*Request, error) {
+	if !isMethod(h.line[0]) || !isVersion(h.line[2]) {
+		return nil, ErrNotHTTP
+	}
+	req := &Request{
+		Method:        h.line[0],
+		Target:        h.line[1],
+		Host:          h.host,
+		Version:       h.line[2],
+		UserAgent:     h.userAgent,
+		ContentLength: h.contentLength,
+	}
+
+	// Requests to proxies carry the host in an absolute-form target.
+	path := h.line[1]
+	if scheme := strings.Index(path, "://"); scheme > 0 && !strings.HasPrefix(path, "/") {
+		rest := path[scheme+3:]
+		slash := strings.IndexByte(rest, '/')
+		if slash < 0 {
+			slash = len(rest)
+		}
+		if req.Host == "" {
+			req.Host = strings.ToLower(rest[:slash])
+		}
+		path = rest[slash:]
+		if path == "" {
+			path = "/"
+		}
+	}
+	if query := strings.IndexAny(path, "?#"); query >= 0 {
+		path = path[:query]
+	}
+	req.Path = path
+	return req, nil
+}
+
+func (h *head) response() (*Response, error) {
+	if !isVersion(h.line[0]) || len(h.line[1]) != 3 {
+		return nil, ErrNotHTTP
+	}
+	code, err := strconv.Atoi(h.line[1])
+	if err != nil || code < 100 {
+		return nil, ErrNotHTTP
+	}
+	return &Response{
+		Version:       h.line[0],
+		StatusCode:    code,
+		Reason:        h.line[2],
+		ContentType:   h.contentType,
+		ContentLength: h.contentLength,
+	}, nil
+}
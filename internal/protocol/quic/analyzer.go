@@ -0,0 +1,372 @@
+package quic
+
+import (
+	"container/list"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/tls"
+	"github.com/Karias-sys/Traffic_Monitor/internal/stream"
+)
+
+// Info is what the Initial packets of one connection revealed.
+type Info struct {
+	Version Version `json:"version"`
+	// The connection IDs of the client's first Initial packet.
+	DestinationConnectionID ConnectionID   `json:"dcid"`
+	SourceConnectionID      ConnectionID   `json:"scid"`
+	Handshake               *tls.Handshake `json:"tls,omitempty"`
+	Timestamp               time.Time      `json:"timestamp"`
+}
+
+type AnalyzerConfig struct {
+	// MaxConnections caps the results kept for Lookup; the oldest is dropped
+	// to make room.
+	MaxConnections int
+
+	// MaxPending caps the handshakes being followed. The least recently
+	// active one is reported with what it has to make room.
+	MaxPending int
+
+	// MaxHelloSize caps the CRYPTO data buffered per direction while waiting
+	// for a complete hello.
+	MaxHelloSize int
+
+	// HandshakeTimeout is how long Expire waits for the server's hello
+	// before reporting a handshake with the client's alone.
+	HandshakeTimeout time.Duration
+}
+
+type AnalyzerStatistics struct {
+	Connections         int    `json:"connections"`
+	Pending             int    `json:"pending"`
+	LongHeaderPackets   uint64 `json:"long_header_packets"`
+	InitialPackets      uint64 `json:"initial_packets"`
+	Decrypted           uint64 `json:"decrypted"`
+	DecryptFailures     uint64 `json:"decrypt_failures"`
+	UnsupportedVersions uint64 `json:"unsupported_versions"`
+	ParseErrors         uint64 `json:"parse_errors"`
+	Oversized           uint64 `json:"oversized"`
+	Handshakes          uint64 `json:"handshakes"`
+}
+
+// Handler is called once for each connection whose client Initial was
+// decrypted, when both hellos are in or the handshake is given up on.
+type Handler func(key stream.ConnectionKey, info *Info)
+
+// Analyzer decrypts the Initial packets of QUIC connections and extracts
+// the TLS hellos they carry. QUIC is recognised by content rather than
+// port. Connections are keyed like TCP ones, with the sender of the first
+// Initial packet as the client.
+type Analyzer struct {
+	mu       *sync.RWMutex
+	logger   *slog.Logger
+	config   AnalyzerConfig
+	handlers []Handler
+
+	pending      map[stream.ConnectionKey]*list.Element
+	pendingOrder *list.List // *handshake, least recently active first
+	results      map[stream.ConnectionKey]*list.Element
+	resultOrder  *list.List // *storedInfo, oldest first
+	// reports are the handshakes finished while the lock is held, for the
+	// handlers to be called with once it is released.
+	reports []report
+	stats   AnalyzerStatistics
+}
+
+type storedInfo struct {
+	key  stream.ConnectionKey
+	info *Info
+}
+
+type report struct {
+	key  stream.ConnectionKey
+	info *Info
+}
+
+func DefaultAnalyzerConfig() AnalyzerConfig {
+	return AnalyzerConfig{
+		MaxConnections:   65536,
+		MaxPending:       4096,
+		MaxHelloSize:     16 * 1024,
+		HandshakeTimeout: 10 * time.Second,
+	}
+}
+
+func NewAnalyzer(logger *slog.Logger) *Analyzer {
+	return NewAnalyzerWithConfig(logger, DefaultAnalyzerConfig())
+}
+
+func NewAnalyzerWithConfig(logger *slog.Logger, config AnalyzerConfig) *Analyzer {
+	defaults := DefaultAnalyzerConfig()
+	if config.MaxConnections <= 0 {
+		config.MaxConnections = defaults.MaxConnections
+	}
+	if config.MaxPending <= 0 {
+		config.MaxPending = defaults.MaxPending
+	}
+	if config.MaxHelloSize <= 0 {
+		config.MaxHelloSize = defaults.MaxHelloSize
+	}
+	if config.HandshakeTimeout <= 0 {
+		config.HandshakeTimeout = defaults.HandshakeTimeout
+	}
+
+	return &Analyzer{
+		mu:           &sync.RWMutex{},
+		logger:       logger,
+		config:       config,
+		pending:      make(map[stream.ConnectionKey]*list.Element),
+		pendingOrder: list.New(),
+		results:      make(map[stream.ConnectionKey]*list.Element),
+		resultOrder:  list.New(),
+	}
+}
+
+// OnHandshake registers a handler for handshakes completed from now on,
+// such as the flow table labelling UDP flows with them.
+func (a *Analyzer) OnHandshake(handler Handler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.handlers = append(a.handlers, handler)
+}
+
+// ObservePacket looks for Initial packets in a UDP datagram. For tunnelled
+// traffic pass packet.Innermost().
+func (a *Analyzer) ObservePacket(packet *capture.ParsedPacket, timestamp time.Time) {
+	if packet == nil || packet.UDP == nil || !IsLongHeader(packet.Payload) {
+		return
+	}
+	var src, dst netip.Addr
+	switch {
+	case packet.IPv4 != nil:
+		src, dst = packet.IPv4.SrcIP, packet.IPv4.DstIP
+	case packet.IPv6 != nil:
+		src, dst = packet.IPv6.SrcIP, packet.IPv6.DstIP
+	default:
+		return
+	}
+	key := stream.ConnectionKey{ClientIP: src, ClientPort: packet.UDP.SrcPort, ServerIP: dst, ServerPort: packet.UDP.DstPort}
+
+	a.mu.Lock()
+	a.stats.LongHeaderPackets++
+	// A datagram may hold several coalesced packets, each with a long
+	// header until the first short-header one.
+	for data := packet.Payload; IsLongHeader(data); {
+		h, err := ParseLongHeader(data)
+		if err != nil {
+			if errors.Is(err, ErrUnsupported) {
+				a.stats.UnsupportedVersions++
+			} else {
+				a.stats.ParseErrors++
+			}
+			break
+		}
+		if h.Type == PacketTypeRetry || h.Type == PacketTypeVersionNegotiation {
+			break
+		}
+		if h.Type == PacketTypeInitial {
+			a.stats.InitialPackets++
+			a.initial(key, data, h, timestamp)
+		}
+		data = data[h.HeaderLength+h.Length:]
+	}
+	a.unlockAndNotify()
+}
+
+// initial follows one Initial packet sent along key.
+func (a *Analyzer) initial(key stream.ConnectionKey, data []byte, h *LongHeader, timestamp time.Time) {
+	hs, dir := a.lookup(key)
+	if hs == nil {
+		a.open(key, data, h, timestamp)
+		return
+	}
+
+	keys := hs.keys[dir]
+	packet, err := keys.Open(data, h)
+	if errors.Is(err, ErrDecryption) && dir == stream.ClientToServer && string(h.DestinationConnectionID) != string(hs.clientDCID) {
+		// After a Retry the client derives new keys from the connection ID
+		// the server chose.
+		if rekeyed, rekeyErr := newHandshake(hs.key, h, timestamp); rekeyErr == nil {
+			if packet, err = rekeyed.keys[dir].Open(data, h); err == nil {
+				hs.keys = rekeyed.keys
+				hs.clientDCID = rekeyed.clientDCID
+			}
+		}
+	}
+	if err != nil {
+		a.packetError(key, err)
+		return
+	}
+	a.stats.Decrypted++
+
+	hs.lastSeen = timestamp
+	a.pendingOrder.MoveToBack(hs.element)
+	if hs.crypto(a, dir, packet.Crypto) {
+		a.finish(hs)
+	}
+}
+
+// open starts following the connection of a client's first Initial packet.
+func (a *Analyzer) open(key stream.ConnectionKey, data []byte, h *LongHeader, timestamp time.Time) {
+	hs, err := newHandshake(key, h, timestamp)
+	if err != nil {
+		a.packetError(key, err)
+		return
+	}
+	packet, err := hs.keys[stream.ClientToServer].Open(data, h)
+	if err != nil {
+		// The later Initial packets of a finished handshake, and those of
+		// servers, do not decrypt with keys derived from their own header.
+		if !a.finished(key) {
+			a.packetError(key, err)
+		}
+		return
+	}
+	a.stats.Decrypted++
+
+	if a.pendingOrder.Len() >= a.config.MaxPending {
+		a.finish(a.pendingOrder.Front().Value.(*handshake))
+	}
+	hs.element = a.pendingOrder.PushBack(hs)
+	a.pending[key] = hs.element
+
+	if hs.crypto(a, stream.ClientToServer, packet.Crypto) {
+		a.finish(hs)
+	}
+}
+
+func (a *Analyzer) lookup(key stream.ConnectionKey) (*handshake, stream.Direction) {
+	if element, exists := a.pending[key]; exists {
+		return element.Value.(*handshake), stream.ClientToServer
+	}
+	if element, exists := a.pending[reverse(key)]; exists {
+		return element.Value.(*handshake), stream.ServerToClient
+	}
+	return nil, stream.ClientToServer
+}
+
+func (a *Analyzer) finished(key stream.ConnectionKey) bool {
+	if _, exists := a.results[key]; exists {
+		return true
+	}
+	_, exists := a.results[reverse(key)]
+	return exists
+}
+
+func (a *Analyzer) packetError(key stream.ConnectionKey, err error) {
+	switch {
+	case errors.Is(err, ErrDecryption):
+		a.stats.DecryptFailures++
+	case errors.Is(err, ErrUnsupported):
+		a.stats.UnsupportedVersions++
+	default:
+		a.stats.ParseErrors++
+	}
+	a.logger.Debug("failed to read QUIC Initial packet",
+		slog.String("connection", key.String()),
+		slog.String("error", err.Error()))
+}
+
+// finish stops following a handshake and records what it revealed, if
+// anything.
+func (a *Analyzer) finish(hs *handshake) {
+	a.pendingOrder.Remove(hs.element)
+	delete(a.pending, hs.key)
+	if hs.client == nil {
+		return
+	}
+
+	a.stats.Handshakes++
+	info := &Info{
+		Version:                 hs.version,
+		DestinationConnectionID: hs.dcid,
+		SourceConnectionID:      hs.scid,
+		Handshake:               tls.NewHandshake(hs.client, hs.server, tls.TransportQUIC),
+		Timestamp:               hs.timestamp,
+	}
+	info.Handshake.Timestamp = hs.timestamp
+
+	if element, exists := a.results[hs.key]; exists {
+		a.resultOrder.Remove(element)
+	} else if a.resultOrder.Len() >= a.config.MaxConnections {
+		oldest := a.resultOrder.Remove(a.resultOrder.Front()).(*storedInfo)
+		delete(a.results, oldest.key)
+	}
+	a.results[hs.key] = a.resultOrder.PushBack(&storedInfo{key: hs.key, info: info})
+	a.reports = append(a.reports, report{key: hs.key, info: info})
+}
+
+// unlockAndNotify releases the lock and calls the handlers with the
+// handshakes finished while it was held.
+func (a *Analyzer) unlockAndNotify() {
+	reports, handlers := a.reports, a.handlers
+	a.reports = nil
+	a.mu.Unlock()
+
+	for _, r := range reports {
+		a.logger.Debug("observed QUIC handshake",
+			slog.String("connection", r.key.String()),
+			slog.String("version", r.info.Version.String()),
+			slog.String("server_name", r.info.Handshake.ServerName),
+			slog.String("ja4", r.info.Handshake.JA4))
+		for _, handler := range handlers {
+			handler(r.key, r.info)
+		}
+	}
+}
+
+// Expire reports the handshakes that have waited for the server's hello
+// for longer than the handshake timeout, and returns their number.
+func (a *Analyzer) Expire(now time.Time) int {
+	a.mu.Lock()
+	expired := 0
+	for element := a.pendingOrder.Front(); element != nil; {
+		hs := element.Value.(*handshake)
+		if now.Sub(hs.lastSeen) <= a.config.HandshakeTimeout {
+			break
+		}
+		element = element.Next()
+		expired++
+		a.finish(hs)
+	}
+	a.unlockAndNotify()
+	return expired
+}
+
+// Lookup returns what was seen of a connection, given either way round.
+func (a *Analyzer) Lookup(key stream.ConnectionKey) (*Info, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	element, exists := a.results[key]
+	if !exists {
+		if element, exists = a.results[reverse(key)]; !exists {
+			return nil, false
+		}
+	}
+	return element.Value.(*storedInfo).info, true
+}
+
+func (a *Analyzer) GetStatistics() AnalyzerStatistics {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	stats := a.stats
+	stats.Connections = len(a.results)
+	stats.Pending = len(a.pending)
+	return stats
+}
+
+func reverse(key stream.ConnectionKey) stream.ConnectionKey {
+	return stream.ConnectionKey{
+		ClientIP:   key.ServerIP,
+		ClientPort: key.ServerPort,
+		ServerIP:   key.ClientIP,
+		ServerPort: key.ClientPort,
+	}
+}
@@ -0,0 +1,157 @@
+package quic
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/tls"
+	"github.com/Karias-sys/Traffic_Monitor/internal/stream"
+)
+
+const handshakeHeaderSize = 4
+
+// handshake follows the Initial packets of one connection until both
+// hellos are read.
+type handshake struct {
+	key        stream.ConnectionKey
+	version    Version
+	dcid       ConnectionID
+	scid       ConnectionID
+	clientDCID ConnectionID // what the current keys were derived from
+	keys       [2]*Keys
+	streams    [2]cryptoStream
+	client     *tls.ClientHello
+	server     *tls.ServerHello
+	timestamp  time.Time
+	lastSeen   time.Time
+	element    *list.Element
+}
+
+// cryptoStream reassembles the CRYPTO frames of one direction.
+type cryptoStream struct {
+	data     []byte        // contiguous from offset 0
+	ahead    []CryptoFrame // frames past the end of data
+	buffered int
+	read     int // bytes of data already read as handshake messages
+	done     bool
+}
+
+func newHandshake(key stream.ConnectionKey, h *LongHeader, timestamp time.Time) (*handshake, error) {
+	hs := &handshake{
+		key:        key,
+		version:    h.Version,
+		dcid:       clone(h.DestinationConnectionID),
+		scid:       clone(h.SourceConnectionID),
+		clientDCID: clone(h.DestinationConnectionID),
+		timestamp:  timestamp,
+		lastSeen:   timestamp,
+	}
+	var err error
+	if hs.keys[stream.ClientToServer], err = InitialKeys(h.Version, h.DestinationConnectionID, false); err != nil {
+		return nil, err
+	}
+	if hs.keys[stream.ServerToClient], err = InitialKeys(h.Version, h.DestinationConnectionID, true); err != nil {
+		return nil, err
+	}
+	return hs, nil
+}
+
+func clone(id ConnectionID) ConnectionID {
+	return append(ConnectionID(nil), id...)
+}
+
+// crypto adds the CRYPTO frames of a packet and reads the hello they
+// complete, reporting whether both hellos are now in.
+func (hs *handshake) crypto(a *Analyzer, dir stream.Direction, frames []CryptoFrame) bool {
+	s := &hs.streams[dir]
+	if s.done {
+		return hs.client != nil && hs.server != nil
+	}
+	for _, f := range frames {
+		s.add(f)
+	}
+	if s.buffered > a.config.MaxHelloSize {
+		a.stats.Oversized++
+		s.finish()
+		return false
+	}
+
+	for !s.done && len(s.data)-s.read >= handshakeHeaderSize {
+		msg := s.data[s.read:]
+		length := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+		if len(msg) < handshakeHeaderSize+length {
+			break
+		}
+		body := msg[handshakeHeaderSize : handshakeHeaderSize+length]
+		s.read += handshakeHeaderSize + length
+
+		switch {
+		case dir == stream.ClientToServer && msg[0] == tls.HandshakeTypeClientHello:
+			ch, err := tls.ParseClientHello(body)
+			if err != nil {
+				a.packetError(hs.key, err)
+				s.finish()
+				break
+			}
+			// After a HelloRetryRequest the client sends a second hello;
+			// the first one is what identifies it.
+			if hs.client == nil {
+				hs.client = ch
+			}
+			s.finish()
+		case dir == stream.ServerToClient && msg[0] == tls.HandshakeTypeServerHello:
+			sh, err := tls.ParseServerHello(body)
+			if err != nil {
+				a.packetError(hs.key, err)
+				s.finish()
+				break
+			}
+			if sh.HelloRetryRequest {
+				// The real ServerHello follows the client's second hello.
+				continue
+			}
+			hs.server = sh
+			s.finish()
+		default:
+			s.finish()
+		}
+	}
+	return hs.client != nil && hs.server != nil
+}
+
+// add places a frame in the stream. Retransmitted data is ignored.
+func (s *cryptoStream) add(f CryptoFrame) {
+	if f.Offset > uint64(len(s.data)) {
+		s.ahead = append(s.ahead, f)
+		s.buffered += len(f.Data)
+		return
+	}
+	s.extend(f)
+
+	for progress := true; progress; {
+		progress = false
+		for i := 0; i < len(s.ahead); i++ {
+			if f := s.ahead[i]; f.Offset <= uint64(len(s.data)) {
+				s.buffered -= len(f.Data)
+				s.extend(f)
+				s.ahead = append(s.ahead[:i], s.ahead[i+1:]...)
+				progress = true
+				i--
+			}
+		}
+	}
+}
+
+func (s *cryptoStream) extend(f CryptoFrame) {
+	if end := f.Offset + uint64(len(f.Data)); end > uint64(len(s.data)) {
+		n := len(s.data)
+		s.data = append(s.data, f.Data[uint64(n)-f.Offset:]...)
+		s.buffered += len(s.data) - n
+	}
+}
+
+func (s *cryptoStream) finish() {
+	s.done = true
+	s.data = nil
+	s.ahead = nil
+}
@@ -0,0 +1,211 @@
+// Package quic recognises QUIC long-header packets and decrypts Initial
+// packets, whose keys any observer can derive, to recover the TLS hellos
+// they carry.
+package quic
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Version is a QUIC version number.
+type Version uint32
+
+const (
+	VersionNegotiation Version = 0x00000000
+	Version1           Version = 0x00000001
+	Version2           Version = 0x6b3343cf
+	VersionDraft29     Version = 0xff00001d
+)
+
+func (v Version) String() string {
+	switch v {
+	case VersionNegotiation:
+		return "negotiation"
+	case Version1:
+		return "v1"
+	case Version2:
+		return "v2"
+	case VersionDraft29:
+		return "draft-29"
+	default:
+		return fmt.Sprintf("0x%08x", uint32(v))
+	}
+}
+
+func (v Version) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// PacketType is the type of a long-header packet, independent of the
+// version-specific encoding of its type bits.
+type PacketType uint8
+
+const (
+	PacketTypeInitial PacketType = iota
+	PacketType0RTT
+	PacketTypeHandshake
+	PacketTypeRetry
+	PacketTypeVersionNegotiation
+)
+
+var packetTypeNames = [...]string{"Initial", "0-RTT", "Handshake", "Retry", "VersionNegotiation"}
+
+func (t PacketType) String() string {
+	if int(t) < len(packetTypeNames) {
+		return packetTypeNames[t]
+	}
+	return fmt.Sprintf("PacketType(%d)", uint8(t))
+}
+
+// ConnectionID is a QUIC connection ID, shown in hex.
+type ConnectionID []byte
+
+func (c ConnectionID) String() string {
+	return hex.EncodeToString(c)
+}
+
+func (c ConnectionID) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+const (
+	maxConnectionIDLength = 20
+	// MinInitialDatagramSize is what clients must pad datagrams carrying
+	// Initial packets to (RFC 9000 section 14.1).
+	MinInitialDatagramSize = 1200
+)
+
+var (
+	ErrNotQUIC      = errors.New("quic: not a long-header packet")
+	ErrTruncated    = errors.New("quic: packet truncated")
+	ErrUnsupported  = errors.New("quic: unsupported version")
+	ErrDecryption   = errors.New("quic: Initial packet failed to decrypt")
+	ErrBadFrame     = errors.New("quic: malformed frame")
+	ErrNotInitial   = errors.New("quic: not an Initial packet")
+	ErrBadConnIDLen = errors.New("quic: connection ID too long")
+)
+
+// LongHeader is the unprotected part of a long-header packet.
+type LongHeader struct {
+	Version                 Version
+	Type                    PacketType
+	DestinationConnectionID ConnectionID
+	SourceConnectionID      ConnectionID
+	// Token is only present in Initial packets.
+	Token []byte
+	// Length covers the packet number and the protected payload; it is not
+	// present in Retry and Version Negotiation packets.
+	Length int
+	// HeaderLength is the offset of the packet number.
+	HeaderLength int
+}
+
+// IsLongHeader reports whether data could start a QUIC long-header packet.
+func IsLongHeader(data []byte) bool {
+	return len(data) >= 7 && data[0]&0x80 != 0
+}
+
+// ParseLongHeader parses the long header at the start of data. Connection
+// IDs and the token alias data.
+func ParseLongHeader(data []byte) (*LongHeader, error) {
+	if !IsLongHeader(data) {
+		return nil, ErrNotQUIC
+	}
+	h := &LongHeader{
+		Version: Version(uint32(data[1])<<24 | uint32(data[2])<<16 | uint32(data[3])<<8 | uint32(data[4])),
+	}
+	offset := 5
+
+	var ok bool
+	if h.DestinationConnectionID, offset, ok = connectionID(data, offset); !ok {
+		return nil, ErrTruncated
+	}
+	if h.SourceConnectionID, offset, ok = connectionID(data, offset); !ok {
+		return nil, ErrTruncated
+	}
+
+	if h.Version == VersionNegotiation {
+		h.Type = PacketTypeVersionNegotiation
+		h.HeaderLength = offset
+		return h, nil
+	}
+	if !supported(h.Version) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, h.Version)
+	}
+	// Version-specific connection ID limits are only enforced for the
+	// versions we know.
+	if len(h.DestinationConnectionID) > maxConnectionIDLength || len(h.SourceConnectionID) > maxConnectionIDLength {
+		return nil, ErrBadConnIDLen
+	}
+	h.Type = packetType(h.Version, data[0]>>4&0x03)
+
+	switch h.Type {
+	case PacketTypeRetry:
+		h.HeaderLength = offset
+		return h, nil
+	case PacketTypeInitial:
+		tokenLength, n := varint(data[offset:])
+		if n == 0 || uint64(len(data)-offset-n) < tokenLength {
+			return nil, ErrTruncated
+		}
+		offset += n
+		h.Token = data[offset : offset+int(tokenLength)]
+		offset += int(tokenLength)
+	}
+
+	length, n := varint(data[offset:])
+	if n == 0 {
+		return nil, ErrTruncated
+	}
+	offset += n
+	if uint64(len(data)-offset) < length {
+		return nil, fmt.Errorf("%w: length %d, %d bytes left", ErrTruncated, length, len(data)-offset)
+	}
+	h.Length = int(length)
+	h.HeaderLength = offset
+	return h, nil
+}
+
+func connectionID(data []byte, offset int) (ConnectionID, int, bool) {
+	if offset >= len(data) {
+		return nil, offset, false
+	}
+	n := int(data[offset])
+	offset++
+	if len(data)-offset < n {
+		return nil, offset, false
+	}
+	return ConnectionID(data[offset : offset+n]), offset + n, true
+}
+
+func supported(v Version) bool {
+	return v == Version1 || v == Version2 || v == VersionDraft29
+}
+
+// packetType decodes the type bits of the first byte. QUIC v2 rotates them
+// (RFC 9369 section 3.2).
+func packetType(v Version, bits byte) PacketType {
+	if v == Version2 {
+		return PacketType((bits + 3) % 4)
+	}
+	return PacketType(bits)
+}
+
+// varint decodes a variable-length integer, returning it and its length,
+// or a length of 0 if data is too short.
+func varint(data []byte) (uint64, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	n := 1 << (data[0] >> 6)
+	if len(data) < n {
+		return 0, 0
+	}
+	v := uint64(data[0] & 0x3F)
+	for _, b := range data[1:n] {
+		v = v<<8 | uint64(b)
+	}
+	return v, n
+}
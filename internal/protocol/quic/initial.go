@@ -0,0 +1,249 @@
+package quic
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// Initial salts, RFC 9001 section 5.2, RFC 9369 section 3.3.1 and
+// draft-ietf-quic-tls-29.
+var (
+	saltV1      = []byte{0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17, 0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a}
+	saltV2      = []byte{0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93, 0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9}
+	saltDraft29 = []byte{0xaf, 0xbf, 0xec, 0x28, 0x99, 0x93, 0xd2, 0x4c, 0x9e, 0x97, 0x86, 0xf1, 0x9c, 0x61, 0x11, 0xe0, 0x43, 0x90, 0xa8, 0x99}
+)
+
+const (
+	sampleSize = 16
+	maxPNSize  = 4
+
+	frameTypePadding          = 0x00
+	frameTypePing             = 0x01
+	frameTypeACK              = 0x02
+	frameTypeACKECN           = 0x03
+	frameTypeCrypto           = 0x06
+	frameTypeConnectionClose  = 0x1c
+	frameTypeApplicationClose = 0x1d
+)
+
+// Keys protect the Initial packets of one side of a connection.
+type Keys struct {
+	Key []byte
+	IV  []byte
+	HP  []byte
+
+	aead cipher.AEAD
+	hp   cipher.Block
+}
+
+// InitialKeys derives the Initial keys of the client, or of the server,
+// from the Destination Connection ID of the client's first Initial packet.
+func InitialKeys(version Version, dcid ConnectionID, server bool) (*Keys, error) {
+	var salt []byte
+	labelPrefix := "quic "
+	switch version {
+	case Version1:
+		salt = saltV1
+	case Version2:
+		salt = saltV2
+		labelPrefix = "quicv2 "
+	case VersionDraft29:
+		salt = saltDraft29
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, version)
+	}
+
+	initial := hkdfExtract(salt, dcid)
+	label := "client in"
+	if server {
+		label = "server in"
+	}
+	secret := hkdfExpandLabel(initial, label, sha256.Size)
+
+	k := &Keys{
+		Key: hkdfExpandLabel(secret, labelPrefix+"key", 16),
+		IV:  hkdfExpandLabel(secret, labelPrefix+"iv", 12),
+		HP:  hkdfExpandLabel(secret, labelPrefix+"hp", 16),
+	}
+	block, err := aes.NewCipher(k.Key)
+	if err != nil {
+		return nil, err
+	}
+	if k.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, err
+	}
+	if k.hp, err = aes.NewCipher(k.HP); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func hkdfExtract(salt, secret []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+// hkdfExpandLabel is HKDF-Expand-Label of TLS 1.3 with an empty context.
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	full := "tls13 " + label
+	info := make([]byte, 0, 4+len(full))
+	info = binary.BigEndian.AppendUint16(info, uint16(length))
+	info = append(info, byte(len(full)))
+	info = append(info, full...)
+	info = append(info, 0)
+
+	mac := hmac.New(sha256.New, secret)
+	var out, block []byte
+	for counter := byte(1); len(out) < length; counter++ {
+		mac.Reset()
+		mac.Write(block)
+		mac.Write(info)
+		mac.Write([]byte{counter})
+		block = mac.Sum(nil)
+		out = append(out, block...)
+	}
+	return out[:length]
+}
+
+// mask returns the header protection mask for a ciphertext sample.
+func (k *Keys) mask(sample []byte) []byte {
+	mask := make([]byte, aes.BlockSize)
+	k.hp.Encrypt(mask, sample)
+	return mask
+}
+
+// nonce returns the AEAD nonce of a packet number.
+func (k *Keys) nonce(pn uint64) []byte {
+	nonce := make([]byte, len(k.IV))
+	copy(nonce, k.IV)
+	for i := range 8 {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	return nonce
+}
+
+// InitialPacket is a decrypted Initial packet.
+type InitialPacket struct {
+	Header *LongHeader
+	// PacketNumber is the truncated packet number as sent, which is the full
+	// one for the first packets of a connection.
+	PacketNumber uint64
+	Crypto       []CryptoFrame
+}
+
+// CryptoFrame carries part of the TLS handshake.
+type CryptoFrame struct {
+	Offset uint64
+	Data   []byte
+}
+
+// Open removes the protection of the Initial packet at the start of data,
+// whose header h has been parsed. data is left untouched.
+func (k *Keys) Open(data []byte, h *LongHeader) (*InitialPacket, error) {
+	if h.Type != PacketTypeInitial {
+		return nil, ErrNotInitial
+	}
+	pnOffset := h.HeaderLength
+	end := pnOffset + h.Length
+	if h.Length < maxPNSize+sampleSize || end > len(data) {
+		return nil, ErrTruncated
+	}
+
+	mask := k.mask(data[pnOffset+maxPNSize : pnOffset+maxPNSize+sampleSize])
+	first := data[0] ^ mask[0]&0x0f
+	pnLength := int(first&0x03) + 1
+
+	header := make([]byte, pnOffset+pnLength)
+	copy(header, data)
+	header[0] = first
+	var pn uint64
+	for i := range pnLength {
+		header[pnOffset+i] ^= mask[1+i]
+		pn = pn<<8 | uint64(header[pnOffset+i])
+	}
+
+	payload, err := k.aead.Open(nil, k.nonce(pn), data[pnOffset+pnLength:end], header)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+
+	packet := &InitialPacket{Header: h, PacketNumber: pn}
+	if packet.Crypto, err = cryptoFrames(payload); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// cryptoFrames returns the CRYPTO frames of an Initial packet payload,
+// skipping the other frames allowed there.
+func cryptoFrames(payload []byte) ([]CryptoFrame, error) {
+	var frames []CryptoFrame
+	r := payload
+	next := func() (uint64, bool) {
+		v, n := varint(r)
+		r = r[n:]
+		return v, n > 0
+	}
+
+	for len(r) > 0 {
+		frameType, ok := next()
+		if !ok {
+			return nil, ErrBadFrame
+		}
+		switch frameType {
+		case frameTypePadding, frameTypePing:
+		case frameTypeACK, frameTypeACKECN:
+			// Largest acknowledged, delay, range count and first range,
+			// then the ranges and the ECN counts.
+			var count uint64
+			for i := range 4 {
+				v, ok := next()
+				if !ok {
+					return nil, ErrBadFrame
+				}
+				if i == 2 {
+					count = v
+				}
+			}
+			fields := 2 * count
+			if frameType == frameTypeACKECN {
+				fields += 3
+			}
+			for range fields {
+				if _, ok := next(); !ok {
+					return nil, ErrBadFrame
+				}
+			}
+		case frameTypeCrypto:
+			offset, ok1 := next()
+			length, ok2 := next()
+			if !ok1 || !ok2 || uint64(len(r)) < length {
+				return nil, ErrBadFrame
+			}
+			frames = append(frames, CryptoFrame{Offset: offset, Data: r[:length]})
+			r = r[length:]
+		case frameTypeConnectionClose, frameTypeApplicationClose:
+			if _, ok := next(); !ok {
+				return nil, ErrBadFrame
+			}
+			if frameType == frameTypeConnectionClose {
+				if _, ok := next(); !ok {
+					return nil, ErrBadFrame
+				}
+			}
+			length, ok := next()
+			if !ok || uint64(len(r)) < length {
+				return nil, ErrBadFrame
+			}
+			r = r[length:]
+		default:
+			return nil, fmt.Errorf("%w: type 0x%x in an Initial packet", ErrBadFrame, frameType)
+		}
+	}
+	return frames, nil
+}
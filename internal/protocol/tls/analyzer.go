@@ -0,0 +1,187 @@
+package tls
+
+import (
+	"container/list"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/stream"
+)
+
+// Handshake is what one connection's hellos revealed.
+type Handshake struct {
+	ServerName string       `json:"server_name,omitempty"`
+	ALPN       []string     `json:"alpn,omitempty"`
+	JA3        string       `json:"ja3,omitempty"`
+	JA3Hash    string       `json:"ja3_hash,omitempty"`
+	JA4        string       `json:"ja4,omitempty"`
+	JA3S       string       `json:"ja3s,omitempty"`
+	JA3SHash   string       `json:"ja3s_hash,omitempty"`
+	Version    Version      `json:"version,omitempty"`
+	Cipher     CipherSuite  `json:"cipher,omitempty"`
+	Client     *ClientHello `json:"client_hello,omitempty"`
+	Server     *ServerHello `json:"server_hello,omitempty"`
+	Timestamp  time.Time    `json:"timestamp"`
+}
+
+// NewHandshake derives the fingerprints and negotiated parameters from the
+// hellos seen; either may be nil.
+func NewHandshake(ch *ClientHello, sh *ServerHello, transport Transport) *Handshake {
+	hs := &Handshake{Client: ch, Server: sh}
+	if ch != nil {
+		hs.ServerName = ch.ServerName
+		hs.ALPN = ch.ALPN
+		hs.JA3 = JA3(ch)
+		hs.JA3Hash = FingerprintHash(hs.JA3)
+		hs.JA4 = JA4(ch, transport)
+	}
+	if sh != nil {
+		hs.JA3S = JA3S(sh)
+		hs.JA3SHash = FingerprintHash(hs.JA3S)
+		hs.Version = sh.NegotiatedVersion()
+		hs.Cipher = sh.CipherSuite
+		if sh.ALPN != "" {
+			hs.ALPN = []string{sh.ALPN}
+		}
+	}
+	return hs
+}
+
+type AnalyzerConfig struct {
+	// MaxHandshakes caps the handshakes kept for Lookup; the oldest is
+	// dropped to make room.
+	MaxHandshakes int
+
+	// MaxHelloSize caps the bytes buffered per direction while waiting for
+	// a complete hello. Post-quantum key shares make ClientHellos of a few
+	// kilobytes common.
+	MaxHelloSize int
+}
+
+type AnalyzerStatistics struct {
+	Handshakes   int    `json:"handshakes"`
+	Connections  uint64 `json:"connections"`
+	ClientHellos uint64 `json:"client_hellos"`
+	ServerHellos uint64 `json:"server_hellos"`
+	NotTLS       uint64 `json:"not_tls"`
+	ParseErrors  uint64 `json:"parse_errors"`
+	Oversized    uint64 `json:"oversized"`
+}
+
+// HandshakeHandler is called once for each connection on which a hello
+// was seen, when both hellos are in or the connection ends.
+type HandshakeHandler func(key stream.ConnectionKey, handshake *Handshake)
+
+// Analyzer follows the start of TCP connections, from a stream.Assembler,
+// and extracts their TLS handshakes. TLS is recognised by content rather
+// than port.
+type Analyzer struct {
+	mu         *sync.RWMutex
+	logger     *slog.Logger
+	config     AnalyzerConfig
+	handlers   []HandshakeHandler
+	handshakes map[stream.ConnectionKey]*list.Element
+	order      *list.List // *storedHandshake, oldest first
+	stats      AnalyzerStatistics
+}
+
+type storedHandshake struct {
+	key       stream.ConnectionKey
+	handshake *Handshake
+}
+
+func DefaultAnalyzerConfig() AnalyzerConfig {
+	return AnalyzerConfig{
+		MaxHandshakes: 65536,
+		MaxHelloSize:  16 * 1024,
+	}
+}
+
+func NewAnalyzer(logger *slog.Logger) *Analyzer {
+	return NewAnalyzerWithConfig(logger, DefaultAnalyzerConfig())
+}
+
+func NewAnalyzerWithConfig(logger *slog.Logger, config AnalyzerConfig) *Analyzer {
+	defaults := DefaultAnalyzerConfig()
+	if config.MaxHandshakes <= 0 {
+		config.MaxHandshakes = defaults.MaxHandshakes
+	}
+	if config.MaxHelloSize <= 0 {
+		config.MaxHelloSize = defaults.MaxHelloSize
+	}
+
+	return &Analyzer{
+		mu:         &sync.RWMutex{},
+		logger:     logger,
+		config:     config,
+		handshakes: make(map[stream.ConnectionKey]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// OnHandshake registers a handler for handshakes completed from now on,
+// such as the flow table attaching them to flow records.
+func (a *Analyzer) OnHandshake(handler HandshakeHandler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.handlers = append(a.handlers, handler)
+}
+
+// ConsumerFactory is registered with a stream.Assembler to have the
+// analyzer follow new connections.
+func (a *Analyzer) ConsumerFactory(key stream.ConnectionKey) stream.Consumer {
+	a.mu.Lock()
+	a.stats.Connections++
+	a.mu.Unlock()
+	return &connection{analyzer: a, key: key}
+}
+
+// Lookup returns the handshake seen on a connection.
+func (a *Analyzer) Lookup(key stream.ConnectionKey) (*Handshake, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	element, exists := a.handshakes[key]
+	if !exists {
+		return nil, false
+	}
+	return element.Value.(*storedHandshake).handshake, true
+}
+
+func (a *Analyzer) GetStatistics() AnalyzerStatistics {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	stats := a.stats
+	stats.Handshakes = len(a.handshakes)
+	return stats
+}
+
+func (a *Analyzer) record(key stream.ConnectionKey, hs *Handshake) {
+	a.mu.Lock()
+	if element, exists := a.handshakes[key]; exists {
+		a.order.Remove(element)
+	} else if a.order.Len() >= a.config.MaxHandshakes {
+		oldest := a.order.Remove(a.order.Front()).(*storedHandshake)
+		delete(a.handshakes, oldest.key)
+	}
+	a.handshakes[key] = a.order.PushBack(&storedHandshake{key: key, handshake: hs})
+	handlers := a.handlers
+	a.mu.Unlock()
+
+	a.logger.Debug("observed TLS handshake",
+		slog.String("connection", key.String()),
+		slog.String("server_name", hs.ServerName),
+		slog.String("ja4", hs.JA4))
+
+	for _, handler := range handlers {
+		handler(key, hs)
+	}
+}
+
+func (a *Analyzer) count(counter *uint64) {
+	a.mu.Lock()
+	*counter++
+	a.mu.Unlock()
+}
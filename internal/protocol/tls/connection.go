@@ -0,0 +1,170 @@
+package tls
+
+import (
+	"encoding/binary"
+	"log/slog"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/stream"
+)
+
+const (
+	recordHeaderSize    = 5
+	handshakeHeaderSize = 4
+	maxRecordLength     = 16384 + 2048
+
+	contentTypeChangeCipherSpec = 20
+	contentTypeHandshake        = 22
+)
+
+// connection is the stream.Consumer that reads the hellos of one
+// connection. Each direction is read until its hello is parsed, after which
+// the rest of the stream is ignored.
+type connection struct {
+	analyzer  *Analyzer
+	key       stream.ConnectionKey
+	half      [2]helloReader
+	client    *ClientHello
+	server    *ServerHello
+	timestamp time.Time
+	reported  bool
+	notTLS    bool
+}
+
+type helloReader struct {
+	done      bool
+	records   []byte // received bytes not yet split into records
+	handshake []byte // handshake messages reassembled from records
+}
+
+func (c *connection) Data(dir stream.Direction, data []byte, timestamp time.Time) {
+	half := &c.half[dir]
+	if c.reported || half.done {
+		return
+	}
+	if c.timestamp.IsZero() {
+		c.timestamp = timestamp
+	}
+
+	if len(half.records)+len(half.handshake)+len(data) > c.analyzer.config.MaxHelloSize {
+		c.analyzer.count(&c.analyzer.stats.Oversized)
+		c.finish(half)
+		return
+	}
+	half.records = append(half.records, data...)
+
+	c.readRecords(half)
+	if !half.done {
+		c.readMessages(half)
+	}
+	if c.client != nil && c.server != nil {
+		c.report()
+	}
+}
+
+// readRecords moves the payload of complete handshake records into the
+// handshake buffer.
+func (c *connection) readRecords(half *helloReader) {
+	for len(half.records) >= recordHeaderSize {
+		contentType := half.records[0]
+		length := int(binary.BigEndian.Uint16(half.records[3:5]))
+		if half.records[1] != 3 || length > maxRecordLength ||
+			(contentType != contentTypeHandshake && contentType != contentTypeChangeCipherSpec) {
+			// Anything else before a hello means this is not a TLS
+			// handshake we can read.
+			if !c.notTLS && c.client == nil && c.server == nil {
+				c.notTLS = true
+				c.analyzer.count(&c.analyzer.stats.NotTLS)
+			}
+			c.finish(half)
+			return
+		}
+		if len(half.records) < recordHeaderSize+length {
+			return
+		}
+
+		// A middlebox-compatibility ChangeCipherSpec may follow a
+		// HelloRetryRequest; it carries nothing of interest.
+		if contentType == contentTypeHandshake {
+			half.handshake = append(half.handshake, half.records[recordHeaderSize:recordHeaderSize+length]...)
+		}
+		half.records = half.records[recordHeaderSize+length:]
+	}
+}
+
+func (c *connection) readMessages(half *helloReader) {
+	for len(half.handshake) >= handshakeHeaderSize && !half.done {
+		msgType := half.handshake[0]
+		length := int(half.handshake[1])<<16 | int(binary.BigEndian.Uint16(half.handshake[2:4]))
+		if len(half.handshake) < handshakeHeaderSize+length {
+			return
+		}
+		body := half.handshake[handshakeHeaderSize : handshakeHeaderSize+length]
+		half.handshake = half.handshake[handshakeHeaderSize+length:]
+
+		switch msgType {
+		case HandshakeTypeClientHello:
+			ch, err := ParseClientHello(body)
+			if err != nil {
+				c.parseError(half, err)
+				return
+			}
+			c.analyzer.count(&c.analyzer.stats.ClientHellos)
+			// After a HelloRetryRequest the client sends a second
+			// hello; the first one is what identifies it.
+			if c.client == nil {
+				c.client = ch
+			}
+			c.finish(half)
+		case HandshakeTypeServerHello:
+			sh, err := ParseServerHello(body)
+			if err != nil {
+				c.parseError(half, err)
+				return
+			}
+			c.analyzer.count(&c.analyzer.stats.ServerHellos)
+			if sh.HelloRetryRequest {
+				// The real ServerHello follows the client's second hello.
+				continue
+			}
+			c.server = sh
+			c.finish(half)
+		default:
+			c.finish(half)
+		}
+	}
+}
+
+func (c *connection) parseError(half *helloReader, err error) {
+	c.analyzer.count(&c.analyzer.stats.ParseErrors)
+	c.analyzer.logger.Debug("failed to parse TLS hello",
+		slog.String("connection", c.key.String()),
+		slog.String("error", err.Error()))
+	c.finish(half)
+}
+
+func (c *connection) finish(half *helloReader) {
+	half.done = true
+	half.records = nil
+	half.handshake = nil
+}
+
+func (c *connection) Gap(dir stream.Direction, length int) {
+	c.finish(&c.half[dir])
+}
+
+func (c *connection) Close(reason stream.CloseReason) {
+	if !c.reported && (c.client != nil || c.server != nil) {
+		c.report()
+	}
+}
+
+func (c *connection) report() {
+	c.reported = true
+	c.finish(&c.half[stream.ClientToServer])
+	c.finish(&c.half[stream.ServerToClient])
+
+	hs := NewHandshake(c.client, c.server, TransportTCP)
+	hs.Timestamp = c.timestamp
+	c.analyzer.record(c.key, hs)
+}
@@ -0,0 +1,155 @@
+package tls
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Transport is the first character of a JA4 fingerprint.
+type Transport byte
+
+const (
+	TransportTCP  Transport = 't'
+	TransportQUIC Transport = 'q'
+	TransportDTLS Transport = 'd'
+)
+
+// JA3 returns the JA3 string of a ClientHello, its MD5 being the
+// fingerprint: version, cipher suites, extensions, groups and point
+// formats, in the order sent and with GREASE values left out.
+func JA3(ch *ClientHello) string {
+	return strings.Join([]string{
+		strconv.Itoa(int(ch.Version)),
+		joinDecimal(ch.CipherSuites),
+		joinDecimal(ch.Extensions),
+		joinDecimal(ch.SupportedGroups),
+		joinDecimal(ch.ECPointFormats),
+	}, ",")
+}
+
+// JA3S returns the JA3S string of a ServerHello: version, chosen cipher
+// suite and extensions.
+func JA3S(sh *ServerHello) string {
+	return strings.Join([]string{
+		strconv.Itoa(int(sh.Version)),
+		strconv.Itoa(int(sh.CipherSuite)),
+		joinDecimal(sh.Extensions),
+	}, ",")
+}
+
+// FingerprintHash returns the MD5 hash under which JA3 and JA3S strings are
+// usually shared.
+func FingerprintHash(fingerprint string) string {
+	sum := md5.Sum([]byte(fingerprint))
+	return hex.EncodeToString(sum[:])
+}
+
+// JA4 returns the JA4 fingerprint of a ClientHello, in the form
+// t13d1516h2_8daaf6152771_b186095e22b6: a readable prefix, then truncated
+// hashes of the sorted cipher suites and of the sorted extensions followed
+// by the signature algorithms.
+func JA4(ch *ClientHello, transport Transport) string {
+	var ciphers, extensions []string
+	for _, suite := range ch.CipherSuites {
+		if !IsGREASE(uint16(suite)) {
+			ciphers = append(ciphers, fmt.Sprintf("%04x", uint16(suite)))
+		}
+	}
+	extensionCount := 0
+	for _, ext := range ch.Extensions {
+		if IsGREASE(ext) {
+			continue
+		}
+		extensionCount++
+		// SNI and ALPN are already in the prefix.
+		if ext != ExtensionServerName && ext != ExtensionALPN {
+			extensions = append(extensions, fmt.Sprintf("%04x", ext))
+		}
+	}
+	slices.Sort(ciphers)
+	slices.Sort(extensions)
+
+	sni := 'i'
+	if slices.Contains(ch.Extensions, ExtensionServerName) {
+		sni = 'd'
+	}
+
+	prefix := fmt.Sprintf("%c%s%c%02d%02d%s", transport, ja4Version(ch.MaxVersion()), sni,
+		min(len(ciphers), 99), min(extensionCount, 99), ja4ALPN(ch.ALPN))
+
+	extensionPart := strings.Join(extensions, ",")
+	var algorithms []string
+	for _, alg := range ch.SignatureAlgorithms {
+		if !IsGREASE(alg) {
+			algorithms = append(algorithms, fmt.Sprintf("%04x", alg))
+		}
+	}
+	if len(algorithms) > 0 {
+		extensionPart += "_" + strings.Join(algorithms, ",")
+	}
+
+	return prefix + "_" + ja4Hash(ciphers, strings.Join(ciphers, ",")) + "_" + ja4Hash(extensions, extensionPart)
+}
+
+func ja4Version(v Version) string {
+	switch v {
+	case VersionTLS13:
+		return "13"
+	case VersionTLS12:
+		return "12"
+	case VersionTLS11:
+		return "11"
+	case VersionTLS10:
+		return "10"
+	case VersionSSL30:
+		return "s3"
+	default:
+		return "00"
+	}
+}
+
+// ja4ALPN returns the first and last characters of the first ALPN value,
+// or of its hex form when either is not alphanumeric.
+func ja4ALPN(alpn []string) string {
+	if len(alpn) == 0 || alpn[0] == "" {
+		return "00"
+	}
+	value := alpn[0]
+	first, last := value[0], value[len(value)-1]
+	if !isAlphanumeric(first) || !isAlphanumeric(last) {
+		encoded := hex.EncodeToString([]byte(value))
+		return encoded[:1] + encoded[len(encoded)-1:]
+	}
+	return string([]byte{first, last})
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func ja4Hash(values []string, input string) string {
+	if len(values) == 0 {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(input))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func joinDecimal[T ~uint8 | ~uint16](values []T) string {
+	var b strings.Builder
+	for _, v := range values {
+		if IsGREASE(uint16(v)) {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		b.WriteString(strconv.Itoa(int(v)))
+	}
+	return b.String()
+}
@@ -0,0 +1,373 @@
+// Package tls extracts what can be seen of a TLS handshake in the clear:
+// the ClientHello and ServerHello, and the JA3 and JA4 fingerprints derived
+// from them.
+package tls
+
+import (
+	cryptotls "crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Version is a TLS protocol version as it appears on the wire.
+type Version uint16
+
+const (
+	VersionSSL30 Version = 0x0300
+	VersionTLS10 Version = 0x0301
+	VersionTLS11 Version = 0x0302
+	VersionTLS12 Version = 0x0303
+	VersionTLS13 Version = 0x0304
+)
+
+func (v Version) String() string {
+	return cryptotls.VersionName(uint16(v))
+}
+
+func (v Version) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// CipherSuite is a TLS cipher suite identifier.
+type CipherSuite uint16
+
+func (c CipherSuite) String() string {
+	return cryptotls.CipherSuiteName(uint16(c))
+}
+
+func (c CipherSuite) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// Extension types decoded from the hellos.
+const (
+	ExtensionServerName          = 0
+	ExtensionSupportedGroups     = 10
+	ExtensionECPointFormats      = 11
+	ExtensionSignatureAlgorithms = 13
+	ExtensionALPN                = 16
+	ExtensionSupportedVersions   = 43
+)
+
+// Handshake message types.
+const (
+	HandshakeTypeClientHello = 1
+	HandshakeTypeServerHello = 2
+)
+
+var (
+	ErrTruncated = errors.New("tls: message truncated")
+	ErrMalformed = errors.New("tls: malformed message")
+)
+
+// helloRetryRandom is the ServerHello random that marks a
+// HelloRetryRequest (RFC 8446 section 4.1.3).
+var helloRetryRandom = [32]byte{
+	0xCF, 0x21, 0xAD, 0x74, 0xE5, 0x9A, 0x61, 0x11, 0xBE, 0x1D, 0x8C, 0x02, 0x1E, 0x65, 0xB8, 0x91,
+	0xC2, 0xA2, 0x11, 0x16, 0x7A, 0xBB, 0x8C, 0x5E, 0x07, 0x9E, 0x09, 0xE2, 0xC8, 0xA8, 0x33, 0x9C,
+}
+
+// ClientHello holds the fields of a ClientHello that identify the client.
+// Lists keep the order they were sent in, GREASE values included.
+type ClientHello struct {
+	Version             Version       `json:"version"`
+	SessionIDLength     int           `json:"session_id_length"`
+	CipherSuites        []CipherSuite `json:"cipher_suites"`
+	CompressionMethods  []uint8       `json:"compression_methods"`
+	Extensions          []uint16      `json:"extensions"`
+	ServerName          string        `json:"server_name,omitempty"`
+	ALPN                []string      `json:"alpn,omitempty"`
+	SupportedVersions   []Version     `json:"supported_versions,omitempty"`
+	SupportedGroups     []uint16      `json:"supported_groups,omitempty"`
+	ECPointFormats      []uint8       `json:"ec_point_formats,omitempty"`
+	SignatureAlgorithms []uint16      `json:"signature_algorithms,omitempty"`
+}
+
+// MaxVersion returns the highest version the client offers, taking
+// supported_versions into account.
+func (ch *ClientHello) MaxVersion() Version {
+	highest := ch.Version
+	for _, v := range ch.SupportedVersions {
+		if !IsGREASE(uint16(v)) && v > highest {
+			highest = v
+		}
+	}
+	return highest
+}
+
+// ServerHello holds the parameters the server chose.
+type ServerHello struct {
+	Version     Version     `json:"version"`
+	CipherSuite CipherSuite `json:"cipher_suite"`
+	Compression uint8       `json:"compression"`
+	Extensions  []uint16    `json:"extensions"`
+	ALPN        string      `json:"alpn,omitempty"`
+	// SelectedVersion is the version chosen through supported_versions,
+	// which TLS 1.3 uses in place of Version.
+	SelectedVersion   Version `json:"selected_version,omitempty"`
+	HelloRetryRequest bool    `json:"hello_retry_request,omitempty"`
+}
+
+// NegotiatedVersion returns the version the connection will use.
+func (sh *ServerHello) NegotiatedVersion() Version {
+	if sh.SelectedVersion != 0 {
+		return sh.SelectedVersion
+	}
+	return sh.Version
+}
+
+// IsGREASE reports whether v is one of the reserved GREASE values
+// (RFC 8701) that clients sprinkle into their lists.
+func IsGREASE(v uint16) bool {
+	return v&0x0F0F == 0x0A0A && v>>8 == v&0xFF
+}
+
+// ParseClientHello parses the body of a ClientHello handshake message,
+// without its 4-byte handshake header.
+func ParseClientHello(body []byte) (*ClientHello, error) {
+	r := reader(body)
+	ch := &ClientHello{}
+
+	version, ok := r.u16()
+	if !ok || !r.skip(32) {
+		return nil, ErrTruncated
+	}
+	ch.Version = Version(version)
+
+	sessionID, ok := r.vec8()
+	if !ok {
+		return nil, ErrTruncated
+	}
+	ch.SessionIDLength = len(sessionID)
+
+	suites, ok := r.vec16()
+	if !ok {
+		return nil, ErrTruncated
+	}
+	if len(suites)%2 != 0 {
+		return nil, fmt.Errorf("%w: odd cipher suite list length", ErrMalformed)
+	}
+	for s := reader(suites); len(s) > 0; {
+		suite, _ := s.u16()
+		ch.CipherSuites = append(ch.CipherSuites, CipherSuite(suite))
+	}
+
+	compression, ok := r.vec8()
+	if !ok {
+		return nil, ErrTruncated
+	}
+	ch.CompressionMethods = append([]uint8(nil), compression...)
+
+	err := parseExtensions(r, func(typ uint16, data reader) bool {
+		ch.Extensions = append(ch.Extensions, typ)
+		switch typ {
+		case ExtensionServerName:
+			return ch.parseServerName(data)
+		case ExtensionSupportedGroups:
+			list, ok := data.vec16()
+			ch.SupportedGroups, ok = uint16List(list, ok)
+			return ok
+		case ExtensionECPointFormats:
+			formats, ok := data.vec8()
+			ch.ECPointFormats = append([]uint8(nil), formats...)
+			return ok
+		case ExtensionSignatureAlgorithms:
+			list, ok := data.vec16()
+			ch.SignatureAlgorithms, ok = uint16List(list, ok)
+			return ok
+		case ExtensionALPN:
+			return ch.parseALPN(data)
+		case ExtensionSupportedVersions:
+			list, ok := data.vec8()
+			versions, ok := uint16List(list, ok)
+			for _, v := range versions {
+				ch.SupportedVersions = append(ch.SupportedVersions, Version(v))
+			}
+			return ok
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (ch *ClientHello) parseServerName(data reader) bool {
+	list, ok := data.vec16()
+	if !ok {
+		return false
+	}
+	for len(list) > 0 {
+		nameType, ok := list.u8()
+		if !ok {
+			return false
+		}
+		name, ok := list.vec16()
+		if !ok {
+			return false
+		}
+		if nameType == 0 && ch.ServerName == "" {
+			ch.ServerName = strings.ToLower(string(name))
+		}
+	}
+	return true
+}
+
+func (ch *ClientHello) parseALPN(data reader) bool {
+	list, ok := data.vec16()
+	if !ok {
+		return false
+	}
+	for len(list) > 0 {
+		protocol, ok := list.vec8()
+		if !ok {
+			return false
+		}
+		ch.ALPN = append(ch.ALPN, string(protocol))
+	}
+	return true
+}
+
+// ParseServerHello parses the body of a ServerHello handshake message,
+// without its 4-byte handshake header.
+func ParseServerHello(body []byte) (*ServerHello, error) {
+	r := reader(body)
+	sh := &ServerHello{}
+
+	version, ok := r.u16()
+	if !ok || len(r) < 32 {
+		return nil, ErrTruncated
+	}
+	sh.Version = Version(version)
+	sh.HelloRetryRequest = [32]byte(r[:32]) == helloRetryRandom
+	r = r[32:]
+
+	if _, ok := r.vec8(); !ok {
+		return nil, ErrTruncated
+	}
+	suite, ok := r.u16()
+	if !ok {
+		return nil, ErrTruncated
+	}
+	sh.CipherSuite = CipherSuite(suite)
+	if sh.Compression, ok = r.u8(); !ok {
+		return nil, ErrTruncated
+	}
+
+	err := parseExtensions(r, func(typ uint16, data reader) bool {
+		sh.Extensions = append(sh.Extensions, typ)
+		switch typ {
+		case ExtensionALPN:
+			list, ok := data.vec16()
+			if !ok {
+				return false
+			}
+			protocol, ok := list.vec8()
+			sh.ALPN = string(protocol)
+			return ok
+		case ExtensionSupportedVersions:
+			selected, ok := data.u16()
+			sh.SelectedVersion = Version(selected)
+			return ok
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sh, nil
+}
+
+// parseExtensions walks the optional extension block that ends both hellos.
+func parseExtensions(r reader, extension func(typ uint16, data reader) bool) error {
+	if len(r) == 0 {
+		return nil
+	}
+	block, ok := r.vec16()
+	if !ok {
+		return ErrTruncated
+	}
+	for len(block) > 0 {
+		typ, ok := block.u16()
+		if !ok {
+			return ErrTruncated
+		}
+		data, ok := block.vec16()
+		if !ok {
+			return ErrTruncated
+		}
+		if !extension(typ, data) {
+			return fmt.Errorf("%w: extension %d", ErrMalformed, typ)
+		}
+	}
+	return nil
+}
+
+func uint16List(list reader, ok bool) ([]uint16, bool) {
+	if !ok || len(list)%2 != 0 {
+		return nil, false
+	}
+	values := make([]uint16, 0, len(list)/2)
+	for len(list) > 0 {
+		v, _ := list.u16()
+		values = append(values, v)
+	}
+	return values, true
+}
+
+// reader consumes big-endian fields from the front of a byte slice.
+type reader []byte
+
+func (r *reader) u8() (uint8, bool) {
+	if len(*r) < 1 {
+		return 0, false
+	}
+	v := (*r)[0]
+	*r = (*r)[1:]
+	return v, true
+}
+
+func (r *reader) u16() (uint16, bool) {
+	if len(*r) < 2 {
+		return 0, false
+	}
+	v := uint16((*r)[0])<<8 | uint16((*r)[1])
+	*r = (*r)[2:]
+	return v, true
+}
+
+func (r *reader) skip(n int) bool {
+	if len(*r) < n {
+		return false
+	}
+	*r = (*r)[n:]
+	return true
+}
+
+func (r *reader) bytes(n int) (reader, bool) {
+	if len(*r) < n {
+		return nil, false
+	}
+	v := (*r)[:n]
+	*r = (*r)[n:]
+	return v, true
+}
+
+// vec8 and vec16 read a vector prefixed by a one or two byte length.
+func (r *reader) vec8() (reader, bool) {
+	n, ok := r.u8()
+	if !ok {
+		return nil, false
+	}
+	return r.bytes(int(n))
+}
+
+func (r *reader) vec16() (reader, bool) {
+	n, ok := r.u16()
+	if !ok {
+		return nil, false
+	}
+	return r.bytes(int(n))
+}
@@ -0,0 +1,260 @@
+package stream
+
+import (
+	"container/list"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+)
+
+type AssemblerConfig struct {
+	// MaxConnections caps the connections followed at once; the least
+	// recently active one is evicted to admit another.
+	MaxConnections int
+
+	// MaxConnectionBuffer caps the out-of-order bytes held for one
+	// connection. Past it, the missing data is given up as a gap.
+	MaxConnectionBuffer int
+
+	// MaxTotalBuffer caps the out-of-order bytes held across all
+	// connections, flushing the least recently active ones first.
+	MaxTotalBuffer int
+
+	// IdleTimeout closes connections that have seen no segment for this
+	// long.
+	IdleTimeout time.Duration
+}
+
+type AssemblerStatistics struct {
+	Connections       int    `json:"connections"`
+	BufferedBytes     int    `json:"buffered_bytes"`
+	Segments          uint64 `json:"segments"`
+	BytesDelivered    uint64 `json:"bytes_delivered"`
+	OutOfOrder        uint64 `json:"out_of_order"`
+	Retransmissions   uint64 `json:"retransmissions"`
+	OverlapBytes      uint64 `json:"overlap_bytes"`
+	GapBytes          uint64 `json:"gap_bytes"`
+	ConnectionsOpened uint64 `json:"connections_opened"`
+	ConnectionsClosed uint64 `json:"connections_closed"`
+	Evictions         uint64 `json:"evictions"`
+	Timeouts          uint64 `json:"timeouts"`
+}
+
+// Assembler turns TCP segments into ordered byte streams for the consumers
+// registered with it. Segments may arrive out of order or more than once;
+// bytes are delivered once each, and where segments overlap the data seen
+// first wins.
+type Assembler struct {
+	mu          *sync.Mutex
+	config      AssemblerConfig
+	factories   []ConsumerFactory
+	connections map[ConnectionKey]*connection
+	order       *list.List // *connection, least recently active first
+	buffered    int
+	stats       AssemblerStatistics
+}
+
+func DefaultAssemblerConfig() AssemblerConfig {
+	return AssemblerConfig{
+		MaxConnections:      65536,
+		MaxConnectionBuffer: 256 * 1024,
+		MaxTotalBuffer:      64 * 1024 * 1024,
+		IdleTimeout:         5 * time.Minute,
+	}
+}
+
+func NewAssembler(config AssemblerConfig) *Assembler {
+	defaults := DefaultAssemblerConfig()
+	if config.MaxConnections <= 0 {
+		config.MaxConnections = defaults.MaxConnections
+	}
+	if config.MaxConnectionBuffer <= 0 {
+		config.MaxConnectionBuffer = defaults.MaxConnectionBuffer
+	}
+	if config.MaxTotalBuffer <= 0 {
+		config.MaxTotalBuffer = defaults.MaxTotalBuffer
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaults.IdleTimeout
+	}
+
+	return &Assembler{
+		mu:          &sync.Mutex{},
+		config:      config,
+		connections: make(map[ConnectionKey]*connection),
+		order:       list.New(),
+	}
+}
+
+// Register adds a factory that is offered every connection opened from now
+// on. Connections no factory wants are tracked but not buffered.
+func (a *Assembler) Register(factory ConsumerFactory) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.factories = append(a.factories, factory)
+}
+
+// Assemble feeds one decoded packet to the assembler. Packets without a TCP
+// header are ignored; for tunnelled traffic pass packet.Innermost().
+func (a *Assembler) Assemble(packet *capture.ParsedPacket, timestamp time.Time) {
+	if packet == nil || packet.TCP == nil {
+		return
+	}
+	tcp := packet.TCP
+
+	var src, dst netip.Addr
+	switch {
+	case packet.IPv4 != nil:
+		src, dst = packet.IPv4.SrcIP, packet.IPv4.DstIP
+	case packet.IPv6 != nil:
+		src, dst = packet.IPv6.SrcIP, packet.IPv6.DstIP
+	default:
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.stats.Segments++
+	key := ConnectionKey{ClientIP: src, ClientPort: tcp.SrcPort, ServerIP: dst, ServerPort: tcp.DstPort}
+
+	conn, dir := a.lookup(key)
+	if conn == nil {
+		// A stray ACK, FIN or RST gives nothing to follow.
+		if tcp.Flags&capture.TCPFlagRST != 0 || (tcp.Flags&capture.TCPFlagSYN == 0 && len(packet.Payload) == 0) {
+			return
+		}
+		conn, dir = a.open(key, tcp, timestamp)
+	}
+	conn.lastSeen = timestamp
+	a.order.MoveToBack(conn.element)
+
+	if tcp.Flags&capture.TCPFlagRST != 0 {
+		a.close(conn, CloseReset)
+		return
+	}
+
+	conn.segment(a, dir, tcp, packet.Payload, timestamp)
+	if conn.finished() {
+		a.close(conn, CloseFIN)
+		return
+	}
+
+	if conn.buffered() > a.config.MaxConnectionBuffer {
+		conn.flush(a, dir)
+		if conn.buffered() > a.config.MaxConnectionBuffer {
+			conn.flush(a, dir.Reverse())
+		}
+	}
+	a.enforceTotalBuffer()
+}
+
+func (a *Assembler) lookup(key ConnectionKey) (*connection, Direction) {
+	if conn, exists := a.connections[key]; exists {
+		return conn, ClientToServer
+	}
+	if conn, exists := a.connections[key.reverse()]; exists {
+		return conn, ServerToClient
+	}
+	return nil, ClientToServer
+}
+
+// open starts following the connection of a segment sent along key.
+func (a *Assembler) open(key ConnectionKey, tcp *capture.TCPHeader, timestamp time.Time) (*connection, Direction) {
+	dir := ClientToServer
+	switch {
+	case tcp.Flags&capture.TCPFlagSYN != 0:
+		if tcp.Flags&capture.TCPFlagACK != 0 {
+			dir = ServerToClient
+		}
+	case key.ClientPort < key.ServerPort:
+		dir = ServerToClient
+	}
+	if dir == ServerToClient {
+		key = key.reverse()
+	}
+
+	if a.order.Len() >= a.config.MaxConnections {
+		a.close(a.order.Front().Value.(*connection), CloseEvicted)
+		a.stats.Evictions++
+	}
+
+	conn := &connection{key: key, firstSeen: timestamp, lastSeen: timestamp}
+	for _, factory := range a.factories {
+		if consumer := factory(key); consumer != nil {
+			conn.consumers = append(conn.consumers, consumer)
+		}
+	}
+	conn.element = a.order.PushBack(conn)
+	a.connections[key] = conn
+	a.stats.ConnectionsOpened++
+	return conn, dir
+}
+
+// close delivers what can still be delivered and ends the connection.
+func (a *Assembler) close(conn *connection, reason CloseReason) {
+	conn.flush(a, ClientToServer)
+	conn.flush(a, ServerToClient)
+	for _, consumer := range conn.consumers {
+		consumer.Close(reason)
+	}
+	delete(a.connections, conn.key)
+	a.order.Remove(conn.element)
+	a.stats.ConnectionsClosed++
+}
+
+func (a *Assembler) enforceTotalBuffer() {
+	for e := a.order.Front(); e != nil && a.buffered > a.config.MaxTotalBuffer; e = e.Next() {
+		conn := e.Value.(*connection)
+		conn.flush(a, ClientToServer)
+		conn.flush(a, ServerToClient)
+	}
+}
+
+// Expire closes connections idle for longer than the idle timeout and
+// returns the number closed.
+func (a *Assembler) Expire(now time.Time) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	closed := 0
+	for a.order.Len() > 0 {
+		conn := a.order.Front().Value.(*connection)
+		if now.Sub(conn.lastSeen) <= a.config.IdleTimeout {
+			break
+		}
+		a.close(conn, CloseTimeout)
+		closed++
+	}
+	a.stats.Timeouts += uint64(closed)
+	return closed
+}
+
+// FlushAll delivers all buffered data, reporting what is missing as gaps,
+// and closes every connection. It is meant for shutdown.
+func (a *Assembler) FlushAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for a.order.Len() > 0 {
+		a.close(a.order.Front().Value.(*connection), CloseFlushed)
+	}
+}
+
+func (a *Assembler) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.connections)
+}
+
+func (a *Assembler) GetStatistics() AssemblerStatistics {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats := a.stats
+	stats.Connections = len(a.connections)
+	stats.BufferedBytes = a.buffered
+	return stats
+}
@@ -0,0 +1,198 @@
+package stream
+
+import (
+	"container/list"
+	"sort"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+)
+
+type connection struct {
+	key       ConnectionKey
+	consumers []Consumer
+	half      [2]halfStream
+	firstSeen time.Time
+	lastSeen  time.Time
+	element   *list.Element
+}
+
+// halfStream is the data flowing in one direction. Sequence numbers are
+// compared by their signed distance so that they may wrap.
+type halfStream struct {
+	started  bool   // next is known
+	next     uint32 // sequence number of the next byte to deliver
+	hasFIN   bool
+	finSeq   uint32
+	pending  []segment // out of order, ordered by sequence number
+	buffered int
+}
+
+type segment struct {
+	seq       uint32
+	data      []byte
+	timestamp time.Time
+}
+
+func (h *halfStream) finished() bool {
+	return h.hasFIN && int32(h.next-h.finSeq) >= 0
+}
+
+func (c *connection) finished() bool {
+	return c.half[ClientToServer].finished() && c.half[ServerToClient].finished()
+}
+
+func (c *connection) buffered() int {
+	return c.half[ClientToServer].buffered + c.half[ServerToClient].buffered
+}
+
+func (c *connection) segment(a *Assembler, dir Direction, tcp *capture.TCPHeader, payload []byte, timestamp time.Time) {
+	half := &c.half[dir]
+	seq := tcp.SeqNum
+
+	// The SYN takes up one sequence number ahead of the data.
+	if tcp.Flags&capture.TCPFlagSYN != 0 {
+		seq++
+	}
+	if !half.started {
+		half.next = seq
+		half.started = true
+	}
+	if tcp.Flags&capture.TCPFlagFIN != 0 && !half.hasFIN {
+		half.hasFIN = true
+		half.finSeq = seq + uint32(len(payload))
+	}
+
+	if len(c.consumers) == 0 {
+		// Nothing is buffered or delivered, but the stream is followed to
+		// its furthest byte so that reaching a FIN finishes it.
+		if end := seq + uint32(len(payload)); int32(end-half.next) > 0 {
+			half.next = end
+		}
+		return
+	}
+	if len(payload) == 0 {
+		return
+	}
+
+	ahead := int32(seq - half.next)
+	if ahead > 0 {
+		c.buffer(a, half, segment{seq: seq, data: append([]byte(nil), payload...), timestamp: timestamp})
+		return
+	}
+
+	skip := int(-ahead)
+	if skip > 0 {
+		a.stats.Retransmissions++
+		a.stats.OverlapBytes += uint64(min(skip, len(payload)))
+	}
+	if skip >= len(payload) {
+		return
+	}
+	c.deliver(a, dir, payload[skip:], timestamp)
+	c.drain(a, dir)
+}
+
+// buffer holds a segment that arrived ahead of a missing one. Bytes
+// already buffered stay as they are; only the parts of s that fill the
+// holes between pending segments are added.
+func (c *connection) buffer(a *Assembler, half *halfStream, s segment) {
+	added := 0
+	for len(s.data) > 0 {
+		// pending[i-1] is the last segment starting at or before s.
+		i := sort.Search(len(half.pending), func(i int) bool {
+			return int32(half.pending[i].seq-s.seq) > 0
+		})
+		if i > 0 {
+			prev := half.pending[i-1]
+			if overlap := int(int32(prev.seq + uint32(len(prev.data)) - s.seq)); overlap > 0 {
+				overlap = min(overlap, len(s.data))
+				a.stats.OverlapBytes += uint64(overlap)
+				s.seq += uint32(overlap)
+				s.data = s.data[overlap:]
+				continue
+			}
+		}
+
+		piece := s
+		if i < len(half.pending) {
+			if room := int(int32(half.pending[i].seq - s.seq)); room < len(s.data) {
+				piece.data = s.data[:room]
+			}
+		}
+		half.pending = append(half.pending, segment{})
+		copy(half.pending[i+1:], half.pending[i:])
+		half.pending[i] = piece
+		half.buffered += len(piece.data)
+		a.buffered += len(piece.data)
+		added += len(piece.data)
+
+		s.seq += uint32(len(piece.data))
+		s.data = s.data[len(piece.data):]
+	}
+
+	if added == 0 {
+		a.stats.Retransmissions++
+	} else {
+		a.stats.OutOfOrder++
+	}
+}
+
+func (c *connection) deliver(a *Assembler, dir Direction, data []byte, timestamp time.Time) {
+	c.half[dir].next += uint32(len(data))
+	a.stats.BytesDelivered += uint64(len(data))
+	for _, consumer := range c.consumers {
+		consumer.Data(dir, data, timestamp)
+	}
+}
+
+// drain delivers the buffered segments that the stream has caught up with.
+func (c *connection) drain(a *Assembler, dir Direction) {
+	half := &c.half[dir]
+	for len(half.pending) > 0 {
+		s := half.pending[0]
+		ahead := int32(s.seq - half.next)
+		if ahead > 0 {
+			return
+		}
+		half.pending[0] = segment{}
+		half.pending = half.pending[1:]
+		half.buffered -= len(s.data)
+		a.buffered -= len(s.data)
+
+		skip := int(-ahead)
+		if skip > 0 {
+			a.stats.OverlapBytes += uint64(min(skip, len(s.data)))
+		}
+		if skip < len(s.data) {
+			c.deliver(a, dir, s.data[skip:], s.timestamp)
+		}
+	}
+	half.pending = nil
+}
+
+// flush gives up waiting for missing data in dir: each hole before a
+// buffered segment, or before a FIN, is reported as a gap and the data
+// after it delivered.
+func (c *connection) flush(a *Assembler, dir Direction) {
+	half := &c.half[dir]
+	for len(half.pending) > 0 {
+		if gap := int32(half.pending[0].seq - half.next); gap > 0 {
+			c.gap(a, dir, int(gap))
+		}
+		c.drain(a, dir)
+	}
+	if half.hasFIN && len(c.consumers) > 0 {
+		if gap := int32(half.finSeq - half.next); gap > 0 {
+			c.gap(a, dir, int(gap))
+		}
+	}
+}
+
+func (c *connection) gap(a *Assembler, dir Direction, length int) {
+	c.half[dir].next += uint32(length)
+	a.stats.GapBytes += uint64(length)
+	for _, consumer := range c.consumers {
+		consumer.Gap(dir, length)
+	}
+}
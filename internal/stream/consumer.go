@@ -0,0 +1,102 @@
+package stream
+
+import (
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// Direction tells which side of a connection sent a piece of data.
+type Direction uint8
+
+const (
+	ClientToServer Direction = iota
+	ServerToClient
+)
+
+func (d Direction) String() string {
+	switch d {
+	case ClientToServer:
+		return "client_to_server"
+	case ServerToClient:
+		return "server_to_client"
+	default:
+		return fmt.Sprintf("direction(%d)", uint8(d))
+	}
+}
+
+func (d Direction) Reverse() Direction {
+	return 1 - d
+}
+
+// ConnectionKey identifies a TCP connection. The client is the side that
+// sent the SYN; for connections picked up mid-stream it is guessed to be
+// the side with the higher port.
+type ConnectionKey struct {
+	ClientIP   netip.Addr
+	ClientPort uint16
+	ServerIP   netip.Addr
+	ServerPort uint16
+}
+
+func (k ConnectionKey) String() string {
+	return netip.AddrPortFrom(k.ClientIP, k.ClientPort).String() + "-" +
+		netip.AddrPortFrom(k.ServerIP, k.ServerPort).String()
+}
+
+func (k ConnectionKey) reverse() ConnectionKey {
+	return ConnectionKey{
+		ClientIP:   k.ServerIP,
+		ClientPort: k.ServerPort,
+		ServerIP:   k.ClientIP,
+		ServerPort: k.ClientPort,
+	}
+}
+
+// CloseReason tells why a connection stopped being reassembled.
+type CloseReason uint8
+
+const (
+	CloseFIN     CloseReason = iota // both sides sent FIN and all data up to it was seen
+	CloseReset                      // either side sent RST
+	CloseTimeout                    // idle for longer than the idle timeout
+	CloseEvicted                    // dropped to make room for a new connection
+	CloseFlushed                    // FlushAll was called
+)
+
+func (r CloseReason) String() string {
+	switch r {
+	case CloseFIN:
+		return "fin"
+	case CloseReset:
+		return "reset"
+	case CloseTimeout:
+		return "timeout"
+	case CloseEvicted:
+		return "evicted"
+	case CloseFlushed:
+		return "flushed"
+	default:
+		return fmt.Sprintf("close_reason(%d)", uint8(r))
+	}
+}
+
+// Consumer receives the reassembled byte streams of one connection. Its
+// methods are called from Assembler.Assemble and friends, one at a time,
+// and must not call back into the Assembler.
+type Consumer interface {
+	// Data delivers the next bytes sent in dir, in sequence order and
+	// without overlap. data is only valid for the duration of the call.
+	Data(dir Direction, data []byte, timestamp time.Time)
+
+	// Gap reports that length bytes sent in dir were never captured and
+	// will not be delivered; the next Data call continues after them.
+	Gap(dir Direction, length int)
+
+	// Close is called once, after the last Data or Gap call.
+	Close(reason CloseReason)
+}
+
+// ConsumerFactory is asked for a Consumer for every new connection. It
+// returns nil if it has no interest in the connection.
+type ConsumerFactory func(key ConnectionKey) Consumer
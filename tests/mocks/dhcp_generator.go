@@ -0,0 +1,68 @@
+package mocks
+
+import "encoding/binary"
+
+// GenerateDHCPOption creates one DHCPv4 option
+func (pg *PacketGenerator) GenerateDHCPOption(code uint8, data []byte) []byte {
+	return append([]byte{code, byte(len(data))}, data...)
+}
+
+// GenerateDHCPMessage creates a DHCPv4 message; op is 1 for client
+// requests and 2 for server replies. The options are followed by an end
+// option
+func (pg *PacketGenerator) GenerateDHCPMessage(op uint8, xid uint32, clientMAC, clientIP, yourIP []byte, options ...[]byte) []byte {
+	msg := make([]byte, 240)
+	msg[0] = op
+	msg[1], msg[2] = 1, 6 // Ethernet
+	binary.BigEndian.PutUint32(msg[4:8], xid)
+	copy(msg[12:16], clientIP)
+	copy(msg[16:20], yourIP)
+	copy(msg[28:34], clientMAC)
+	binary.BigEndian.PutUint32(msg[236:240], 0x63825363)
+	for _, opt := range options {
+		msg = append(msg, opt...)
+	}
+	return append(msg, 255)
+}
+
+// GenerateDHCPv6Option creates one DHCPv6 option
+func (pg *PacketGenerator) GenerateDHCPv6Option(code uint16, data []byte) []byte {
+	opt := binary.BigEndian.AppendUint16(nil, code)
+	opt = binary.BigEndian.AppendUint16(opt, uint16(len(data)))
+	return append(opt, data...)
+}
+
+// GenerateDHCPv6Message creates a DHCPv6 client or server message
+func (pg *PacketGenerator) GenerateDHCPv6Message(msgType uint8, xid uint32, options ...[]byte) []byte {
+	msg := []byte{msgType, byte(xid >> 16), byte(xid >> 8), byte(xid)}
+	for _, opt := range options {
+		msg = append(msg, opt...)
+	}
+	return msg
+}
+
+// GenerateDHCPv6RelayForward wraps a message in a Relay-forward message
+// from a relay that received it from peer
+func (pg *PacketGenerator) GenerateDHCPv6RelayForward(hops uint8, link, peer []byte, relayed []byte) []byte {
+	msg := append([]byte{12, hops}, link...)
+	msg = append(msg, peer...)
+	return append(msg, pg.GenerateDHCPv6Option(9, relayed)...)
+}
+
+// GenerateDHCPv6IANA creates an IA_NA option holding one address
+func (pg *PacketGenerator) GenerateDHCPv6IANA(iaid uint32, addr []byte, preferred, valid uint32) []byte {
+	iaAddr := append([]byte(nil), addr...)
+	iaAddr = binary.BigEndian.AppendUint32(iaAddr, preferred)
+	iaAddr = binary.BigEndian.AppendUint32(iaAddr, valid)
+
+	data := binary.BigEndian.AppendUint32(nil, iaid)
+	data = binary.BigEndian.AppendUint32(data, valid/2)
+	data = binary.BigEndian.AppendUint32(data, valid*4/5)
+	data = append(data, pg.GenerateDHCPv6Option(5, iaAddr)...)
+	return pg.GenerateDHCPv6Option(3, data)
+}
+
+// GenerateDHCPv6DUIDLL creates a DUID-LL for an Ethernet address
+func (pg *PacketGenerator) GenerateDHCPv6DUIDLL(mac []byte) []byte {
+	return append([]byte{0, 3, 0, 1}, mac...)
+}
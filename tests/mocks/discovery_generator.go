@@ -0,0 +1,75 @@
+package mocks
+
+import "encoding/binary"
+
+// GenerateLLDPTLV creates an LLDP TLV with a 7-bit type and 9-bit length
+func (pg *PacketGenerator) GenerateLLDPTLV(tlvType uint8, value []byte) []byte {
+	tlv := binary.BigEndian.AppendUint16(nil, uint16(tlvType)<<9|uint16(len(value)))
+	return append(tlv, value...)
+}
+
+// GenerateLLDPDU creates an LLDP data unit from a MAC chassis ID, an
+// interface name port ID, a TTL in seconds and any further TLVs, closed by
+// an End TLV
+func (pg *PacketGenerator) GenerateLLDPDU(chassisMAC []byte, portName string, ttl uint16, tlvs ...[]byte) []byte {
+	pdu := pg.GenerateLLDPTLV(1, append([]byte{4}, chassisMAC...))
+	pdu = append(pdu, pg.GenerateLLDPTLV(2, append([]byte{5}, portName...))...)
+	pdu = append(pdu, pg.GenerateLLDPTLV(3, binary.BigEndian.AppendUint16(nil, ttl))...)
+	for _, tlv := range tlvs {
+		pdu = append(pdu, tlv...)
+	}
+	return append(pdu, pg.GenerateLLDPTLV(0, nil)...)
+}
+
+// GenerateLLDPManagementAddress creates an LLDP management address TLV for
+// an IPv4 or IPv6 address
+func (pg *PacketGenerator) GenerateLLDPManagementAddress(ip []byte) []byte {
+	family := byte(1)
+	if len(ip) == 16 {
+		family = 2
+	}
+	value := []byte{byte(1 + len(ip)), family}
+	value = append(value, ip...)
+	value = append(value, 2, 0, 0, 0, 1, 0) // ifIndex 1, no OID
+	return pg.GenerateLLDPTLV(8, value)
+}
+
+// GenerateLLDPPortVLAN creates the IEEE 802.1 port VLAN ID TLV
+func (pg *PacketGenerator) GenerateLLDPPortVLAN(vlanID uint16) []byte {
+	return pg.GenerateLLDPTLV(127, binary.BigEndian.AppendUint16([]byte{0x00, 0x80, 0xC2, 0x01}, vlanID))
+}
+
+// GenerateCDPTLV creates a CDP TLV; its length includes the 4-byte header
+func (pg *PacketGenerator) GenerateCDPTLV(tlvType uint16, value []byte) []byte {
+	tlv := binary.BigEndian.AppendUint16(nil, tlvType)
+	tlv = binary.BigEndian.AppendUint16(tlv, uint16(4+len(value)))
+	return append(tlv, value...)
+}
+
+// GenerateCDPAddresses creates the value of a CDP address TLV listing IPv4
+// and IPv6 addresses
+func (pg *PacketGenerator) GenerateCDPAddresses(ips ...[]byte) []byte {
+	value := binary.BigEndian.AppendUint32(nil, uint32(len(ips)))
+	for _, ip := range ips {
+		if len(ip) == 16 {
+			value = append(value, 2, 8, 0xAA, 0xAA, 0x03, 0x00, 0x00, 0x00, 0x86, 0xDD)
+		} else {
+			value = append(value, 1, 1, 0xCC)
+		}
+		value = binary.BigEndian.AppendUint16(value, uint16(len(ip)))
+		value = append(value, ip...)
+	}
+	return value
+}
+
+// GenerateCDPFrame creates an 802.3 frame to the CDP multicast address whose
+// LLC/SNAP payload is a CDP version 2 message with the given TTL and TLVs
+func (pg *PacketGenerator) GenerateCDPFrame(srcMAC []byte, ttl uint8, tlvs ...[]byte) []byte {
+	payload := []byte{0xAA, 0xAA, 0x03, 0x00, 0x00, 0x0C, 0x20, 0x00}
+	payload = append(payload, 2, ttl, 0, 0) // checksum left unset
+	for _, tlv := range tlvs {
+		payload = append(payload, tlv...)
+	}
+	cdpMulticast := []byte{0x01, 0x00, 0x0C, 0xCC, 0xCC, 0xCC}
+	return pg.GenerateEthernetFrame(srcMAC, cdpMulticast, uint16(len(payload)), payload)
+}
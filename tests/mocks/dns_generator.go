@@ -0,0 +1,55 @@
+package mocks
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// GenerateDNSName encodes a dotted name as uncompressed wire-format labels
+func (pg *PacketGenerator) GenerateDNSName(name string) []byte {
+	var encoded []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		encoded = append(encoded, byte(len(label)))
+		encoded = append(encoded, label...)
+	}
+	return append(encoded, 0)
+}
+
+// GenerateDNSQuestion creates a question entry of class IN
+func (pg *PacketGenerator) GenerateDNSQuestion(name string, qtype uint16) []byte {
+	question := pg.GenerateDNSName(name)
+	return binary.BigEndian.AppendUint32(question, uint32(qtype)<<16|1)
+}
+
+// GenerateDNSRecord creates a resource record; name is already in wire format
+// so that tests can pass compression pointers
+func (pg *PacketGenerator) GenerateDNSRecord(name []byte, rrType, class uint16, ttl uint32, rdata []byte) []byte {
+	record := append([]byte(nil), name...)
+	record = binary.BigEndian.AppendUint16(record, rrType)
+	record = binary.BigEndian.AppendUint16(record, class)
+	record = binary.BigEndian.AppendUint32(record, ttl)
+	record = binary.BigEndian.AppendUint16(record, uint16(len(rdata)))
+	return append(record, rdata...)
+}
+
+// GenerateDNSMessage creates a DNS message from a header and the encoded
+// entries of each section, in order
+func (pg *PacketGenerator) GenerateDNSMessage(id, flags uint16, questions, answers, authority, additional [][]byte) []byte {
+	message := make([]byte, 12)
+	binary.BigEndian.PutUint16(message[0:2], id)
+	binary.BigEndian.PutUint16(message[2:4], flags)
+	binary.BigEndian.PutUint16(message[4:6], uint16(len(questions)))
+	binary.BigEndian.PutUint16(message[6:8], uint16(len(answers)))
+	binary.BigEndian.PutUint16(message[8:10], uint16(len(authority)))
+	binary.BigEndian.PutUint16(message[10:12], uint16(len(additional)))
+
+	for _, section := range [][][]byte{questions, answers, authority, additional} {
+		for _, entry := range section {
+			message = append(message, entry...)
+		}
+	}
+	return message
+}
@@ -1,6 +1,7 @@
 package mocks
 
 import (
+	"encoding/binary"
 	"time"
 )
 
@@ -29,6 +30,40 @@ func (pg *PacketGenerator) GenerateEthernetFrame(srcMAC, dstMAC []byte, etherTyp
 	return frame
 }
 
+// GenerateLinuxSLLHeader creates a Linux cooked capture header for a packet
+// of the given EtherType sent by srcMAC
+func (pg *PacketGenerator) GenerateLinuxSLLHeader(packetType uint16, srcMAC []byte, protocol uint16) []byte {
+	header := make([]byte, 16)
+	binary.BigEndian.PutUint16(header[0:2], packetType)
+	binary.BigEndian.PutUint16(header[2:4], 1) // ARPHRD_ETHER
+	binary.BigEndian.PutUint16(header[4:6], uint16(len(srcMAC)))
+	copy(header[6:14], srcMAC)
+	binary.BigEndian.PutUint16(header[14:16], protocol)
+	return header
+}
+
+// GenerateLoopbackHeader creates a BSD loopback header with the address
+// family in little-endian host order
+func (pg *PacketGenerator) GenerateLoopbackHeader(family uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, family)
+}
+
+// GenerateVLANTag creates an 802.1Q/802.1ad tag body (TCI and inner EtherType);
+// the tag's TPID is the EtherType of the preceding header
+func (pg *PacketGenerator) GenerateVLANTag(priority uint8, vlanID uint16, innerEtherType uint16) []byte {
+	tci := uint16(priority)<<13 | vlanID&0x0FFF
+	return []byte{byte(tci >> 8), byte(tci), byte(innerEtherType >> 8), byte(innerEtherType)}
+}
+
+// GenerateMPLSLabel creates a single MPLS label stack entry
+func (pg *PacketGenerator) GenerateMPLSLabel(label uint32, trafficClass uint8, bottomOfStack bool, ttl uint8) []byte {
+	entry := label<<12 | uint32(trafficClass&0x07)<<9 | uint32(ttl)
+	if bottomOfStack {
+		entry |= 0x100
+	}
+	return []byte{byte(entry >> 24), byte(entry >> 16), byte(entry >> 8), byte(entry)}
+}
+
 // GenerateIPv4Packet creates an IPv4 packet with basic headers
 func (pg *PacketGenerator) GenerateIPv4Packet(srcIP, dstIP []byte, protocol uint8, payload []byte) []byte {
 	ipHeader := make([]byte, 20)
@@ -53,6 +88,68 @@ func (pg *PacketGenerator) GenerateIPv4Packet(srcIP, dstIP []byte, protocol uint
 	return packet
 }
 
+// GenerateIPv4Fragment creates an IPv4 fragment of datagram id carrying
+// payload at offset, counted in 8-byte units as in the header.
+func (pg *PacketGenerator) GenerateIPv4Fragment(srcIP, dstIP []byte, protocol uint8, id uint16, offset uint16, more bool, payload []byte) []byte {
+	packet := pg.GenerateIPv4Packet(srcIP, dstIP, protocol, payload)
+	packet[4], packet[5] = byte(id>>8), byte(id)
+	fragment := offset
+	if more {
+		fragment |= 0x2000
+	}
+	packet[6], packet[7] = byte(fragment>>8), byte(fragment)
+	putChecksum(packet[10:12], checksum(packet[:20]))
+	return packet
+}
+
+// GenerateIPv6Packet creates an IPv6 packet with a fixed 40-byte header
+func (pg *PacketGenerator) GenerateIPv6Packet(srcIP, dstIP []byte, nextHeader uint8, payload []byte) []byte {
+	packet := make([]byte, 40+len(payload))
+
+	packet[0] = 0x60 // Version 6
+	packet[4] = byte(len(payload) >> 8)
+	packet[5] = byte(len(payload) & 0xFF)
+	packet[6] = nextHeader
+	packet[7] = 0x40 // Hop limit
+	copy(packet[8:24], srcIP)
+	copy(packet[24:40], dstIP)
+	copy(packet[40:], payload)
+
+	return packet
+}
+
+// GenerateIPv6ExtensionHeader creates a generic IPv6 extension header
+// (Hop-by-Hop, Routing, Destination Options) padded to a multiple of 8 bytes
+func (pg *PacketGenerator) GenerateIPv6ExtensionHeader(nextHeader uint8, payload []byte) []byte {
+	length := (2 + len(payload) + 7) / 8 * 8
+	header := make([]byte, length)
+
+	header[0] = nextHeader
+	header[1] = byte(length/8 - 1)
+	copy(header[2:], payload)
+
+	return header
+}
+
+// GenerateIPv6FragmentHeader creates an IPv6 Fragment extension header
+func (pg *PacketGenerator) GenerateIPv6FragmentHeader(nextHeader uint8, offset uint16, more bool, id uint32) []byte {
+	header := make([]byte, 8)
+
+	header[0] = nextHeader
+	fragment := offset << 3
+	if more {
+		fragment |= 0x1
+	}
+	header[2] = byte(fragment >> 8)
+	header[3] = byte(fragment & 0xFF)
+	header[4] = byte(id >> 24)
+	header[5] = byte(id >> 16)
+	header[6] = byte(id >> 8)
+	header[7] = byte(id)
+
+	return header
+}
+
 // GenerateTCPSegment creates a TCP segment
 func (pg *PacketGenerator) GenerateTCPSegment(srcPort, dstPort uint16, flags uint8, payload []byte) []byte {
 	tcpHeader := make([]byte, 20)
@@ -76,6 +173,30 @@ func (pg *PacketGenerator) GenerateTCPSegment(srcPort, dstPort uint16, flags uin
 	return segment
 }
 
+// GenerateTCPSegmentWithSeq creates a TCP segment with the given sequence
+// and acknowledgment numbers
+func (pg *PacketGenerator) GenerateTCPSegmentWithSeq(srcPort, dstPort uint16, flags uint8, seq, ack uint32, payload []byte) []byte {
+	segment := pg.GenerateTCPSegment(srcPort, dstPort, flags, payload)
+	binary.BigEndian.PutUint32(segment[4:8], seq)
+	binary.BigEndian.PutUint32(segment[8:12], ack)
+	return segment
+}
+
+// GenerateTCPSegmentWithOptions creates a TCP segment carrying the given
+// option bytes, padded with EOL to a multiple of 4 bytes
+func (pg *PacketGenerator) GenerateTCPSegmentWithOptions(srcPort, dstPort uint16, flags uint8, options []byte, payload []byte) []byte {
+	optionLen := (len(options) + 3) / 4 * 4
+	base := pg.GenerateTCPSegment(srcPort, dstPort, flags, nil)
+
+	segment := make([]byte, 20+optionLen+len(payload))
+	copy(segment, base)
+	segment[12] = byte((20+optionLen)/4) << 4
+	copy(segment[20:], options)
+	copy(segment[20+optionLen:], payload)
+
+	return segment
+}
+
 // GenerateUDPDatagram creates a UDP datagram
 func (pg *PacketGenerator) GenerateUDPDatagram(srcPort, dstPort uint16, payload []byte) []byte {
 	udpHeader := make([]byte, 8)
@@ -97,6 +218,128 @@ func (pg *PacketGenerator) GenerateUDPDatagram(srcPort, dstPort uint16, payload
 	return datagram
 }
 
+// GenerateICMPMessage creates an ICMP or ICMPv6 message; rest is the
+// 4-byte type-specific field (echo id/sequence, MTU, gateway)
+func (pg *PacketGenerator) GenerateICMPMessage(icmpType, code uint8, rest [4]byte, payload []byte) []byte {
+	message := make([]byte, 8+len(payload))
+
+	message[0] = icmpType
+	message[1] = code
+	copy(message[4:8], rest[:])
+	copy(message[8:], payload)
+
+	return message
+}
+
+// GenerateARPPacket creates an Ethernet/IPv4 ARP request or reply body
+func (pg *PacketGenerator) GenerateARPPacket(operation uint16, senderMAC, senderIP, targetMAC, targetIP []byte) []byte {
+	arp := make([]byte, 28)
+
+	arp[0], arp[1] = 0x00, 0x01 // Hardware type: Ethernet
+	arp[2], arp[3] = 0x08, 0x00 // Protocol type: IPv4
+	arp[4] = 6
+	arp[5] = 4
+	arp[6] = byte(operation >> 8)
+	arp[7] = byte(operation & 0xFF)
+	copy(arp[8:14], senderMAC)
+	copy(arp[14:18], senderIP)
+	copy(arp[18:24], targetMAC)
+	copy(arp[24:28], targetIP)
+
+	return arp
+}
+
+// GenerateGREHeader creates a GRE header with an optional key; a negative
+// key omits the key field
+func (pg *PacketGenerator) GenerateGREHeader(protocol uint16, key int64, payload []byte) []byte {
+	header := []byte{0x00, 0x00, byte(protocol >> 8), byte(protocol & 0xFF)}
+	if key >= 0 {
+		header[0] |= 0x20 // K bit
+		header = append(header, byte(key>>24), byte(key>>16), byte(key>>8), byte(key))
+	}
+	return append(header, payload...)
+}
+
+// GenerateVXLANHeader creates a VXLAN header with the I flag set
+func (pg *PacketGenerator) GenerateVXLANHeader(vni uint32, payload []byte) []byte {
+	header := []byte{0x08, 0, 0, 0, byte(vni >> 16), byte(vni >> 8), byte(vni), 0}
+	return append(header, payload...)
+}
+
+// GenerateGENEVEHeader creates a GENEVE header; options must be a multiple
+// of 4 bytes
+func (pg *PacketGenerator) GenerateGENEVEHeader(vni uint32, protocol uint16, options []byte, payload []byte) []byte {
+	header := []byte{
+		byte(len(options) / 4), 0,
+		byte(protocol >> 8), byte(protocol & 0xFF),
+		byte(vni >> 16), byte(vni >> 8), byte(vni), 0,
+	}
+	header = append(header, options...)
+	return append(header, payload...)
+}
+
+// FinalizeChecksums fills in the IPv4 header checksum and the TCP, UDP,
+// ICMP or ICMPv6 checksum of an IPv4 or IPv6 packet without extension
+// headers, in place
+func (pg *PacketGenerator) FinalizeChecksums(packet []byte) []byte {
+	var pseudo []byte
+	var protocol uint8
+	var segment []byte
+
+	if packet[0]>>4 == 4 {
+		ihl := int(packet[0]&0x0F) * 4
+		packet[10], packet[11] = 0, 0
+		putChecksum(packet[10:12], checksum(packet[:ihl]))
+		protocol = packet[9]
+		segment = packet[ihl:]
+		if protocol != 1 {
+			pseudo = append(pseudo, packet[12:20]...)
+		}
+	} else {
+		protocol = packet[6]
+		segment = packet[40:]
+		pseudo = append(pseudo, packet[8:40]...)
+	}
+	if pseudo != nil {
+		pseudo = append(pseudo, 0, 0, byte(len(segment)>>8), byte(len(segment)), 0, 0, 0, protocol)
+	}
+
+	var field []byte
+	switch protocol {
+	case 6:
+		field = segment[16:18]
+	case 17:
+		field = segment[6:8]
+	case 1, 58:
+		field = segment[2:4]
+	default:
+		return packet
+	}
+	field[0], field[1] = 0, 0
+	putChecksum(field, checksum(append(pseudo, segment...)))
+
+	return packet
+}
+
+func checksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+func putChecksum(field []byte, sum uint16) {
+	field[0] = byte(sum >> 8)
+	field[1] = byte(sum)
+}
+
 // GenerateCompletePacket creates a complete Ethernet + IP + Transport packet
 func (pg *PacketGenerator) GenerateCompletePacket(
 	srcMAC, dstMAC []byte,
@@ -0,0 +1,92 @@
+package mocks
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+)
+
+// GenerateQUICCryptoFrame creates a CRYPTO frame carrying data at offset
+func (pg *PacketGenerator) GenerateQUICCryptoFrame(offset uint64, data []byte) []byte {
+	frame := appendQUICVarint([]byte{0x06}, offset)
+	frame = appendQUICVarint(frame, uint64(len(data)))
+	return append(frame, data...)
+}
+
+// GenerateQUICInitial creates an Initial packet with a two-byte packet
+// number, protected with the given key, IV and header protection key. The
+// payload is padded so that a header protection sample can be taken.
+func (pg *PacketGenerator) GenerateQUICInitial(version uint32, dcid, scid []byte, pn uint16, key, iv, hp []byte, payload []byte) []byte {
+	const pnLength = 2
+	typeBits := byte(0)
+	if version == 0x6b3343cf { // QUIC v2 rotates the packet types
+		typeBits = 1
+	}
+
+	if len(payload) < 20 {
+		payload = append(payload, make([]byte, 20-len(payload))...)
+	}
+
+	header := []byte{0xc0 | typeBits<<4 | (pnLength - 1)}
+	header = binary.BigEndian.AppendUint32(header, version)
+	header = append(header, byte(len(dcid)))
+	header = append(header, dcid...)
+	header = append(header, byte(len(scid)))
+	header = append(header, scid...)
+	header = append(header, 0) // no token
+	header = appendQUICVarint2(header, uint64(pnLength+len(payload)+16))
+	pnOffset := len(header)
+	header = binary.BigEndian.AppendUint16(header, pn)
+
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	nonce := append([]byte(nil), iv...)
+	nonce[len(nonce)-2] ^= byte(pn >> 8)
+	nonce[len(nonce)-1] ^= byte(pn)
+	packet := aead.Seal(header, nonce, payload, header)
+
+	hpBlock, _ := aes.NewCipher(hp)
+	mask := make([]byte, 16)
+	hpBlock.Encrypt(mask, packet[pnOffset+4:pnOffset+20])
+	packet[0] ^= mask[0] & 0x0f
+	for i := range pnLength {
+		packet[pnOffset+i] ^= mask[1+i]
+	}
+	return packet
+}
+
+// GenerateQUICLongHeader creates an unprotected long header of the given
+// type bits followed by payload, such as a Handshake packet to coalesce.
+// Initial packets get an empty token
+func (pg *PacketGenerator) GenerateQUICLongHeader(version uint32, typeBits uint8, dcid, scid []byte, payload []byte) []byte {
+	packet := []byte{0xc0 | typeBits<<4}
+	packet = binary.BigEndian.AppendUint32(packet, version)
+	packet = append(packet, byte(len(dcid)))
+	packet = append(packet, dcid...)
+	packet = append(packet, byte(len(scid)))
+	packet = append(packet, scid...)
+	if (version == 0x6b3343cf && typeBits == 1) || (version != 0x6b3343cf && typeBits == 0) {
+		packet = append(packet, 0)
+	}
+	packet = appendQUICVarint2(packet, uint64(len(payload)))
+	return append(packet, payload...)
+}
+
+func appendQUICVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return appendQUICVarint2(b, v)
+	case v < 1<<30:
+		return binary.BigEndian.AppendUint32(b, uint32(v)|0x80000000)
+	default:
+		return binary.BigEndian.AppendUint64(b, v|0xc000000000000000)
+	}
+}
+
+// appendQUICVarint2 encodes v on two bytes, as implementations usually do
+// for the Length field
+func appendQUICVarint2(b []byte, v uint64) []byte {
+	return binary.BigEndian.AppendUint16(b, uint16(v)|0x4000)
+}
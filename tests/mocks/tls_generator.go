@@ -0,0 +1,94 @@
+package mocks
+
+import "encoding/binary"
+
+// GenerateTLSExtension creates one hello extension
+func (pg *PacketGenerator) GenerateTLSExtension(extType uint16, data []byte) []byte {
+	ext := binary.BigEndian.AppendUint16(nil, extType)
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(data)))
+	return append(ext, data...)
+}
+
+// GenerateTLSServerNameExtension creates a server_name extension for host
+func (pg *PacketGenerator) GenerateTLSServerNameExtension(host string) []byte {
+	entry := append([]byte{0}, byte(len(host)>>8), byte(len(host)))
+	entry = append(entry, host...)
+	list := binary.BigEndian.AppendUint16(nil, uint16(len(entry)))
+	return pg.GenerateTLSExtension(0, append(list, entry...))
+}
+
+// GenerateTLSALPNExtension creates an application_layer_protocol_negotiation extension
+func (pg *PacketGenerator) GenerateTLSALPNExtension(protocols ...string) []byte {
+	var entries []byte
+	for _, protocol := range protocols {
+		entries = append(entries, byte(len(protocol)))
+		entries = append(entries, protocol...)
+	}
+	list := binary.BigEndian.AppendUint16(nil, uint16(len(entries)))
+	return pg.GenerateTLSExtension(16, append(list, entries...))
+}
+
+// GenerateTLSUint16ListExtension creates an extension holding a list of
+// 16-bit values behind a one or two byte length, such as supported_groups
+func (pg *PacketGenerator) GenerateTLSUint16ListExtension(extType uint16, lengthSize int, values ...uint16) []byte {
+	var data []byte
+	if lengthSize == 1 {
+		data = []byte{byte(2 * len(values))}
+	} else {
+		data = binary.BigEndian.AppendUint16(nil, uint16(2*len(values)))
+	}
+	for _, v := range values {
+		data = binary.BigEndian.AppendUint16(data, v)
+	}
+	return pg.GenerateTLSExtension(extType, data)
+}
+
+// GenerateTLSClientHello creates a ClientHello handshake body; with no
+// extensions the extension block is left out entirely
+func (pg *PacketGenerator) GenerateTLSClientHello(version uint16, ciphers []uint16, extensions ...[]byte) []byte {
+	body := binary.BigEndian.AppendUint16(nil, version)
+	body = append(body, make([]byte, 32)...) // random
+	body = append(body, 0)                   // session ID
+	body = binary.BigEndian.AppendUint16(body, uint16(2*len(ciphers)))
+	for _, cipher := range ciphers {
+		body = binary.BigEndian.AppendUint16(body, cipher)
+	}
+	body = append(body, 1, 0) // null compression
+	return appendTLSExtensions(body, extensions)
+}
+
+// GenerateTLSServerHello creates a ServerHello handshake body
+func (pg *PacketGenerator) GenerateTLSServerHello(version uint16, random []byte, cipher uint16, extensions ...[]byte) []byte {
+	body := binary.BigEndian.AppendUint16(nil, version)
+	body = append(body, make([]byte, 32)...)
+	copy(body[2:34], random)
+	body = append(body, 0)
+	body = binary.BigEndian.AppendUint16(body, cipher)
+	body = append(body, 0)
+	return appendTLSExtensions(body, extensions)
+}
+
+func appendTLSExtensions(body []byte, extensions [][]byte) []byte {
+	if len(extensions) == 0 {
+		return body
+	}
+	var block []byte
+	for _, ext := range extensions {
+		block = append(block, ext...)
+	}
+	body = binary.BigEndian.AppendUint16(body, uint16(len(block)))
+	return append(body, block...)
+}
+
+// GenerateTLSHandshakeRecord wraps a handshake body in its handshake header
+// and a single TLS record
+func (pg *PacketGenerator) GenerateTLSHandshakeRecord(msgType uint8, body []byte) []byte {
+	message := append([]byte{msgType, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+	return pg.GenerateTLSRecord(22, message)
+}
+
+// GenerateTLSRecord creates a TLS 1.2-versioned record
+func (pg *PacketGenerator) GenerateTLSRecord(contentType uint8, payload []byte) []byte {
+	record := []byte{contentType, 3, 3, byte(len(payload) >> 8), byte(len(payload))}
+	return append(record, payload...)
+}
@@ -0,0 +1,66 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePacket_ARPRequest(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	arp := gen.GenerateARPPacket(capture.ARPOperationRequest, testSrcMAC, testSrcIPv4, make([]byte, 6), testDstIPv4)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, capture.EtherTypeARP, arp)
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.ARP)
+	assert.Equal(t, uint16(capture.ARPHardwareEthernet), packet.ARP.HardwareType)
+	assert.Equal(t, uint16(capture.EtherTypeIPv4), packet.ARP.ProtocolType)
+	assert.Equal(t, uint16(capture.ARPOperationRequest), packet.ARP.Operation)
+	assert.Equal(t, "00:11:22:33:44:55", packet.ARP.SenderMAC.String())
+	assert.Equal(t, "192.168.1.10", packet.ARP.SenderIP.String())
+	assert.Equal(t, "10.0.0.1", packet.ARP.TargetIP.String())
+	assert.False(t, packet.ARP.IsGratuitous())
+	assert.False(t, packet.ARP.IsProbe())
+	assert.Empty(t, packet.Payload)
+}
+
+func TestParsePacket_GratuitousARP(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	arp := gen.GenerateARPPacket(capture.ARPOperationReply, testSrcMAC, testSrcIPv4, testSrcMAC, testSrcIPv4)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeARP, append(arp, make([]byte, 18)...))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.ARP)
+	assert.True(t, packet.ARP.IsGratuitous())
+	assert.Len(t, packet.Payload, 18, "Ethernet padding follows the ARP body")
+}
+
+func TestParsePacket_ARPProbe(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	arp := gen.GenerateARPPacket(capture.ARPOperationRequest, testSrcMAC, []byte{0, 0, 0, 0}, make([]byte, 6), testDstIPv4)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeARP, arp)
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.ARP)
+	assert.True(t, packet.ARP.IsProbe())
+	assert.False(t, packet.ARP.IsGratuitous())
+}
+
+func TestParsePacket_TruncatedARP(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	arp := gen.GenerateARPPacket(capture.ARPOperationRequest, testSrcMAC, testSrcIPv4, make([]byte, 6), testDstIPv4)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeARP, arp[:20])
+
+	packet, err := capture.ParsePacket(frame)
+	requireDecodeError(t, err, capture.LayerARP, capture.DecodeTruncated)
+	assert.Nil(t, packet.ARP)
+}
@@ -0,0 +1,169 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func verifyingDecoder() *capture.Decoder {
+	opts := capture.DefaultParseOptions()
+	opts.VerifyChecksums = true
+	return capture.NewDecoder(opts)
+}
+
+func TestDecoder_ChecksumsValid(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+
+	tests := []struct {
+		name   string
+		frame  []byte
+		expect capture.Checksums
+	}{
+		{
+			name: "ipv4 tcp",
+			frame: gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, gen.FinalizeChecksums(
+				gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, gen.GenerateTCPSegment(40000, 80, 0x18, []byte("odd"))))),
+			expect: capture.Checksums{IPv4: capture.ChecksumValid, TCP: capture.ChecksumValid},
+		},
+		{
+			name: "ipv4 udp",
+			frame: gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, gen.FinalizeChecksums(
+				gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, gen.GenerateUDPDatagram(5353, 53, []byte("query"))))),
+			expect: capture.Checksums{IPv4: capture.ChecksumValid, UDP: capture.ChecksumValid},
+		},
+		{
+			name: "ipv4 icmp",
+			frame: gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, gen.FinalizeChecksums(
+				gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoICMP,
+					gen.GenerateICMPMessage(capture.ICMPv4EchoRequest, 0, [4]byte{0, 1, 0, 1}, []byte("ping"))))),
+			expect: capture.Checksums{IPv4: capture.ChecksumValid, ICMP: capture.ChecksumValid},
+		},
+		{
+			name: "ipv6 tcp",
+			frame: gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6, gen.FinalizeChecksums(
+				gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoTCP, gen.GenerateTCPSegment(40000, 443, 0x02, nil)))),
+			expect: capture.Checksums{TCP: capture.ChecksumValid},
+		},
+		{
+			name: "ipv6 icmpv6",
+			frame: gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6, gen.FinalizeChecksums(
+				gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoICMPv6,
+					gen.GenerateICMPMessage(capture.ICMPv6EchoRequest, 0, [4]byte{0, 1, 0, 1}, nil)))),
+			expect: capture.Checksums{ICMP: capture.ChecksumValid},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := verifyingDecoder()
+			var packet capture.ParsedPacket
+
+			require.NoError(t, decoder.Decode(tt.frame, &packet))
+			assert.Equal(t, tt.expect, packet.Checksums)
+			assert.Equal(t, capture.ChecksumStatistics{}, decoder.ChecksumStatistics())
+		})
+	}
+}
+
+func TestDecoder_ChecksumsInvalidAreCounted(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	decoder := verifyingDecoder()
+	var packet capture.ParsedPacket
+
+	ip := gen.FinalizeChecksums(gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP,
+		gen.GenerateTCPSegment(40000, 80, 0x18, []byte("data"))))
+	ip[len(ip)-1] ^= 0xff // corrupt the payload
+	require.NoError(t, decoder.Decode(gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, ip), &packet))
+	assert.Equal(t, capture.ChecksumValid, packet.Checksums.IPv4)
+	assert.Equal(t, capture.ChecksumInvalid, packet.Checksums.TCP)
+
+	ip[8]-- // decrement the TTL without updating the header checksum
+	require.NoError(t, decoder.Decode(gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, ip), &packet))
+	assert.Equal(t, capture.ChecksumInvalid, packet.Checksums.IPv4)
+
+	stats := decoder.ChecksumStatistics()
+	assert.Equal(t, uint64(1), stats.IPv4Invalid)
+	assert.Equal(t, uint64(2), stats.TCPInvalid)
+	assert.Zero(t, stats.UDPInvalid)
+}
+
+func TestDecoder_ChecksumsNotVerifiable(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	decoder := verifyingDecoder()
+	var packet capture.ParsedPacket
+
+	// Zero UDP checksum: none was computed.
+	ip := gen.FinalizeChecksums(gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP,
+		gen.GenerateUDPDatagram(49152, 5000, []byte("payload"))))
+	ip[26], ip[27] = 0, 0
+	require.NoError(t, decoder.Decode(gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, ip), &packet))
+	assert.Equal(t, capture.ChecksumAbsent, packet.Checksums.UDP)
+
+	// Snap length cut the segment short.
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, gen.FinalizeChecksums(
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, gen.GenerateTCPSegment(40000, 80, 0x18, make([]byte, 100)))))
+	require.NoError(t, decoder.Decode(frame[:80], &packet))
+	assert.Equal(t, capture.ChecksumValid, packet.Checksums.IPv4)
+	assert.Equal(t, capture.ChecksumIncomplete, packet.Checksums.TCP)
+
+	// First fragment of a fragmented datagram.
+	ip = gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, gen.GenerateUDPDatagram(1234, 53, nil))
+	ip[6] = 0x20 // MF
+	require.NoError(t, decoder.Decode(gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.FinalizeChecksums(ip)), &packet))
+	assert.Equal(t, capture.ChecksumValid, packet.Checksums.IPv4)
+	assert.Equal(t, capture.ChecksumIncomplete, packet.Checksums.UDP)
+
+	assert.Equal(t, capture.ChecksumStatistics{}, decoder.ChecksumStatistics())
+}
+
+func TestDecoder_DecodeRawHonoursChecksumOffload(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	decoder := verifyingDecoder()
+	var packet capture.ParsedPacket
+
+	// Checksum fields hold whatever the stack left for the NIC.
+	raw := capture.RawPacket{
+		Data: gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, gen.FinalizeChecksums(
+			gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, gen.GenerateUDPDatagram(5353, 53, []byte("query"))))),
+		ChecksumOffloaded: true,
+	}
+	raw.Data[len(raw.Data)-1] ^= 0xff
+
+	require.NoError(t, decoder.DecodeRaw(&raw, &packet))
+	assert.Equal(t, capture.ChecksumValid, packet.Checksums.IPv4)
+	assert.Equal(t, capture.ChecksumOffloaded, packet.Checksums.UDP)
+
+	require.NoError(t, decoder.Decode(raw.Data, &packet))
+	assert.Equal(t, capture.ChecksumInvalid, packet.Checksums.UDP)
+
+	stats := decoder.ChecksumStatistics()
+	assert.Equal(t, uint64(1), stats.Offloaded)
+	assert.Equal(t, uint64(1), stats.UDPInvalid)
+}
+
+func TestDecoder_ChecksumsDisabledByDefault(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	packet, err := capture.ParsePacket(gen.GenerateCompletePacket(testSrcMAC, testDstMAC, testSrcIPv4, testDstIPv4,
+		capture.IPProtoTCP, 40000, 80, []byte("data")))
+	require.NoError(t, err)
+
+	assert.Equal(t, capture.Checksums{}, packet.Checksums)
+}
+
+func TestDecoder_ChecksumsZeroAllocations(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, gen.FinalizeChecksums(
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, gen.GenerateTCPSegment(40000, 80, 0x18, []byte("data")))))
+	decoder := verifyingDecoder()
+	var packet capture.ParsedPacket
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = decoder.Decode(frame, &packet)
+	})
+	assert.Zero(t, allocs)
+}
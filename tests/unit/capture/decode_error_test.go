@@ -0,0 +1,204 @@
+package capture
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/metrics"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// requireDecodeError asserts that err is a *DecodeError for layer and reason.
+func requireDecodeError(t *testing.T, err error, layer capture.LayerType, reason capture.DecodeErrorReason) {
+	t.Helper()
+	var decodeErr *capture.DecodeError
+	require.ErrorAs(t, err, &decodeErr)
+	assert.Equal(t, layer, decodeErr.Layer, "layer")
+	assert.Equal(t, reason, decodeErr.Reason, "reason")
+}
+
+func TestParsePacket_DecodeErrors(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+
+	badIPv4Version := gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, nil)
+	badIPv4Version[0] = 0x55
+	badIHL := gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, nil)
+	badIHL[0] = 0x44
+	badTotalLength := gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, nil)
+	badTotalLength[2], badTotalLength[3] = 0, 12
+	badTCPOffset := gen.GenerateTCPSegment(1, 2, 0x02, nil)
+	badTCPOffset[12] = 0x30
+	badUDPLength := gen.GenerateUDPDatagram(1, 2, nil)
+	badUDPLength[5] = 4
+	badIPv6Version := gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoUDP, nil)
+	badIPv6Version[0] = 0x40
+	badGENEVE := gen.GenerateGENEVEHeader(1, capture.EtherTypeTransparentBridging, nil, nil)
+	badGENEVE[0] = 0x40
+
+	tests := []struct {
+		name   string
+		frame  []byte
+		layer  capture.LayerType
+		reason capture.DecodeErrorReason
+	}{
+		{
+			name:   "truncated tcp",
+			frame:  gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, make([]byte, 10))),
+			layer:  capture.LayerTCP,
+			reason: capture.DecodeTruncated,
+		},
+		{
+			name:   "ipv4 version",
+			frame:  gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, badIPv4Version),
+			layer:  capture.LayerIPv4,
+			reason: capture.DecodeBadVersion,
+		},
+		{
+			name:   "ipv4 header length",
+			frame:  gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, badIHL),
+			layer:  capture.LayerIPv4,
+			reason: capture.DecodeBadLength,
+		},
+		{
+			name:   "ipv4 total length",
+			frame:  gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, badTotalLength),
+			layer:  capture.LayerIPv4,
+			reason: capture.DecodeBadLength,
+		},
+		{
+			name:   "tcp data offset",
+			frame:  gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, badTCPOffset)),
+			layer:  capture.LayerTCP,
+			reason: capture.DecodeBadLength,
+		},
+		{
+			name:   "udp length",
+			frame:  gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, badUDPLength)),
+			layer:  capture.LayerUDP,
+			reason: capture.DecodeBadLength,
+		},
+		{
+			name:   "ipv6 version",
+			frame:  gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6, badIPv6Version),
+			layer:  capture.LayerIPv6,
+			reason: capture.DecodeBadVersion,
+		},
+		{
+			name: "geneve version",
+			frame: gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP,
+				gen.GenerateUDPDatagram(49152, capture.GENEVEPort, badGENEVE))),
+			layer:  capture.LayerTunnel,
+			reason: capture.DecodeBadVersion,
+		},
+		{
+			name: "too many vlan tags",
+			frame: gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeVLAN, concat(
+				gen.GenerateVLANTag(0, 1, capture.EtherTypeVLAN), gen.GenerateVLANTag(0, 2, capture.EtherTypeVLAN),
+				gen.GenerateVLANTag(0, 3, capture.EtherTypeVLAN), gen.GenerateVLANTag(0, 4, capture.EtherTypeVLAN),
+				gen.GenerateVLANTag(0, 5, capture.EtherTypeVLAN), gen.GenerateVLANTag(0, 6, capture.EtherTypeVLAN),
+				gen.GenerateVLANTag(0, 7, capture.EtherTypeVLAN), gen.GenerateVLANTag(0, 8, capture.EtherTypeVLAN),
+				gen.GenerateVLANTag(0, 9, capture.EtherTypeIPv4))),
+			layer:  capture.LayerVLAN,
+			reason: capture.DecodeUnsupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet, err := capture.ParsePacket(tt.frame)
+			requireDecodeError(t, err, tt.layer, tt.reason)
+
+			require.NotNil(t, packet)
+			require.NotNil(t, packet.Err)
+			assert.Equal(t, tt.layer, packet.Err.Layer)
+			assert.True(t, packet.Has(capture.LayerEthernet))
+			assert.False(t, packet.Has(tt.layer) && tt.layer != capture.LayerVLAN)
+		})
+	}
+}
+
+func TestParsePacket_ShortFrameReturnsNoPacket(t *testing.T) {
+	packet, err := capture.ParsePacket(make([]byte, 10))
+
+	assert.Nil(t, packet)
+	requireDecodeError(t, err, capture.LayerEthernet, capture.DecodeTruncated)
+}
+
+func TestDecoder_DecodeStatistics(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	decoder := capture.NewDecoder(capture.DefaultParseOptions())
+	var packet capture.ParsedPacket
+
+	good := ipv4TCPFrame(gen)
+	truncatedTCP := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, make([]byte, 10)))
+	truncatedInner := vxlanFrame(gen, 7, innerFrame(gen)[:30])
+
+	require.NoError(t, decoder.Decode(good, &packet))
+	assert.Nil(t, packet.Err)
+	assert.Error(t, decoder.Decode(truncatedTCP, &packet))
+	assert.Error(t, decoder.Decode(truncatedTCP, &packet))
+	assert.NoError(t, decoder.Decode(truncatedInner, &packet))
+	assert.Error(t, decoder.Decode(make([]byte, 4), &packet))
+
+	require.NoError(t, decoder.Decode(good, &packet))
+	assert.Nil(t, packet.Err, "error must not leak into the next decode")
+
+	stats := decoder.DecodeStatistics()
+	assert.Equal(t, uint64(6), stats.PacketsDecoded)
+	assert.Equal(t, uint64(4), stats.PacketsFailed)
+	assert.Equal(t, map[string]map[string]uint64{
+		"ethernet": {"truncated": 1},
+		"ipv4":     {"truncated": 1},
+		"tcp":      {"truncated": 2},
+	}, stats.Failures)
+}
+
+type recordingDecodeCollector struct {
+	decoded, failed uint64
+	failures        map[string]map[string]uint64
+	checksumErrors  map[string]uint64
+}
+
+func (r *recordingDecodeCollector) UpdateDecodeMetrics(packetsDecoded, packetsFailed uint64,
+	failures map[string]map[string]uint64, checksumErrors map[string]uint64) {
+	r.decoded, r.failed = packetsDecoded, packetsFailed
+	r.failures, r.checksumErrors = failures, checksumErrors
+}
+
+func TestDecoder_ReportMetrics(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	decoder := capture.NewDecoder(capture.DefaultParseOptions())
+	var packet capture.ParsedPacket
+
+	_ = decoder.Decode(gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeVLAN, []byte{0x00}), &packet)
+
+	collector := &recordingDecodeCollector{}
+	decoder.ReportMetrics(collector)
+
+	assert.Equal(t, uint64(1), collector.decoded)
+	assert.Equal(t, uint64(1), collector.failed)
+	assert.Equal(t, uint64(1), collector.failures["vlan"]["truncated"])
+	assert.Contains(t, collector.checksumErrors, "tcp")
+}
+
+func TestDecoder_ReportMetricsToSystemCollector(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	decoder := capture.NewDecoder(capture.DefaultParseOptions())
+	var packet capture.ParsedPacket
+
+	truncatedTCP := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, make([]byte, 10)))
+	_ = decoder.Decode(truncatedTCP, &packet)
+
+	collector := metrics.NewSystemMetricsCollector(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	decoder.ReportMetrics(collector)
+
+	decodeMetrics := collector.GetDecodeMetrics()
+	assert.Equal(t, uint64(1), decodeMetrics.PacketsFailed)
+	assert.Equal(t, uint64(1), decodeMetrics.Failures["tcp"]["truncated"])
+}
@@ -0,0 +1,160 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ipv4TCPFrame(gen *mocks.PacketGenerator) []byte {
+	options := []byte{
+		2, 4, 0x05, 0xb4, // MSS 1460
+		1, 3, 3, 7, // NOP, window scale 7
+		8, 10, 0, 0, 0, 1, 0, 0, 0, 0, // timestamps
+		1, 1, // padding
+	}
+	return gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP,
+			gen.GenerateTCPSegmentWithOptions(40000, 443, 0x18, options, []byte("GET / HTTP/1.1\r\n"))))
+}
+
+func ipv6UDPFrame(gen *mocks.PacketGenerator) []byte {
+	return gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6,
+		gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoUDP,
+			gen.GenerateUDPDatagram(5353, 53, []byte("query"))))
+}
+
+func TestDecoder_LayersAreExplicit(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	decoder := capture.NewDecoder(capture.DefaultParseOptions())
+	var packet capture.ParsedPacket
+
+	require.NoError(t, decoder.Decode(ipv4TCPFrame(gen), &packet))
+
+	assert.Equal(t, []capture.LayerType{
+		capture.LayerEthernet, capture.LayerIPv4, capture.LayerTCP, capture.LayerPayload,
+	}, packet.Layers.Layers())
+	assert.Equal(t, "ethernet,ipv4,tcp,payload", packet.Layers.String())
+	assert.True(t, packet.Has(capture.LayerTCP))
+	assert.False(t, packet.Has(capture.LayerUDP))
+}
+
+func TestDecoder_ReusedPacketDropsStaleLayers(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	decoder := capture.NewDecoder(capture.DefaultParseOptions())
+	var packet capture.ParsedPacket
+
+	require.NoError(t, decoder.Decode(ipv4TCPFrame(gen), &packet))
+	require.NotNil(t, packet.TCP)
+	assert.True(t, packet.TCP.Options.HasMSS)
+
+	require.NoError(t, decoder.Decode(ipv6UDPFrame(gen), &packet))
+	assert.Nil(t, packet.IPv4)
+	assert.Nil(t, packet.TCP)
+	require.NotNil(t, packet.IPv6)
+	require.NotNil(t, packet.UDP)
+	assert.Equal(t, uint16(53), packet.UDP.DstPort)
+	assert.Equal(t, []byte("query"), packet.Payload)
+	assert.Equal(t, "ethernet,ipv6,udp,payload", packet.Layers.String())
+
+	require.NoError(t, decoder.Decode(gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, gen.GenerateTCPSegment(1, 2, 0x10, nil))), &packet))
+	require.NotNil(t, packet.TCP)
+	assert.False(t, packet.TCP.Options.HasMSS)
+	assert.Empty(t, packet.TCP.Options.Kinds)
+	assert.Nil(t, packet.Payload)
+}
+
+func TestDecoder_AddressesOutliveBuffer(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	decoder := capture.NewDecoder(capture.DefaultParseOptions())
+	var packet capture.ParsedPacket
+
+	frame := ipv4TCPFrame(gen)
+	require.NoError(t, decoder.Decode(frame, &packet))
+	srcIP := packet.IPv4.SrcIP
+	srcMAC := packet.Ethernet.SrcMAC
+
+	for i := range frame {
+		frame[i] = 0xee
+	}
+
+	assert.Equal(t, "192.168.1.10", srcIP.String())
+	assert.Equal(t, "192.168.1.10", packet.IPv4.SrcIP.String())
+	assert.Equal(t, "00:11:22:33:44:55", srcMAC.String())
+}
+
+func TestDecoder_ShortFrame(t *testing.T) {
+	decoder := capture.NewDecoder(capture.DefaultParseOptions())
+	var packet capture.ParsedPacket
+
+	assert.Error(t, decoder.Decode([]byte{0x00, 0x01}, &packet))
+	assert.Equal(t, capture.LayerSet(0), packet.Layers)
+}
+
+func TestDecoder_ZeroAllocations(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{name: "ipv4 tcp", frame: ipv4TCPFrame(gen)},
+		{name: "ipv6 udp", frame: ipv6UDPFrame(gen)},
+		{
+			name: "vlan ipv4 udp",
+			frame: gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeVLAN, concat(
+				gen.GenerateVLANTag(0, 100, capture.EtherTypeIPv4),
+				gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, gen.GenerateUDPDatagram(1234, 53, nil)))),
+		},
+		{name: "vxlan", frame: vxlanFrame(gen, 42, innerFrame(gen))},
+	}
+
+	decoder := capture.NewDecoder(capture.DefaultParseOptions())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var packet capture.ParsedPacket
+			allocs := testing.AllocsPerRun(100, func() {
+				_ = decoder.Decode(tt.frame, &packet)
+			})
+			assert.Zero(t, allocs)
+		})
+	}
+}
+
+func BenchmarkDecoder_IPv4TCP(b *testing.B) {
+	frame := ipv4TCPFrame(mocks.NewPacketGenerator())
+	decoder := capture.NewDecoder(capture.DefaultParseOptions())
+	var packet capture.ParsedPacket
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(frame)))
+	for i := 0; i < b.N; i++ {
+		_ = decoder.Decode(frame, &packet)
+	}
+}
+
+func BenchmarkDecoder_IPv6UDP(b *testing.B) {
+	frame := ipv6UDPFrame(mocks.NewPacketGenerator())
+	decoder := capture.NewDecoder(capture.DefaultParseOptions())
+	var packet capture.ParsedPacket
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(frame)))
+	for i := 0; i < b.N; i++ {
+		_ = decoder.Decode(frame, &packet)
+	}
+}
+
+func BenchmarkParsePacket_IPv4TCP(b *testing.B) {
+	frame := ipv4TCPFrame(mocks.NewPacketGenerator())
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(frame)))
+	for i := 0; i < b.N; i++ {
+		_, _ = capture.ParsePacket(frame)
+	}
+}
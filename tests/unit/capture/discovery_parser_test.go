@@ -0,0 +1,166 @@
+package capture
+
+import (
+	"log/slog"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var lldpMulticast = []byte{0x01, 0x80, 0xc2, 0x00, 0x00, 0x0e}
+
+func TestParsePacket_LLDP(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	pdu := gen.GenerateLLDPDU(testDstMAC, "Gi1/0/24", 120,
+		gen.GenerateLLDPTLV(4, []byte("uplink to rack 7")),
+		gen.GenerateLLDPTLV(5, []byte("core-sw1.example.net")),
+		gen.GenerateLLDPTLV(6, []byte("Cisco IOS\nVersion 15.2")),
+		gen.GenerateLLDPManagementAddress([]byte{10, 0, 0, 2}),
+		gen.GenerateLLDPManagementAddress(testSrcIPv6),
+		gen.GenerateLLDPPortVLAN(42),
+	)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, lldpMulticast, capture.EtherTypeLLDP, append(pdu, make([]byte, 4)...))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	assert.True(t, packet.Has(capture.LayerLLDP))
+	assert.False(t, packet.Has(capture.LayerCDP))
+	require.NotNil(t, packet.Discovery)
+	d := packet.Discovery
+	assert.Equal(t, capture.DiscoveryLLDP, d.Protocol)
+	assert.Equal(t, "66:77:88:99:aa:bb", d.ChassisID)
+	assert.Equal(t, "Gi1/0/24", d.PortID)
+	assert.Equal(t, "uplink to rack 7", d.PortDescription)
+	assert.Equal(t, "core-sw1.example.net", d.SystemName)
+	assert.Equal(t, "Cisco IOS?Version 15.2", d.SystemDescription)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("2001:db8::1")}, d.ManagementAddresses)
+	assert.Equal(t, uint16(42), d.VLANID)
+	assert.Equal(t, 120*time.Second, d.TTL)
+	assert.Len(t, packet.Payload, 4, "Ethernet padding follows the End TLV")
+}
+
+func TestParsePacket_LLDPOverVLAN(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	pdu := gen.GenerateLLDPDU(testDstMAC, "eth0", 30)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, lldpMulticast, capture.EtherTypeVLAN,
+		append(gen.GenerateVLANTag(0, 10, capture.EtherTypeLLDP), pdu...))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	assert.Equal(t, "ethernet,vlan,lldp", packet.Layers.String())
+	require.NotNil(t, packet.Discovery)
+	assert.Equal(t, "eth0", packet.Discovery.PortID)
+}
+
+func TestParsePacket_TruncatedLLDP(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	pdu := gen.GenerateLLDPDU(testDstMAC, "Gi1/0/24", 120)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, lldpMulticast, capture.EtherTypeLLDP, pdu[:10])
+
+	packet, err := capture.ParsePacket(frame)
+	requireDecodeError(t, err, capture.LayerLLDP, capture.DecodeTruncated)
+	assert.Nil(t, packet.Discovery)
+}
+
+func TestParsePacket_CDP(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frame := gen.GenerateCDPFrame(testDstMAC, 180,
+		gen.GenerateCDPTLV(0x0001, []byte("edge-sw2")),
+		gen.GenerateCDPTLV(0x0002, gen.GenerateCDPAddresses([]byte{192, 168, 1, 2})),
+		gen.GenerateCDPTLV(0x0003, []byte("GigabitEthernet0/3")),
+		gen.GenerateCDPTLV(0x0005, []byte("Cisco IOS Software, C2960")),
+		gen.GenerateCDPTLV(0x0006, []byte("cisco WS-C2960-24TT-L")),
+		gen.GenerateCDPTLV(0x000a, []byte{0x00, 0x64}),
+		gen.GenerateCDPTLV(0x0016, gen.GenerateCDPAddresses([]byte{10, 1, 1, 1}, testSrcIPv6)),
+	)
+	frame = append(frame, make([]byte, 6)...) // padding beyond the 802.3 length
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	assert.Equal(t, "ethernet,cdp", packet.Layers.String())
+	require.NotNil(t, packet.Discovery)
+	d := packet.Discovery
+	assert.Equal(t, capture.DiscoveryCDP, d.Protocol)
+	assert.Equal(t, "edge-sw2", d.ChassisID)
+	assert.Equal(t, "edge-sw2", d.SystemName)
+	assert.Equal(t, "GigabitEthernet0/3", d.PortID)
+	assert.Equal(t, "Cisco IOS Software, C2960", d.SystemDescription)
+	assert.Equal(t, "cisco WS-C2960-24TT-L", d.Platform)
+	assert.Equal(t, uint16(100), d.VLANID)
+	assert.Equal(t, 180*time.Second, d.TTL)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.1.1.1"), netip.MustParseAddr("2001:db8::1")}, d.ManagementAddresses,
+		"management addresses are preferred over interface addresses")
+	assert.Empty(t, packet.Payload)
+}
+
+func TestParsePacket_CDPBadTLVLength(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frame := gen.GenerateCDPFrame(testDstMAC, 180, []byte{0x00, 0x01, 0x00, 0x02})
+
+	packet, err := capture.ParsePacket(frame)
+	requireDecodeError(t, err, capture.LayerCDP, capture.DecodeBadLength)
+	assert.Nil(t, packet.Discovery)
+}
+
+func TestParsePacket_OtherLLC(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	// An STP BPDU: 802.3 with an LLC header but no SNAP.
+	bpdu := []byte{0x42, 0x42, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00}
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, uint16(len(bpdu)), bpdu)
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	assert.Nil(t, packet.Discovery)
+	assert.Equal(t, bpdu, packet.Payload)
+}
+
+func TestInterfaceManager_Neighbors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	im := capture.NewInterfaceManager(logger)
+	gen := mocks.NewPacketGenerator()
+
+	lo, err := im.GetInterfaceByName("lo")
+	if err != nil {
+		t.Skip("Loopback interface 'lo' not available on this system")
+	}
+	assert.Empty(t, lo.Neighbors)
+
+	lldp, err := capture.ParsePacket(gen.GenerateEthernetFrame(testDstMAC, lldpMulticast, capture.EtherTypeLLDP,
+		gen.GenerateLLDPDU(testDstMAC, "Gi1/0/24", 120, gen.GenerateLLDPTLV(5, []byte("core-sw1")))))
+	require.NoError(t, err)
+	now := time.Now()
+	im.ObserveDiscovery(lo.Index, lldp, now.Add(-time.Minute))
+	im.ObserveDiscovery(lo.Index, lldp, now)
+
+	cdp, err := capture.ParsePacket(gen.GenerateCDPFrame(testSrcMAC, 10, gen.GenerateCDPTLV(0x0001, []byte("edge-sw2"))))
+	require.NoError(t, err)
+	im.ObserveDiscovery(lo.Index, cdp, now.Add(-time.Minute))
+
+	lo, err = im.GetInterfaceByIndex(lo.Index)
+	require.NoError(t, err)
+	require.Len(t, lo.Neighbors, 1, "the CDP neighbor's TTL has run out")
+	n := lo.Neighbors[0]
+	assert.Equal(t, capture.DiscoveryLLDP, n.Protocol)
+	assert.Equal(t, "core-sw1", n.SystemName)
+	assert.Equal(t, "Gi1/0/24", n.PortID)
+	assert.Equal(t, "66:77:88:99:aa:bb", n.SourceMAC.String())
+	assert.Equal(t, now.Add(-time.Minute), n.FirstSeen)
+	assert.Equal(t, now, n.LastSeen)
+
+	// A zero TTL withdraws the neighbor.
+	shutdown, err := capture.ParsePacket(gen.GenerateEthernetFrame(testDstMAC, lldpMulticast, capture.EtherTypeLLDP,
+		gen.GenerateLLDPDU(testDstMAC, "Gi1/0/24", 0)))
+	require.NoError(t, err)
+	im.ObserveDiscovery(lo.Index, shutdown, now)
+	assert.Empty(t, im.Neighbors(lo.Index))
+}
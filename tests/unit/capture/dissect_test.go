@@ -0,0 +1,386 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var broadcastMAC = []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+func arpRequestFrame(gen *mocks.PacketGenerator) []byte {
+	return gen.GenerateEthernetFrame(testSrcMAC, broadcastMAC, capture.EtherTypeARP,
+		append(gen.GenerateARPPacket(capture.ARPOperationRequest, testSrcMAC, testSrcIPv4, make([]byte, 6), []byte{192, 168, 1, 1}),
+			make([]byte, 18)...))
+}
+
+type dissectCase struct {
+	name     string
+	linkType capture.LinkType
+	data     []byte
+}
+
+// dissectCases covers every layer the decoder produces.
+func dissectCases(gen *mocks.PacketGenerator) []dissectCase {
+	udp := gen.GenerateUDPDatagram(5353, 53, []byte("query"))
+	quoted := gen.GenerateIPv4Packet(testDstIPv4, testSrcIPv4, capture.IPProtoUDP, gen.GenerateUDPDatagram(53, 5353, nil))
+
+	return []dissectCase{
+		{"ethernet tcp", capture.LinkTypeEthernet, ipv4TCPFrame(gen)},
+		{"ethernet ipv6 udp", capture.LinkTypeEthernet, ipv6UDPFrame(gen)},
+		{"arp", capture.LinkTypeEthernet, arpRequestFrame(gen)},
+		{"vlan mpls", capture.LinkTypeEthernet, gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeVLAN,
+			bytes.Join([][]byte{
+				gen.GenerateVLANTag(5, 100, capture.EtherTypeMPLSUnicast),
+				gen.GenerateMPLSLabel(16, 0, true, 64),
+				gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, udp),
+			}, nil))},
+		{"lldp", capture.LinkTypeEthernet, gen.GenerateEthernetFrame(testSrcMAC, lldpMulticast, capture.EtherTypeLLDP,
+			gen.GenerateLLDPDU(testDstMAC, "Gi1/0/24", 120, gen.GenerateLLDPTLV(5, []byte("core-sw1"))))},
+		{"cdp", capture.LinkTypeEthernet, gen.GenerateCDPFrame(testSrcMAC, 180,
+			gen.GenerateCDPTLV(0x0001, []byte("edge-sw2")), gen.GenerateCDPTLV(0x0003, []byte("Gi0/1")))},
+		{"ipv6 fragment", capture.LinkTypeEthernet, gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6,
+			gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPv6ExtHopByHop, bytes.Join([][]byte{
+				gen.GenerateIPv6ExtensionHeader(capture.IPv6ExtFragment, make([]byte, 6)),
+				gen.GenerateIPv6FragmentHeader(capture.IPProtoUDP, 0, true, 0xcafe),
+				udp,
+			}, nil)))},
+		{"icmp error", capture.LinkTypeEthernet, gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+			gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoICMP,
+				gen.GenerateICMPMessage(capture.ICMPv4DestUnreachable, 3, [4]byte{}, quoted)))},
+		{"icmpv6 echo", capture.LinkTypeRaw, gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoICMPv6,
+			gen.GenerateICMPMessage(capture.ICMPv6EchoRequest, 0, [4]byte{0, 7, 0, 1}, []byte("ping")))},
+		{"linux sll", capture.LinkTypeLinuxSLL, append(gen.GenerateLinuxSLLHeader(4, testSrcMAC, capture.EtherTypeIPv4),
+			gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, udp)...)},
+		{"loopback", capture.LinkTypeNull, append(gen.GenerateLoopbackHeader(2),
+			gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, udp)...)},
+		{"vxlan", capture.LinkTypeEthernet, vxlanFrame(gen, 5001, innerFrame(gen))},
+		{"gre", capture.LinkTypeEthernet, gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+			gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoGRE,
+				gen.GenerateGREHeader(capture.EtherTypeIPv4, 42,
+					gen.GenerateIPv4Packet(testInnerSrcIPv4, testInnerDstIPv4, capture.IPProtoUDP, udp))))},
+	}
+}
+
+var treeHeadings = map[capture.LayerType]string{
+	capture.LayerEthernet:     "Ethernet II, ",
+	capture.LayerLinuxSLL:     "Linux cooked capture, ",
+	capture.LayerLoopback:     "Null/Loopback, ",
+	capture.LayerVLAN:         "802.1Q Virtual LAN, ",
+	capture.LayerMPLS:         "MultiProtocol Label Switching, ",
+	capture.LayerARP:          "Address Resolution Protocol ",
+	capture.LayerLLDP:         "Link Layer Discovery Protocol, ",
+	capture.LayerCDP:          "Cisco Discovery Protocol, ",
+	capture.LayerIPv4:         "Internet Protocol Version 4, ",
+	capture.LayerIPv6:         "Internet Protocol Version 6, ",
+	capture.LayerIPv6Fragment: "    Extension header: Fragment (44), 8 bytes",
+	capture.LayerTCP:          "Transmission Control Protocol, ",
+	capture.LayerUDP:          "User Datagram Protocol, ",
+	capture.LayerICMP:         "Internet Control Message Protocol, ",
+	capture.LayerICMPv6:       "Internet Control Message Protocol v6, ",
+	capture.LayerTunnel:       "Tunnel: ",
+	capture.LayerPayload:      "Data (",
+}
+
+func TestDissect_CoversEveryLayer(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	seen := make(map[capture.LayerType]bool)
+
+	for _, tc := range dissectCases(gen) {
+		t.Run(tc.name, func(t *testing.T) {
+			packet, err := parseLinkType(t, tc.linkType, tc.data)
+			require.NoError(t, err)
+
+			tree := packet.Tree()
+			dump := packet.HexDump(tc.data)
+			prefix := ""
+			for p := packet; p != nil; p = p.Inner {
+				for _, layer := range p.Layers.Layers() {
+					seen[layer] = true
+					// An outer payload is the tunnelled packet.
+					if layer == capture.LayerPayload && p.Inner != nil {
+						continue
+					}
+					assert.Contains(t, tree, treeHeadings[layer], "tree lacks %s", layer)
+					if start, end, ok := p.Bounds(layer); ok && end > start {
+						assert.Contains(t, "\n"+dump, "\n"+prefix+layer.String()+" (", "hex dump lacks %s", layer)
+					}
+				}
+				prefix += "inner "
+			}
+
+			assert.NotContains(t, packet.Summary(), "no layers decoded")
+			assert.NotContains(t, packet.Summary(), "\n")
+			assert.True(t, json.Valid([]byte(mustMarshal(t, packet))))
+		})
+	}
+
+	for layer := capture.LayerEthernet; layer <= capture.LayerPayload; layer++ {
+		assert.True(t, seen[layer], "no test case decodes %s", layer)
+	}
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	t.Helper()
+	encoded, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(encoded)
+}
+
+func TestParsedPacket_Summary(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	cases := dissectCases(gen)
+
+	expected := map[string]string{
+		"ethernet tcp":      "192.168.1.10:40000 -> 10.0.0.1:443 TCP [PSH, ACK] Seq=305419896 Ack=2271560481 Win=8192 Len=16",
+		"ethernet ipv6 udp": "[2001:db8::1]:5353 -> [2001:db8::2]:53 UDP Len=5",
+		"arp":               "ARP Who has 192.168.1.1? Tell 192.168.1.10",
+		"vlan mpls":         "[vlan 100] [mpls 16] 192.168.1.10:5353 -> 10.0.0.1:53 UDP Len=5",
+		"lldp":              "LLDP Chassis=66:77:88:99:aa:bb Port=Gi1/0/24 System=core-sw1 TTL=2m0s",
+		"cdp":               "CDP Chassis=edge-sw2 Port=Gi0/1 TTL=3m0s",
+		"ipv6 fragment":     "[2001:db8::1]:5353 -> [2001:db8::2]:53 UDP Len=5",
+		"icmp error":        "192.168.1.10 -> 10.0.0.1 ICMP Destination unreachable code=3",
+		"icmpv6 echo":       "2001:db8::1 -> 2001:db8::2 ICMPv6 Echo request id=0x0007 seq=1",
+		"linux sll":         "192.168.1.10:5353 -> 10.0.0.1:53 UDP Len=5",
+		"vxlan":             "[vxlan 5001] 172.16.0.1:1234 -> 172.16.0.2:80 TCP [PSH, ACK] Seq=305419896 Ack=2271560481 Win=8192 Len=5",
+		"gre":               "[gre 42] 172.16.0.1:5353 -> 172.16.0.2:53 UDP Len=5",
+	}
+	for _, tc := range cases {
+		want, ok := expected[tc.name]
+		if !ok {
+			continue
+		}
+		packet, err := parseLinkType(t, tc.linkType, tc.data)
+		require.NoError(t, err)
+		assert.Equal(t, want, packet.Summary(), tc.name)
+	}
+
+	// A later IPv4 fragment carries no transport header.
+	fragment := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Fragment(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, 0x4242, 185, false, make([]byte, 16)))
+	packet, err := capture.ParsePacket(fragment)
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.1.10 -> 10.0.0.1 IPv4 UDP (17) fragment id=0x4242 off=1480", packet.Summary())
+
+	// Decode errors and bad checksums are flagged.
+	truncated := ipv4TCPFrame(gen)[:40]
+	packet, err = capture.ParsePacket(truncated)
+	require.Error(t, err)
+	assert.Equal(t, "192.168.1.10 -> 10.0.0.1 IPv4 TCP (6) [malformed tcp truncated: insufficient data for TCP header: need 20, got 6]",
+		packet.Summary())
+
+	opts := capture.DefaultParseOptions()
+	opts.VerifyChecksums = true
+	packet, err = capture.ParsePacketWithOptions(ipv4TCPFrame(gen), opts)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(packet.Summary(), "Len=16 [bad ipv4 checksum] [bad tcp checksum]"), packet.Summary())
+}
+
+func TestParsedPacket_Tree(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	packet, err := capture.ParsePacket(ipv4TCPFrame(gen))
+	require.NoError(t, err)
+
+	tree := packet.Tree()
+	for _, line := range []string{
+		"Ethernet II, Src: 00:11:22:33:44:55, Dst: 66:77:88:99:aa:bb\n",
+		"    Type: IPv4 (0x0800)\n",
+		"Internet Protocol Version 4, Src: 192.168.1.10, Dst: 10.0.0.1\n",
+		"    Header length: 20 bytes (5)\n",
+		"    Flags: 0x2, don't fragment\n",
+		"    Protocol: TCP (6)\n",
+		"    Header checksum: 0x0000 [unchecked]\n",
+		"Transmission Control Protocol, Src Port: 40000, Dst Port: 443, Seq: 305419896, Ack: 2271560481, Len: 16\n",
+		"    Flags: 0x18 [PSH, ACK]\n",
+		"    Options: (20 bytes)\n",
+		"        Maximum segment size: 1460\n",
+		"        Window scale: 7 (multiply by 128)\n",
+		"        Timestamps: TSval 1, TSecr 0\n",
+		"        Kinds: 2,1,3,8,1,1\n",
+		"Data (16 bytes)\n",
+		"    Data: 474554202f20485454502f312e310d0a\n",
+	} {
+		assert.Contains(t, tree, line)
+	}
+
+	// The datagram quoted by an ICMP error is dissected too.
+	var icmpError dissectCase
+	for _, tc := range dissectCases(gen) {
+		if tc.name == "icmp error" {
+			icmpError = tc
+		}
+	}
+	packet, err = capture.ParsePacket(icmpError.data)
+	require.NoError(t, err)
+	tree = packet.Tree()
+	assert.Contains(t, tree, "    Type: 3 (Destination unreachable)\n")
+	assert.Contains(t, tree, "    Quoted datagram, UDP (17)\n")
+	assert.Contains(t, tree, "        IPv4: 10.0.0.1 -> 192.168.1.10, ID 0x1234, TTL 64, Protocol UDP (17)\n")
+	assert.Contains(t, tree, "        UDP: 53 -> 5353, Length 8\n")
+
+	// A decode error ends the tree.
+	packet, _ = capture.ParsePacket(ipv4TCPFrame(gen)[:40])
+	assert.True(t, strings.HasSuffix(packet.Tree(), "[Malformed packet: tcp truncated: insufficient data for TCP header: need 20, got 6]\n"))
+}
+
+func TestParsedPacket_HexDump(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frame := arpRequestFrame(gen)
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	assert.Equal(t, `ethernet (14 bytes)
+0000  ff ff ff ff ff ff 00 11  22 33 44 55 08 06        ........"3DU..
+arp (28 bytes)
+000e  00 01 08 00 06 04 00 01  00 11 22 33 44 55 c0 a8  .........."3DU..
+001e  01 0a 00 00 00 00 00 00  c0 a8 01 01              ............
+payload (18 bytes)
+002a  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  ................
+003a  00 00                                             ..
+`, packet.HexDump(frame))
+
+	// Padding after the IP datagram belongs to no layer.
+	padded := append(gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, gen.GenerateUDPDatagram(1, 2, []byte("hi")))),
+		0, 0, 0, 0)
+	packet, err = capture.ParsePacket(padded)
+	require.NoError(t, err)
+	dump := packet.HexDump(padded)
+	assert.Contains(t, dump, "payload (2 bytes)\n002a  68 69 ")
+	assert.Contains(t, dump, "trailer (4 bytes)\n002c  00 00 00 00 ")
+
+	// The fragment header splits the IPv6 layer's extension headers.
+	for _, tc := range dissectCases(gen) {
+		if tc.name != "ipv6 fragment" {
+			continue
+		}
+		packet, err = capture.ParsePacket(tc.data)
+		require.NoError(t, err)
+		dump = packet.HexDump(tc.data)
+		assert.Contains(t, dump, "ipv6 (48 bytes)\n")
+		assert.Contains(t, dump, "ipv6_fragment (8 bytes)\n003e  11 00 00 01 00 00 ca fe ")
+		assert.Contains(t, dump, "udp (8 bytes)\n0046  ")
+	}
+}
+
+func TestParsedPacket_Bounds(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	packet, err := capture.ParsePacket(ipv4TCPFrame(gen))
+	require.NoError(t, err)
+
+	bounds := func(p *capture.ParsedPacket, layer capture.LayerType) [2]int {
+		start, end, ok := p.Bounds(layer)
+		require.True(t, ok, "no bounds for %s", layer)
+		return [2]int{start, end}
+	}
+	assert.Equal(t, [2]int{0, 14}, bounds(packet, capture.LayerEthernet))
+	assert.Equal(t, [2]int{14, 34}, bounds(packet, capture.LayerIPv4))
+	assert.Equal(t, [2]int{34, 74}, bounds(packet, capture.LayerTCP))
+	assert.Equal(t, [2]int{74, 90}, bounds(packet, capture.LayerPayload))
+	_, _, ok := packet.Bounds(capture.LayerUDP)
+	assert.False(t, ok)
+
+	// Decapsulated layers are placed in the outer frame, which the inner
+	// frame starts 50 bytes into.
+	packet, err = capture.ParsePacket(vxlanFrame(gen, 5001, innerFrame(gen)))
+	require.NoError(t, err)
+	assert.Equal(t, [2]int{42, 50}, bounds(packet, capture.LayerTunnel))
+	assert.Equal(t, [2]int{50, 109}, bounds(packet, capture.LayerPayload))
+	assert.Equal(t, [2]int{50, 64}, bounds(packet.Inner, capture.LayerEthernet))
+	assert.Equal(t, [2]int{84, 104}, bounds(packet.Inner, capture.LayerTCP))
+
+	// Stacked tags are spanned together.
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeQinQ, bytes.Join([][]byte{
+		gen.GenerateVLANTag(0, 10, capture.EtherTypeVLAN),
+		gen.GenerateVLANTag(0, 20, capture.EtherTypeIPv4),
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, gen.GenerateUDPDatagram(1, 2, nil)),
+	}, nil))
+	packet, err = capture.ParsePacket(frame)
+	require.NoError(t, err)
+	assert.Equal(t, [2]int{14, 22}, bounds(packet, capture.LayerVLAN))
+	assert.Equal(t, [2]int{22, 42}, bounds(packet, capture.LayerIPv4))
+}
+
+func TestParsedPacket_MarshalJSON(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	packet, err := capture.ParsePacket(vxlanFrame(gen, 5001, ipv4TCPFrame(gen)))
+	require.NoError(t, err)
+
+	var decoded struct {
+		Layers []string `json:"layers"`
+		UDP    struct {
+			DstPort int `json:"dst_port"`
+		} `json:"udp"`
+		Tunnel struct {
+			Type string `json:"type"`
+			ID   int    `json:"id"`
+		} `json:"tunnel"`
+		Inner struct {
+			Layers []string `json:"layers"`
+			IPv4   struct {
+				SrcIP string `json:"src_ip"`
+			} `json:"ipv4"`
+			TCP struct {
+				Flags   int `json:"flags"`
+				Options struct {
+					MSS   int   `json:"mss"`
+					Kinds []int `json:"kinds"`
+				} `json:"options"`
+			} `json:"tcp"`
+			PayloadLength int    `json:"payload_length"`
+			Payload       []byte `json:"payload"`
+		} `json:"inner"`
+		Checksums map[string]string `json:"checksums"`
+		Error     *struct{}         `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(mustMarshal(t, packet)), &decoded))
+
+	assert.Equal(t, []string{"ethernet", "ipv4", "udp", "tunnel", "payload"}, decoded.Layers)
+	assert.Equal(t, capture.VXLANPort, decoded.UDP.DstPort)
+	assert.Equal(t, "vxlan", decoded.Tunnel.Type)
+	assert.Equal(t, 5001, decoded.Tunnel.ID)
+	assert.Equal(t, []string{"ethernet", "ipv4", "tcp", "payload"}, decoded.Inner.Layers)
+	assert.Equal(t, "192.168.1.10", decoded.Inner.IPv4.SrcIP)
+	assert.Equal(t, 0x18, decoded.Inner.TCP.Flags)
+	assert.Equal(t, 1460, decoded.Inner.TCP.Options.MSS)
+	assert.Equal(t, []int{2, 1, 3, 8, 1, 1}, decoded.Inner.TCP.Options.Kinds)
+	assert.Equal(t, 16, decoded.Inner.PayloadLength)
+	assert.Equal(t, []byte("GET / HTTP/1.1\r\n"), decoded.Inner.Payload)
+	assert.Equal(t, "unchecked", decoded.Checksums["tcp"])
+	assert.Nil(t, decoded.Error)
+
+	packet, _ = capture.ParsePacket(ipv4TCPFrame(gen)[:40])
+	assert.Contains(t, mustMarshal(t, packet), `"error":{"layer":"tcp","reason":"truncated","detail":"insufficient data for TCP header: need 20, got 6"}`)
+}
+
+func TestParsedPacket_Dissect(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frame := arpRequestFrame(gen)
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	render := func(format capture.DissectFormat) string {
+		var out bytes.Buffer
+		require.NoError(t, packet.Dissect(&out, format, frame))
+		return out.String()
+	}
+	assert.Equal(t, packet.Summary()+"\n", render(capture.DissectSummary))
+	assert.Equal(t, packet.Tree(), render(capture.DissectTree))
+	assert.Equal(t, packet.Summary()+"\n"+packet.HexDump(frame), render(capture.DissectHex))
+	assert.Equal(t, mustMarshal(t, packet)+"\n", render(capture.DissectJSON))
+	assert.Error(t, packet.Dissect(&bytes.Buffer{}, capture.DissectFormat(9), frame))
+
+	for _, name := range []string{"summary", "tree", "hex", "json"} {
+		format, err := capture.ParseDissectFormat(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, format.String())
+	}
+	_, err = capture.ParseDissectFormat("pdml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,116 @@
+//go:build linux
+
+package capture
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receiveEvent(t *testing.T, events <-chan capture.EngineEvent) capture.EngineEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "event channel closed unexpectedly")
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for engine event")
+	}
+	return capture.EngineEvent{}
+}
+
+func TestPacketCaptureEngine_Subscribe_FilterChanged(t *testing.T) {
+	engine := capture.NewPacketCaptureEngine(createTestLogger())
+
+	events, unsubscribe := engine.Subscribe(4)
+	defer unsubscribe()
+
+	program := []capture.BPFInstruction{{Code: 0x06, K: 0xFFFF}} // ret #65535
+	require.NoError(t, engine.SetFilter(program))
+
+	event := receiveEvent(t, events)
+	assert.Equal(t, capture.EventFilterChanged, event.Type)
+	assert.False(t, event.Timestamp.IsZero())
+	assert.Equal(t, 0, event.Details["previous_length"])
+	assert.Equal(t, 1, event.Details["filter_length"])
+	assert.Equal(t, false, event.Details["applied"])
+
+	require.NoError(t, engine.SetFilter(nil))
+	event = receiveEvent(t, events)
+	assert.Equal(t, 1, event.Details["previous_length"])
+	assert.Equal(t, 0, event.Details["filter_length"])
+}
+
+func TestPacketCaptureEngine_Subscribe_MultipleSubscribers(t *testing.T) {
+	engine := capture.NewPacketCaptureEngine(createTestLogger())
+
+	first, unsubscribeFirst := engine.Subscribe(1)
+	defer unsubscribeFirst()
+	second, unsubscribeSecond := engine.Subscribe(1)
+	defer unsubscribeSecond()
+
+	require.NoError(t, engine.SetFilter(nil))
+
+	assert.Equal(t, capture.EventFilterChanged, receiveEvent(t, first).Type)
+	assert.Equal(t, capture.EventFilterChanged, receiveEvent(t, second).Type)
+}
+
+func TestPacketCaptureEngine_Unsubscribe(t *testing.T) {
+	engine := capture.NewPacketCaptureEngine(createTestLogger())
+
+	events, unsubscribe := engine.Subscribe(1)
+	unsubscribe()
+	unsubscribe() // safe to call twice
+
+	_, ok := <-events
+	assert.False(t, ok, "channel should be closed after unsubscribe")
+
+	require.NoError(t, engine.SetFilter(nil))
+	assert.Equal(t, uint64(0), engine.GetStatistics().EventsDropped)
+}
+
+func TestPacketCaptureEngine_Subscribe_SlowSubscriberDropsEvents(t *testing.T) {
+	engine := capture.NewPacketCaptureEngine(createTestLogger())
+
+	_, unsubscribe := engine.Subscribe(1)
+	defer unsubscribe()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, engine.SetFilter(nil))
+	}
+
+	assert.Equal(t, uint64(2), engine.GetStatistics().EventsDropped)
+}
+
+func TestPacketCaptureEngine_Events_Lifecycle(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Lifecycle events test requires root privileges for AF_PACKET socket")
+	}
+
+	engine := capture.NewPacketCaptureEngine(createTestLogger())
+	events, unsubscribe := engine.Subscribe(8)
+	defer unsubscribe()
+
+	if err := engine.StartCapture("lo"); err != nil {
+		t.Skipf("Cannot start capture on loopback: %v", err)
+	}
+	started := receiveEvent(t, events)
+	assert.Equal(t, capture.EventCaptureStarted, started.Type)
+	assert.Equal(t, "lo", started.Interface)
+	assert.Equal(t, "ethernet", started.Details["link_type"], "Linux loopback frames carry an Ethernet header")
+
+	require.NoError(t, engine.SetFilter([]capture.BPFInstruction{{Code: 0x06, K: 0xFFFF}}))
+	changed := receiveEvent(t, events)
+	assert.Equal(t, capture.EventFilterChanged, changed.Type)
+	assert.Equal(t, true, changed.Details["applied"])
+
+	require.NoError(t, engine.StopCapture())
+	stopped := receiveEvent(t, events)
+	assert.Equal(t, capture.EventCaptureStopped, stopped.Type)
+	assert.Contains(t, stopped.Details, "packets_received")
+}
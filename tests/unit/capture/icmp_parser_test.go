@@ -0,0 +1,115 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePacket_ICMPEcho(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	icmp := gen.GenerateICMPMessage(capture.ICMPv4EchoRequest, 0, [4]byte{0x12, 0x34, 0x00, 0x07}, []byte("ping"))
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoICMP, icmp))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.ICMP)
+	assert.Nil(t, packet.ICMPv6)
+	assert.Equal(t, uint8(capture.ICMPv4EchoRequest), packet.ICMP.Type)
+	assert.Equal(t, uint16(0x1234), packet.ICMP.ID)
+	assert.Equal(t, uint16(7), packet.ICMP.Sequence)
+	assert.Nil(t, packet.ICMP.Embedded)
+	assert.Equal(t, []byte("ping"), packet.Payload)
+}
+
+func TestParsePacket_ICMPDestUnreachableEmbedsUDP(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	original := gen.GenerateIPv4Packet(testDstIPv4, testSrcIPv4, capture.IPProtoUDP, gen.GenerateUDPDatagram(33434, 53, nil))
+	icmp := gen.GenerateICMPMessage(capture.ICMPv4DestUnreachable, capture.ICMPv4CodeFragmentationNeeded,
+		[4]byte{0, 0, 0x05, 0xdc}, original)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoICMP, icmp))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.ICMP)
+	assert.Equal(t, uint32(1500), packet.ICMP.MTU)
+	embedded := packet.ICMP.Embedded
+	require.NotNil(t, embedded)
+	require.NotNil(t, embedded.IPv4)
+	assert.Equal(t, "10.0.0.1", embedded.IPv4.SrcIP.String())
+	assert.Equal(t, uint8(capture.IPProtoUDP), embedded.Protocol)
+	require.NotNil(t, embedded.UDP)
+	assert.Equal(t, uint16(33434), embedded.UDP.SrcPort)
+	assert.Equal(t, uint16(53), embedded.UDP.DstPort)
+}
+
+func TestParsePacket_ICMPTimeExceededWithTruncatedTCP(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	tcp := gen.GenerateTCPSegment(40000, 443, 0x02, nil)
+	original := gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, tcp)[:28]
+	icmp := gen.GenerateICMPMessage(capture.ICMPv4TimeExceeded, 0, [4]byte{}, original)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testDstIPv4, testSrcIPv4, capture.IPProtoICMP, icmp))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.ICMP.Embedded)
+	require.NotNil(t, packet.ICMP.Embedded.TCP)
+	assert.Equal(t, uint16(40000), packet.ICMP.Embedded.TCP.SrcPort)
+	assert.Equal(t, uint16(443), packet.ICMP.Embedded.TCP.DstPort)
+	assert.Equal(t, uint32(0x12345678), packet.ICMP.Embedded.TCP.SeqNum)
+}
+
+func TestParsePacket_ICMPv6PacketTooBig(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	original := gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoTCP, gen.GenerateTCPSegment(50000, 443, 0x18, nil))
+	icmp := gen.GenerateICMPMessage(capture.ICMPv6PacketTooBig, 0, [4]byte{0, 0, 0x05, 0x00}, original)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6,
+		gen.GenerateIPv6Packet(testDstIPv6, testSrcIPv6, capture.IPProtoICMPv6, icmp))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	assert.Nil(t, packet.ICMP)
+	require.NotNil(t, packet.ICMPv6)
+	assert.Equal(t, uint32(1280), packet.ICMPv6.MTU)
+	require.NotNil(t, packet.ICMPv6.Embedded)
+	require.NotNil(t, packet.ICMPv6.Embedded.IPv6)
+	assert.Equal(t, "2001:db8::1", packet.ICMPv6.Embedded.IPv6.SrcIP.String())
+	require.NotNil(t, packet.ICMPv6.Embedded.TCP)
+	assert.Equal(t, uint16(50000), packet.ICMPv6.Embedded.TCP.SrcPort)
+}
+
+func TestParsePacket_ICMPv6EchoReply(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	icmp := gen.GenerateICMPMessage(capture.ICMPv6EchoReply, 0, [4]byte{0x00, 0x01, 0x00, 0x02}, nil)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6,
+		gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoICMPv6, icmp))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.ICMPv6)
+	assert.Equal(t, uint16(1), packet.ICMPv6.ID)
+	assert.Equal(t, uint16(2), packet.ICMPv6.Sequence)
+}
+
+func TestParsePacket_TruncatedICMP(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoICMP, []byte{8, 0, 0}))
+
+	packet, err := capture.ParsePacket(frame)
+	requireDecodeError(t, err, capture.LayerICMP, capture.DecodeTruncated)
+
+	require.NotNil(t, packet.IPv4)
+	assert.Nil(t, packet.ICMP)
+}
@@ -0,0 +1,141 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseLinkType(t *testing.T, linkType capture.LinkType, data []byte) (*capture.ParsedPacket, error) {
+	t.Helper()
+	opts := capture.DefaultParseOptions()
+	opts.LinkType = linkType
+	return capture.ParsePacketWithOptions(data, opts)
+}
+
+func TestParsePacket_RawIPv4(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	data := gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP,
+		gen.GenerateTCPSegment(40000, 443, capture.TCPFlagSYN, []byte("hello")))
+
+	packet, err := parseLinkType(t, capture.LinkTypeRaw, data)
+	require.NoError(t, err)
+
+	assert.Equal(t, "ipv4,tcp,payload", packet.Layers.String())
+	assert.Nil(t, packet.Ethernet)
+	assert.Equal(t, "192.168.1.10", packet.IPv4.SrcIP.String())
+	assert.Equal(t, uint16(443), packet.TCP.DstPort)
+	assert.Equal(t, []byte("hello"), packet.Payload)
+}
+
+func TestDecoder_DecodeRawUsesLinkType(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	raw := capture.RawPacket{
+		LinkType: capture.LinkTypeRaw,
+		Data: gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoUDP,
+			gen.GenerateUDPDatagram(5353, 5353, []byte{1, 2, 3})),
+	}
+
+	var packet capture.ParsedPacket
+	decoder := capture.NewDecoder(capture.DefaultParseOptions())
+	require.NoError(t, decoder.DecodeRaw(&raw, &packet))
+
+	assert.Equal(t, "ipv6,udp,payload", packet.Layers.String())
+	assert.Equal(t, "2001:db8::1", packet.IPv6.SrcIP.String())
+
+	// The same decoder still reads Ethernet frames from other interfaces.
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6, raw.Data)
+	require.NoError(t, decoder.DecodeRaw(&capture.RawPacket{Data: frame}, &packet))
+	assert.Equal(t, "ethernet,ipv6,udp,payload", packet.Layers.String())
+}
+
+func TestParsePacket_RawBadVersion(t *testing.T) {
+	packet, err := parseLinkType(t, capture.LinkTypeRaw, []byte{0x50, 0x00, 0x00, 0x00})
+	requireDecodeError(t, err, capture.LayerIPv4, capture.DecodeBadVersion)
+	assert.Nil(t, packet)
+
+	_, err = parseLinkType(t, capture.LinkTypeRaw, nil)
+	requireDecodeError(t, err, capture.LayerIPv4, capture.DecodeTruncated)
+}
+
+func TestParsePacket_Loopback(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	ipv4 := gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, gen.GenerateUDPDatagram(1000, 53, nil))
+	ipv6 := gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoUDP, gen.GenerateUDPDatagram(1000, 53, nil))
+
+	tests := []struct {
+		name   string
+		header []byte
+		ip     []byte
+		layers string
+	}{
+		{"IPv4", gen.GenerateLoopbackHeader(2), ipv4, "loopback,ipv4,udp"},
+		{"IPv6 Darwin", gen.GenerateLoopbackHeader(30), ipv6, "loopback,ipv6,udp"},
+		{"IPv6 big-endian", []byte{0, 0, 0, 24}, ipv6, "loopback,ipv6,udp"},
+		{"unknown family", gen.GenerateLoopbackHeader(7), ipv4, "loopback,payload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet, err := parseLinkType(t, capture.LinkTypeNull, append(tt.header, tt.ip...))
+			require.NoError(t, err)
+			assert.Equal(t, tt.layers, packet.Layers.String())
+			require.NotNil(t, packet.Loopback)
+		})
+	}
+
+	_, err := parseLinkType(t, capture.LinkTypeNull, []byte{2, 0})
+	requireDecodeError(t, err, capture.LayerLoopback, capture.DecodeTruncated)
+}
+
+func TestParsePacket_LinuxSLL(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	arp := gen.GenerateARPPacket(capture.ARPOperationRequest, testSrcMAC, testSrcIPv4, make([]byte, 6), testDstIPv4)
+	data := append(gen.GenerateLinuxSLLHeader(1, testSrcMAC, capture.EtherTypeARP), arp...)
+
+	packet, err := parseLinkType(t, capture.LinkTypeLinuxSLL, data)
+	require.NoError(t, err)
+
+	assert.Equal(t, "linux_sll,arp", packet.Layers.String())
+	require.NotNil(t, packet.LinuxSLL)
+	assert.Equal(t, uint16(1), packet.LinuxSLL.PacketType)
+	assert.Equal(t, uint16(capture.ARPHRDEther), packet.LinuxSLL.ARPHRD)
+	assert.Equal(t, testSrcMAC, packet.LinuxSLL.Address[:packet.LinuxSLL.AddressSize])
+	require.NotNil(t, packet.ARP)
+	assert.Equal(t, "10.0.0.1", packet.ARP.TargetIP.String())
+
+	// ETH_P_802_2: an LLC frame, left undecoded.
+	llc := append(gen.GenerateLinuxSLLHeader(0, testSrcMAC, 0x0004), 0x42, 0x42, 0x03)
+	packet, err = parseLinkType(t, capture.LinkTypeLinuxSLL, llc)
+	require.NoError(t, err)
+	assert.Equal(t, "linux_sll,payload", packet.Layers.String())
+
+	_, err = parseLinkType(t, capture.LinkTypeLinuxSLL, data[:10])
+	requireDecodeError(t, err, capture.LayerLinuxSLL, capture.DecodeTruncated)
+}
+
+func TestLinkTypeFromARPHRD(t *testing.T) {
+	tests := []struct {
+		hatype   uint16
+		linkType capture.LinkType
+		ok       bool
+	}{
+		{capture.ARPHRDEther, capture.LinkTypeEthernet, true},
+		{capture.ARPHRDLoopback, capture.LinkTypeEthernet, true},
+		{capture.ARPHRDNone, capture.LinkTypeRaw, true}, // tun, WireGuard
+		{capture.ARPHRDRawIP, capture.LinkTypeRaw, true},
+		{capture.ARPHRDPPP, capture.LinkTypeRaw, true},
+		{capture.ARPHRDSit, capture.LinkTypeRaw, true},
+		{803, 0, false}, // 802.11 radiotap
+	}
+
+	for _, tt := range tests {
+		linkType, ok := capture.LinkTypeFromARPHRD(tt.hatype)
+		assert.Equal(t, tt.ok, ok, "ARPHRD %d", tt.hatype)
+		assert.Equal(t, tt.linkType, linkType, "ARPHRD %d", tt.hatype)
+	}
+	assert.Equal(t, "raw", capture.LinkTypeRaw.String())
+}
@@ -0,0 +1,264 @@
+package capture
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testSrcMAC  = []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	testDstMAC  = []byte{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb}
+	testSrcIPv4 = []byte{192, 168, 1, 10}
+	testDstIPv4 = []byte{10, 0, 0, 1}
+	testSrcIPv6 = net.ParseIP("2001:db8::1").To16()
+	testDstIPv6 = net.ParseIP("2001:db8::2").To16()
+)
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+func TestParsePacket_IPv4TCP(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frame := gen.GenerateCompletePacket(testSrcMAC, testDstMAC, testSrcIPv4, testDstIPv4,
+		capture.IPProtoTCP, 12345, 80, []byte("hello"))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.Ethernet)
+	assert.Equal(t, uint16(capture.EtherTypeIPv4), packet.Ethernet.EtherType)
+	require.NotNil(t, packet.IPv4)
+	assert.Equal(t, "192.168.1.10", packet.IPv4.SrcIP.String())
+	require.NotNil(t, packet.TCP)
+	assert.Equal(t, uint16(12345), packet.TCP.SrcPort)
+	assert.Equal(t, uint16(80), packet.TCP.DstPort)
+	assert.Equal(t, []byte("hello"), packet.Payload)
+}
+
+func TestParsePacket_IPv6ExtensionHeaderChain(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	udp := gen.GenerateUDPDatagram(5353, 53, []byte("query"))
+	chain := concat(
+		gen.GenerateIPv6ExtensionHeader(capture.IPv6ExtRouting, []byte{0, 0, 0, 0}),
+		gen.GenerateIPv6ExtensionHeader(capture.IPv6ExtDestinationOptions, make([]byte, 14)),
+		gen.GenerateIPv6ExtensionHeader(capture.IPProtoUDP, nil),
+		udp,
+	)
+	ip := gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPv6ExtHopByHop, chain)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6, ip)
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+	require.NotNil(t, packet.IPv6)
+
+	types := []uint8{}
+	for _, ext := range packet.IPv6.ExtensionHeaders {
+		types = append(types, ext.Type)
+	}
+	assert.Equal(t, []uint8{capture.IPv6ExtHopByHop, capture.IPv6ExtRouting, capture.IPv6ExtDestinationOptions}, types)
+	assert.Equal(t, 8, packet.IPv6.ExtensionHeaders[0].Length)
+	assert.Equal(t, 16, packet.IPv6.ExtensionHeaders[1].Length)
+	assert.Equal(t, uint8(capture.IPProtoUDP), packet.IPv6.UpperLayerProtocol)
+	assert.Equal(t, capture.IPv6HeaderSize+32, packet.IPv6.UpperLayerOffset)
+	assert.Nil(t, packet.IPv6.Fragment)
+
+	require.NotNil(t, packet.UDP)
+	assert.Equal(t, uint16(53), packet.UDP.DstPort)
+	assert.Equal(t, []byte("query"), packet.Payload)
+}
+
+func TestParsePacket_IPv6FirstFragment(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	tcp := gen.GenerateTCPSegment(40000, 443, 0x02, nil)
+	payload := concat(gen.GenerateIPv6FragmentHeader(capture.IPProtoTCP, 0, true, 0xdeadbeef), tcp)
+	ip := gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPv6ExtFragment, payload)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6, ip)
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.IPv6.Fragment)
+	assert.Equal(t, uint16(0), packet.IPv6.Fragment.FragmentOffset)
+	assert.True(t, packet.IPv6.Fragment.MoreFragments)
+	assert.Equal(t, uint32(0xdeadbeef), packet.IPv6.Fragment.Identification)
+	assert.Equal(t, uint8(capture.IPProtoTCP), packet.IPv6.UpperLayerProtocol)
+
+	require.NotNil(t, packet.TCP)
+	assert.Equal(t, uint16(443), packet.TCP.DstPort)
+}
+
+func TestParsePacket_IPv6LaterFragmentSkipsTransport(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	payload := concat(gen.GenerateIPv6FragmentHeader(capture.IPProtoUDP, 185, false, 7), []byte("continuation data"))
+	ip := gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPv6ExtFragment, payload)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6, ip)
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.IPv6.Fragment)
+	assert.Equal(t, uint16(185), packet.IPv6.Fragment.FragmentOffset)
+	assert.False(t, packet.IPv6.Fragment.MoreFragments)
+	assert.Nil(t, packet.UDP)
+	assert.Equal(t, []byte("continuation data"), packet.Payload)
+}
+
+func TestParsePacket_IPv6AuthenticationHeader(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	ah := make([]byte, 24) // 12-byte fixed part plus a 12-byte ICV
+	ah[0] = capture.IPProtoTCP
+	ah[1] = 4 // (24 / 4) - 2
+	payload := concat(ah, gen.GenerateTCPSegment(1000, 22, 0x10, nil))
+	ip := gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPv6ExtAuthentication, payload)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6, ip)
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.Len(t, packet.IPv6.ExtensionHeaders, 1)
+	assert.Equal(t, 24, packet.IPv6.ExtensionHeaders[0].Length)
+	require.NotNil(t, packet.TCP)
+	assert.Equal(t, uint16(22), packet.TCP.DstPort)
+}
+
+func TestParsePacket_IPv6TruncatedExtensionHeader(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	ext := gen.GenerateIPv6ExtensionHeader(capture.IPProtoTCP, make([]byte, 14))
+	ip := gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPv6ExtHopByHop, ext[:10])
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6, ip)
+
+	packet, err := capture.ParsePacket(frame)
+	requireDecodeError(t, err, capture.LayerIPv6, capture.DecodeTruncated)
+
+	require.NotNil(t, packet.IPv6)
+	assert.Empty(t, packet.IPv6.ExtensionHeaders)
+	assert.Nil(t, packet.TCP)
+}
+
+func TestParsePacket_SingleVLANTag(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	ip := gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, gen.GenerateUDPDatagram(1234, 53, nil))
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeVLAN,
+		concat(gen.GenerateVLANTag(5, 100, capture.EtherTypeIPv4), ip))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.Len(t, packet.VLANs, 1)
+	assert.Equal(t, capture.VLANTag{
+		TPID:      capture.EtherTypeVLAN,
+		Priority:  5,
+		VLANID:    100,
+		EtherType: capture.EtherTypeIPv4,
+	}, packet.VLANs[0])
+	require.NotNil(t, packet.IPv4)
+	require.NotNil(t, packet.UDP)
+	assert.Equal(t, uint16(53), packet.UDP.DstPort)
+}
+
+func TestParsePacket_QinQ(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	ip := gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoTCP, gen.GenerateTCPSegment(5000, 443, 0x02, nil))
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeQinQ, concat(
+		gen.GenerateVLANTag(0, 300, capture.EtherTypeVLAN),
+		gen.GenerateVLANTag(3, 42, capture.EtherTypeIPv6),
+		ip,
+	))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.Len(t, packet.VLANs, 2)
+	assert.Equal(t, uint16(capture.EtherTypeQinQ), packet.VLANs[0].TPID)
+	assert.Equal(t, uint16(300), packet.VLANs[0].VLANID)
+	assert.Equal(t, uint16(capture.EtherTypeVLAN), packet.VLANs[1].TPID)
+	assert.Equal(t, uint16(42), packet.VLANs[1].VLANID)
+	assert.Equal(t, uint8(3), packet.VLANs[1].Priority)
+	require.NotNil(t, packet.IPv6)
+	require.NotNil(t, packet.TCP)
+	assert.Equal(t, uint16(443), packet.TCP.DstPort)
+}
+
+func TestParsePacket_MPLSLabelStack(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	ip := gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, gen.GenerateTCPSegment(179, 40000, 0x18, nil))
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeMPLSUnicast, concat(
+		gen.GenerateMPLSLabel(16004, 0, false, 64),
+		gen.GenerateMPLSLabel(24001, 5, true, 63),
+		ip,
+	))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.Len(t, packet.MPLS, 2)
+	assert.Equal(t, capture.MPLSLabel{Label: 16004, TTL: 64}, packet.MPLS[0])
+	assert.Equal(t, capture.MPLSLabel{Label: 24001, TrafficClass: 5, BottomOfStack: true, TTL: 63}, packet.MPLS[1])
+	require.NotNil(t, packet.IPv4)
+	require.NotNil(t, packet.TCP)
+	assert.Equal(t, uint16(179), packet.TCP.SrcPort)
+}
+
+func TestParsePacket_VLANTaggedMPLS(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	ip := gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoUDP, gen.GenerateUDPDatagram(4000, 4001, nil))
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeVLAN, concat(
+		gen.GenerateVLANTag(0, 10, capture.EtherTypeMPLSUnicast),
+		gen.GenerateMPLSLabel(100, 0, true, 255),
+		ip,
+	))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.Len(t, packet.VLANs, 1)
+	require.Len(t, packet.MPLS, 1)
+	require.NotNil(t, packet.IPv6)
+	require.NotNil(t, packet.UDP)
+}
+
+func TestParsePacket_TruncatedVLANTag(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeVLAN, []byte{0x00, 0x64})
+
+	packet, err := capture.ParsePacket(frame)
+	requireDecodeError(t, err, capture.LayerVLAN, capture.DecodeTruncated)
+
+	assert.Empty(t, packet.VLANs)
+	assert.Nil(t, packet.IPv4)
+}
+
+func TestParsePacket_EthernetPaddingNotPayload(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	tcp := gen.GenerateTCPSegment(1000, 80, 0x18, []byte("hi"))
+	ip := gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, tcp)
+	// Padded to the 60-byte Ethernet minimum.
+	frame := concat(gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, ip), make([]byte, 4))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.TCP)
+	assert.Equal(t, []byte("hi"), packet.Payload)
+}
+
+func TestParsePacket_IPv6PaddingNotPayload(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	ip := gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoUDP, gen.GenerateUDPDatagram(1, 2, []byte("x")))
+	frame := concat(gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6, ip), make([]byte, 6))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("x"), packet.Payload)
+}
@@ -0,0 +1,364 @@
+package capture
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFragmentTime = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// udpDatagram returns a checksummed IPv4 UDP datagram's UDP segment.
+func udpDatagram(gen *mocks.PacketGenerator, payload []byte) []byte {
+	ip := gen.FinalizeChecksums(gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP,
+		gen.GenerateUDPDatagram(5353, 53, payload)))
+	return ip[capture.IPv4HeaderMinSize:]
+}
+
+// ipv4Fragments splits segment into Ethernet frames of IPv4 fragments
+// carrying size bytes each.
+func ipv4Fragments(gen *mocks.PacketGenerator, id uint16, segment []byte, size int) [][]byte {
+	return framed(ipv4FragmentPackets(gen, id, segment, size), func(ip []byte) []byte {
+		return gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, ip)
+	})
+}
+
+func ipv4FragmentPackets(gen *mocks.PacketGenerator, id uint16, segment []byte, size int) [][]byte {
+	var packets [][]byte
+	for offset := 0; offset < len(segment); offset += size {
+		end := min(offset+size, len(segment))
+		packets = append(packets, gen.GenerateIPv4Fragment(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, id,
+			uint16(offset/8), end < len(segment), segment[offset:end]))
+	}
+	return packets
+}
+
+func framed(packets [][]byte, frame func([]byte) []byte) [][]byte {
+	frames := make([][]byte, len(packets))
+	for i, packet := range packets {
+		frames[i] = frame(packet)
+	}
+	return frames
+}
+
+// vlanFrame tags an IPv4 packet with vlan.
+func vlanFrame(gen *mocks.PacketGenerator, vlan uint16, ip []byte) []byte {
+	return gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeVLAN,
+		append(gen.GenerateVLANTag(0, vlan, capture.EtherTypeIPv4), ip...))
+}
+
+// reassemble decodes each frame and feeds it to reassembler, returning the
+// reassembled packet if one completed.
+func reassemble(t *testing.T, reassembler *capture.Reassembler, timestamp time.Time, frames ...[]byte) *capture.ParsedPacket {
+	t.Helper()
+	decoder := capture.NewDecoder(capture.DefaultParseOptions())
+	var packet capture.ParsedPacket
+	var out *capture.ParsedPacket
+	for _, frame := range frames {
+		require.NoError(t, decoder.Decode(frame, &packet))
+		require.True(t, packet.Innermost().IsFragment())
+		whole := &capture.ParsedPacket{}
+		if reassembler.Reassemble(&packet, timestamp, whole) {
+			out = whole
+		}
+	}
+	return out
+}
+
+func TestParsePacket_IPv4Fragments(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frames := ipv4Fragments(gen, 0x4242, udpDatagram(gen, bytes.Repeat([]byte("d"), 100)), 48)
+
+	first, err := capture.ParsePacket(frames[0])
+	require.NoError(t, err)
+	assert.True(t, first.IsFragment())
+	require.NotNil(t, first.UDP, "the first fragment carries the UDP header")
+	assert.Equal(t, uint16(53), first.UDP.DstPort)
+
+	later, err := capture.ParsePacket(frames[1])
+	require.NoError(t, err)
+	assert.True(t, later.IsFragment())
+	assert.Equal(t, uint16(6), later.IPv4.FragOffset)
+	assert.Nil(t, later.UDP)
+	assert.Len(t, later.Payload, 48)
+}
+
+func TestReassembler_IPv4OutOfOrder(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	data := bytes.Repeat([]byte("0123456789"), 30)
+	frames := ipv4Fragments(gen, 0x4242, udpDatagram(gen, data), 128)
+	require.Len(t, frames, 3)
+
+	reassembler := capture.NewReassembler(capture.DefaultReassemblyConfig())
+	decoder := capture.NewDecoder(capture.ParseOptions{MaxTunnelDepth: 4, VerifyChecksums: true})
+	var packet, whole capture.ParsedPacket
+
+	for i, index := range []int{2, 0, 1} {
+		require.NoError(t, decoder.Decode(frames[index], &packet))
+		complete := reassembler.Reassemble(&packet, testFragmentTime, &whole)
+		assert.Equal(t, i == 2, complete)
+	}
+
+	assert.False(t, whole.IsFragment())
+	require.NotNil(t, whole.Ethernet)
+	assert.Equal(t, capture.MACAddr(testSrcMAC), whole.Ethernet.SrcMAC)
+	require.NotNil(t, whole.IPv4)
+	assert.Equal(t, uint16(20+8+300), whole.IPv4.Length)
+	assert.Equal(t, uint16(0), whole.IPv4.FragOffset)
+	assert.Equal(t, uint8(0), whole.IPv4.Flags)
+	require.NotNil(t, whole.UDP)
+	assert.Equal(t, uint16(5353), whole.UDP.SrcPort)
+	assert.Equal(t, data, whole.Payload)
+	assert.Equal(t, capture.ChecksumValid, whole.Checksums.IPv4)
+	assert.Equal(t, capture.ChecksumValid, whole.Checksums.UDP)
+
+	stats := reassembler.GetStatistics()
+	assert.Equal(t, uint64(3), stats.Fragments)
+	assert.Equal(t, uint64(1), stats.Reassembled)
+	assert.Equal(t, 0, stats.Pending)
+	assert.Equal(t, 0, stats.MemoryBytes)
+}
+
+func TestReassembler_ResultOutlivesFrames(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	data := bytes.Repeat([]byte("x"), 64)
+	frames := ipv4Fragments(gen, 1, udpDatagram(gen, data), 40)
+
+	whole := reassemble(t, capture.NewReassembler(capture.DefaultReassemblyConfig()), testFragmentTime, frames...)
+	require.NotNil(t, whole)
+
+	for _, frame := range frames {
+		for i := range frame {
+			frame[i] = 0
+		}
+	}
+	assert.Equal(t, data, whole.Payload)
+}
+
+func TestReassembler_KeepsVLAN(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	data := bytes.Repeat([]byte("v"), 100)
+	packets := ipv4FragmentPackets(gen, 7, udpDatagram(gen, data), 64)
+	require.Len(t, packets, 2)
+
+	// The same datagram ID in another VLAN is another datagram.
+	other := ipv4FragmentPackets(gen, 7, udpDatagram(gen, bytes.Repeat([]byte("w"), 100)), 64)
+	reassembler := capture.NewReassembler(capture.DefaultReassemblyConfig())
+	assert.Nil(t, reassemble(t, reassembler, testFragmentTime, vlanFrame(gen, 200, other[0])))
+
+	whole := reassemble(t, reassembler, testFragmentTime, vlanFrame(gen, 100, packets[0]), vlanFrame(gen, 100, packets[1]))
+	require.NotNil(t, whole)
+	require.Len(t, whole.VLANs, 1)
+	assert.Equal(t, uint16(100), whole.VLANs[0].VLANID)
+	require.NotNil(t, whole.UDP)
+	assert.Equal(t, data, whole.Payload)
+	assert.Equal(t, uint64(0), reassembler.GetStatistics().Overlaps)
+}
+
+func TestReassembler_KeepsTunnel(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	data := bytes.Repeat([]byte("t"), 100)
+	frames := framed(ipv4FragmentPackets(gen, 9, udpDatagram(gen, data), 64), func(ip []byte) []byte {
+		inner := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4, ip)
+		return vlanFrame(gen, 100, gen.GenerateIPv4Packet(testInnerSrcIPv4, testInnerDstIPv4, capture.IPProtoUDP,
+			gen.GenerateUDPDatagram(49152, capture.VXLANPort, gen.GenerateVXLANHeader(5001, inner))))
+	})
+
+	whole := reassemble(t, capture.NewReassembler(capture.DefaultReassemblyConfig()), testFragmentTime, frames...)
+	require.NotNil(t, whole)
+	require.Len(t, whole.VLANs, 1)
+	assert.Equal(t, uint16(100), whole.VLANs[0].VLANID)
+	require.NotNil(t, whole.IPv4)
+	assert.Equal(t, netip.AddrFrom4([4]byte(testInnerSrcIPv4)), whole.IPv4.SrcIP)
+	require.NotNil(t, whole.Tunnel)
+	assert.Equal(t, uint32(5001), whole.Tunnel.ID)
+	assert.Nil(t, whole.Payload)
+
+	require.NotNil(t, whole.Inner)
+	inner := whole.Inner
+	assert.Same(t, inner, whole.Innermost())
+	assert.False(t, inner.IsFragment())
+	require.NotNil(t, inner.Ethernet)
+	require.NotNil(t, inner.UDP)
+	assert.Equal(t, uint16(53), inner.UDP.DstPort)
+	assert.Equal(t, data, inner.Payload)
+}
+
+func TestReassembler_IPv6(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	data := bytes.Repeat([]byte("v6"), 60)
+	segment := gen.GenerateUDPDatagram(5353, 53, data)
+	hopByHop := gen.GenerateIPv6ExtensionHeader(capture.IPv6ExtFragment, nil)
+
+	var frames [][]byte
+	for offset := 0; offset < len(segment); offset += 64 {
+		end := min(offset+64, len(segment))
+		fragment := gen.GenerateIPv6FragmentHeader(capture.IPProtoUDP, uint16(offset/8), end < len(segment), 0xabcdef01)
+		ip := gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPv6ExtHopByHop, concat(hopByHop, fragment, segment[offset:end]))
+		frames = append(frames, gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6, ip))
+	}
+	require.Len(t, frames, 2)
+
+	later, err := capture.ParsePacket(frames[1])
+	require.NoError(t, err)
+	assert.True(t, later.IsFragment())
+	assert.Nil(t, later.UDP)
+	assert.Len(t, later.Payload, len(segment)-64)
+
+	whole := reassemble(t, capture.NewReassembler(capture.DefaultReassemblyConfig()), testFragmentTime, frames[1], frames[0])
+	require.NotNil(t, whole)
+
+	require.NotNil(t, whole.IPv6)
+	assert.Nil(t, whole.IPv6.Fragment)
+	assert.False(t, whole.Has(capture.LayerIPv6Fragment))
+	assert.Equal(t, uint16(8+len(segment)), whole.IPv6.PayloadLen)
+	require.Len(t, whole.IPv6.ExtensionHeaders, 1)
+	assert.Equal(t, uint8(capture.IPv6ExtHopByHop), whole.IPv6.ExtensionHeaders[0].Type)
+	require.NotNil(t, whole.UDP)
+	assert.Equal(t, uint16(53), whole.UDP.DstPort)
+	assert.Equal(t, data, whole.Payload)
+}
+
+func TestReassembler_DuplicateFragmentIgnored(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frames := ipv4Fragments(gen, 7, udpDatagram(gen, make([]byte, 80)), 48)
+	reassembler := capture.NewReassembler(capture.DefaultReassemblyConfig())
+
+	whole := reassemble(t, reassembler, testFragmentTime, frames[0], frames[0], frames[1])
+
+	require.NotNil(t, whole)
+	assert.Equal(t, uint64(1), reassembler.GetStatistics().Duplicates)
+}
+
+func TestReassembler_OverlapDropsDatagram(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	segment := udpDatagram(gen, make([]byte, 80))
+	frames := ipv4Fragments(gen, 7, segment, 48)
+
+	// Rewrites bytes 40..56 of the datagram with different data, the way
+	// overlap evasion hides a payload from one reassembly policy.
+	forged := append([]byte(nil), segment[40:56]...)
+	forged[0] ^= 0xff
+	overlap := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Fragment(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, 7, 5, true, forged))
+
+	reassembler := capture.NewReassembler(capture.DefaultReassemblyConfig())
+	whole := reassemble(t, reassembler, testFragmentTime, frames[0], overlap, frames[1])
+
+	assert.Nil(t, whole)
+	stats := reassembler.GetStatistics()
+	assert.Equal(t, uint64(1), stats.Overlaps)
+	assert.Equal(t, uint64(0), stats.Reassembled)
+	assert.Equal(t, 1, stats.Pending, "the fragment after the overlap starts over")
+}
+
+func TestReassembler_ConflictingLastFragment(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frames := ipv4Fragments(gen, 9, udpDatagram(gen, make([]byte, 200)), 64)
+	shortEnd := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Fragment(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, 9, 2, false, make([]byte, 8)))
+
+	reassembler := capture.NewReassembler(capture.DefaultReassemblyConfig())
+	whole := reassemble(t, reassembler, testFragmentTime, frames[len(frames)-1], shortEnd)
+
+	assert.Nil(t, whole)
+	assert.Equal(t, uint64(1), reassembler.GetStatistics().Overlaps)
+}
+
+func TestReassembler_Timeout(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frames := ipv4Fragments(gen, 3, udpDatagram(gen, make([]byte, 80)), 48)
+	reassembler := capture.NewReassembler(capture.ReassemblyConfig{Timeout: 10 * time.Second})
+
+	assert.Nil(t, reassemble(t, reassembler, testFragmentTime, frames[0]))
+	assert.Nil(t, reassemble(t, reassembler, testFragmentTime.Add(11*time.Second), frames[1]))
+
+	stats := reassembler.GetStatistics()
+	assert.Equal(t, uint64(1), stats.Timeouts)
+	assert.Equal(t, 1, stats.Pending)
+
+	assert.Equal(t, 1, reassembler.Expire(testFragmentTime.Add(time.Minute)))
+	assert.Equal(t, 0, reassembler.GetStatistics().Pending)
+}
+
+func TestReassembler_MemoryLimitEvictsOldest(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	reassembler := capture.NewReassembler(capture.ReassemblyConfig{MaxMemory: 100})
+
+	for id := uint16(1); id <= 3; id++ {
+		frames := ipv4Fragments(gen, id, udpDatagram(gen, make([]byte, 80)), 48)
+		assert.Nil(t, reassemble(t, reassembler, testFragmentTime, frames[0]))
+	}
+
+	stats := reassembler.GetStatistics()
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, 2, stats.Pending)
+	assert.Equal(t, 96, stats.MemoryBytes)
+
+	// The first datagram was evicted, so its last fragment cannot complete it.
+	frames := ipv4Fragments(gen, 1, udpDatagram(gen, make([]byte, 80)), 48)
+	assert.Nil(t, reassemble(t, reassembler, testFragmentTime, frames[1]))
+	frames = ipv4Fragments(gen, 3, udpDatagram(gen, make([]byte, 80)), 48)
+	assert.NotNil(t, reassemble(t, reassembler, testFragmentTime, frames[1]))
+}
+
+func TestReassembler_MaxDatagrams(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	reassembler := capture.NewReassembler(capture.ReassemblyConfig{MaxDatagrams: 2})
+
+	for id := uint16(1); id <= 5; id++ {
+		frames := ipv4Fragments(gen, id, udpDatagram(gen, make([]byte, 80)), 48)
+		reassemble(t, reassembler, testFragmentTime, frames[0])
+	}
+
+	stats := reassembler.GetStatistics()
+	assert.Equal(t, 2, stats.Pending)
+	assert.Equal(t, uint64(3), stats.Evictions)
+}
+
+func TestReassembler_OversizedDatagram(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frames := ipv4Fragments(gen, 5, udpDatagram(gen, make([]byte, 80)), 48)
+	// Ends at 65528 + 24 + 20 bytes of header, past the 65535-byte limit.
+	tail := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Fragment(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, 5, 8191, false, make([]byte, 24)))
+
+	reassembler := capture.NewReassembler(capture.DefaultReassemblyConfig())
+	assert.Nil(t, reassemble(t, reassembler, testFragmentTime, frames[0], tail))
+
+	stats := reassembler.GetStatistics()
+	assert.Equal(t, uint64(1), stats.Oversized)
+	assert.Equal(t, 0, stats.Pending)
+}
+
+func TestReassembler_MalformedFragments(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frames := ipv4Fragments(gen, 11, udpDatagram(gen, make([]byte, 80)), 48)
+	truncated := frames[0][:len(frames[0])-10]
+	unaligned := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Fragment(testSrcIPv4, testDstIPv4, capture.IPProtoUDP, 12, 0, true, make([]byte, 30)))
+
+	reassembler := capture.NewReassembler(capture.DefaultReassemblyConfig())
+	assert.Nil(t, reassemble(t, reassembler, testFragmentTime, truncated, unaligned))
+
+	stats := reassembler.GetStatistics()
+	assert.Equal(t, uint64(2), stats.Malformed)
+	assert.Equal(t, 0, stats.Pending)
+}
+
+func TestReassembler_IgnoresWholePackets(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	packet, err := capture.ParsePacket(ipv4TCPFrame(gen))
+	require.NoError(t, err)
+
+	reassembler := capture.NewReassembler(capture.DefaultReassemblyConfig())
+	assert.False(t, packet.IsFragment())
+	assert.False(t, reassembler.Reassemble(packet, testFragmentTime, &capture.ParsedPacket{}))
+	assert.Equal(t, uint64(0), reassembler.GetStatistics().Fragments)
+}
@@ -3,7 +3,6 @@
 package capture
 
 import (
-	"log/slog"
 	"os"
 	"syscall"
 	"testing"
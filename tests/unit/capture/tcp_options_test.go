@@ -0,0 +1,97 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseTCPWithOptions(t *testing.T, options []byte, payload []byte) *capture.ParsedPacket {
+	t.Helper()
+	gen := mocks.NewPacketGenerator()
+	tcp := gen.GenerateTCPSegmentWithOptions(51000, 443, 0x02, options, payload)
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoTCP, tcp))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+	require.NotNil(t, packet.TCP)
+	return packet
+}
+
+func TestParsePacket_TCPSynOptions(t *testing.T) {
+	// Typical Linux SYN: MSS, SACK permitted, timestamps, NOP, window scale
+	options := []byte{
+		2, 4, 0x05, 0xb4,
+		4, 2,
+		8, 10, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00,
+		1,
+		3, 3, 7,
+	}
+	packet := parseTCPWithOptions(t, options, []byte("data"))
+	opts := packet.TCP.Options
+
+	assert.True(t, opts.HasMSS)
+	assert.Equal(t, uint16(1460), opts.MSS)
+	assert.True(t, opts.SACKPermitted)
+	assert.True(t, opts.HasTimestamps)
+	assert.Equal(t, uint32(4096), opts.TSVal)
+	assert.Equal(t, uint32(0), opts.TSEcr)
+	assert.True(t, opts.HasWindowScale)
+	assert.Equal(t, uint8(7), opts.WindowScale)
+	assert.Equal(t, []uint8{2, 4, 8, 1, 3}, opts.Kinds)
+	assert.False(t, opts.Malformed)
+	assert.Equal(t, uint8(10), packet.TCP.DataOffset)
+	assert.Equal(t, []byte("data"), packet.Payload)
+}
+
+func TestParsePacket_TCPSACKBlocks(t *testing.T) {
+	options := []byte{
+		1, 1,
+		5, 18,
+		0x00, 0x00, 0x03, 0xe8, 0x00, 0x00, 0x07, 0xd0,
+		0x00, 0x00, 0x0b, 0xb8, 0x00, 0x00, 0x0f, 0xa0,
+	}
+	packet := parseTCPWithOptions(t, options, nil)
+
+	assert.Equal(t, []capture.TCPSACKBlock{
+		{Left: 1000, Right: 2000},
+		{Left: 3000, Right: 4000},
+	}, packet.TCP.Options.SACKBlocks)
+}
+
+func TestParsePacket_TCPUnknownOption(t *testing.T) {
+	options := []byte{
+		30, 4, 0xab, 0xcd, // MPTCP
+		2, 4, 0x02, 0x18,
+	}
+	packet := parseTCPWithOptions(t, options, nil)
+	opts := packet.TCP.Options
+
+	require.Len(t, opts.Unknown, 1)
+	assert.Equal(t, uint8(30), opts.Unknown[0].Kind)
+	assert.Equal(t, []byte{0xab, 0xcd}, opts.Unknown[0].Data)
+	assert.Equal(t, uint16(536), opts.MSS)
+}
+
+func TestParsePacket_TCPMalformedOptions(t *testing.T) {
+	options := []byte{
+		2, 4, 0x05, 0xb4,
+		8, 40, 0x00, 0x00, // timestamp length runs past the header
+	}
+	packet := parseTCPWithOptions(t, options, nil)
+	opts := packet.TCP.Options
+
+	assert.True(t, opts.Malformed)
+	assert.Equal(t, uint16(1460), opts.MSS, "options before the bad one are kept")
+	assert.False(t, opts.HasTimestamps)
+}
+
+func TestParsePacket_TCPWithoutOptions(t *testing.T) {
+	packet := parseTCPWithOptions(t, nil, nil)
+
+	assert.Equal(t, capture.TCPOptions{}, packet.TCP.Options)
+}
@@ -0,0 +1,278 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testInnerSrcIPv4 = []byte{172, 16, 0, 1}
+	testInnerDstIPv4 = []byte{172, 16, 0, 2}
+)
+
+// innerFrame builds the Ethernet/IPv4/TCP frame carried inside the tunnels.
+func innerFrame(gen *mocks.PacketGenerator) []byte {
+	return gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testInnerSrcIPv4, testInnerDstIPv4, capture.IPProtoTCP,
+			gen.GenerateTCPSegment(1234, 80, 0x18, []byte("inner"))))
+}
+
+func vxlanFrame(gen *mocks.PacketGenerator, vni uint32, inner []byte) []byte {
+	return gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP,
+			gen.GenerateUDPDatagram(49152, capture.VXLANPort, gen.GenerateVXLANHeader(vni, inner))))
+}
+
+func TestParsePacket_VXLAN(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+
+	encapsulated := innerFrame(gen)
+	packet, err := capture.ParsePacket(vxlanFrame(gen, 5001, encapsulated))
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.UDP)
+	require.NotNil(t, packet.Tunnel)
+	assert.Equal(t, capture.TunnelVXLAN, packet.Tunnel.Type)
+	assert.Equal(t, uint32(5001), packet.Tunnel.ID)
+	assert.True(t, packet.Tunnel.HasID)
+	assert.Equal(t, encapsulated, packet.Payload)
+
+	inner := packet.Inner
+	require.NotNil(t, inner)
+	require.NotNil(t, inner.Ethernet)
+	require.NotNil(t, inner.IPv4)
+	assert.Equal(t, "172.16.0.1", inner.IPv4.SrcIP.String())
+	require.NotNil(t, inner.TCP)
+	assert.Equal(t, uint16(80), inner.TCP.DstPort)
+	assert.Equal(t, []byte("inner"), inner.Payload)
+	assert.Same(t, inner, packet.Innermost())
+	assert.Len(t, packet.Tunnels(), 1)
+}
+
+func TestParsePacket_VXLANWithoutIFlagIsNotDecapsulated(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	vxlan := gen.GenerateVXLANHeader(5001, innerFrame(gen))
+	vxlan[0] = 0
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP,
+			gen.GenerateUDPDatagram(49152, capture.VXLANPort, vxlan)))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	assert.Nil(t, packet.Tunnel)
+	assert.Nil(t, packet.Inner)
+	assert.Equal(t, vxlan, packet.Payload)
+}
+
+func TestParsePacket_GENEVEWithOptions(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	options := []byte{0x01, 0x02, 0x80, 0x01, 0xde, 0xad, 0xbe, 0xef}
+	geneve := gen.GenerateGENEVEHeader(0xABCDE, capture.EtherTypeTransparentBridging, options, innerFrame(gen))
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv6,
+		gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoUDP,
+			gen.GenerateUDPDatagram(49152, capture.GENEVEPort, geneve)))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.Tunnel)
+	assert.Equal(t, capture.TunnelGENEVE, packet.Tunnel.Type)
+	assert.Equal(t, uint32(0xABCDE), packet.Tunnel.ID)
+	assert.Equal(t, 8, packet.Tunnel.OptionsLength)
+	assert.Equal(t, 16, packet.Tunnel.HeaderLength)
+	require.NotNil(t, packet.Inner)
+	require.NotNil(t, packet.Inner.TCP)
+	assert.Equal(t, []byte("inner"), packet.Inner.Payload)
+}
+
+func TestParsePacket_GREWithKey(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	innerIP := gen.GenerateIPv4Packet(testInnerSrcIPv4, testInnerDstIPv4, capture.IPProtoUDP,
+		gen.GenerateUDPDatagram(5353, 53, []byte("query")))
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoGRE,
+			gen.GenerateGREHeader(capture.EtherTypeIPv4, 42, innerIP)))
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.Tunnel)
+	assert.Equal(t, capture.TunnelGRE, packet.Tunnel.Type)
+	assert.Equal(t, uint32(42), packet.Tunnel.ID)
+	assert.Equal(t, uint16(capture.EtherTypeIPv4), packet.Tunnel.Protocol)
+	assert.Equal(t, 8, packet.Tunnel.HeaderLength)
+
+	require.NotNil(t, packet.Inner)
+	assert.Nil(t, packet.Inner.Ethernet)
+	require.NotNil(t, packet.Inner.UDP)
+	assert.Equal(t, uint16(53), packet.Inner.UDP.DstPort)
+	assert.Equal(t, []byte("query"), packet.Inner.Payload)
+}
+
+func TestParsePacket_ERSPAN(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+
+	tests := []struct {
+		name     string
+		protocol uint16
+		header   []byte
+		version  uint8
+	}{
+		{
+			name:     "type II",
+			protocol: capture.EtherTypeERSPANTypeII,
+			// Ver=1, VLAN=100, session=7
+			header:  []byte{0x10, 0x64, 0x00, 0x07, 0, 0, 0, 0},
+			version: 1,
+		},
+		{
+			name:     "type III",
+			protocol: capture.EtherTypeERSPANTypeIII,
+			// Ver=2, VLAN=100, session=7, no platform subheader
+			header:  []byte{0x20, 0x64, 0x00, 0x07, 0, 0, 0, 0, 0, 0, 0, 0},
+			version: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gre := gen.GenerateGREHeader(tt.protocol, -1, append(append([]byte(nil), tt.header...), innerFrame(gen)...))
+			gre[0] |= 0x10 // S bit, always set for type II and III
+			gre = append(gre[:4], append([]byte{0, 0, 0, 1}, gre[4:]...)...)
+			frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+				gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoGRE, gre))
+
+			packet, err := capture.ParsePacket(frame)
+			require.NoError(t, err)
+
+			require.NotNil(t, packet.Tunnel)
+			assert.Equal(t, capture.TunnelERSPAN, packet.Tunnel.Type)
+			assert.Equal(t, tt.version, packet.Tunnel.ERSPANVersion)
+			assert.Equal(t, uint16(100), packet.Tunnel.ERSPANVLAN)
+			assert.Equal(t, uint32(7), packet.Tunnel.ID)
+			assert.True(t, packet.Tunnel.HasSequence)
+			assert.Equal(t, uint32(1), packet.Tunnel.GRESequence)
+
+			require.NotNil(t, packet.Inner)
+			require.NotNil(t, packet.Inner.TCP)
+			assert.Equal(t, []byte("inner"), packet.Inner.Payload)
+		})
+	}
+}
+
+func TestParsePacket_IPInIP(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+
+	tests := []struct {
+		name       string
+		outer      func(payload []byte) []byte
+		outerType  uint16
+		protocol   uint8
+		inner      []byte
+		tunnelType capture.TunnelType
+	}{
+		{
+			name: "ipip",
+			outer: func(payload []byte) []byte {
+				return gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoIPIP, payload)
+			},
+			outerType:  capture.EtherTypeIPv4,
+			inner:      gen.GenerateIPv4Packet(testInnerSrcIPv4, testInnerDstIPv4, capture.IPProtoTCP, gen.GenerateTCPSegment(1234, 80, 0x02, nil)),
+			tunnelType: capture.TunnelIPv4InIPv4,
+		},
+		{
+			name: "6in4",
+			outer: func(payload []byte) []byte {
+				return gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoIPv6, payload)
+			},
+			outerType:  capture.EtherTypeIPv4,
+			inner:      gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoTCP, gen.GenerateTCPSegment(1234, 80, 0x02, nil)),
+			tunnelType: capture.TunnelIPv6InIPv4,
+		},
+		{
+			name: "4in6",
+			outer: func(payload []byte) []byte {
+				return gen.GenerateIPv6Packet(testSrcIPv6, testDstIPv6, capture.IPProtoIPIP, payload)
+			},
+			outerType:  capture.EtherTypeIPv6,
+			inner:      gen.GenerateIPv4Packet(testInnerSrcIPv4, testInnerDstIPv4, capture.IPProtoTCP, gen.GenerateTCPSegment(1234, 80, 0x02, nil)),
+			tunnelType: capture.TunnelIPv4InIPv6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, tt.outerType, tt.outer(tt.inner))
+
+			packet, err := capture.ParsePacket(frame)
+			require.NoError(t, err)
+
+			require.NotNil(t, packet.Tunnel)
+			assert.Equal(t, tt.tunnelType, packet.Tunnel.Type)
+			assert.Nil(t, packet.TCP)
+			require.NotNil(t, packet.Inner)
+			require.NotNil(t, packet.Inner.TCP)
+			assert.Equal(t, uint16(80), packet.Inner.TCP.DstPort)
+		})
+	}
+}
+
+func TestParsePacketWithOptions_MaxTunnelDepth(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	nested := vxlanFrame(gen, 1, vxlanFrame(gen, 2, innerFrame(gen)))
+
+	packet, err := capture.ParsePacket(nested)
+	require.NoError(t, err)
+	tunnels := packet.Tunnels()
+	require.Len(t, tunnels, 2)
+	assert.Equal(t, uint32(1), tunnels[0].ID)
+	assert.Equal(t, uint32(2), tunnels[1].ID)
+	require.NotNil(t, packet.Innermost().TCP)
+	assert.Equal(t, []byte("inner"), packet.Innermost().Payload)
+
+	packet, err = capture.ParsePacketWithOptions(nested, capture.ParseOptions{MaxTunnelDepth: 1})
+	require.NoError(t, err)
+	assert.Len(t, packet.Tunnels(), 1)
+	require.NotNil(t, packet.Inner)
+	require.NotNil(t, packet.Inner.UDP)
+	assert.Nil(t, packet.Inner.Inner)
+	assert.NotEmpty(t, packet.Inner.Payload)
+
+	packet, err = capture.ParsePacketWithOptions(nested, capture.ParseOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, packet.Tunnel)
+	assert.Nil(t, packet.Inner)
+}
+
+func TestParsePacket_TruncatedTunnelKeepsOuterHeaders(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frame := gen.GenerateEthernetFrame(testSrcMAC, testDstMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(testSrcIPv4, testDstIPv4, capture.IPProtoUDP,
+			gen.GenerateUDPDatagram(49152, capture.GENEVEPort, []byte{0x02, 0, 0x65, 0x58, 0, 0, 1, 0})))
+
+	packet, err := capture.ParsePacket(frame)
+	requireDecodeError(t, err, capture.LayerTunnel, capture.DecodeTruncated)
+
+	require.NotNil(t, packet.UDP)
+	assert.Nil(t, packet.Tunnel)
+	assert.Nil(t, packet.Inner)
+}
+
+func TestParsePacket_InnerDecodeErrorStaysInner(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	frame := vxlanFrame(gen, 7, innerFrame(gen)[:30])
+
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+
+	require.NotNil(t, packet.Inner)
+	require.NotNil(t, packet.Inner.Err)
+	assert.Equal(t, capture.LayerIPv4, packet.Inner.Err.Layer)
+	assert.Equal(t, capture.DecodeTruncated, packet.Inner.Err.Reason)
+	assert.NotNil(t, packet.Inner.Ethernet)
+}
@@ -0,0 +1,202 @@
+package classify
+
+import (
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/classify"
+	"github.com/Karias-sys/Traffic_Monitor/internal/config"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	clientIP = netip.MustParseAddr("192.168.1.10")
+	serverIP = netip.MustParseAddr("10.0.0.1")
+)
+
+func createTestLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+}
+
+// newClassifier returns a classifier that does not read the host's
+// services file.
+func newClassifier(t *testing.T, rules ...classify.Rule) *classify.Classifier {
+	return classify.NewClassifierWithConfig(createTestLogger(), classify.ClassifierConfig{
+		ServicesFile: filepath.Join(t.TempDir(), "services"),
+		Rules:        rules,
+	})
+}
+
+func tcpFlow(serverPort uint16, client, server []byte) *classify.Flow {
+	return &classify.Flow{
+		Transport:     capture.IPProtoTCP,
+		ClientIP:      clientIP,
+		ServerIP:      serverIP,
+		ClientPort:    49152,
+		ServerPort:    serverPort,
+		ClientPayload: client,
+		ServerPayload: server,
+	}
+}
+
+func TestClassifier_PayloadSignatures(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	clientHello := gen.GenerateTLSHandshakeRecord(1, gen.GenerateTLSClientHello(0x0303, []uint16{0x1301}))
+
+	tests := []struct {
+		name       string
+		flow       *classify.Flow
+		app        string
+		confidence classify.Confidence
+	}{
+		{"SSH banner on any port", tcpFlow(2222, []byte("SSH-2.0-OpenSSH_9.6\r\n"), nil), classify.AppSSH, classify.ConfidenceHigh},
+		{"SSH server banner", tcpFlow(2222, nil, []byte("SSH-2.0-dropbear\r\n")), classify.AppSSH, classify.ConfidenceHigh},
+		{"HTTP request", tcpFlow(8000, []byte("GET /index.html HTTP/1.1\r\nHost: a\r\n\r\n"), nil), classify.AppHTTP, classify.ConfidenceHigh},
+		{"HTTP response", tcpFlow(8000, nil, []byte("HTTP/1.1 200 OK\r\n")), classify.AppHTTP, classify.ConfidenceHigh},
+		{"HTTP/2 preface", tcpFlow(8000, []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"), nil), classify.AppHTTP2, classify.ConfidenceHigh},
+		{"TLS off its port", tcpFlow(4433, clientHello, nil), classify.AppTLS, classify.ConfidenceHigh},
+		{"TLS on HTTPS port", tcpFlow(443, clientHello, nil), classify.AppHTTPS, classify.ConfidenceHigh},
+		{"SMB2", tcpFlow(445, []byte("\x00\x00\x00\x40\xfeSMB\x40\x00"), nil), classify.AppSMB, classify.ConfidenceHigh},
+		{"PostgreSQL SSLRequest", tcpFlow(6432, []byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}, nil), classify.AppPostgreSQL, classify.ConfidenceHigh},
+		{"PostgreSQL startup", tcpFlow(5432, []byte{0, 0, 0, 9, 0, 3, 0, 0, 0}, nil), classify.AppPostgreSQL, classify.ConfidenceHigh},
+		{"Redis off its port", tcpFlow(7000, []byte("*1\r\n$4\r\nPING\r\n"), nil), classify.AppRedis, classify.ConfidenceMedium},
+		{"Redis on its port", tcpFlow(6379, []byte("*1\r\n$4\r\nPING\r\n"), nil), classify.AppRedis, classify.ConfidenceHigh},
+		{"MySQL greeting", tcpFlow(3307, nil, []byte("\x0a\x00\x00\x00\x0a8.0.36\x00\x01\x02")), classify.AppMySQL, classify.ConfidenceMedium},
+		{"SMTP greeting", tcpFlow(2525, nil, []byte("220 mail.example.com ESMTP Postfix\r\n")), classify.AppSMTP, classify.ConfidenceHigh},
+		{"RDP", tcpFlow(13389, []byte{0x03, 0x00, 0x00, 0x13, 0x0e, 0xe0, 0, 0}, nil), classify.AppRDP, classify.ConfidenceHigh},
+		{"MQTT", tcpFlow(18830, []byte("\x10\x10\x00\x04MQTT\x04\x02\x00\x3c"), nil), classify.AppMQTT, classify.ConfidenceHigh},
+	}
+
+	classifier := newClassifier(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := classifier.Classify(tt.flow)
+			assert.Equal(t, tt.app, result.App)
+			assert.Equal(t, tt.confidence, result.Confidence)
+			assert.Equal(t, classify.MethodPayload, result.Method)
+		})
+	}
+}
+
+func TestClassifier_UDPSignatures(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	classifier := newClassifier(t)
+
+	quic := gen.GenerateQUICLongHeader(0x00000001, 0, []byte{1, 2, 3, 4}, nil, make([]byte, 16))
+	result := classifier.Classify(&classify.Flow{Transport: capture.IPProtoUDP, ServerPort: 8443, ClientPayload: quic})
+	assert.Equal(t, classify.Result{App: classify.AppQUIC, Confidence: classify.ConfidenceMedium, Method: classify.MethodPayload}, result)
+
+	stun := append([]byte{0x00, 0x01, 0x00, 0x00, 0x21, 0x12, 0xa4, 0x42}, make([]byte, 12)...)
+	result = classifier.Classify(&classify.Flow{Transport: capture.IPProtoUDP, ServerPort: 19302, ClientPayload: stun})
+	assert.Equal(t, classify.AppSTUN, result.App)
+
+	// TCP-only signatures do not apply to UDP.
+	result = classifier.Classify(&classify.Flow{Transport: capture.IPProtoUDP, ServerPort: 40000, ClientPayload: []byte("SSH-2.0-x")})
+	assert.Equal(t, classify.Result{}, result)
+}
+
+func TestClassifier_Ports(t *testing.T) {
+	classifier := newClassifier(t)
+
+	result := classifier.Classify(tcpFlow(22, nil, nil))
+	assert.Equal(t, classify.Result{App: classify.AppSSH, Confidence: classify.ConfidenceLow, Method: classify.MethodPort}, result)
+
+	// The client port is tried when the server port is unknown, in case
+	// the flow's direction was guessed wrong.
+	flow := tcpFlow(49153, nil, nil)
+	flow.ClientPort = 5432
+	assert.Equal(t, classify.AppPostgreSQL, classifier.Classify(flow).App)
+
+	assert.Equal(t, classify.AppQUIC, classifier.Classify(&classify.Flow{Transport: capture.IPProtoUDP, ServerPort: 443}).App)
+	assert.Equal(t, classify.Result{}, classifier.Classify(tcpFlow(40000, nil, []byte{0xde, 0xad})))
+}
+
+func TestClassifier_ServicesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "services")
+	require.NoError(t, os.WriteFile(path, []byte(`# Network services
+ssh		22/tcp				# SSH Remote Login Protocol
+gopher		70/tcp
+kerberos	88/tcp		kerberos5 krb5	# Kerberos v5
+kerberos	88/udp
+sieve		4190/tcp
+bogus		notaport/tcp
+`), 0o644))
+
+	classifier := classify.NewClassifierWithConfig(createTestLogger(), classify.ClassifierConfig{ServicesFile: path})
+	assert.Equal(t, 5, classifier.GetStatistics().Services)
+
+	assert.Equal(t, "sieve", classifier.Classify(tcpFlow(4190, nil, nil)).App)
+	assert.Equal(t, "kerberos", classifier.Classify(&classify.Flow{Transport: capture.IPProtoUDP, ServerPort: 88}).App)
+	// The built-in table wins over the file's names.
+	assert.Equal(t, classify.AppHTTPS, classifier.Classify(tcpFlow(443, nil, nil)).App)
+}
+
+func TestClassifier_Metadata(t *testing.T) {
+	classifier := newClassifier(t)
+
+	tests := []struct {
+		metadata classify.Metadata
+		app      string
+	}{
+		{classify.Metadata{Protocol: classify.AppTLS, ALPN: "h2"}, classify.AppHTTPS},
+		{classify.Metadata{Protocol: classify.AppTLS, ALPN: "http/1.1"}, classify.AppHTTPS},
+		{classify.Metadata{Protocol: classify.AppTLS, ALPN: "dot"}, classify.AppDNS},
+		{classify.Metadata{Protocol: classify.AppTLS}, classify.AppTLS},
+		{classify.Metadata{Protocol: classify.AppQUIC, ALPN: "h3"}, classify.AppHTTP3},
+		{classify.Metadata{Protocol: classify.AppDNS}, classify.AppDNS},
+	}
+
+	for _, tt := range tests {
+		// Metadata outranks the port and the payload.
+		flow := tcpFlow(22, []byte("SSH-2.0-x"), nil)
+		flow.Metadata = tt.metadata
+		result := classifier.Classify(flow)
+		assert.Equal(t, tt.app, result.App, "%+v", tt.metadata)
+		assert.Equal(t, classify.ConfidenceHigh, result.Confidence)
+		assert.Equal(t, classify.MethodMetadata, result.Method)
+	}
+}
+
+func TestClassifier_Rules(t *testing.T) {
+	rules, err := classify.RulesFromConfig([]config.ClassifierRule{
+		{App: "billing", Transport: "tcp", PortLow: 9000, PortHigh: 9010},
+		{App: "intranet", Host: "*.corp.example"},
+		{App: "lab-ssh", Network: "10.0.0.0/24", PortLow: 22, PortHigh: 22},
+		{App: "legacy", Payload: "cafe"},
+	})
+	require.NoError(t, err)
+	classifier := newClassifier(t, rules...)
+
+	assert.Equal(t, "billing", classifier.Classify(tcpFlow(9005, []byte("GET / HTTP/1.1\r\n"), nil)).App)
+	assert.NotEqual(t, "billing", classifier.Classify(&classify.Flow{Transport: capture.IPProtoUDP, ServerPort: 9005}).App)
+
+	flow := tcpFlow(443, nil, nil)
+	flow.Metadata = classify.Metadata{Protocol: classify.AppTLS, Hostname: "Wiki.Corp.Example"}
+	assert.Equal(t, classify.Result{App: "intranet", Confidence: classify.ConfidenceHigh, Method: classify.MethodRule}, classifier.Classify(flow))
+	flow.Metadata.Hostname = "notcorp.example"
+	assert.Equal(t, classify.AppTLS, classifier.Classify(flow).App)
+
+	assert.Equal(t, "lab-ssh", classifier.Classify(tcpFlow(22, nil, nil)).App)
+	offNet := tcpFlow(22, nil, nil)
+	offNet.ServerIP = netip.MustParseAddr("10.0.1.1")
+	assert.Equal(t, classify.AppSSH, classifier.Classify(offNet).App)
+
+	assert.Equal(t, "legacy", classifier.Classify(tcpFlow(40000, nil, []byte{0xca, 0xfe, 0x01})).App)
+
+	stats := classifier.GetStatistics()
+	assert.Equal(t, 4, stats.Rules)
+	assert.Equal(t, uint64(4), stats.ByRule)
+	assert.Equal(t, uint64(6), stats.Classified)
+	assert.Equal(t, uint64(1), stats.Unknown)
+
+	_, err = classify.RulesFromConfig([]config.ClassifierRule{{App: "x", Network: "nonsense"}})
+	assert.Error(t, err)
+}
@@ -28,7 +28,15 @@ func TestLoadDefault(t *testing.T) {
 	assert.Equal(t, 32*1024*1024, cfg.BufferSize)
 	assert.Equal(t, 5*time.Minute, cfg.FlowTimeout)
 	assert.Equal(t, 100000, cfg.MaxFlows)
+	assert.Equal(t, "lru", cfg.FlowEviction)
+	assert.Equal(t, 64, cfg.FlowShards)
 	assert.Equal(t, 30*time.Second, cfg.CleanupInterval)
+	assert.Equal(t, 4, cfg.MaxTunnelDepth)
+	assert.False(t, cfg.VerifyChecksums)
+	assert.Equal(t, 30*time.Second, cfg.FragmentTimeout)
+	assert.Equal(t, 4*1024*1024, cfg.FragmentMemory)
+	assert.Equal(t, "/etc/services", cfg.ServicesFile)
+	assert.Empty(t, cfg.ClassifierRules)
 	assert.Equal(t, "info", cfg.LogLevel)
 	assert.Equal(t, "json", cfg.LogFormat)
 	assert.Equal(t, false, cfg.EnableAuth)
@@ -67,7 +75,12 @@ func TestLoadFromEnvironment(t *testing.T) {
 				"NETWATCH_BUFFER_SIZE":      "65536",
 				"NETWATCH_FLOW_TIMEOUT":     "10m",
 				"NETWATCH_MAX_FLOWS":        "50000",
+				"NETWATCH_FLOW_SHARDS":      "16",
 				"NETWATCH_CLEANUP_INTERVAL": "60s",
+				"NETWATCH_MAX_TUNNEL_DEPTH": "2",
+				"NETWATCH_VERIFY_CHECKSUMS": "true",
+				"NETWATCH_FRAGMENT_TIMEOUT": "10s",
+				"NETWATCH_FRAGMENT_MEMORY":  "1048576",
 			},
 			validate: func(t *testing.T, cfg *config.Config) {
 				assert.Equal(t, "eth0", cfg.Interface)
@@ -77,7 +90,35 @@ func TestLoadFromEnvironment(t *testing.T) {
 				assert.Equal(t, 65536, cfg.BufferSize)
 				assert.Equal(t, 10*time.Minute, cfg.FlowTimeout)
 				assert.Equal(t, 50000, cfg.MaxFlows)
+				assert.Equal(t, 16, cfg.FlowShards)
 				assert.Equal(t, 60*time.Second, cfg.CleanupInterval)
+				assert.Equal(t, 2, cfg.MaxTunnelDepth)
+				assert.True(t, cfg.VerifyChecksums)
+				assert.Equal(t, 10*time.Second, cfg.FragmentTimeout)
+				assert.Equal(t, 1048576, cfg.FragmentMemory)
+			},
+		},
+		{
+			name: "classifier settings",
+			envVars: map[string]string{
+				"NETWATCH_SERVICES_FILE":    "/opt/netwatch/services",
+				"NETWATCH_CLASSIFIER_RULES": "app=billing,transport=tcp,ports=9000-9010; app=intranet,host=*.corp.example",
+			},
+			validate: func(t *testing.T, cfg *config.Config) {
+				assert.Equal(t, "/opt/netwatch/services", cfg.ServicesFile)
+				assert.Equal(t, []config.ClassifierRule{
+					{App: "billing", Transport: "tcp", PortLow: 9000, PortHigh: 9010},
+					{App: "intranet", Host: "*.corp.example"},
+				}, cfg.ClassifierRules)
+			},
+		},
+		{
+			name: "analyzer settings",
+			envVars: map[string]string{
+				"NETWATCH_DHCP_AUTHORIZED_SERVERS": "192.168.1.1, fe80::1,",
+			},
+			validate: func(t *testing.T, cfg *config.Config) {
+				assert.Equal(t, []string{"192.168.1.1", "fe80::1"}, cfg.DHCPAuthorizedServers)
 			},
 		},
 		{
@@ -152,7 +193,16 @@ func clearEnvVars() {
 		"NETWATCH_BUFFER_SIZE",
 		"NETWATCH_FLOW_TIMEOUT",
 		"NETWATCH_MAX_FLOWS",
+		"NETWATCH_FLOW_EVICTION",
+		"NETWATCH_FLOW_SHARDS",
 		"NETWATCH_CLEANUP_INTERVAL",
+		"NETWATCH_MAX_TUNNEL_DEPTH",
+		"NETWATCH_VERIFY_CHECKSUMS",
+		"NETWATCH_FRAGMENT_TIMEOUT",
+		"NETWATCH_FRAGMENT_MEMORY",
+		"NETWATCH_SERVICES_FILE",
+		"NETWATCH_CLASSIFIER_RULES",
+		"NETWATCH_DHCP_AUTHORIZED_SERVERS",
 		"NETWATCH_LOG_LEVEL",
 		"NETWATCH_LOG_FORMAT",
 		"NETWATCH_ENABLE_AUTH",
@@ -168,3 +218,21 @@ func clearEnvVars() {
 		os.Unsetenv(env)
 	}
 }
+
+func TestParseClassifierRules(t *testing.T) {
+	rules, err := config.ParseClassifierRules("app=dns-alt,transport=UDP,ports=5353,network=10.0.0.0/8,payload=c0ffee")
+	require.NoError(t, err)
+	assert.Equal(t, []config.ClassifierRule{{
+		App: "dns-alt", Transport: "udp", PortLow: 5353, PortHigh: 5353, Network: "10.0.0.0/8", Payload: "c0ffee",
+	}}, rules)
+
+	for _, spec := range []string{
+		"app=x,ports=70000",
+		"app=x,ports=1-b",
+		"app=x,colour=blue",
+		"app=x,tcp",
+	} {
+		_, err := config.ParseClassifierRules(spec)
+		assert.Error(t, err, spec)
+	}
+}
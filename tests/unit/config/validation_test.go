@@ -25,6 +25,8 @@ func getValidConfig(host string, port int, metricsPort int) *config.Config {
 		FlowTimeout:     5 * time.Minute,
 		MaxFlows:        100000,
 		CleanupInterval: 30 * time.Second,
+		FragmentTimeout: 30 * time.Second,
+		FragmentMemory:  4 * 1024 * 1024,
 
 		// Logging settings
 		LogLevel:  "info",
@@ -208,6 +210,94 @@ func TestValidateCapture(t *testing.T) {
 			wantError: true,
 			errorMsg:  "max flows must not exceed 1M",
 		},
+		{
+			name: "valid flow eviction policy",
+			cfg: func() *config.Config {
+				cfg := getValidConfig("localhost", 8080, 9090)
+				cfg.FlowEviction = "Sampled_Smallest"
+				return cfg
+			}(),
+			wantError: false,
+		},
+		{
+			name: "invalid flow eviction policy",
+			cfg: func() *config.Config {
+				cfg := getValidConfig("localhost", 8080, 9090)
+				cfg.FlowEviction = "random"
+				return cfg
+			}(),
+			wantError: true,
+			errorMsg:  "invalid flow eviction policy: random",
+		},
+		{
+			name: "negative flow shards",
+			cfg: func() *config.Config {
+				cfg := getValidConfig("localhost", 8080, 9090)
+				cfg.FlowShards = -1
+				return cfg
+			}(),
+			wantError: true,
+			errorMsg:  "flow shards must be between 0 and 1024",
+		},
+		{
+			name: "too many flow shards",
+			cfg: func() *config.Config {
+				cfg := getValidConfig("localhost", 8080, 9090)
+				cfg.FlowShards = 2048
+				return cfg
+			}(),
+			wantError: true,
+			errorMsg:  "flow shards must be between 0 and 1024",
+		},
+		{
+			name: "tunnel decapsulation disabled",
+			cfg: func() *config.Config {
+				cfg := getValidConfig("localhost", 8080, 9090)
+				cfg.MaxTunnelDepth = 0
+				return cfg
+			}(),
+			wantError: false,
+		},
+		{
+			name: "max tunnel depth too large",
+			cfg: func() *config.Config {
+				cfg := getValidConfig("localhost", 8080, 9090)
+				cfg.MaxTunnelDepth = 9
+				return cfg
+			}(),
+			wantError: true,
+			errorMsg:  "max tunnel depth must be between 0 and 8",
+		},
+		{
+			name: "zero fragment timeout",
+			cfg: func() *config.Config {
+				cfg := getValidConfig("localhost", 8080, 9090)
+				cfg.FragmentTimeout = 0
+				return cfg
+			}(),
+			wantError: true,
+			errorMsg:  "fragment timeout must be positive",
+		},
+		{
+			name: "fragment memory too small",
+			cfg: func() *config.Config {
+				cfg := getValidConfig("localhost", 8080, 9090)
+				cfg.FragmentMemory = 1024
+				return cfg
+			}(),
+			wantError: true,
+			errorMsg:  "fragment memory must be at least 64KB",
+		},
+		{
+			name: "fragment memory too large",
+			cfg: func() *config.Config {
+				cfg := getValidConfig("localhost", 8080, 9090)
+				cfg.FragmentMemory = 512 * 1024 * 1024
+				return cfg
+			}(),
+			wantError: true,
+			errorMsg:  "fragment memory must not exceed 256MB",
+		},
 	}
 
 	for _, tt := range tests {
@@ -225,6 +315,75 @@ func TestValidateCapture(t *testing.T) {
 	}
 }
 
+func TestValidateClassifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     config.ClassifierRule
+		errorMsg string
+	}{
+		{
+			name: "port range",
+			rule: config.ClassifierRule{App: "billing", Transport: "tcp", PortLow: 9000, PortHigh: 9010},
+		},
+		{
+			name: "network and payload",
+			rule: config.ClassifierRule{App: "legacy", Network: "192.168.0.0/16", Payload: "0102"},
+		},
+		{
+			name:     "missing app",
+			rule:     config.ClassifierRule{PortLow: 80, PortHigh: 80},
+			errorMsg: "has no app",
+		},
+		{
+			name:     "unknown transport",
+			rule:     config.ClassifierRule{App: "x", Transport: "sctp", PortLow: 80, PortHigh: 80},
+			errorMsg: "transport must be tcp or udp",
+		},
+		{
+			name:     "reversed ports",
+			rule:     config.ClassifierRule{App: "x", PortLow: 90, PortHigh: 80},
+			errorMsg: "is reversed",
+		},
+		{
+			name:     "invalid network",
+			rule:     config.ClassifierRule{App: "x", Network: "10.0.0.0/33"},
+			errorMsg: "invalid network",
+		},
+		{
+			name:     "invalid payload",
+			rule:     config.ClassifierRule{App: "x", Payload: "xyz"},
+			errorMsg: "payload must be hex",
+		},
+		{
+			name:     "matches everything",
+			rule:     config.ClassifierRule{App: "x", Transport: "tcp"},
+			errorMsg: "must match on ports, network, host or payload",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := getValidConfig("localhost", 8080, 9090)
+			cfg.ClassifierRules = []config.ClassifierRule{tt.rule}
+			err := config.Validate(cfg)
+			if tt.errorMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.errorMsg)
+			}
+		})
+	}
+}
+
+func TestValidateAnalyzers(t *testing.T) {
+	cfg := getValidConfig("localhost", 8080, 9090)
+	cfg.DHCPAuthorizedServers = []string{"192.168.1.1", "2001:db8::1"}
+	assert.NoError(t, config.Validate(cfg))
+
+	cfg.DHCPAuthorizedServers = []string{"192.168.1.1", "dhcp.example"}
+	assert.ErrorContains(t, config.Validate(cfg), `invalid DHCP authorized server "dhcp.example"`)
+}
+
 func TestValidateLogging(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -267,6 +426,25 @@ func TestValidateLogging(t *testing.T) {
 			wantError: true,
 			errorMsg:  "invalid log format: xml",
 		},
+		{
+			name: "valid dissect mode",
+			cfg: func() *config.Config {
+				cfg := getValidConfig("localhost", 8080, 9090)
+				cfg.Dissect = "tree"
+				return cfg
+			}(),
+			wantError: false,
+		},
+		{
+			name: "invalid dissect mode",
+			cfg: func() *config.Config {
+				cfg := getValidConfig("localhost", 8080, 9090)
+				cfg.Dissect = "pcap"
+				return cfg
+			}(),
+			wantError: true,
+			errorMsg:  "invalid dissect mode: pcap",
+		},
 	}
 
 	for _, tt := range tests {
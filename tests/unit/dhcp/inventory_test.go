@@ -0,0 +1,214 @@
+package dhcp
+
+import (
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/dhcp"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	start     = time.Unix(1000, 0)
+	broadcast = []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	rogueMAC  = []byte{0xde, 0xad, 0xbe, 0xef, 0x00, 0x01}
+)
+
+func createTestLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+}
+
+func packet4(t *testing.T, srcMAC []byte, srcIP, dstIP []byte, srcPort, dstPort uint16, payload []byte) *capture.ParsedPacket {
+	t.Helper()
+	gen := mocks.NewPacketGenerator()
+	udp := gen.GenerateUDPDatagram(srcPort, dstPort, payload)
+	frame := gen.GenerateEthernetFrame(srcMAC, broadcast, capture.EtherTypeIPv4, gen.GenerateIPv4Packet(srcIP, dstIP, capture.IPProtoUDP, udp))
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+	return packet
+}
+
+func fromClient(t *testing.T, msgType dhcp.MessageType, clientIP []byte, options ...[]byte) *capture.ParsedPacket {
+	gen := mocks.NewPacketGenerator()
+	options = append([][]byte{gen.GenerateDHCPOption(dhcp.OptionMessageType, []byte{byte(msgType)})}, options...)
+	payload := gen.GenerateDHCPMessage(1, 42, clientMAC, clientIP, nil, options...)
+	src := clientIP
+	if src == nil {
+		src = []byte{0, 0, 0, 0}
+	}
+	return packet4(t, clientMAC, src, []byte{255, 255, 255, 255}, dhcp.ClientPort, dhcp.ServerPort, payload)
+}
+
+func fromServer(t *testing.T, mac, serverIP []byte, msgType dhcp.MessageType, yourIP []byte, leaseSeconds byte) *capture.ParsedPacket {
+	gen := mocks.NewPacketGenerator()
+	payload := gen.GenerateDHCPMessage(2, 42, clientMAC, nil, yourIP,
+		gen.GenerateDHCPOption(dhcp.OptionMessageType, []byte{byte(msgType)}),
+		gen.GenerateDHCPOption(dhcp.OptionServerID, serverIP),
+		gen.GenerateDHCPOption(dhcp.OptionLeaseTime, []byte{0, 0, 0, leaseSeconds}))
+	return packet4(t, mac, serverIP, []byte{255, 255, 255, 255}, dhcp.ServerPort, dhcp.ClientPort, payload)
+}
+
+func TestInventory_LearnsLeaseFromExchange(t *testing.T) {
+	inventory := dhcp.NewInventory(createTestLogger())
+	gen := mocks.NewPacketGenerator()
+	serverIP := []byte{192, 168, 1, 1}
+	yourIP := []byte{192, 168, 1, 50}
+
+	var servers []dhcp.Server
+	inventory.OnServer(func(server dhcp.Server) {
+		servers = append(servers, server)
+	})
+
+	inventory.ObservePacket(fromClient(t, dhcp.MessageTypeDiscover, nil,
+		gen.GenerateDHCPOption(dhcp.OptionHostname, []byte("laptop")),
+		gen.GenerateDHCPOption(dhcp.OptionVendorClass, []byte("MSFT 5.0"))), start)
+	inventory.ObservePacket(fromServer(t, serverMAC, serverIP, dhcp.MessageTypeOffer, yourIP, 120), start)
+	inventory.ObservePacket(fromClient(t, dhcp.MessageTypeRequest, nil,
+		gen.GenerateDHCPOption(dhcp.OptionRequestedIP, yourIP)), start)
+	inventory.ObservePacket(fromServer(t, serverMAC, serverIP, dhcp.MessageTypeAck, yourIP, 120), start.Add(time.Second))
+
+	client, ok := inventory.LookupMAC(net.HardwareAddr(clientMAC))
+	require.True(t, ok)
+	assert.Equal(t, "laptop", client.Hostname)
+	assert.Equal(t, "MSFT 5.0", client.VendorClass)
+	require.Len(t, client.Leases, 1)
+	lease := client.Leases[0]
+	assert.Equal(t, "192.168.1.50", lease.IP)
+	assert.Equal(t, "laptop", lease.Hostname)
+	assert.Equal(t, "192.168.1.1", lease.Server)
+	assert.Equal(t, 2*time.Minute, lease.LeaseTime)
+	assert.Equal(t, start.Add(time.Second+2*time.Minute), lease.Expires)
+
+	found, ok := inventory.LookupIP(netip.MustParseAddr("192.168.1.50"), start.Add(time.Minute))
+	require.True(t, ok)
+	assert.Equal(t, "00:11:22:33:44:55", found.MAC)
+	_, ok = inventory.LookupIP(netip.MustParseAddr("192.168.1.50"), start.Add(time.Hour))
+	assert.False(t, ok, "the lease has expired by then")
+
+	require.Len(t, servers, 1)
+	assert.Equal(t, "192.168.1.1", servers[0].IP)
+	assert.Equal(t, "66:77:88:99:aa:bb", servers[0].MAC)
+	assert.False(t, servers[0].Rogue)
+
+	listed := inventory.Servers()
+	require.Len(t, listed, 1)
+	assert.Equal(t, uint64(1), listed[0].Offers)
+	assert.Equal(t, uint64(1), listed[0].Acks)
+
+	stats := inventory.GetStatistics()
+	assert.Equal(t, uint64(4), stats.Messages)
+	assert.Equal(t, uint64(1), stats.Acks)
+	assert.Equal(t, 1, stats.Clients)
+	assert.Equal(t, 1, stats.Leases)
+	assert.Equal(t, 0, stats.RogueServers)
+}
+
+func TestInventory_KeepsLeaseHistory(t *testing.T) {
+	inventory := dhcp.NewInventory(createTestLogger())
+	serverIP := []byte{192, 168, 1, 1}
+
+	inventory.ObservePacket(fromServer(t, serverMAC, serverIP, dhcp.MessageTypeAck, []byte{192, 168, 1, 50}, 120), start)
+	// A renewal extends the lease rather than adding one.
+	inventory.ObservePacket(fromServer(t, serverMAC, serverIP, dhcp.MessageTypeAck, []byte{192, 168, 1, 50}, 120), start.Add(time.Minute))
+	inventory.ObservePacket(fromClient(t, dhcp.MessageTypeRelease, []byte{192, 168, 1, 50}), start.Add(90*time.Second))
+	inventory.ObservePacket(fromServer(t, serverMAC, serverIP, dhcp.MessageTypeAck, []byte{192, 168, 1, 77}, 120), start.Add(2*time.Minute))
+
+	client, ok := inventory.LookupMAC(net.HardwareAddr(clientMAC))
+	require.True(t, ok)
+	require.Len(t, client.Leases, 2)
+	assert.Equal(t, "192.168.1.50", client.Leases[0].IP)
+	assert.Equal(t, start, client.Leases[0].FirstSeen)
+	assert.Equal(t, start.Add(time.Minute), client.Leases[0].LastSeen)
+	assert.True(t, client.Leases[0].Released)
+	assert.Equal(t, start.Add(90*time.Second), client.Leases[0].Expires)
+	assert.Equal(t, "192.168.1.77", client.Leases[1].IP)
+	assert.False(t, client.Leases[1].Released)
+
+	// Expired leases are kept for the retention period.
+	assert.Equal(t, 0, inventory.Expire(start.Add(24*time.Hour)))
+	assert.Equal(t, 2, inventory.Expire(start.Add(8*24*time.Hour)))
+	assert.Empty(t, inventory.Clients())
+}
+
+func TestInventory_DetectsRogueServer(t *testing.T) {
+	inventory := dhcp.NewInventoryWithConfig(createTestLogger(), dhcp.InventoryConfig{
+		AuthorizedServers: []netip.Addr{netip.MustParseAddr("192.168.1.1")},
+	})
+	var servers []dhcp.Server
+	inventory.OnServer(func(server dhcp.Server) {
+		servers = append(servers, server)
+	})
+
+	inventory.ObservePacket(fromServer(t, serverMAC, []byte{192, 168, 1, 1}, dhcp.MessageTypeOffer, []byte{192, 168, 1, 50}, 120), start)
+	inventory.ObservePacket(fromServer(t, rogueMAC, []byte{192, 168, 1, 66}, dhcp.MessageTypeOffer, []byte{192, 168, 1, 51}, 120), start)
+	inventory.ObservePacket(fromServer(t, rogueMAC, []byte{192, 168, 1, 66}, dhcp.MessageTypeOffer, []byte{192, 168, 1, 51}, 120), start)
+
+	require.Len(t, servers, 2, "each server is reported once")
+	assert.True(t, servers[0].Authorized)
+	assert.False(t, servers[0].Rogue)
+	assert.Equal(t, "192.168.1.66", servers[1].IP)
+	assert.Equal(t, "de:ad:be:ef:00:01", servers[1].MAC)
+	assert.True(t, servers[1].Rogue)
+
+	listed := inventory.Servers()
+	require.Len(t, listed, 2)
+	assert.Equal(t, "192.168.1.66", listed[0].IP, "rogue servers come first")
+	assert.Equal(t, uint64(2), listed[0].Offers)
+	assert.Equal(t, 1, inventory.GetStatistics().RogueServers)
+}
+
+func TestInventory_DHCPv6(t *testing.T) {
+	inventory := dhcp.NewInventory(createTestLogger())
+	gen := mocks.NewPacketGenerator()
+	clientIP := netip.MustParseAddr("fe80::211:22ff:fe33:4455").AsSlice()
+	serverIP := netip.MustParseAddr("fe80::1").AsSlice()
+	multicast := netip.MustParseAddr("ff02::1:2").AsSlice()
+	duid := append([]byte{0, 4}, make([]byte, 16)...) // DUID-UUID, which holds no MAC
+	fqdn := append([]byte{0x01}, 2, 'p', 'c', 0)
+
+	packet6 := func(srcMAC, src, dst []byte, srcPort, dstPort uint16, payload []byte) *capture.ParsedPacket {
+		udp := gen.GenerateUDPDatagram(srcPort, dstPort, payload)
+		frame := gen.GenerateEthernetFrame(srcMAC, broadcast, capture.EtherTypeIPv6, gen.GenerateIPv6Packet(src, dst, capture.IPProtoUDP, udp))
+		packet, err := capture.ParsePacket(frame)
+		require.NoError(t, err)
+		return packet
+	}
+
+	request := gen.GenerateDHCPv6Message(byte(dhcp.MessageType6Request), 9,
+		gen.GenerateDHCPv6Option(dhcp.Option6ClientID, duid),
+		gen.GenerateDHCPv6Option(dhcp.Option6ClientFQDN, fqdn))
+	reply := gen.GenerateDHCPv6Message(byte(dhcp.MessageType6Reply), 9,
+		gen.GenerateDHCPv6Option(dhcp.Option6ClientID, duid),
+		gen.GenerateDHCPv6Option(dhcp.Option6ServerID, []byte{0, 3, 0, 1, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb}),
+		gen.GenerateDHCPv6IANA(1, netip.MustParseAddr("2001:db8::50").AsSlice(), 1800, 3600))
+
+	inventory.ObservePacket(packet6(clientMAC, clientIP, multicast, dhcp.ClientPort6, dhcp.ServerPort6, request), start)
+	inventory.ObservePacket(packet6(serverMAC, serverIP, clientIP, dhcp.ServerPort6, dhcp.ClientPort6, reply), start)
+
+	// The DUID holds no MAC, so the client is known by the address its
+	// request came from.
+	client, ok := inventory.LookupMAC(net.HardwareAddr(clientMAC))
+	require.True(t, ok)
+	assert.Equal(t, "pc", client.Hostname)
+	assert.NotEmpty(t, client.DUID)
+	require.Len(t, client.Leases, 1)
+	assert.Equal(t, "2001:db8::50", client.Leases[0].IP)
+	assert.Equal(t, "pc", client.Leases[0].Hostname)
+	assert.Equal(t, time.Hour, client.Leases[0].LeaseTime)
+
+	servers := inventory.Servers()
+	require.Len(t, servers, 1)
+	assert.Equal(t, "fe80::1", servers[0].IP)
+	assert.Equal(t, "0003000166778899aabb", servers[0].DUID)
+	assert.Equal(t, uint64(2), inventory.GetStatistics().Messages6)
+	assert.Equal(t, uint64(1), servers[0].Acks)
+}
@@ -0,0 +1,154 @@
+package dhcp
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/dhcp"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	clientMAC = []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	serverMAC = []byte{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb}
+)
+
+func TestDecode_Options(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	data := gen.GenerateDHCPMessage(2, 0xdeadbeef, clientMAC, nil, []byte{192, 168, 1, 50},
+		gen.GenerateDHCPOption(dhcp.OptionMessageType, []byte{byte(dhcp.MessageTypeAck)}),
+		[]byte{dhcp.OptionPad, dhcp.OptionPad},
+		gen.GenerateDHCPOption(dhcp.OptionServerID, []byte{192, 168, 1, 1}),
+		gen.GenerateDHCPOption(dhcp.OptionLeaseTime, []byte{0, 0, 0x0e, 0x10}),
+		gen.GenerateDHCPOption(dhcp.OptionSubnetMask, []byte{255, 255, 255, 0}),
+		gen.GenerateDHCPOption(dhcp.OptionRouter, []byte{192, 168, 1, 1}),
+		gen.GenerateDHCPOption(dhcp.OptionDNSServers, []byte{1, 1, 1, 1, 8, 8, 8, 8}),
+		gen.GenerateDHCPOption(dhcp.OptionHostname, []byte("laptop\x00")),
+		gen.GenerateDHCPOption(dhcp.OptionDomainName, []byte("home.arpa")),
+	)
+
+	msg, err := dhcp.Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(2), msg.Op)
+	assert.Equal(t, uint32(0xdeadbeef), msg.TransactionID)
+	assert.Equal(t, "00:11:22:33:44:55", msg.ClientMAC.String())
+	assert.Equal(t, netip.MustParseAddr("192.168.1.50"), msg.YourIP)
+	assert.Equal(t, dhcp.MessageTypeAck, msg.MessageType)
+	assert.Equal(t, "ACK", msg.MessageType.String())
+	assert.True(t, msg.MessageType.FromServer())
+	assert.Equal(t, netip.MustParseAddr("192.168.1.1"), msg.ServerID)
+	assert.Equal(t, time.Hour, msg.LeaseTime)
+	assert.Equal(t, netip.MustParseAddr("255.255.255.0"), msg.SubnetMask)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("192.168.1.1")}, msg.Routers)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("1.1.1.1"), netip.MustParseAddr("8.8.8.8")}, msg.DNSServers)
+	assert.Equal(t, "laptop", msg.Hostname)
+	assert.Equal(t, "home.arpa", msg.DomainName)
+	assert.Len(t, msg.Options, 8)
+
+	lease, ok := msg.Option(dhcp.OptionLeaseTime)
+	require.True(t, ok)
+	assert.Equal(t, []byte{0, 0, 0x0e, 0x10}, lease)
+}
+
+func TestDecode_ClientOptions(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	fqdn := append([]byte{0x05, 0, 0}, 5, 'p', 'h', 'o', 'n', 'e', 4, 'h', 'o', 'm', 'e', 0)
+	data := gen.GenerateDHCPMessage(1, 1, clientMAC, nil, nil,
+		gen.GenerateDHCPOption(dhcp.OptionMessageType, []byte{byte(dhcp.MessageTypeRequest)}),
+		gen.GenerateDHCPOption(dhcp.OptionRequestedIP, []byte{10, 0, 0, 7}),
+		gen.GenerateDHCPOption(dhcp.OptionVendorClass, []byte("android-dhcp-14")),
+		gen.GenerateDHCPOption(dhcp.OptionClientID, append([]byte{1}, clientMAC...)),
+		gen.GenerateDHCPOption(dhcp.OptionParameterRequestList, []byte{1, 3, 6, 15}),
+		gen.GenerateDHCPOption(dhcp.OptionClientFQDN, fqdn),
+	)
+
+	msg, err := dhcp.Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, dhcp.MessageTypeRequest, msg.MessageType)
+	assert.False(t, msg.MessageType.FromServer())
+	assert.Equal(t, netip.MustParseAddr("10.0.0.7"), msg.RequestedIP)
+	assert.Equal(t, "android-dhcp-14", msg.VendorClass)
+	assert.Equal(t, append([]byte{1}, clientMAC...), msg.ClientID)
+	assert.Equal(t, []uint8{1, 3, 6, 15}, msg.ParameterRequestList)
+	assert.Equal(t, "phone.home", msg.Hostname)
+}
+
+func TestDecode_Errors(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	valid := gen.GenerateDHCPMessage(1, 1, clientMAC, nil, nil)
+
+	_, err := dhcp.Decode(valid[:200])
+	assert.ErrorIs(t, err, dhcp.ErrTruncated)
+
+	bootp := append([]byte(nil), valid...)
+	bootp[236] = 0
+	_, err = dhcp.Decode(bootp)
+	assert.ErrorIs(t, err, dhcp.ErrNotDHCP)
+
+	_, err = dhcp.Decode(append(valid[:240], dhcp.OptionHostname, 10, 'a'))
+	assert.ErrorIs(t, err, dhcp.ErrBadOption)
+}
+
+func TestDecode6_Reply(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	addr := netip.MustParseAddr("2001:db8::1234").AsSlice()
+	fqdn := append([]byte{0x01}, 4, 'h', 'o', 's', 't', 0)
+	vendor := append([]byte{0, 0, 0x01, 0x37}, 0, 5, 'M', 'S', 'F', 'T', '5')
+	data := gen.GenerateDHCPv6Message(byte(dhcp.MessageType6Reply), 0x123456,
+		gen.GenerateDHCPv6Option(dhcp.Option6ClientID, gen.GenerateDHCPv6DUIDLL(clientMAC)),
+		gen.GenerateDHCPv6Option(dhcp.Option6ServerID, []byte{0, 2, 0, 0, 0, 9, 1}),
+		gen.GenerateDHCPv6IANA(1, addr, 3600, 7200),
+		gen.GenerateDHCPv6Option(dhcp.Option6ClientFQDN, fqdn),
+		gen.GenerateDHCPv6Option(dhcp.Option6VendorClass, vendor),
+		gen.GenerateDHCPv6Option(dhcp.Option6DNSServers, netip.MustParseAddr("2001:db8::53").AsSlice()),
+	)
+
+	msg, err := dhcp.Decode6(data)
+	require.NoError(t, err)
+	assert.Equal(t, dhcp.MessageType6Reply, msg.MessageType)
+	assert.True(t, msg.MessageType.FromServer())
+	assert.Equal(t, uint32(0x123456), msg.TransactionID)
+	assert.Equal(t, 0, msg.Hops)
+	require.Len(t, msg.Addresses, 1)
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1234"), msg.Addresses[0].IP)
+	assert.Equal(t, time.Hour, msg.Addresses[0].PreferredLifetime)
+	assert.Equal(t, 2*time.Hour, msg.Addresses[0].ValidLifetime)
+	assert.Equal(t, "host", msg.Hostname)
+	assert.Equal(t, "MSFT5", msg.VendorClass)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("2001:db8::53")}, msg.DNSServers)
+	assert.Equal(t, []byte{0, 2, 0, 0, 0, 9, 1}, msg.ServerDUID)
+
+	mac, ok := dhcp.DUIDLinkLayerAddress(msg.ClientDUID)
+	require.True(t, ok)
+	assert.Equal(t, "00:11:22:33:44:55", mac.String())
+}
+
+func TestDecode6_UnwrapsRelays(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	link := netip.MustParseAddr("2001:db8:1::1").AsSlice()
+	peer := netip.MustParseAddr("fe80::211:22ff:fe33:4455").AsSlice()
+	solicit := gen.GenerateDHCPv6Message(byte(dhcp.MessageType6Solicit), 7,
+		gen.GenerateDHCPv6Option(dhcp.Option6ClientID, append([]byte{0, 1, 0, 1, 0x2a, 0, 0, 0}, clientMAC...)))
+	inner := gen.GenerateDHCPv6RelayForward(0, link, peer, solicit)
+	outer := gen.GenerateDHCPv6RelayForward(1, link, link, inner)
+
+	msg, err := dhcp.Decode6(outer)
+	require.NoError(t, err)
+	assert.Equal(t, dhcp.MessageType6Solicit, msg.MessageType)
+	assert.Equal(t, 2, msg.Hops)
+	assert.Equal(t, netip.MustParseAddr("fe80::211:22ff:fe33:4455"), msg.PeerAddress)
+
+	// DUID-LLT carries the address after a timestamp.
+	mac, ok := dhcp.DUIDLinkLayerAddress(msg.ClientDUID)
+	require.True(t, ok)
+	assert.Equal(t, "00:11:22:33:44:55", mac.String())
+
+	_, ok = dhcp.DUIDLinkLayerAddress([]byte{0, 2, 0, 0, 0, 9, 1})
+	assert.False(t, ok)
+
+	_, err = dhcp.Decode6(append(solicit, 0, 1))
+	assert.ErrorIs(t, err, dhcp.ErrBadOption)
+}
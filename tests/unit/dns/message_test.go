@@ -0,0 +1,226 @@
+package dns
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/dns"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	flagsQuery    = 0x0100 // RD
+	flagsResponse = 0x8180 // QR, RD, RA
+)
+
+// pointer is a compression pointer to offset in the message.
+func pointer(offset int) []byte {
+	return []byte{0xC0 | byte(offset>>8), byte(offset)}
+}
+
+func TestDecode_Query(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	data := gen.GenerateDNSMessage(0x1234, flagsQuery,
+		[][]byte{gen.GenerateDNSQuestion("WWW.Example.COM", uint16(dns.TypeAAAA))}, nil, nil, nil)
+
+	msg, err := dns.Decode(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint16(0x1234), msg.Header.ID)
+	assert.False(t, msg.Header.Response)
+	assert.True(t, msg.Header.RecursionDesired)
+	assert.Equal(t, dns.RCodeSuccess, msg.Header.RCode)
+	require.Len(t, msg.Questions, 1)
+	assert.Equal(t, dns.Question{Name: "www.example.com", Type: dns.TypeAAAA, Class: dns.ClassINET}, msg.Questions[0])
+	assert.Equal(t, "www.example.com", msg.QueryName())
+	assert.Nil(t, msg.EDNS)
+}
+
+func TestDecode_CompressedAnswers(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	question := gen.GenerateDNSQuestion("www.example.com", uint16(dns.TypeA))
+	// The question name starts right after the header; the CNAME target
+	// reuses its "example.com" suffix, which starts 4 bytes in.
+	cnameTarget := append([]byte{3, 'c', 'd', 'n'}, pointer(dns.HeaderSize+4)...)
+	cname := gen.GenerateDNSRecord(pointer(dns.HeaderSize), uint16(dns.TypeCNAME), 1, 300, cnameTarget)
+	cnameOwner := dns.HeaderSize + len(question) + len(pointer(0)) + 10
+	a := gen.GenerateDNSRecord(pointer(cnameOwner), uint16(dns.TypeA), 1, 60, []byte{93, 184, 216, 34})
+
+	msg, err := dns.Decode(gen.GenerateDNSMessage(1, flagsResponse, [][]byte{question}, [][]byte{cname, a}, nil, nil))
+	require.NoError(t, err)
+
+	require.Len(t, msg.Answers, 2)
+	assert.Equal(t, "www.example.com", msg.Answers[0].Name)
+	assert.Equal(t, dns.TypeCNAME, msg.Answers[0].Type)
+	assert.Equal(t, "cdn.example.com", msg.Answers[0].Target)
+	assert.Equal(t, uint32(300), msg.Answers[0].TTL)
+	assert.Equal(t, "cdn.example.com", msg.Answers[1].Name)
+	assert.Equal(t, netip.MustParseAddr("93.184.216.34"), msg.Answers[1].IP)
+	assert.Equal(t, uint32(60), msg.Answers[1].TTL)
+}
+
+func TestDecode_RecordTypes(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	owner := gen.GenerateDNSName("example.com")
+
+	soa := append(gen.GenerateDNSName("ns1.example.com"), gen.GenerateDNSName("hostmaster.example.com")...)
+	for _, v := range []uint32{2024010101, 7200, 3600, 1209600, 300} {
+		soa = binary.BigEndian.AppendUint32(soa, v)
+	}
+
+	records := [][]byte{
+		gen.GenerateDNSRecord(owner, uint16(dns.TypeAAAA), 1, 60, netip.MustParseAddr("2001:db8::1").AsSlice()),
+		gen.GenerateDNSRecord(owner, uint16(dns.TypeNS), 1, 60, gen.GenerateDNSName("ns1.example.com")),
+		gen.GenerateDNSRecord(owner, uint16(dns.TypeMX), 1, 60, append([]byte{0, 10}, gen.GenerateDNSName("mail.example.com")...)),
+		gen.GenerateDNSRecord(gen.GenerateDNSName("_sip._tcp.example.com"), uint16(dns.TypeSRV), 1, 60,
+			append([]byte{0, 5, 0, 20, 0x13, 0xC4}, gen.GenerateDNSName("sip.example.com")...)),
+		gen.GenerateDNSRecord(owner, uint16(dns.TypeTXT), 1, 60, []byte("\x0bv=spf1 -all\x00\x03abc")),
+		gen.GenerateDNSRecord(owner, uint16(dns.TypeSOA), 1, 60, soa),
+		gen.GenerateDNSRecord(owner, uint16(dns.TypeCAA), 1, 60, []byte("\x00\x05issueletsencrypt.org")),
+		gen.GenerateDNSRecord(owner, uint16(dns.TypeHTTPS), 1, 60, append([]byte{0, 1, 0}, 0, 1, 0, 3, 2, 'h', '2')),
+		gen.GenerateDNSRecord(gen.GenerateDNSName("1.0.0.127.in-addr.arpa"), uint16(dns.TypePTR), 1, 60, gen.GenerateDNSName("localhost")),
+		gen.GenerateDNSRecord(owner, 99, 1, 60, []byte{1, 2, 3}),
+	}
+
+	msg, err := dns.Decode(gen.GenerateDNSMessage(1, flagsResponse, nil, records, nil, nil))
+	require.NoError(t, err)
+	require.Len(t, msg.Answers, len(records))
+
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1"), msg.Answers[0].IP)
+	assert.Equal(t, "ns1.example.com", msg.Answers[1].Target)
+
+	assert.Equal(t, uint16(10), msg.Answers[2].Preference)
+	assert.Equal(t, "mail.example.com", msg.Answers[2].Target)
+
+	srv := msg.Answers[3]
+	assert.Equal(t, "_sip._tcp.example.com", srv.Name)
+	assert.Equal(t, uint16(5), srv.Preference)
+	assert.Equal(t, uint16(20), srv.Weight)
+	assert.Equal(t, uint16(5060), srv.Port)
+	assert.Equal(t, "sip.example.com", srv.Target)
+
+	assert.Equal(t, []string{"v=spf1 -all", "", "abc"}, msg.Answers[4].Text)
+
+	require.NotNil(t, msg.Answers[5].SOA)
+	assert.Equal(t, dns.SOA{
+		MName: "ns1.example.com", RName: "hostmaster.example.com",
+		Serial: 2024010101, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300,
+	}, *msg.Answers[5].SOA)
+
+	require.NotNil(t, msg.Answers[6].CAA)
+	assert.Equal(t, dns.CAA{Flags: 0, Tag: "issue", Value: "letsencrypt.org"}, *msg.Answers[6].CAA)
+
+	https := msg.Answers[7]
+	assert.Equal(t, uint16(1), https.Preference)
+	assert.Equal(t, "", https.Target, "the root target means the owner name")
+
+	assert.Equal(t, "localhost", msg.Answers[8].Target)
+
+	unknown := msg.Answers[9]
+	assert.Equal(t, "TYPE99", unknown.Type.String())
+	assert.Equal(t, []byte{1, 2, 3}, unknown.Data)
+}
+
+func TestDecode_EDNS(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	cookie := []byte{0, dns.EDNSOptionCookie, 0, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+	// Extended RCode 1 with header RCode 0 is BADVERS (16); DO is set.
+	opt := gen.GenerateDNSRecord([]byte{0}, uint16(dns.TypeOPT), 1232, 0x01008000, cookie)
+
+	msg, err := dns.Decode(gen.GenerateDNSMessage(1, flagsResponse,
+		[][]byte{gen.GenerateDNSQuestion("example.com", uint16(dns.TypeA))}, nil, nil, [][]byte{opt}))
+	require.NoError(t, err)
+
+	require.NotNil(t, msg.EDNS)
+	assert.Equal(t, uint16(1232), msg.EDNS.UDPSize)
+	assert.Equal(t, uint8(0), msg.EDNS.Version)
+	assert.True(t, msg.EDNS.DNSSECOK)
+	require.Len(t, msg.EDNS.Options, 1)
+	assert.Equal(t, uint16(dns.EDNSOptionCookie), msg.EDNS.Options[0].Code)
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, msg.EDNS.Options[0].Data)
+	assert.Empty(t, msg.Additional, "OPT is not kept as an additional record")
+	assert.Equal(t, dns.RCodeBadVersion, msg.Header.RCode)
+	assert.Equal(t, "BADVERS", msg.Header.RCode.String())
+}
+
+func TestDecode_RejectsSecondOPT(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	opt := gen.GenerateDNSRecord([]byte{0}, uint16(dns.TypeOPT), 1232, 0, nil)
+
+	_, err := dns.Decode(gen.GenerateDNSMessage(1, flagsResponse, nil, nil, nil, [][]byte{opt, opt}))
+	assert.ErrorIs(t, err, dns.ErrExtraOPT)
+}
+
+func TestDecode_Malformed(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	question := gen.GenerateDNSQuestion("example.com", uint16(dns.TypeA))
+	valid := gen.GenerateDNSMessage(1, flagsResponse, [][]byte{question},
+		[][]byte{gen.GenerateDNSRecord(pointer(dns.HeaderSize), uint16(dns.TypeA), 1, 60, []byte{10, 0, 0, 1})}, nil, nil)
+
+	longName := make([]byte, 0, 300)
+	for i := 0; i < 5; i++ {
+		longName = append(longName, 63)
+		longName = append(longName, make([]byte, 63)...)
+	}
+	longName = append(longName, 0)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"short header", valid[:dns.HeaderSize-1], dns.ErrTruncated},
+		{"truncated question", valid[:dns.HeaderSize+5], dns.ErrTruncated},
+		{"truncated rdata", valid[:len(valid)-1], dns.ErrTruncated},
+		{"pointer loop", gen.GenerateDNSMessage(1, flagsQuery,
+			[][]byte{append(pointer(dns.HeaderSize), 0, 1, 0, 1)}, nil, nil, nil), dns.ErrBadName},
+		{"name too long", gen.GenerateDNSMessage(1, flagsQuery,
+			[][]byte{append(longName, 0, 1, 0, 1)}, nil, nil, nil), dns.ErrBadName},
+		{"reserved label type", gen.GenerateDNSMessage(1, flagsQuery,
+			[][]byte{{0x40, 0, 0, 1, 0, 1}}, nil, nil, nil), dns.ErrBadName},
+		{"A record length", gen.GenerateDNSMessage(1, flagsResponse, nil,
+			[][]byte{gen.GenerateDNSRecord([]byte{0}, uint16(dns.TypeA), 1, 60, []byte{10, 0, 0})}, nil, nil), dns.ErrBadRecord},
+		{"TXT string overrun", gen.GenerateDNSMessage(1, flagsResponse, nil,
+			[][]byte{gen.GenerateDNSRecord([]byte{0}, uint16(dns.TypeTXT), 1, 60, []byte{5, 'a'})}, nil, nil), dns.ErrBadRecord},
+		{"name runs past rdata", gen.GenerateDNSMessage(1, flagsResponse, nil,
+			[][]byte{append(gen.GenerateDNSRecord([]byte{0}, uint16(dns.TypeCNAME), 1, 60, []byte{3, 'w', 'w'}), 'w', 0)}, nil, nil), dns.ErrTruncated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := dns.Decode(tt.data)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestDecode_EscapesLabels(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	name := []byte{5, 'a', '.', 'b', ' ', 0xFF, 3, 'c', 'o', 'm', 0}
+
+	msg, err := dns.Decode(gen.GenerateDNSMessage(1, flagsQuery, [][]byte{append(name, 0, 1, 0, 1)}, nil, nil, nil))
+	require.NoError(t, err)
+	assert.Equal(t, `a\.b\032\255.com`, msg.QueryName())
+}
+
+func TestDecodeTCP(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	message := gen.GenerateDNSMessage(7, flagsQuery,
+		[][]byte{gen.GenerateDNSQuestion("example.org", uint16(dns.TypeMX))}, nil, nil, nil)
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(message)))
+	framed = append(framed, message...)
+
+	msg, err := dns.DecodeTCP(framed)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(7), msg.Header.ID)
+	assert.Equal(t, "example.org", msg.QueryName())
+
+	_, err = dns.DecodeTCP(framed[:len(framed)-1])
+	assert.ErrorIs(t, err, dns.ErrTruncated)
+
+	_, err = dns.DecodeTCP(framed[:1])
+	assert.ErrorIs(t, err, dns.ErrBadTCPFrame)
+}
@@ -0,0 +1,263 @@
+package dns
+
+import (
+	"encoding/binary"
+	"log/slog"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/dns"
+	"github.com/Karias-sys/Traffic_Monitor/internal/stream"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	clientMAC = []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	serverMAC = []byte{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb}
+	clientIP  = []byte{192, 168, 1, 10}
+	serverIP  = []byte{192, 168, 1, 1}
+)
+
+func createTestLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+}
+
+// aResponse builds a response to an A query for name, answered through a
+// CNAME to canonical when that is not empty.
+func aResponse(name, canonical string, ttl uint32, addrs ...string) []byte {
+	gen := mocks.NewPacketGenerator()
+	owner := gen.GenerateDNSName(name)
+
+	var answers [][]byte
+	if canonical != "" {
+		answers = append(answers, gen.GenerateDNSRecord(owner, uint16(dns.TypeCNAME), 1, ttl, gen.GenerateDNSName(canonical)))
+		owner = gen.GenerateDNSName(canonical)
+	}
+	for _, addr := range addrs {
+		rrType := dns.TypeA
+		if netip.MustParseAddr(addr).Is6() {
+			rrType = dns.TypeAAAA
+		}
+		answers = append(answers, gen.GenerateDNSRecord(owner, uint16(rrType), 1, ttl, netip.MustParseAddr(addr).AsSlice()))
+	}
+	return gen.GenerateDNSMessage(1, flagsResponse, [][]byte{gen.GenerateDNSQuestion(name, uint16(dns.TypeA))}, answers, nil, nil)
+}
+
+func udpPacket(t *testing.T, srcPort, dstPort uint16, payload []byte) *capture.ParsedPacket {
+	t.Helper()
+	gen := mocks.NewPacketGenerator()
+	packet, err := capture.ParsePacket(gen.GenerateCompletePacket(serverMAC, clientMAC, serverIP, clientIP, 17, srcPort, dstPort, payload))
+	require.NoError(t, err)
+	return packet
+}
+
+func observe(t *testing.T, store *dns.Store, payload []byte, timestamp time.Time) {
+	t.Helper()
+	msg, err := dns.Decode(payload)
+	require.NoError(t, err)
+	store.Observe(msg, timestamp)
+}
+
+func TestStore_LearnsFromResponsePackets(t *testing.T) {
+	store := dns.NewStore(createTestLogger())
+	now := time.Unix(1000, 0)
+	gen := mocks.NewPacketGenerator()
+
+	query := gen.GenerateDNSMessage(1, flagsQuery, [][]byte{gen.GenerateDNSQuestion("example.com", uint16(dns.TypeA))}, nil, nil, nil)
+	store.ObservePacket(udpPacket(t, 40000, dns.Port, query), now)
+	store.ObservePacket(udpPacket(t, dns.Port, 40000, aResponse("example.com", "", 300, "93.184.216.34", "2606:2800:220:1::1")), now)
+
+	name, ok := store.Hostname(netip.MustParseAddr("93.184.216.34"), now)
+	require.True(t, ok)
+	assert.Equal(t, "example.com", name)
+
+	resolutions := store.Lookup(netip.MustParseAddr("2606:2800:220:1::1"))
+	require.Len(t, resolutions, 1)
+	assert.Equal(t, dns.Resolution{
+		IP:           "2606:2800:220:1::1",
+		Name:         "example.com",
+		TTL:          300,
+		FirstSeen:    now,
+		LastSeen:     now,
+		Expires:      now.Add(time.Hour),
+		Observations: 1,
+	}, resolutions[0])
+
+	stats := store.GetStatistics()
+	assert.Equal(t, 2, stats.Addresses)
+	assert.Equal(t, uint64(1), stats.Queries)
+	assert.Equal(t, uint64(1), stats.Responses)
+	assert.Equal(t, uint64(2), stats.AddressAnswer)
+}
+
+func TestStore_IgnoresOtherPortsAndCountsDecodeErrors(t *testing.T) {
+	store := dns.NewStore(createTestLogger())
+
+	store.ObservePacket(udpPacket(t, 443, 40000, aResponse("example.com", "", 300, "10.0.0.1")), time.Now())
+	assert.Equal(t, 0, store.Len())
+
+	store.ObservePacket(udpPacket(t, dns.Port, 40000, []byte{1, 2, 3}), time.Now())
+	assert.Equal(t, uint64(1), store.GetStatistics().DecodeErrors)
+}
+
+func TestStore_DecodesTCPMessages(t *testing.T) {
+	store := dns.NewStore(createTestLogger())
+	now := time.Unix(1000, 0)
+
+	key := stream.ConnectionKey{
+		ClientIP:   netip.AddrFrom4([4]byte(clientIP)),
+		ClientPort: 40000,
+		ServerIP:   netip.AddrFrom4([4]byte(serverIP)),
+		ServerPort: dns.Port,
+	}
+	consumer := store.ConsumerFactory(key)
+	require.NotNil(t, consumer)
+
+	var data []byte
+	for _, msg := range [][]byte{
+		aResponse("example.net", "", 60, "10.0.0.2"),
+		aResponse("example.org", "", 60, "10.0.0.3"),
+		{1, 2, 3},
+	} {
+		data = binary.BigEndian.AppendUint16(data, uint16(len(msg)))
+		data = append(data, msg...)
+	}
+
+	// A message split across segments is decoded once it is whole, and
+	// a segment may complete one message and start the next.
+	consumer.Data(stream.ServerToClient, data[:10], now)
+	assert.Equal(t, 0, store.Len())
+	split := 2 + len(aResponse("example.net", "", 60, "10.0.0.2")) + 5
+	consumer.Data(stream.ServerToClient, data[10:split], now)
+	name, ok := store.Hostname(netip.MustParseAddr("10.0.0.2"), now)
+	require.True(t, ok)
+	assert.Equal(t, "example.net", name)
+	assert.Equal(t, 1, store.Len())
+
+	consumer.Data(stream.ServerToClient, data[split:], now)
+	name, ok = store.Hostname(netip.MustParseAddr("10.0.0.3"), now)
+	require.True(t, ok)
+	assert.Equal(t, "example.org", name)
+	assert.Equal(t, uint64(1), store.GetStatistics().DecodeErrors)
+
+	// Message boundaries are lost with a gap.
+	consumer.Gap(stream.ClientToServer, 100)
+	consumer.Data(stream.ClientToServer, data, now)
+	assert.Equal(t, uint64(2), store.GetStatistics().Responses)
+	consumer.Close(stream.CloseFIN)
+
+	key.ServerPort = 443
+	assert.Nil(t, store.ConsumerFactory(key))
+
+	// Segments seen outside a stream are not decoded.
+	gen := mocks.NewPacketGenerator()
+	packet, err := capture.ParsePacket(gen.GenerateCompletePacket(serverMAC, clientMAC, serverIP, clientIP, 6, dns.Port, 40000, data))
+	require.NoError(t, err)
+	store.ObservePacket(packet, now)
+	assert.Equal(t, uint64(2), store.GetStatistics().Responses)
+}
+
+func TestStore_FollowsCNAMEChain(t *testing.T) {
+	store := dns.NewStore(createTestLogger())
+	observe(t, store, aResponse("www.example.com", "edge.cdn.net", 30, "203.0.113.7"), time.Now())
+
+	resolutions := store.Lookup(netip.MustParseAddr("203.0.113.7"))
+	require.Len(t, resolutions, 1)
+	assert.Equal(t, "www.example.com", resolutions[0].Name)
+	assert.Equal(t, "edge.cdn.net", resolutions[0].Canonical)
+}
+
+func TestStore_KeepsNamesMostRecentFirst(t *testing.T) {
+	store := dns.NewStoreWithConfig(createTestLogger(), dns.StoreConfig{MaxNamesPerAddress: 2})
+	start := time.Unix(1000, 0)
+
+	observe(t, store, aResponse("a.example", "", 60, "198.51.100.1"), start)
+	observe(t, store, aResponse("b.example", "", 60, "198.51.100.1"), start.Add(time.Second))
+	observe(t, store, aResponse("a.example", "", 60, "198.51.100.1"), start.Add(2*time.Second))
+
+	resolutions := store.Lookup(netip.MustParseAddr("198.51.100.1"))
+	require.Len(t, resolutions, 2)
+	assert.Equal(t, "a.example", resolutions[0].Name)
+	assert.Equal(t, uint64(2), resolutions[0].Observations)
+	assert.Equal(t, start, resolutions[0].FirstSeen)
+	assert.Equal(t, "b.example", resolutions[1].Name)
+
+	observe(t, store, aResponse("c.example", "", 60, "198.51.100.1"), start.Add(3*time.Second))
+	resolutions = store.Lookup(netip.MustParseAddr("198.51.100.1"))
+	require.Len(t, resolutions, 2)
+	assert.Equal(t, "c.example", resolutions[0].Name)
+	assert.Equal(t, "a.example", resolutions[1].Name, "the least recently seen name is dropped")
+}
+
+func TestStore_ExpiresPastTTLAndRetention(t *testing.T) {
+	store := dns.NewStoreWithConfig(createTestLogger(), dns.StoreConfig{MinRetention: time.Minute})
+	start := time.Unix(1000, 0)
+
+	observe(t, store, aResponse("short.example", "", 10, "10.0.0.1"), start)
+	observe(t, store, aResponse("long.example", "", 3600, "10.0.0.2"), start)
+
+	assert.Equal(t, 0, store.Expire(start.Add(time.Minute)))
+	assert.Equal(t, 1, store.Expire(start.Add(time.Minute+time.Second)))
+
+	_, ok := store.Hostname(netip.MustParseAddr("10.0.0.1"), start)
+	assert.False(t, ok)
+	_, ok = store.Hostname(netip.MustParseAddr("10.0.0.2"), start)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), store.GetStatistics().Expired)
+}
+
+func TestStore_HostnameSkipsExpiredNames(t *testing.T) {
+	store := dns.NewStoreWithConfig(createTestLogger(), dns.StoreConfig{MinRetention: time.Minute})
+	start := time.Unix(1000, 0)
+	ip := netip.MustParseAddr("10.0.0.1")
+
+	observe(t, store, aResponse("long.example", "", 3600, "10.0.0.1"), start)
+	observe(t, store, aResponse("short.example", "", 10, "10.0.0.1"), start.Add(time.Second))
+
+	name, ok := store.Hostname(ip, start.Add(time.Minute))
+	require.True(t, ok)
+	assert.Equal(t, "short.example", name)
+
+	// Without Expire having run, the expired name is still held but
+	// no longer answered.
+	name, ok = store.Hostname(ip, start.Add(2*time.Minute))
+	require.True(t, ok)
+	assert.Equal(t, "long.example", name)
+
+	_, ok = store.Hostname(ip, start.Add(2*time.Hour))
+	assert.False(t, ok)
+	assert.Len(t, store.Lookup(ip), 2)
+}
+
+func TestStore_EvictsLeastRecentAddress(t *testing.T) {
+	store := dns.NewStoreWithConfig(createTestLogger(), dns.StoreConfig{MaxAddresses: 2})
+	start := time.Unix(1000, 0)
+
+	observe(t, store, aResponse("one.example", "", 60, "10.0.0.1"), start)
+	observe(t, store, aResponse("two.example", "", 60, "10.0.0.2"), start.Add(time.Second))
+	observe(t, store, aResponse("one.example", "", 60, "10.0.0.1"), start.Add(2*time.Second))
+	observe(t, store, aResponse("three.example", "", 60, "10.0.0.3"), start.Add(3*time.Second))
+
+	entries := store.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "10.0.0.1", entries[0].IP)
+	assert.Equal(t, "10.0.0.3", entries[1].IP)
+	assert.Equal(t, uint64(1), store.GetStatistics().Evictions)
+}
+
+func TestStore_LookupAcceptsMappedIPv4(t *testing.T) {
+	store := dns.NewStore(createTestLogger())
+	now := time.Now()
+	observe(t, store, aResponse("example.com", "", 60, "10.0.0.1"), now)
+
+	name, ok := store.Hostname(netip.MustParseAddr("::ffff:10.0.0.1"), now)
+	require.True(t, ok)
+	assert.Equal(t, "example.com", name)
+}
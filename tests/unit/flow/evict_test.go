@@ -0,0 +1,107 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/flow"
+	"github.com/Karias-sys/Traffic_Monitor/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTable_EvictionPolicy(t *testing.T) {
+	payload := make([]byte, 100)
+
+	tests := []struct {
+		policy  flow.EvictionPolicy
+		evicted uint16 // source port of the evicted flow
+	}{
+		{flow.EvictLRU, 1002},
+		{flow.EvictOldest, 1001},
+		{flow.EvictSampledSmallest, 1003},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			table := flow.NewTableWithConfig(createTestLogger(), flow.TableConfig{
+				MaxFlows:       3,
+				EvictionPolicy: tt.policy,
+			})
+			ended := recordEnds(table)
+			start := time.Unix(1000, 0)
+
+			// 1001 started first, 1002 was seen least recently and 1003
+			// carried the fewest bytes.
+			table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 1001, 80, capture.TCPFlagACK, nil), start)
+			table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 1002, 80, capture.TCPFlagACK, payload), start.Add(time.Second))
+			table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 1003, 80, capture.TCPFlagACK, nil), start.Add(2*time.Second))
+			table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 1001, 80, capture.TCPFlagACK, payload), start.Add(3*time.Second))
+
+			table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 1004, 80, capture.TCPFlagACK, nil), start.Add(4*time.Second))
+			require.Len(t, *ended, 1)
+			assert.Equal(t, tt.evicted, (*ended)[0].flow.SrcPort)
+			assert.Equal(t, flow.EndEvicted, (*ended)[0].reason)
+
+			stats := table.GetStatistics()
+			assert.Equal(t, 3, stats.Flows)
+			assert.Equal(t, uint64(1), stats.Evictions)
+			assert.Equal(t, (*ended)[0].flow.Packets, stats.EvictedPackets)
+			assert.Equal(t, (*ended)[0].flow.Bytes, stats.EvictedBytes)
+		})
+	}
+}
+
+func TestTable_ReportMetrics(t *testing.T) {
+	table := flow.NewTableWithConfig(createTestLogger(), flow.TableConfig{MaxFlows: 2})
+	start := time.Unix(1000, 0)
+
+	for port := uint16(1001); port <= 1003; port++ {
+		table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, port, 80, capture.TCPFlagACK, nil), start)
+	}
+
+	collector := metrics.NewSystemMetricsCollector(createTestLogger())
+	table.ReportMetrics(collector)
+
+	stats := table.GetStatistics()
+	flowMetrics := collector.GetFlowMetrics()
+	assert.Equal(t, 2, flowMetrics.Flows)
+	assert.Equal(t, uint64(3), flowMetrics.FlowsCreated)
+	assert.Equal(t, uint64(1), flowMetrics.Evictions)
+	assert.Equal(t, stats.EvictedPackets, flowMetrics.EvictedPackets)
+	assert.Equal(t, stats.EvictedBytes, flowMetrics.EvictedBytes)
+}
+
+func TestTable_EvictsHandshakesBeforeOpen(t *testing.T) {
+	table := flow.NewTableWithConfig(createTestLogger(), flow.TableConfig{MaxFlows: 2})
+	ended := recordEnds(table)
+	start := time.Unix(1000, 0)
+
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 1001, 80, capture.TCPFlagACK, nil), start)
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 1002, 80, capture.TCPFlagSYN, nil), start.Add(time.Second))
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 1003, 80, capture.TCPFlagACK, nil), start.Add(2*time.Second))
+
+	require.Len(t, *ended, 1)
+	assert.Equal(t, uint16(1002), (*ended)[0].flow.SrcPort)
+	assert.Equal(t, uint64(1), table.GetStatistics().FailedHandshakes)
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	for name, want := range map[string]flow.EvictionPolicy{
+		"":                 flow.EvictLRU,
+		"lru":              flow.EvictLRU,
+		"Oldest":           flow.EvictOldest,
+		"sampled_smallest": flow.EvictSampledSmallest,
+	} {
+		policy, err := flow.ParseEvictionPolicy(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, policy, name)
+	}
+
+	_, err := flow.ParseEvictionPolicy("random")
+	assert.EqualError(t, err, "unknown eviction policy: random")
+	// Only an approximation of the smallest flow is offered.
+	_, err = flow.ParseEvictionPolicy("smallest")
+	assert.Error(t, err)
+}
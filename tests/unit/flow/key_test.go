@@ -0,0 +1,134 @@
+package flow
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/flow"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyFromPacket(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+
+	key, ok := flow.KeyFromPacket(3, tcpPacket(t, clientIP, serverIP, 49152, 443, capture.TCPFlagSYN, nil))
+	require.True(t, ok)
+	assert.Equal(t, flow.Key{
+		Interface: 3,
+		Protocol:  capture.IPProtoTCP,
+		SrcIP:     netip.MustParseAddr("192.168.1.10"),
+		DstIP:     netip.MustParseAddr("10.0.0.1"),
+		SrcPort:   49152,
+		DstPort:   443,
+	}, key)
+	assert.Equal(t, "tcp 192.168.1.10:49152 -> 10.0.0.1:443 if 3", key.String())
+
+	// The outermost VLAN qualifies the key.
+	tagged := gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeVLAN,
+		append(gen.GenerateVLANTag(0, 100, capture.EtherTypeIPv4),
+			gen.GenerateIPv4Packet(clientIP, serverIP, capture.IPProtoUDP, gen.GenerateUDPDatagram(5353, 53, []byte("q")))...))
+	key, ok = flow.KeyFromPacket(1, parse(t, tagged))
+	require.True(t, ok)
+	assert.Equal(t, uint16(100), key.VLAN)
+	assert.Equal(t, uint8(capture.IPProtoUDP), key.Protocol)
+	assert.Equal(t, "udp 192.168.1.10:5353 -> 10.0.0.1:53 vlan 100 if 1", key.String())
+
+	// Echo requests and replies use the identifier as both ports.
+	echo := gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(clientIP, serverIP, capture.IPProtoICMP,
+			gen.GenerateICMPMessage(capture.ICMPv4EchoRequest, 0, [4]byte{0x12, 0x34, 0, 1}, nil)))
+	key, ok = flow.KeyFromPacket(1, parse(t, echo))
+	require.True(t, ok)
+	assert.Equal(t, uint16(0x1234), key.SrcPort)
+	assert.Equal(t, uint16(0x1234), key.DstPort)
+
+	// Tunnelled traffic is keyed on the inner packet.
+	inner := gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(clientIP, serverIP, capture.IPProtoTCP, gen.GenerateTCPSegment(40000, 22, capture.TCPFlagACK, nil)))
+	vxlan := gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet([]byte{172, 16, 0, 1}, []byte{172, 16, 0, 2}, capture.IPProtoUDP,
+			gen.GenerateUDPDatagram(50000, 4789, gen.GenerateVXLANHeader(5001, inner))))
+	key, ok = flow.KeyFromPacket(1, parse(t, vxlan))
+	require.True(t, ok)
+	assert.Equal(t, uint32(5001), key.TunnelID)
+	assert.True(t, key.HasTunnelID)
+	assert.Equal(t, "tcp 192.168.1.10:40000 -> 10.0.0.1:22 tunnel 5001 if 1", key.String())
+
+	// So is GRE, qualified by its key.
+	gre := gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet([]byte{172, 16, 0, 1}, []byte{172, 16, 0, 2}, capture.IPProtoGRE,
+			gen.GenerateGREHeader(capture.EtherTypeIPv4, 42,
+				gen.GenerateIPv4Packet(clientIP, serverIP, capture.IPProtoTCP, gen.GenerateTCPSegment(40000, 22, capture.TCPFlagACK, nil)))))
+	key, ok = flow.KeyFromPacket(1, parse(t, gre))
+	require.True(t, ok)
+	assert.Equal(t, uint32(42), key.TunnelID)
+	assert.Equal(t, uint16(40000), key.SrcPort)
+
+	arp := gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeARP,
+		gen.GenerateARPPacket(capture.ARPOperationRequest, clientMAC, clientIP, make([]byte, 6), serverIP))
+	_, ok = flow.KeyFromPacket(1, parse(t, arp))
+	assert.False(t, ok)
+}
+
+func TestKeyFromPacket_Reassembled(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	// A VLAN-tagged VXLAN frame carrying ip.
+	frame := func(ip []byte) []byte {
+		inner := gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeIPv4, ip)
+		return gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeVLAN,
+			append(gen.GenerateVLANTag(0, 100, capture.EtherTypeIPv4),
+				gen.GenerateIPv4Packet([]byte{172, 16, 0, 1}, []byte{172, 16, 0, 2}, capture.IPProtoUDP,
+					gen.GenerateUDPDatagram(50000, capture.VXLANPort, gen.GenerateVXLANHeader(5001, inner)))...))
+	}
+
+	whole := gen.GenerateIPv4Packet(clientIP, serverIP, capture.IPProtoUDP,
+		gen.GenerateUDPDatagram(5353, 53, bytes.Repeat([]byte("q"), 100)))
+	want, ok := flow.KeyFromPacket(1, parse(t, frame(whole)))
+	require.True(t, ok)
+
+	segment := whole[capture.IPv4HeaderMinSize:]
+	reassembler := capture.NewReassembler(capture.DefaultReassemblyConfig())
+	var datagram capture.ParsedPacket
+	for offset, complete := 0, false; !complete; offset += 64 {
+		end := min(offset+64, len(segment))
+		fragment := gen.GenerateIPv4Fragment(clientIP, serverIP, capture.IPProtoUDP, 7,
+			uint16(offset/8), end < len(segment), segment[offset:end])
+		complete = reassembler.Reassemble(parse(t, frame(fragment)), time.Now(), &datagram)
+		require.True(t, complete || end < len(segment))
+	}
+
+	key, ok := flow.KeyFromPacket(1, &datagram)
+	require.True(t, ok)
+	assert.Equal(t, want, key)
+	assert.Equal(t, "udp 192.168.1.10:5353 -> 10.0.0.1:53 vlan 100 tunnel 5001 if 1", key.String())
+}
+
+func TestKey_Hash(t *testing.T) {
+	key := flow.Key{
+		Interface: 1,
+		Protocol:  capture.IPProtoUDP,
+		SrcIP:     netip.MustParseAddr("192.168.1.10"),
+		DstIP:     netip.MustParseAddr("10.0.0.1"),
+		SrcPort:   5353,
+		DstPort:   53,
+	}
+	assert.Equal(t, key.Hash(), key.Hash())
+
+	other := key
+	other.VLAN = 10
+	assert.NotEqual(t, key.Hash(), other.Hash())
+	other = key
+	other.SrcPort, other.DstPort = key.DstPort, key.SrcPort
+	assert.NotEqual(t, key.Hash(), other.Hash())
+}
+
+func TestProtocolName(t *testing.T) {
+	assert.Equal(t, "tcp", flow.ProtocolName(capture.IPProtoTCP))
+	assert.Equal(t, "icmpv6", flow.ProtocolName(capture.IPProtoICMPv6))
+	assert.Equal(t, "ip-proto-132", flow.ProtocolName(132))
+}
@@ -0,0 +1,588 @@
+package flow
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/classify"
+	"github.com/Karias-sys/Traffic_Monitor/internal/flow"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	clientMAC = []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	serverMAC = []byte{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb}
+	clientIP  = []byte{192, 168, 1, 10}
+	serverIP  = []byte{10, 0, 0, 1}
+	otherIP   = []byte{10, 0, 0, 2}
+)
+
+func createTestLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+}
+
+func parse(t *testing.T, frame []byte) *capture.ParsedPacket {
+	t.Helper()
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+	return packet
+}
+
+func tcpPacket(t *testing.T, src, dst []byte, srcPort, dstPort uint16, flags uint8, payload []byte) *capture.ParsedPacket {
+	t.Helper()
+	gen := mocks.NewPacketGenerator()
+	return parse(t, gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(src, dst, capture.IPProtoTCP, gen.GenerateTCPSegment(srcPort, dstPort, flags, payload))))
+}
+
+type endedFlow struct {
+	flow   flow.NetworkFlow
+	reason flow.EndReason
+}
+
+func recordEnds(table *flow.Table) *[]endedFlow {
+	var ended []endedFlow
+	table.OnEnd(func(f flow.NetworkFlow, reason flow.EndReason) {
+		ended = append(ended, endedFlow{f, reason})
+	})
+	return &ended
+}
+
+func TestTable_CountsPackets(t *testing.T) {
+	table := flow.NewTable(createTestLogger())
+	first := time.Unix(1000, 0)
+
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 49152, 80, capture.TCPFlagSYN, nil), first)
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 49152, 80, capture.TCPFlagACK, nil), first.Add(time.Second))
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 49152, 80, capture.TCPFlagPSH|capture.TCPFlagACK, []byte("GET / HTTP/1.1\r\n")), first.Add(2*time.Second))
+
+	key, ok := flow.KeyFromPacket(1, tcpPacket(t, clientIP, serverIP, 49152, 80, 0, nil))
+	require.True(t, ok)
+	f, ok := table.Lookup(key)
+	require.True(t, ok)
+	assert.Equal(t, uint64(3), f.Packets)
+	assert.Equal(t, uint64(40+40+56), f.Bytes)
+	assert.Equal(t, first, f.FirstSeen)
+	assert.Equal(t, first.Add(2*time.Second), f.LastSeen)
+	assert.Equal(t, 2*time.Second, f.Duration)
+	assert.Equal(t, "tcp", f.ProtocolName)
+	assert.Equal(t, "192.168.1.10", f.SrcIP)
+	assert.Equal(t, uint16(80), f.DstPort)
+	assert.Len(t, f.FlowKey, 16)
+
+	// Each interface and VLAN is a flow of its own.
+	table.ObservePacket(2, tcpPacket(t, clientIP, serverIP, 49152, 80, capture.TCPFlagACK, nil), first)
+	table.ObservePacket(1, tcpPacket(t, clientIP, otherIP, 49152, 80, capture.TCPFlagACK, nil), first)
+	assert.Equal(t, 3, table.Len())
+
+	flows := table.Flows()
+	require.Len(t, flows, 3)
+	assert.Equal(t, f, flows[0])
+
+	stats := table.GetStatistics()
+	assert.Equal(t, 3, stats.Flows)
+	assert.Equal(t, uint64(5), stats.Packets)
+	assert.Equal(t, uint64(216), stats.Bytes)
+	assert.Equal(t, uint64(3), stats.FlowsCreated)
+}
+
+func TestTable_TunnelTenants(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	table := flow.NewTable(createTestLogger())
+	now := time.Unix(1000, 0)
+
+	// Two VXLAN tenants using the same addresses and ports.
+	inner := gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(clientIP, serverIP, capture.IPProtoTCP, gen.GenerateTCPSegment(40000, 22, capture.TCPFlagSYN, nil)))
+	for _, vni := range []uint32{5001, 5002, 5001} {
+		vxlan := gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeIPv4,
+			gen.GenerateIPv4Packet([]byte{172, 16, 0, 1}, []byte{172, 16, 0, 2}, capture.IPProtoUDP,
+				gen.GenerateUDPDatagram(50000, 4789, gen.GenerateVXLANHeader(vni, inner))))
+		table.ObservePacket(1, parse(t, vxlan), now)
+	}
+
+	flows := table.Flows()
+	require.Len(t, flows, 2)
+	packets := map[uint32]uint64{}
+	for _, f := range flows {
+		require.NotNil(t, f.TunnelID)
+		assert.Equal(t, "192.168.1.10", f.SrcIP)
+		packets[*f.TunnelID] = f.Packets
+	}
+	assert.Equal(t, map[uint32]uint64{5001: 2, 5002: 1}, packets)
+
+	// Traffic outside any tunnel has no ID.
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 40000, 22, capture.TCPFlagSYN, nil), now)
+	assert.Equal(t, 3, table.Len())
+	key, ok := flow.KeyFromPacket(1, tcpPacket(t, clientIP, serverIP, 40000, 22, 0, nil))
+	require.True(t, ok)
+	f, ok := table.Lookup(key)
+	require.True(t, ok)
+	assert.Nil(t, f.TunnelID)
+}
+
+func TestTable_Bidirectional(t *testing.T) {
+	table := flow.NewTable(createTestLogger())
+	now := time.Unix(1000, 0)
+
+	request := []byte("GET / HTTP/1.1\r\n\r\n")
+	response := []byte("HTTP/1.1 204 No Content\r\n\r\n")
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 49152, 80, capture.TCPFlagSYN, nil), now)
+	table.ObservePacket(1, tcpPacket(t, serverIP, clientIP, 80, 49152, capture.TCPFlagSYN|capture.TCPFlagACK, nil), now)
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 49152, 80, capture.TCPFlagPSH|capture.TCPFlagACK, request), now)
+	table.ObservePacket(1, tcpPacket(t, serverIP, clientIP, 80, 49152, capture.TCPFlagPSH|capture.TCPFlagACK, response), now)
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 49152, 80, capture.TCPFlagFIN|capture.TCPFlagACK, nil), now)
+	require.Equal(t, 1, table.Len())
+
+	// Either direction's key finds the flow.
+	key, _ := flow.KeyFromPacket(1, tcpPacket(t, serverIP, clientIP, 80, 49152, 0, nil))
+	f, ok := table.Lookup(key)
+	require.True(t, ok)
+	assert.Equal(t, key.Reverse(), f.Key)
+	assert.Equal(t, "192.168.1.10", f.SrcIP)
+	assert.Equal(t, uint16(80), f.DstPort)
+	assert.False(t, f.InitiatorGuessed)
+
+	assert.Equal(t, flow.DirectionCounters{
+		Bytes:        40 + uint64(40+len(request)) + 40,
+		Packets:      3,
+		PayloadBytes: uint64(len(request)),
+		TCPFlags:     flow.TCPFlags(capture.TCPFlagSYN | capture.TCPFlagPSH | capture.TCPFlagACK | capture.TCPFlagFIN),
+	}, f.Initiator)
+	assert.Equal(t, flow.DirectionCounters{
+		Bytes:        40 + uint64(40+len(response)),
+		Packets:      2,
+		PayloadBytes: uint64(len(response)),
+		TCPFlags:     flow.TCPFlags(capture.TCPFlagSYN | capture.TCPFlagPSH | capture.TCPFlagACK),
+	}, f.Responder)
+	assert.Equal(t, uint64(5), f.Packets)
+	assert.Equal(t, f.Initiator.Bytes+f.Responder.Bytes, f.Bytes)
+	assert.Equal(t, "FIN,SYN,PSH,ACK", f.Initiator.TCPFlags.String())
+}
+
+func TestTable_Initiator(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	udp := func(src, dst []byte, srcPort, dstPort uint16) *capture.ParsedPacket {
+		return parse(t, gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeIPv4,
+			gen.GenerateIPv4Packet(src, dst, capture.IPProtoUDP, gen.GenerateUDPDatagram(srcPort, dstPort, []byte("x")))))
+	}
+	echo := func(src, dst []byte, typ uint8) *capture.ParsedPacket {
+		return parse(t, gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeIPv4,
+			gen.GenerateIPv4Packet(src, dst, capture.IPProtoICMP, gen.GenerateICMPMessage(typ, 0, [4]byte{0, 7, 0, 1}, nil))))
+	}
+
+	tests := []struct {
+		name      string
+		packet    *capture.ParsedPacket
+		initiator string
+		guessed   bool
+	}{
+		{"SYN", tcpPacket(t, clientIP, serverIP, 49152, 443, capture.TCPFlagSYN, nil), "192.168.1.10", false},
+		{"SYN-ACK", tcpPacket(t, serverIP, clientIP, 443, 49152, capture.TCPFlagSYN|capture.TCPFlagACK, nil), "192.168.1.10", false},
+		{"mid-stream from server", tcpPacket(t, serverIP, clientIP, 443, 49152, capture.TCPFlagACK, []byte("x")), "192.168.1.10", true},
+		{"mid-stream from client", tcpPacket(t, clientIP, serverIP, 49152, 443, capture.TCPFlagACK, []byte("x")), "192.168.1.10", true},
+		{"UDP response", udp(serverIP, clientIP, 53, 5353), "192.168.1.10", true},
+		{"echo request", echo(clientIP, serverIP, capture.ICMPv4EchoRequest), "192.168.1.10", false},
+		{"echo reply", echo(serverIP, clientIP, capture.ICMPv4EchoReply), "192.168.1.10", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := flow.NewTable(createTestLogger())
+			table.ObservePacket(1, tt.packet, time.Unix(1000, 0))
+			flows := table.Flows()
+			require.Len(t, flows, 1)
+			assert.Equal(t, tt.initiator, flows[0].SrcIP)
+			assert.Equal(t, tt.guessed, flows[0].InitiatorGuessed)
+			assert.Equal(t, uint64(1), flows[0].Initiator.Packets+flows[0].Responder.Packets)
+		})
+	}
+}
+
+func TestTable_IgnoresNonIPAndFragments(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	table := flow.NewTable(createTestLogger())
+
+	arp := gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeARP,
+		gen.GenerateARPPacket(capture.ARPOperationRequest, clientMAC, clientIP, make([]byte, 6), serverIP))
+	table.ObservePacket(1, parse(t, arp), time.Unix(1000, 0))
+
+	fragment := gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Fragment(clientIP, serverIP, capture.IPProtoUDP, 7, 0, true, gen.GenerateUDPDatagram(1000, 2000, make([]byte, 16))))
+	table.ObservePacket(1, parse(t, fragment), time.Unix(1000, 0))
+
+	stats := table.GetStatistics()
+	assert.Equal(t, 0, stats.Flows)
+	assert.Equal(t, uint64(1), stats.NonIP)
+	assert.Equal(t, uint64(1), stats.Fragments)
+}
+
+func TestTable_Expire(t *testing.T) {
+	table := flow.NewTableWithConfig(createTestLogger(), flow.TableConfig{FlowTimeout: time.Minute})
+	ended := recordEnds(table)
+	start := time.Unix(1000, 0)
+
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 49152, 22, capture.TCPFlagACK, nil), start)
+	table.ObservePacket(1, tcpPacket(t, clientIP, otherIP, 49153, 22, capture.TCPFlagACK, nil), start.Add(30*time.Second))
+
+	assert.Equal(t, 0, table.Expire(start.Add(time.Minute)))
+	assert.Equal(t, 1, table.Expire(start.Add(80*time.Second)))
+	require.Len(t, *ended, 1)
+	assert.Equal(t, "10.0.0.1", (*ended)[0].flow.DstIP)
+	assert.Equal(t, flow.EndIdle, (*ended)[0].reason)
+
+	// A packet keeps a flow alive.
+	table.ObservePacket(1, tcpPacket(t, clientIP, otherIP, 49153, 22, capture.TCPFlagACK, nil), start.Add(85*time.Second))
+	assert.Equal(t, 0, table.Expire(start.Add(2*time.Minute)))
+	assert.Equal(t, 1, table.Len())
+	assert.Equal(t, uint64(1), table.GetStatistics().Expired)
+}
+
+func TestTable_MaxFlows(t *testing.T) {
+	table := flow.NewTableWithConfig(createTestLogger(), flow.TableConfig{MaxFlows: 2})
+	ended := recordEnds(table)
+	start := time.Unix(1000, 0)
+
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 1001, 80, capture.TCPFlagACK, nil), start)
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 1002, 80, capture.TCPFlagACK, nil), start.Add(time.Second))
+	// Seeing the first flow again makes the second the least recently seen.
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 1001, 80, capture.TCPFlagACK, nil), start.Add(2*time.Second))
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 1003, 80, capture.TCPFlagACK, nil), start.Add(3*time.Second))
+
+	assert.Equal(t, 2, table.Len())
+	require.Len(t, *ended, 1)
+	assert.Equal(t, uint16(1002), (*ended)[0].flow.SrcPort)
+	assert.Equal(t, flow.EndEvicted, (*ended)[0].reason)
+	assert.Equal(t, uint64(1), table.GetStatistics().Evictions)
+
+	table.Flush()
+	assert.Equal(t, 0, table.Len())
+	require.Len(t, *ended, 3)
+	assert.Equal(t, flow.EndFlushed, (*ended)[2].reason)
+}
+
+type staticResolver map[netip.Addr]string
+
+func (r staticResolver) Hostname(ip netip.Addr, _ time.Time) (string, bool) {
+	name, ok := r[ip]
+	return name, ok
+}
+
+func TestTable_Classification(t *testing.T) {
+	table := flow.NewTable(createTestLogger())
+	table.SetClassifier(classify.NewClassifierWithConfig(createTestLogger(), classify.ClassifierConfig{
+		ServicesFile: filepath.Join(t.TempDir(), "services"),
+	}))
+	table.SetResolver(staticResolver{netip.MustParseAddr("10.0.0.1"): "www.example.com"})
+	now := time.Unix(1000, 0)
+
+	// The port is all there is to go on until payload shows up.
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 49152, 8080, capture.TCPFlagSYN, nil), now)
+	key, _ := flow.KeyFromPacket(1, tcpPacket(t, clientIP, serverIP, 49152, 8080, 0, nil))
+	f, _ := table.Lookup(key)
+	assert.Equal(t, "www.example.com", f.Hostname)
+	assert.Equal(t, classify.MethodPort, f.Application.Method)
+
+	table.ObservePacket(1, tcpPacket(t, clientIP, serverIP, 49152, 8080, capture.TCPFlagACK, []byte("SSH-2.0-OpenSSH_9.6\r\n")), now)
+	f, _ = table.Lookup(key)
+	assert.Equal(t, classify.Result{App: classify.AppSSH, Confidence: classify.ConfidenceHigh, Method: classify.MethodPayload}, f.Application)
+
+	// Analyzers report connections by their endpoints, in either order.
+	n := table.Annotate(capture.IPProtoTCP,
+		netip.MustParseAddrPort("10.0.0.1:8080"), netip.MustParseAddrPort("192.168.1.10:49152"),
+		classify.Metadata{Protocol: classify.AppTLS, ALPN: "h2", Hostname: "api.example.com"},
+		&flow.TLSInfo{JA3: "771,4865,0,29,0", JA3Hash: "0123", JA4: "t13d0101h2_0123_4567"})
+	assert.Equal(t, 1, n)
+	f, _ = table.Lookup(key)
+	assert.Equal(t, "api.example.com", f.Hostname)
+	assert.Equal(t, classify.Result{App: classify.AppHTTPS, Confidence: classify.ConfidenceHigh, Method: classify.MethodMetadata}, f.Application)
+	require.NotNil(t, f.TLS)
+	assert.Equal(t, "t13d0101h2_0123_4567", f.TLS.JA4)
+
+	// Empty fields keep what was known.
+	table.Annotate(capture.IPProtoTCP,
+		netip.MustParseAddrPort("192.168.1.10:49152"), netip.MustParseAddrPort("10.0.0.1:8080"),
+		classify.Metadata{Protocol: classify.AppTLS},
+		&flow.TLSInfo{Version: "TLS 1.3", Cipher: "TLS_AES_128_GCM_SHA256", JA3S: "771,4865,43", JA3SHash: "89ab"})
+	f, _ = table.Lookup(key)
+	assert.Equal(t, "api.example.com", f.Hostname)
+	assert.Equal(t, classify.AppHTTPS, f.Application.App)
+	assert.Equal(t, &flow.TLSInfo{
+		Version:  "TLS 1.3",
+		Cipher:   "TLS_AES_128_GCM_SHA256",
+		JA3:      "771,4865,0,29,0",
+		JA3Hash:  "0123",
+		JA4:      "t13d0101h2_0123_4567",
+		JA3S:     "771,4865,43",
+		JA3SHash: "89ab",
+	}, f.TLS)
+
+	// Server banners count as well as the client's payload.
+	table.ObservePacket(1, tcpPacket(t, serverIP, clientIP, 2525, 49200, capture.TCPFlagPSH|capture.TCPFlagACK,
+		[]byte("220 mail.example.com ESMTP Postfix\r\n")), now)
+	key, _ = flow.KeyFromPacket(1, tcpPacket(t, clientIP, serverIP, 49200, 2525, 0, nil))
+	f, _ = table.Lookup(key)
+	assert.Equal(t, classify.AppSMTP, f.Application.App)
+
+	assert.Equal(t, 0, table.Annotate(capture.IPProtoUDP,
+		netip.MustParseAddrPort("192.168.1.10:49152"), netip.MustParseAddrPort("10.0.0.1:8080"), classify.Metadata{Protocol: classify.AppQUIC}, nil))
+}
+
+func TestTable_Shards(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxFlows int
+		shards   int
+		want     int
+	}{
+		{"default", 100000, 0, 64},
+		{"power of two", 100000, 48, 32},
+		{"small table", 4096, 64, 4},
+		{"tiny table", 2, 64, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := flow.NewTableWithConfig(createTestLogger(), flow.TableConfig{MaxFlows: tt.maxFlows, Shards: tt.shards})
+			assert.Equal(t, tt.want, table.GetStatistics().Shards)
+		})
+	}
+
+	// The shards' capacities add up to MaxFlows.
+	table := flow.NewTableWithConfig(createTestLogger(), flow.TableConfig{MaxFlows: 3000, Shards: 2})
+	start := time.Unix(1000, 0)
+	packet := tcpPacket(t, clientIP, serverIP, 0, 80, capture.TCPFlagACK, nil)
+	for i := 0; i < 6000; i++ {
+		packet.TCP.SrcPort = uint16(1024 + i)
+		table.ObservePacket(1, packet, start)
+	}
+	assert.Equal(t, 3000, table.Len())
+	assert.Equal(t, uint64(3000), table.GetStatistics().Evictions)
+}
+
+func TestTable_Concurrent(t *testing.T) {
+	table := flow.NewTable(createTestLogger())
+	ended := 0
+	var mu sync.Mutex
+	table.OnEnd(func(flow.NetworkFlow, flow.EndReason) {
+		mu.Lock()
+		ended++
+		mu.Unlock()
+	})
+	start := time.Unix(1000, 0)
+
+	// Each goroutine sees both directions of its own connections and
+	// shares one more with all the others.
+	const workers, connections = 8, 100
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		request := tcpPacket(t, clientIP, serverIP, 0, 80, capture.TCPFlagACK, nil)
+		reply := tcpPacket(t, serverIP, clientIP, 80, 0, capture.TCPFlagACK, nil)
+		shared := tcpPacket(t, clientIP, otherIP, 40000, 443, capture.TCPFlagACK, nil)
+		base := uint16(10000 + w*connections)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := uint16(0); i < connections; i++ {
+				request.TCP.SrcPort = base + i
+				reply.TCP.DstPort = base + i
+				table.ObservePacket(1, request, start)
+				table.ObservePacket(1, reply, start)
+				table.ObservePacket(1, shared, start)
+				_ = table.Flows()
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := table.GetStatistics()
+	assert.Equal(t, workers*connections+1, stats.Flows)
+	assert.Equal(t, uint64(3*workers*connections), stats.Packets)
+
+	key, ok := flow.KeyFromPacket(1, tcpPacket(t, clientIP, otherIP, 40000, 443, 0, nil))
+	require.True(t, ok)
+	f, ok := table.Lookup(key)
+	require.True(t, ok)
+	assert.Equal(t, uint64(workers*connections), f.Packets)
+
+	table.Flush()
+	assert.Equal(t, workers*connections+1, ended)
+}
+
+func TestTable_Partition(t *testing.T) {
+	table := flow.NewTableWithConfig(createTestLogger(), flow.TableConfig{MaxFlows: 64 * 1024, Shards: 64})
+	start := time.Unix(1000, 0)
+
+	// Observations are taken on one goroutine and applied by the worker
+	// their flow falls to, as the pipeline does.
+	const workers, connections = 4, 1000
+	work := make([]chan flow.Observation, workers)
+	var wg sync.WaitGroup
+	for i := range work {
+		work[i] = make(chan flow.Observation, 16)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for o := range work[i] {
+				table.Apply(&o)
+			}
+		}()
+	}
+
+	request := tcpPacket(t, clientIP, serverIP, 0, 80, capture.TCPFlagSYN, nil)
+	reply := tcpPacket(t, serverIP, clientIP, 80, 0, capture.TCPFlagSYN|capture.TCPFlagACK, nil)
+	for i := uint16(0); i < connections; i++ {
+		request.TCP.SrcPort = 10000 + i
+		reply.TCP.DstPort = 10000 + i
+		var partitions []int
+		for _, packet := range []*capture.ParsedPacket{request, reply} {
+			o, ok := table.Observation(1, packet, start)
+			require.True(t, ok)
+			partition := table.Partition(o.Key, workers)
+			partitions = append(partitions, partition)
+			work[partition] <- o
+		}
+		require.Equal(t, partitions[0], partitions[1], "both directions go to one worker")
+	}
+	for i := range work {
+		close(work[i])
+	}
+	wg.Wait()
+
+	stats := table.GetStatistics()
+	assert.Equal(t, connections, stats.Flows)
+	assert.Equal(t, uint64(2*connections), stats.Packets)
+	for _, f := range table.Flows() {
+		assert.Equal(t, flow.TCPStateSynReceived, f.TCPState)
+		assert.Equal(t, uint64(1), f.Responder.Packets)
+	}
+}
+
+// fillPacket turns packet into one of the i-th flow of a benchmark: a
+// distinct client address for each of 16M flows, then a distinct port.
+func fillPacket(packet *capture.ParsedPacket, i int) {
+	packet.IPv4.SrcIP = netip.AddrFrom4([4]byte{10, byte(i >> 16), byte(i >> 8), byte(i)})
+	packet.TCP.SrcPort = uint16(1024 + i>>24)
+}
+
+func benchmarkPacket(b *testing.B) *capture.ParsedPacket {
+	gen := mocks.NewPacketGenerator()
+	packet, err := capture.ParsePacket(gen.GenerateEthernetFrame(clientMAC, serverMAC, capture.EtherTypeIPv4,
+		gen.GenerateIPv4Packet(clientIP, serverIP, capture.IPProtoTCP, gen.GenerateTCPSegment(0, 443, capture.TCPFlagACK, nil))))
+	require.NoError(b, err)
+	return packet
+}
+
+const benchmarkFlows = 1000000
+
+// fullTable returns a table holding a million flows, and what they cost in
+// heap per flow.
+func fullTable(b *testing.B, policy flow.EvictionPolicy) (*flow.Table, float64) {
+	const flows = benchmarkFlows
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	table := flow.NewTableWithConfig(createTestLogger(), flow.TableConfig{MaxFlows: flows, EvictionPolicy: policy})
+	packet := benchmarkPacket(b)
+	start := time.Unix(1000, 0)
+	for i := 0; i < flows; i++ {
+		fillPacket(packet, i)
+		table.ObservePacket(1, packet, start)
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	return table, float64(after.HeapAlloc-before.HeapAlloc) / flows
+}
+
+// randomFlows picks the flows of a full table to update at random. Going
+// through them in any fixed order instead would have LRU evict, in a shard
+// given more than its share, the very flow needed next.
+func randomFlows(seed uint64) func() int {
+	rng := rand.New(rand.NewPCG(1, seed))
+	return func() int {
+		return rng.IntN(benchmarkFlows)
+	}
+}
+
+func BenchmarkTable_Insert(b *testing.B) {
+	table := flow.NewTableWithConfig(createTestLogger(), flow.TableConfig{MaxFlows: benchmarkFlows})
+	packet := benchmarkPacket(b)
+	start := time.Unix(1000, 0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fillPacket(packet, i)
+		table.ObservePacket(1, packet, start)
+	}
+}
+
+func BenchmarkTable_Update(b *testing.B) {
+	table, heap := fullTable(b, flow.EvictLRU)
+	packet := benchmarkPacket(b)
+	start := time.Unix(1000, 0)
+	next := randomFlows(0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fillPacket(packet, next())
+		table.ObservePacket(1, packet, start.Add(time.Duration(i)))
+	}
+	b.ReportMetric(heap, "heap-B/flow")
+}
+
+func BenchmarkTable_UpdateParallel(b *testing.B) {
+	table, heap := fullTable(b, flow.EvictLRU)
+	start := time.Unix(1000, 0)
+
+	var seed atomic.Uint64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		packet := benchmarkPacket(b)
+		next := randomFlows(seed.Add(1))
+		for i := 0; pb.Next(); i++ {
+			fillPacket(packet, next())
+			table.ObservePacket(1, packet, start.Add(time.Duration(i)))
+		}
+	})
+	b.ReportMetric(heap, "heap-B/flow")
+}
+
+// BenchmarkTable_Evict inserts new flows into a full table, so that each
+// costs an eviction.
+func BenchmarkTable_Evict(b *testing.B) {
+	for _, policy := range []flow.EvictionPolicy{flow.EvictLRU, flow.EvictOldest, flow.EvictSampledSmallest} {
+		b.Run(policy.String(), func(b *testing.B) {
+			table, heap := fullTable(b, policy)
+			packet := benchmarkPacket(b)
+			start := time.Unix(1000, 0)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				fillPacket(packet, benchmarkFlows+i)
+				table.ObservePacket(1, packet, start.Add(time.Duration(i)))
+			}
+			b.ReportMetric(heap, "heap-B/flow")
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/flow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	syn    = capture.TCPFlagSYN
+	synAck = capture.TCPFlagSYN | capture.TCPFlagACK
+	ack    = capture.TCPFlagACK
+	finAck = capture.TCPFlagFIN | capture.TCPFlagACK
+	rst    = capture.TCPFlagRST
+)
+
+// segment is a TCP segment of the connection from clientIP:49152 to
+// serverIP:80, sent by the client unless fromServer is set.
+type segment struct {
+	fromServer bool
+	flags      uint8
+}
+
+func observe(t *testing.T, table *flow.Table, start time.Time, segments ...segment) {
+	t.Helper()
+	for i, s := range segments {
+		packet := tcpPacket(t, clientIP, serverIP, 49152, 80, s.flags, nil)
+		if s.fromServer {
+			packet = tcpPacket(t, serverIP, clientIP, 80, 49152, s.flags, nil)
+		}
+		table.ObservePacket(1, packet, start.Add(time.Duration(i)*time.Millisecond))
+	}
+}
+
+func connection(t *testing.T, table *flow.Table) flow.NetworkFlow {
+	t.Helper()
+	key, ok := flow.KeyFromPacket(1, tcpPacket(t, clientIP, serverIP, 49152, 80, 0, nil))
+	require.True(t, ok)
+	f, ok := table.Lookup(key)
+	require.True(t, ok)
+	return f
+}
+
+func TestTable_TCPState(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	tests := []struct {
+		name     string
+		segments []segment
+		state    flow.TCPState
+		status   flow.FlowStatus
+		stats    flow.TableStatistics
+	}{
+		{
+			name:     "syn sent",
+			segments: []segment{{false, syn}},
+			state:    flow.TCPStateSynSent,
+			status:   flow.StatusActive,
+		},
+		{
+			name:     "syn received",
+			segments: []segment{{false, syn}, {true, synAck}},
+			state:    flow.TCPStateSynReceived,
+			status:   flow.StatusActive,
+		},
+		{
+			name:     "established",
+			segments: []segment{{false, syn}, {true, synAck}, {false, ack}},
+			state:    flow.TCPStateEstablished,
+			status:   flow.StatusActive,
+			stats:    flow.TableStatistics{Handshakes: 1},
+		},
+		{
+			name:     "half closed",
+			segments: []segment{{false, syn}, {true, synAck}, {false, ack}, {false, finAck}},
+			state:    flow.TCPStateHalfClosed,
+			status:   flow.StatusActive,
+			stats:    flow.TableStatistics{Handshakes: 1},
+		},
+		{
+			name:     "closed",
+			segments: []segment{{false, syn}, {true, synAck}, {false, ack}, {false, finAck}, {true, finAck}, {false, ack}},
+			state:    flow.TCPStateClosed,
+			status:   flow.StatusClosed,
+			stats:    flow.TableStatistics{Handshakes: 1, ClosedFIN: 1},
+		},
+		{
+			name:     "reset",
+			segments: []segment{{false, syn}, {true, synAck}, {false, ack}, {true, rst}},
+			state:    flow.TCPStateReset,
+			status:   flow.StatusClosed,
+			stats:    flow.TableStatistics{Handshakes: 1, Resets: 1},
+		},
+		{
+			name:     "refused",
+			segments: []segment{{false, syn}, {true, rst | capture.TCPFlagACK}},
+			state:    flow.TCPStateReset,
+			status:   flow.StatusClosed,
+			stats:    flow.TableStatistics{FailedHandshakes: 1, Resets: 1},
+		},
+		{
+			name:     "reset during handshake",
+			segments: []segment{{false, syn}, {true, synAck}, {false, rst}},
+			state:    flow.TCPStateReset,
+			status:   flow.StatusClosed,
+			stats:    flow.TableStatistics{Incomplete: 1, Resets: 1},
+		},
+		{
+			name:     "mid-stream",
+			segments: []segment{{true, ack}, {false, ack}},
+			state:    flow.TCPStateEstablished,
+			status:   flow.StatusActive,
+			stats:    flow.TableStatistics{MidStream: 1},
+		},
+		{
+			name:     "synack missed",
+			segments: []segment{{false, syn}, {false, ack}},
+			state:    flow.TCPStateEstablished,
+			status:   flow.StatusActive,
+			stats:    flow.TableStatistics{Handshakes: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := flow.NewTable(createTestLogger())
+			observe(t, table, start, tt.segments...)
+
+			f := connection(t, table)
+			assert.Equal(t, tt.state, f.TCPState)
+			assert.Equal(t, tt.status, f.Status)
+
+			stats := table.GetStatistics()
+			assert.Equal(t, tt.stats.Handshakes, stats.Handshakes)
+			assert.Equal(t, tt.stats.MidStream, stats.MidStream)
+			assert.Equal(t, tt.stats.FailedHandshakes, stats.FailedHandshakes)
+			assert.Equal(t, tt.stats.Resets, stats.Resets)
+			assert.Equal(t, tt.stats.ClosedFIN, stats.ClosedFIN)
+		})
+	}
+}
+
+func TestTable_TCPExpire(t *testing.T) {
+	table := flow.NewTableWithConfig(createTestLogger(), flow.TableConfig{
+		FlowTimeout:      5 * time.Minute,
+		HandshakeTimeout: 20 * time.Second,
+		ClosedTimeout:    10 * time.Second,
+	})
+	ended := recordEnds(table)
+	start := time.Unix(1000, 0)
+
+	// A closed connection leaves soon after its last segment.
+	observe(t, table, start, segment{false, syn}, segment{true, synAck}, segment{false, ack},
+		segment{false, finAck}, segment{true, finAck})
+	assert.Equal(t, 0, table.Expire(start.Add(5*time.Second)))
+	assert.Equal(t, 1, table.Expire(start.Add(11*time.Second)))
+	require.Len(t, *ended, 1)
+	assert.Equal(t, flow.EndClosed, (*ended)[0].reason)
+	assert.Equal(t, flow.StatusClosed, (*ended)[0].flow.Status)
+
+	// An unanswered SYN is a failed handshake once it times out.
+	start = start.Add(time.Minute)
+	observe(t, table, start, segment{false, syn})
+	assert.Equal(t, 1, table.Expire(start.Add(21*time.Second)))
+	assert.Equal(t, uint64(1), table.GetStatistics().FailedHandshakes)
+
+	// So is a SYN-ACK never acknowledged, but as an incomplete one.
+	start = start.Add(time.Minute)
+	observe(t, table, start, segment{false, syn}, segment{true, synAck})
+	assert.Equal(t, 1, table.Expire(start.Add(21*time.Second)))
+	assert.Equal(t, uint64(1), table.GetStatistics().FailedHandshakes)
+	assert.Equal(t, uint64(1), table.GetStatistics().Incomplete)
+
+	// An established connection lives until the flow timeout, turning idle
+	// on the way, and is not counted when it goes: it may just be quiet.
+	start = start.Add(time.Minute)
+	observe(t, table, start, segment{false, syn}, segment{true, synAck}, segment{false, ack})
+	assert.Equal(t, flow.StatusActive, connection(t, table).Status)
+	assert.Equal(t, 0, table.Expire(start.Add(time.Minute)))
+	assert.Equal(t, flow.StatusIdle, connection(t, table).Status)
+	assert.Equal(t, 1, table.Expire(start.Add(6*time.Minute)))
+	assert.Equal(t, flow.EndIdle, (*ended)[3].reason)
+	assert.Equal(t, uint64(1), table.GetStatistics().Incomplete)
+
+	// One picked up mid-stream is incomplete.
+	start = start.Add(10 * time.Minute)
+	observe(t, table, start, segment{false, ack}, segment{true, ack})
+	assert.Equal(t, 1, table.Expire(start.Add(6*time.Minute)))
+
+	stats := table.GetStatistics()
+	assert.Equal(t, uint64(1), stats.FailedHandshakes)
+	assert.Equal(t, uint64(2), stats.Incomplete)
+	assert.Equal(t, uint64(5), stats.Expired)
+}
+
+func TestTable_TCPPortReuse(t *testing.T) {
+	table := flow.NewTable(createTestLogger())
+	ended := recordEnds(table)
+	start := time.Unix(1000, 0)
+
+	observe(t, table, start, segment{false, syn}, segment{true, synAck}, segment{false, ack}, segment{true, rst})
+	// Segments straggling after the reset belong to the old connection.
+	observe(t, table, start.Add(time.Second), segment{false, ack})
+	assert.Empty(t, *ended)
+
+	observe(t, table, start.Add(2*time.Second), segment{false, syn})
+	require.Len(t, *ended, 1)
+	assert.Equal(t, flow.EndClosed, (*ended)[0].reason)
+	assert.Equal(t, uint64(5), (*ended)[0].flow.Packets)
+
+	f := connection(t, table)
+	assert.Equal(t, flow.TCPStateSynSent, f.TCPState)
+	assert.Equal(t, uint64(1), f.Packets)
+	assert.Equal(t, 1, table.Len())
+}
+
+func TestTable_TCPPortReuseFromResponder(t *testing.T) {
+	table := flow.NewTable(createTestLogger())
+	ended := recordEnds(table)
+	start := time.Unix(1000, 0)
+
+	observe(t, table, start, segment{false, syn}, segment{true, synAck}, segment{false, ack},
+		segment{false, finAck}, segment{true, finAck}, segment{false, ack})
+
+	// The server opens the next connection on the same ports.
+	observe(t, table, start.Add(time.Second), segment{true, syn}, segment{false, synAck}, segment{true, ack})
+	require.Len(t, *ended, 1)
+	assert.Equal(t, flow.EndClosed, (*ended)[0].reason)
+
+	key, ok := flow.KeyFromPacket(1, tcpPacket(t, serverIP, clientIP, 80, 49152, 0, nil))
+	require.True(t, ok)
+	f, ok := table.Lookup(key)
+	require.True(t, ok)
+	assert.Equal(t, flow.TCPStateEstablished, f.TCPState)
+	assert.Equal(t, uint64(2), f.Initiator.Packets)
+	assert.Equal(t, uint64(1), f.Responder.Packets)
+	assert.Equal(t, uint64(2), table.GetStatistics().Handshakes)
+}
+
+func TestTable_EvictsClosedFirst(t *testing.T) {
+	table := flow.NewTableWithConfig(createTestLogger(), flow.TableConfig{MaxFlows: 2})
+	ended := recordEnds(table)
+	start := time.Unix(1000, 0)
+
+	table.ObservePacket(1, tcpPacket(t, clientIP, otherIP, 1001, 22, ack, nil), start)
+	observe(t, table, start.Add(time.Second), segment{false, syn}, segment{true, rst | capture.TCPFlagACK})
+	table.ObservePacket(1, tcpPacket(t, clientIP, otherIP, 1002, 22, ack, nil), start.Add(2*time.Second))
+
+	require.Len(t, *ended, 1)
+	assert.Equal(t, uint16(80), (*ended)[0].flow.DstPort)
+	assert.Equal(t, flow.EndEvicted, (*ended)[0].reason)
+}
+
+func TestTCPState_String(t *testing.T) {
+	assert.Equal(t, "half_closed", flow.TCPStateHalfClosed.String())
+	assert.True(t, flow.TCPStateReset.Finished())
+	assert.False(t, flow.TCPStateHalfClosed.Finished())
+	assert.Equal(t, "idle", flow.StatusIdle.String())
+	assert.Equal(t, "closed", flow.EndClosed.String())
+}
@@ -0,0 +1,270 @@
+package http
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/http"
+	"github.com/Karias-sys/Traffic_Monitor/internal/stream"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	connectionKey = stream.ConnectionKey{
+		ClientIP: netip.MustParseAddr("192.168.1.10"), ClientPort: 49152,
+		ServerIP: netip.MustParseAddr("10.0.0.1"), ServerPort: 8080,
+	}
+	start = time.Unix(1000, 0)
+)
+
+func createTestLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+}
+
+// recordingAnalyzer returns an analyzer, a consumer for connectionKey and
+// the transactions the analyzer reports.
+func recordingAnalyzer(config http.AnalyzerConfig) (*http.Analyzer, stream.Consumer, *[]*http.Transaction) {
+	analyzer := http.NewAnalyzerWithConfig(createTestLogger(), config)
+	var txns []*http.Transaction
+	analyzer.OnTransaction(func(txn *http.Transaction) {
+		txns = append(txns, txn)
+	})
+	return analyzer, analyzer.ConsumerFactory(connectionKey), &txns
+}
+
+func at(ms int) time.Time {
+	return start.Add(time.Duration(ms) * time.Millisecond)
+}
+
+func TestAnalyzer_PairsRequestsAndResponses(t *testing.T) {
+	analyzer, consumer, txns := recordingAnalyzer(http.DefaultAnalyzerConfig())
+
+	consumer.Data(stream.ClientToServer, []byte("GET /api/users?id=7 HTTP/1.1\r\nHost: API.Example.com\r\nUser-Agent: curl/8.5.0\r\n\r\n"), at(0))
+	consumer.Data(stream.ServerToClient, []byte("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 11\r\n\r\n"), at(25))
+	consumer.Data(stream.ServerToClient, []byte(`{"id": 7}`+"\r\n"), at(26))
+
+	// The body of a keep-alive POST spans two deliveries, and the response
+	// is chunked.
+	consumer.Data(stream.ClientToServer, []byte("POST /api/users HTTP/1.1\r\nHost: api.example.com\r\nContent-Length: 10\r\n\r\nname="), at(100))
+	consumer.Data(stream.ClientToServer, []byte("alice"), at(110))
+	consumer.Data(stream.ClientToServer, []byte("DELETE /api/users/7 HTTP/1.1\r\nHost: api.example.com\r\n\r\n"), at(140))
+	consumer.Data(stream.ServerToClient, []byte("HTTP/1.1 201 Created\r\nTransfer-Encoding: chunked\r\n\r\n4;ext=1\r\nabcd\r\n"), at(150))
+	consumer.Data(stream.ServerToClient, []byte("0\r\nX-Trailer: 1\r\n\r\nHTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n"), at(151))
+
+	require.Len(t, *txns, 3)
+
+	get := (*txns)[0]
+	assert.Equal(t, connectionKey, get.Connection)
+	assert.Equal(t, http.Request{
+		Method:        "GET",
+		Target:        "/api/users?id=7",
+		Host:          "api.example.com",
+		Path:          "/api/users",
+		Version:       "HTTP/1.1",
+		UserAgent:     "curl/8.5.0",
+		ContentLength: -1,
+		Timestamp:     at(0),
+	}, *get.Request)
+	assert.Equal(t, http.Response{
+		Version:       "HTTP/1.1",
+		StatusCode:    200,
+		Reason:        "OK",
+		ContentType:   "application/json",
+		ContentLength: 11,
+		Timestamp:     at(25),
+	}, *get.Response)
+	assert.Equal(t, 25*time.Millisecond, get.Latency)
+
+	post := (*txns)[1]
+	assert.Equal(t, "POST", post.Request.Method)
+	assert.Equal(t, int64(10), post.Request.ContentLength)
+	assert.Equal(t, 201, post.Response.StatusCode)
+	assert.Equal(t, 40*time.Millisecond, post.Latency, "measured from the end of the request body")
+
+	assert.Equal(t, "DELETE", (*txns)[2].Request.Method)
+	assert.Equal(t, 404, (*txns)[2].Response.StatusCode)
+
+	stats := analyzer.GetStatistics()
+	assert.Equal(t, uint64(3), stats.Requests)
+	assert.Equal(t, uint64(3), stats.Responses)
+	assert.Zero(t, stats.ParseErrors)
+}
+
+func TestAnalyzer_Pipelining(t *testing.T) {
+	_, consumer, txns := recordingAnalyzer(http.DefaultAnalyzerConfig())
+
+	consumer.Data(stream.ClientToServer, []byte("GET /a HTTP/1.1\r\nHost: h\r\n\r\nGET /b HTTP/1.1\r\nHost: h\r\n\r\n"), at(0))
+	consumer.Data(stream.ServerToClient, []byte("HTTP/1.1 200 OK\r\nContent-Length: 1\r\n\r\naHTTP/1.1 500 Oops\r\nContent-Length: 1\r\n\r\nb"), at(10))
+
+	require.Len(t, *txns, 2)
+	assert.Equal(t, "/a", (*txns)[0].Request.Path)
+	assert.Equal(t, 200, (*txns)[0].Response.StatusCode)
+	assert.Equal(t, "/b", (*txns)[1].Request.Path)
+	assert.Equal(t, 500, (*txns)[1].Response.StatusCode)
+}
+
+func TestAnalyzer_ResponsesWithoutBody(t *testing.T) {
+	_, consumer, txns := recordingAnalyzer(http.DefaultAnalyzerConfig())
+
+	// A HEAD response announces a length but carries no body, and 100
+	// Continue is not the final answer.
+	consumer.Data(stream.ClientToServer, []byte("HEAD /file HTTP/1.1\r\nHost: h\r\n\r\n"), at(0))
+	consumer.Data(stream.ClientToServer, []byte("PUT /file HTTP/1.1\r\nHost: h\r\nContent-Length: 3\r\nExpect: 100-continue\r\n\r\n"), at(1))
+	consumer.Data(stream.ServerToClient, []byte("HTTP/1.1 200 OK\r\nContent-Length: 5000\r\n\r\n"), at(5))
+	consumer.Data(stream.ServerToClient, []byte("HTTP/1.1 100 Continue\r\n\r\n"), at(6))
+	consumer.Data(stream.ClientToServer, []byte("abc"), at(7))
+	consumer.Data(stream.ServerToClient, []byte("HTTP/1.1 204 No Content\r\n\r\n"), at(9))
+
+	require.Len(t, *txns, 2)
+	assert.Equal(t, "HEAD", (*txns)[0].Request.Method)
+	assert.Equal(t, "PUT", (*txns)[1].Request.Method)
+	assert.Equal(t, 204, (*txns)[1].Response.StatusCode)
+	assert.Equal(t, 2*time.Millisecond, (*txns)[1].Latency)
+}
+
+func TestAnalyzer_StopsAfterUpgrade(t *testing.T) {
+	analyzer, consumer, txns := recordingAnalyzer(http.DefaultAnalyzerConfig())
+
+	consumer.Data(stream.ClientToServer, []byte("GET /ws HTTP/1.1\r\nHost: h\r\nUpgrade: websocket\r\n\r\n"), at(0))
+	consumer.Data(stream.ServerToClient, []byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n\x81\x05hello"), at(1))
+	consumer.Data(stream.ClientToServer, []byte("\x81\x85garbage"), at(2))
+
+	require.Len(t, *txns, 1)
+	assert.Equal(t, 101, (*txns)[0].Response.StatusCode)
+	assert.Zero(t, analyzer.GetStatistics().ParseErrors)
+}
+
+func TestAnalyzer_ResponseUntilClose(t *testing.T) {
+	analyzer, consumer, txns := recordingAnalyzer(http.DefaultAnalyzerConfig())
+
+	consumer.Data(stream.ClientToServer, []byte("GET / HTTP/1.0\r\n\r\n"), at(0))
+	consumer.Data(stream.ServerToClient, []byte("HTTP/1.0 200 OK\r\n\r\nHTTP/1.1 looks like a header but is body"), at(1))
+	consumer.Close(stream.CloseFIN)
+
+	require.Len(t, *txns, 1)
+	assert.Equal(t, "10.0.0.1", analyzer.Hosts(at(1))[0].Host, "the server address stands in for a missing Host")
+	assert.Zero(t, analyzer.GetStatistics().ParseErrors)
+}
+
+func TestAnalyzer_Gaps(t *testing.T) {
+	analyzer, consumer, txns := recordingAnalyzer(http.DefaultAnalyzerConfig())
+
+	// A gap inside a body of known length keeps the parser in step.
+	consumer.Data(stream.ClientToServer, []byte("GET /a HTTP/1.1\r\nHost: h\r\n\r\nGET /b HTTP/1.1\r\nHost: h\r\n\r\n"), at(0))
+	consumer.Data(stream.ServerToClient, []byte("HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n"), at(1))
+	consumer.Gap(stream.ServerToClient, 100)
+	consumer.Data(stream.ServerToClient, []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"), at(2))
+	require.Len(t, *txns, 2)
+
+	// One in the headers loses it; the outstanding request goes unanswered.
+	consumer.Data(stream.ClientToServer, []byte("GET /c HTTP/1.1\r\nHo"), at(3))
+	consumer.Gap(stream.ClientToServer, 20)
+	consumer.Data(stream.ClientToServer, []byte("GET /d HTTP/1.1\r\nHost: h\r\n\r\n"), at(4))
+	consumer.Close(stream.CloseFIN)
+
+	assert.Equal(t, uint64(2), analyzer.GetStatistics().Requests)
+}
+
+func TestAnalyzer_NotHTTP(t *testing.T) {
+	analyzer, consumer, txns := recordingAnalyzer(http.DefaultAnalyzerConfig())
+
+	consumer.Data(stream.ClientToServer, []byte("SSH-2.0-OpenSSH_9.6\r\n\r\n"), at(0))
+	consumer.Data(stream.ClientToServer, []byte("GET / HTTP/1.1\r\n\r\n"), at(1))
+
+	assert.Empty(t, *txns)
+	stats := analyzer.GetStatistics()
+	assert.Equal(t, uint64(1), stats.NotHTTP)
+	assert.Zero(t, stats.Requests)
+}
+
+func TestAnalyzer_AbsoluteFormTarget(t *testing.T) {
+	analyzer, consumer, _ := recordingAnalyzer(http.DefaultAnalyzerConfig())
+
+	consumer.Data(stream.ClientToServer, []byte("GET http://Proxy.Example/path/x?q=1 HTTP/1.1\r\n\r\n"), at(0))
+
+	endpoints := analyzer.Endpoints(at(0))
+	require.Len(t, endpoints, 1)
+	assert.Equal(t, "proxy.example", endpoints[0].Host)
+	assert.Equal(t, "/path/x", endpoints[0].Path)
+}
+
+func TestAnalyzer_HostAndEndpointStatistics(t *testing.T) {
+	analyzer, consumer, _ := recordingAnalyzer(http.AnalyzerConfig{MaxEndpoints: 2})
+
+	for i := 0; i < 10; i++ {
+		path := "/fast"
+		latency := i + 1
+		status := 200
+		if i%5 == 4 {
+			path, latency, status = "/slow", 100*(i+1), 503
+		}
+		sent := i * 1000
+		consumer.Data(stream.ClientToServer, []byte(fmt.Sprintf("GET %s HTTP/1.1\r\nHost: svc\r\n\r\n", path)), at(sent))
+		consumer.Data(stream.ServerToClient, []byte(fmt.Sprintf("HTTP/1.1 %d X\r\nContent-Length: 0\r\n\r\n", status)), at(sent+latency))
+	}
+	consumer.Data(stream.ClientToServer, []byte("GET /third HTTP/1.1\r\nHost: svc\r\n\r\n"), at(10000))
+
+	hosts := analyzer.Hosts(at(10000))
+	require.Len(t, hosts, 1)
+	host := hosts[0]
+	assert.Equal(t, "svc", host.Host)
+	assert.Equal(t, uint64(11), host.Requests)
+	assert.Equal(t, uint64(10), host.Responses)
+	assert.InDelta(t, 11.0/60, host.RequestRate, 1e-9)
+	assert.Equal(t, map[int]uint64{200: 8, 503: 2}, host.StatusCodes)
+	assert.Equal(t, 10, host.Latency.Samples)
+	assert.Equal(t, 1000*time.Millisecond, host.Latency.Max)
+
+	endpoints := analyzer.Endpoints(at(10000))
+	require.Len(t, endpoints, 2)
+	assert.Equal(t, "/fast", endpoints[0].Path)
+	assert.Equal(t, "GET", endpoints[0].Method)
+	assert.Equal(t, uint64(8), endpoints[0].Requests)
+	assert.Equal(t, 4*time.Millisecond, endpoints[0].Latency.P50)
+	assert.Equal(t, 9*time.Millisecond, endpoints[0].Latency.P99)
+	assert.Equal(t, "/slow", endpoints[1].Path)
+	assert.Equal(t, map[int]uint64{503: 2}, endpoints[1].StatusCodes)
+
+	assert.Equal(t, uint64(1), analyzer.GetStatistics().EndpointsDropped)
+	assert.Zero(t, analyzer.Hosts(at(80000))[0].RequestRate, "the rate only covers the last minute")
+}
+
+func TestAnalyzer_WithAssembler(t *testing.T) {
+	analyzer := http.NewAnalyzer(createTestLogger())
+	assembler := stream.NewAssembler(stream.DefaultAssemblerConfig())
+	assembler.Register(analyzer.ConsumerFactory)
+	gen := mocks.NewPacketGenerator()
+
+	send := func(fromClient bool, flags uint8, seq uint32, payload string) {
+		srcIP, dstIP := []byte{192, 168, 1, 10}, []byte{10, 0, 0, 1}
+		srcPort, dstPort := uint16(49152), uint16(8080)
+		if !fromClient {
+			srcIP, dstIP, srcPort, dstPort = dstIP, srcIP, dstPort, srcPort
+		}
+		tcp := gen.GenerateTCPSegmentWithSeq(srcPort, dstPort, flags, seq, 0, []byte(payload))
+		frame := gen.GenerateEthernetFrame(make([]byte, 6), make([]byte, 6), capture.EtherTypeIPv4, gen.GenerateIPv4Packet(srcIP, dstIP, capture.IPProtoTCP, tcp))
+		packet, err := capture.ParsePacket(frame)
+		require.NoError(t, err)
+		assembler.Assemble(packet, start)
+	}
+
+	request := "GET /health HTTP/1.1\r\nHost: svc\r\n\r\n"
+	send(true, capture.TCPFlagSYN, 100, "")
+	send(false, capture.TCPFlagSYN|capture.TCPFlagACK, 500, "")
+	send(true, capture.TCPFlagPSH|capture.TCPFlagACK, 101, request)
+	send(false, capture.TCPFlagPSH|capture.TCPFlagACK, 501, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+
+	endpoints := analyzer.Endpoints(start)
+	require.Len(t, endpoints, 1)
+	assert.Equal(t, "/health", endpoints[0].Path)
+	assert.Equal(t, map[int]uint64{200: 1}, endpoints[0].StatusCodes)
+}
@@ -49,7 +49,7 @@ func TestSystemMetricsCollector_UpdateCaptureMetrics(t *testing.T) {
 	assert.Equal(t, 0.25, metrics.RingUtilization)
 	assert.Equal(t, now, metrics.LastPacketTime)
 	assert.Equal(t, startTime, metrics.CaptureStartTime)
-	assert.Equal(t, 60.0, metrics.UptimeSeconds)
+	assert.InDelta(t, 60.0, metrics.UptimeSeconds, 1.0)
 }
 
 func TestSystemMetricsCollector_UpdateSystemMetrics(t *testing.T) {
@@ -161,6 +161,52 @@ func TestSystemMetricsCollector_Reset(t *testing.T) {
 	assert.True(t, systemMetrics.LastUpdateTime.IsZero())
 }
 
+func TestSystemMetricsCollector_UpdateDecodeMetrics(t *testing.T) {
+	logger := createTestLogger()
+	collector := metrics.NewSystemMetricsCollector(logger)
+
+	failures := map[string]map[string]uint64{
+		"tcp":  {"truncated": 3},
+		"ipv4": {"bad_version": 1},
+	}
+	checksumErrors := map[string]uint64{"udp": 2}
+	collector.UpdateDecodeMetrics(100, 4, failures, checksumErrors)
+
+	// The collector keeps its own copy.
+	failures["tcp"]["truncated"] = 99
+	checksumErrors["udp"] = 99
+
+	decodeMetrics := collector.GetDecodeMetrics()
+	assert.Equal(t, uint64(100), decodeMetrics.PacketsDecoded)
+	assert.Equal(t, uint64(4), decodeMetrics.PacketsFailed)
+	assert.Equal(t, uint64(3), decodeMetrics.Failures["tcp"]["truncated"])
+	assert.Equal(t, uint64(1), decodeMetrics.Failures["ipv4"]["bad_version"])
+	assert.Equal(t, uint64(2), decodeMetrics.ChecksumErrors["udp"])
+	assert.Equal(t, uint64(3), collector.GetAllMetrics().Decode.Failures["tcp"]["truncated"])
+
+	collector.Reset()
+	assert.Equal(t, metrics.DecodeMetrics{}, collector.GetDecodeMetrics())
+}
+
+func TestSystemMetricsCollector_UpdateFlowMetrics(t *testing.T) {
+	logger := createTestLogger()
+	collector := metrics.NewSystemMetricsCollector(logger)
+
+	collector.UpdateFlowMetrics(500, 1200, 650, 50, 4000, 3200000)
+
+	flowMetrics := collector.GetFlowMetrics()
+	assert.Equal(t, 500, flowMetrics.Flows)
+	assert.Equal(t, uint64(1200), flowMetrics.FlowsCreated)
+	assert.Equal(t, uint64(650), flowMetrics.Expired)
+	assert.Equal(t, uint64(50), flowMetrics.Evictions)
+	assert.Equal(t, uint64(4000), flowMetrics.EvictedPackets)
+	assert.Equal(t, uint64(3200000), flowMetrics.EvictedBytes)
+	assert.Equal(t, flowMetrics, collector.GetAllMetrics().Flow)
+
+	collector.Reset()
+	assert.Equal(t, metrics.FlowMetrics{}, collector.GetFlowMetrics())
+}
+
 func TestSystemMetricsCollector_ConcurrentAccess(t *testing.T) {
 	logger := createTestLogger()
 	collector := metrics.NewSystemMetricsCollector(logger)
@@ -0,0 +1,149 @@
+package neighbor
+
+import (
+	"log/slog"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/neighbor"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	macA = []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	macB = []byte{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb}
+	ipA  = []byte{192, 168, 1, 10}
+	ipB  = []byte{192, 168, 1, 20}
+)
+
+func createTestLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+}
+
+func arpPacket(t *testing.T, operation uint16, senderMAC, senderIP, targetMAC, targetIP []byte) *capture.ParsedPacket {
+	t.Helper()
+	gen := mocks.NewPacketGenerator()
+	frame := gen.GenerateEthernetFrame(senderMAC, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, capture.EtherTypeARP,
+		gen.GenerateARPPacket(operation, senderMAC, senderIP, targetMAC, targetIP))
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+	require.NotNil(t, packet.ARP)
+	return packet
+}
+
+func TestTable_LearnsSenderBinding(t *testing.T) {
+	table := neighbor.NewTable(createTestLogger())
+	first := time.Unix(1000, 0)
+	later := first.Add(time.Minute)
+
+	table.ObservePacket(arpPacket(t, capture.ARPOperationRequest, macA, ipA, make([]byte, 6), ipB), first)
+	table.ObservePacket(arpPacket(t, capture.ARPOperationReply, macB, ipB, macA, ipA), first)
+	table.ObservePacket(arpPacket(t, capture.ARPOperationRequest, macA, ipA, make([]byte, 6), ipB), later)
+
+	entry, ok := table.Lookup(netip.AddrFrom4([4]byte(ipA)))
+	require.True(t, ok)
+	assert.Equal(t, "192.168.1.10", entry.IP)
+	assert.Equal(t, "00:11:22:33:44:55", entry.MAC)
+	assert.Equal(t, first, entry.FirstSeen)
+	assert.Equal(t, later, entry.LastSeen)
+	assert.Equal(t, uint64(2), entry.Observations)
+
+	entries := table.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "192.168.1.10", entries[0].IP)
+	assert.Equal(t, "192.168.1.20", entries[1].IP)
+
+	stats := table.GetStatistics()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, uint64(2), stats.ARPRequests)
+	assert.Equal(t, uint64(1), stats.ARPReplies)
+}
+
+func TestTable_LookupAcceptsMappedIPv4(t *testing.T) {
+	table := neighbor.NewTable(createTestLogger())
+	table.ObservePacket(arpPacket(t, capture.ARPOperationRequest, macA, ipA, make([]byte, 6), ipB), time.Now())
+
+	_, ok := table.Lookup(netip.MustParseAddr("::ffff:192.168.1.10"))
+	assert.True(t, ok)
+
+	byMAC := table.LookupMAC(capture.MACAddr(macA))
+	require.Len(t, byMAC, 1)
+	assert.Equal(t, "192.168.1.10", byMAC[0].IP)
+}
+
+func TestTable_GratuitousAndMACChange(t *testing.T) {
+	table := neighbor.NewTable(createTestLogger())
+	now := time.Now()
+
+	table.ObservePacket(arpPacket(t, capture.ARPOperationRequest, macA, ipA, make([]byte, 6), ipA), now)
+	table.ObservePacket(arpPacket(t, capture.ARPOperationReply, macB, ipA, macB, ipA), now.Add(time.Second))
+
+	entry, ok := table.Lookup(netip.AddrFrom4([4]byte(ipA)))
+	require.True(t, ok)
+	assert.Equal(t, "66:77:88:99:aa:bb", entry.MAC)
+	assert.Equal(t, "00:11:22:33:44:55", entry.PreviousMAC)
+	assert.Equal(t, uint64(1), entry.MACChanges)
+	assert.Equal(t, uint64(2), entry.Gratuitous)
+
+	stats := table.GetStatistics()
+	assert.Equal(t, uint64(2), stats.ARPGratuitous)
+	assert.Equal(t, uint64(1), stats.MACChanges)
+}
+
+func TestTable_IgnoresProbesAndNonARP(t *testing.T) {
+	table := neighbor.NewTable(createTestLogger())
+
+	table.ObservePacket(arpPacket(t, capture.ARPOperationRequest, macA, []byte{0, 0, 0, 0}, make([]byte, 6), ipB), time.Now())
+	table.ObservePacket(&capture.ParsedPacket{}, time.Now())
+	table.ObservePacket(nil, time.Now())
+
+	assert.Equal(t, 0, table.Len())
+	assert.Equal(t, uint64(1), table.GetStatistics().ARPProbes)
+}
+
+func TestTable_ExpireAndEvict(t *testing.T) {
+	table := neighbor.NewTableWithConfig(createTestLogger(), neighbor.TableConfig{
+		MaxEntries: 2,
+		EntryTTL:   time.Minute,
+	})
+	base := time.Unix(5000, 0)
+
+	table.ObservePacket(arpPacket(t, capture.ARPOperationRequest, macA, ipA, make([]byte, 6), ipB), base)
+	table.ObservePacket(arpPacket(t, capture.ARPOperationRequest, macB, ipB, make([]byte, 6), ipA), base.Add(30*time.Second))
+	table.ObservePacket(arpPacket(t, capture.ARPOperationRequest, macA, []byte{192, 168, 1, 30}, make([]byte, 6), ipA), base.Add(40*time.Second))
+
+	assert.Equal(t, 2, table.Len())
+	_, ok := table.Lookup(netip.AddrFrom4([4]byte(ipA)))
+	assert.False(t, ok, "least recently seen entry should be evicted")
+	assert.Equal(t, uint64(1), table.GetStatistics().Evictions)
+
+	removed := table.Expire(base.Add(95 * time.Second))
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, 1, table.Len())
+}
+
+func TestTable_ExpireFollowsLastSeen(t *testing.T) {
+	table := neighbor.NewTableWithConfig(createTestLogger(), neighbor.TableConfig{EntryTTL: time.Minute})
+	base := time.Unix(5000, 0)
+
+	table.ObservePacket(arpPacket(t, capture.ARPOperationRequest, macA, ipA, make([]byte, 6), ipB), base)
+	table.ObservePacket(arpPacket(t, capture.ARPOperationRequest, macB, ipB, make([]byte, 6), ipA), base.Add(30*time.Second))
+	table.ObservePacket(arpPacket(t, capture.ARPOperationRequest, macA, ipA, make([]byte, 6), ipB), base.Add(50*time.Second))
+
+	assert.Equal(t, 1, table.Expire(base.Add(95*time.Second)))
+	_, ok := table.Lookup(netip.AddrFrom4([4]byte(ipA)))
+	assert.True(t, ok, "an entry seen again is kept")
+	_, ok = table.Lookup(netip.AddrFrom4([4]byte(ipB)))
+	assert.False(t, ok)
+
+	assert.Equal(t, 1, table.Expire(base.Add(2*time.Minute)))
+	assert.Equal(t, 0, table.Len())
+	assert.Equal(t, uint64(2), table.GetStatistics().Expired)
+}
@@ -0,0 +1,251 @@
+package quic
+
+import (
+	"log/slog"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/quic"
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/tls"
+	"github.com/Karias-sys/Traffic_Monitor/internal/stream"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	clientMAC = []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	serverMAC = []byte{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb}
+	clientIP  = []byte{192, 168, 1, 10}
+	serverIP  = []byte{10, 0, 0, 1}
+
+	connectionKey = stream.ConnectionKey{
+		ClientIP: netip.MustParseAddr("192.168.1.10"), ClientPort: 50000,
+		ServerIP: netip.MustParseAddr("10.0.0.1"), ServerPort: 443,
+	}
+	start = time.Unix(1000, 0)
+
+	clientDCID = []byte{0x83, 0x94, 0xc8, 0xf0, 0x3e, 0x51, 0x57, 0x08}
+	clientSCID = []byte{0xc1}
+	serverSCID = []byte{0xf0, 0x67, 0xa5, 0x50, 0x2a, 0x42, 0x62, 0xb5}
+)
+
+func createTestLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+}
+
+func datagram(t *testing.T, fromClient bool, payload []byte) *capture.ParsedPacket {
+	t.Helper()
+	gen := mocks.NewPacketGenerator()
+	srcIP, dstIP, srcPort, dstPort, srcMAC, dstMAC := clientIP, serverIP, uint16(50000), uint16(443), clientMAC, serverMAC
+	if !fromClient {
+		srcIP, dstIP, srcPort, dstPort, srcMAC, dstMAC = serverIP, clientIP, uint16(443), uint16(50000), serverMAC, clientMAC
+	}
+	udp := gen.GenerateUDPDatagram(srcPort, dstPort, payload)
+	frame := gen.GenerateEthernetFrame(srcMAC, dstMAC, capture.EtherTypeIPv4, gen.GenerateIPv4Packet(srcIP, dstIP, capture.IPProtoUDP, udp))
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+	return packet
+}
+
+func clientHello() []byte {
+	gen := mocks.NewPacketGenerator()
+	body := gen.GenerateTLSClientHello(0x0303, []uint16{0x1301, 0x1302, 0x1303},
+		gen.GenerateTLSServerNameExtension("quic.example.com"),
+		gen.GenerateTLSUint16ListExtension(tls.ExtensionSupportedGroups, 2, 0x001d, 0x0017),
+		gen.GenerateTLSALPNExtension("h3"),
+		gen.GenerateTLSUint16ListExtension(tls.ExtensionSignatureAlgorithms, 2, 0x0403, 0x0804),
+		gen.GenerateTLSUint16ListExtension(tls.ExtensionSupportedVersions, 1, 0x0304),
+		gen.GenerateTLSExtension(0x0039, []byte{0x01, 0x02, 0x40, 0x64}), // quic_transport_parameters
+	)
+	return handshakeMessage(tls.HandshakeTypeClientHello, body)
+}
+
+func serverHello(hrr bool) []byte {
+	gen := mocks.NewPacketGenerator()
+	random := make([]byte, 32)
+	if hrr {
+		random = []byte{
+			0xcf, 0x21, 0xad, 0x74, 0xe5, 0x9a, 0x61, 0x11, 0xbe, 0x1d, 0x8c, 0x02, 0x1e, 0x65, 0xb8, 0x91,
+			0xc2, 0xa2, 0x11, 0x16, 0x7a, 0xbb, 0x8c, 0x5e, 0x07, 0x9e, 0x09, 0xe2, 0xc8, 0xa8, 0x33, 0x9c,
+		}
+	}
+	body := gen.GenerateTLSServerHello(0x0303, random, 0x1301,
+		gen.GenerateTLSExtension(tls.ExtensionSupportedVersions, []byte{0x03, 0x04}))
+	return handshakeMessage(tls.HandshakeTypeServerHello, body)
+}
+
+func handshakeMessage(msgType uint8, body []byte) []byte {
+	return append([]byte{msgType, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+// initial protects CRYPTO frames in an Initial packet of either side,
+// padded as clients pad theirs.
+func initial(t *testing.T, version quic.Version, fromClient bool, pn uint16, frames ...[]byte) []byte {
+	t.Helper()
+	gen := mocks.NewPacketGenerator()
+	keys, err := quic.InitialKeys(version, clientDCID, !fromClient)
+	require.NoError(t, err)
+
+	var payload []byte
+	for _, frame := range frames {
+		payload = append(payload, frame...)
+	}
+	dcid, scid := clientDCID, clientSCID
+	if !fromClient {
+		dcid, scid = clientSCID, serverSCID
+	} else if len(payload) < quic.MinInitialDatagramSize-100 {
+		payload = append(payload, make([]byte, quic.MinInitialDatagramSize-100-len(payload))...)
+	}
+	return gen.GenerateQUICInitial(uint32(version), dcid, scid, pn, keys.Key, keys.IV, keys.HP, payload)
+}
+
+func TestAnalyzer_ExtractsHandshake(t *testing.T) {
+	for _, version := range []quic.Version{quic.Version1, quic.Version2, quic.VersionDraft29} {
+		t.Run(version.String(), func(t *testing.T) {
+			analyzer := quic.NewAnalyzer(createTestLogger())
+			gen := mocks.NewPacketGenerator()
+
+			var handled []*quic.Info
+			analyzer.OnHandshake(func(key stream.ConnectionKey, info *quic.Info) {
+				assert.Equal(t, connectionKey, key)
+				handled = append(handled, info)
+			})
+
+			analyzer.ObservePacket(datagram(t, true, initial(t, version, true, 0, gen.GenerateQUICCryptoFrame(0, clientHello()))), start)
+			assert.Empty(t, handled)
+
+			// The server's Initial comes coalesced with a Handshake packet.
+			response := initial(t, version, false, 0, []byte{0x02, 0x00, 0x00, 0x00, 0x00}, gen.GenerateQUICCryptoFrame(0, serverHello(false)))
+			handshakeType := uint8(2)
+			if version == quic.Version2 {
+				handshakeType = 3
+			}
+			response = append(response, gen.GenerateQUICLongHeader(uint32(version), handshakeType, clientSCID, serverSCID, make([]byte, 40))...)
+			analyzer.ObservePacket(datagram(t, false, response), start.Add(20*time.Millisecond))
+
+			require.Len(t, handled, 1)
+			info := handled[0]
+			assert.Equal(t, version, info.Version)
+			assert.Equal(t, "8394c8f03e515708", info.DestinationConnectionID.String())
+			assert.Equal(t, "c1", info.SourceConnectionID.String())
+			assert.Equal(t, start, info.Timestamp)
+			require.NotNil(t, info.Handshake)
+			assert.Equal(t, "quic.example.com", info.Handshake.ServerName)
+			assert.True(t, strings.HasPrefix(info.Handshake.JA4, "q13d0306h3_"), info.Handshake.JA4)
+			assert.Equal(t, tls.VersionTLS13, info.Handshake.Version)
+			assert.Equal(t, tls.CipherSuite(0x1301), info.Handshake.Cipher)
+			assert.NotEmpty(t, info.Handshake.JA3SHash)
+
+			// Either orientation of the flow finds it.
+			found, ok := analyzer.Lookup(connectionKey)
+			require.True(t, ok)
+			assert.Same(t, info, found)
+			_, ok = analyzer.Lookup(stream.ConnectionKey{
+				ClientIP: connectionKey.ServerIP, ClientPort: connectionKey.ServerPort,
+				ServerIP: connectionKey.ClientIP, ServerPort: connectionKey.ClientPort,
+			})
+			assert.True(t, ok)
+
+			stats := analyzer.GetStatistics()
+			assert.Equal(t, uint64(2), stats.InitialPackets)
+			assert.Equal(t, uint64(2), stats.Decrypted)
+			assert.Equal(t, uint64(1), stats.Handshakes)
+			assert.Equal(t, 1, stats.Connections)
+			assert.Equal(t, 0, stats.Pending)
+		})
+	}
+}
+
+func TestAnalyzer_ReassemblesClientHelloAcrossPackets(t *testing.T) {
+	analyzer := quic.NewAnalyzer(createTestLogger())
+	gen := mocks.NewPacketGenerator()
+	hello := clientHello()
+	split := len(hello) / 2
+
+	// The second half arrives first.
+	analyzer.ObservePacket(datagram(t, true, initial(t, quic.Version1, true, 1, gen.GenerateQUICCryptoFrame(uint64(split), hello[split:]))), start)
+	analyzer.ObservePacket(datagram(t, true, initial(t, quic.Version1, true, 0, gen.GenerateQUICCryptoFrame(0, hello[:split]))), start)
+	assert.Equal(t, 1, analyzer.GetStatistics().Pending)
+
+	// With no ServerHello the handshake is reported with the client's alone.
+	var handled []*quic.Info
+	analyzer.OnHandshake(func(key stream.ConnectionKey, info *quic.Info) {
+		handled = append(handled, info)
+	})
+	assert.Equal(t, 0, analyzer.Expire(start.Add(5*time.Second)))
+	assert.Equal(t, 1, analyzer.Expire(start.Add(time.Minute)))
+
+	require.Len(t, handled, 1)
+	assert.Equal(t, "quic.example.com", handled[0].Handshake.ServerName)
+	assert.Nil(t, handled[0].Handshake.Server)
+	assert.Equal(t, 0, analyzer.GetStatistics().Pending)
+}
+
+func TestAnalyzer_ServerHelloAfterHelloRetryRequest(t *testing.T) {
+	analyzer := quic.NewAnalyzer(createTestLogger())
+	gen := mocks.NewPacketGenerator()
+	var handled []*quic.Info
+	analyzer.OnHandshake(func(key stream.ConnectionKey, info *quic.Info) {
+		handled = append(handled, info)
+	})
+
+	hello := clientHello()
+	hrr := serverHello(true)
+	analyzer.ObservePacket(datagram(t, true, initial(t, quic.Version1, true, 0, gen.GenerateQUICCryptoFrame(0, hello))), start)
+	analyzer.ObservePacket(datagram(t, false, initial(t, quic.Version1, false, 0, gen.GenerateQUICCryptoFrame(0, hrr))), start)
+	analyzer.ObservePacket(datagram(t, true, initial(t, quic.Version1, true, 1, gen.GenerateQUICCryptoFrame(uint64(len(hello)), hello))), start)
+	assert.Empty(t, handled)
+
+	analyzer.ObservePacket(datagram(t, false, initial(t, quic.Version1, false, 1, gen.GenerateQUICCryptoFrame(uint64(len(hrr)), serverHello(false)))), start)
+	require.Len(t, handled, 1)
+	assert.False(t, handled[0].Handshake.Server.HelloRetryRequest)
+}
+
+func TestAnalyzer_IgnoresOtherTraffic(t *testing.T) {
+	analyzer := quic.NewAnalyzer(createTestLogger())
+	gen := mocks.NewPacketGenerator()
+	analyzer.OnHandshake(func(key stream.ConnectionKey, info *quic.Info) {
+		t.Fatal("no handshake expected")
+	})
+
+	// Short-header packets and non-QUIC payloads are skipped outright.
+	analyzer.ObservePacket(datagram(t, true, []byte{0x40, 1, 2, 3, 4, 5, 6, 7}), start)
+	// An unknown version cannot be decrypted.
+	analyzer.ObservePacket(datagram(t, true, gen.GenerateQUICLongHeader(0x1a2a3a4a, 0, clientDCID, nil, make([]byte, 40))), start)
+	// Random bytes behind a valid header fail authentication.
+	analyzer.ObservePacket(datagram(t, true, gen.GenerateQUICLongHeader(uint32(quic.Version1), 0, clientDCID, nil, make([]byte, 60))), start)
+	// A server Initial on its own cannot be decrypted either.
+	analyzer.ObservePacket(datagram(t, false, initial(t, quic.Version1, false, 0, gen.GenerateQUICCryptoFrame(0, serverHello(false)))), start)
+
+	stats := analyzer.GetStatistics()
+	assert.Equal(t, uint64(3), stats.LongHeaderPackets)
+	assert.Equal(t, uint64(1), stats.UnsupportedVersions)
+	assert.Equal(t, uint64(2), stats.DecryptFailures)
+	assert.Equal(t, uint64(0), stats.Decrypted)
+	assert.Equal(t, 0, stats.Pending)
+}
+
+func TestAnalyzer_MaxPendingReportsOldest(t *testing.T) {
+	analyzer := quic.NewAnalyzerWithConfig(createTestLogger(), quic.AnalyzerConfig{MaxPending: 1})
+	gen := mocks.NewPacketGenerator()
+	var handled []stream.ConnectionKey
+	analyzer.OnHandshake(func(key stream.ConnectionKey, info *quic.Info) {
+		handled = append(handled, key)
+	})
+
+	analyzer.ObservePacket(datagram(t, true, initial(t, quic.Version1, true, 0, gen.GenerateQUICCryptoFrame(0, clientHello()))), start)
+
+	other := datagram(t, true, initial(t, quic.Version1, true, 0, gen.GenerateQUICCryptoFrame(0, clientHello())))
+	other.UDP.SrcPort = 50001
+	analyzer.ObservePacket(other, start)
+
+	require.Equal(t, []stream.ConnectionKey{connectionKey}, handled)
+	assert.Equal(t, 1, analyzer.GetStatistics().Pending)
+}
@@ -0,0 +1,128 @@
+package quic
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/quic"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestInitialKeys_RFC9001Vectors(t *testing.T) {
+	dcid := quic.ConnectionID(unhex(t, "8394c8f03e515708"))
+
+	client, err := quic.InitialKeys(quic.Version1, dcid, false)
+	require.NoError(t, err)
+	assert.Equal(t, "1f369613dd76d5467730efcbe3b1a22d", hex.EncodeToString(client.Key))
+	assert.Equal(t, "fa044b2f42a3fd3b46fb255c", hex.EncodeToString(client.IV))
+	assert.Equal(t, "9f50449e04a0e810283a1e9933adedd2", hex.EncodeToString(client.HP))
+
+	server, err := quic.InitialKeys(quic.Version1, dcid, true)
+	require.NoError(t, err)
+	assert.Equal(t, "cf3a5331653c364c88f0f379b6067e37", hex.EncodeToString(server.Key))
+	assert.Equal(t, "0ac1493ca1905853b0bba03e", hex.EncodeToString(server.IV))
+	assert.Equal(t, "c206b8d9b9f0f37644430b490eeaa314", hex.EncodeToString(server.HP))
+}
+
+func TestInitialKeys_RFC9369Vectors(t *testing.T) {
+	client, err := quic.InitialKeys(quic.Version2, quic.ConnectionID(unhex(t, "8394c8f03e515708")), false)
+	require.NoError(t, err)
+	assert.Equal(t, "8b1a0bc121284290a29e0971b5cd045d", hex.EncodeToString(client.Key))
+	assert.Equal(t, "91f73e2351d8fa91660e909f", hex.EncodeToString(client.IV))
+	assert.Equal(t, "45b95e15235d6f45a6b19cbcb0294ba9", hex.EncodeToString(client.HP))
+}
+
+func TestInitialKeys_UnsupportedVersion(t *testing.T) {
+	_, err := quic.InitialKeys(quic.Version(0x0a0a0a0a), quic.ConnectionID{1, 2, 3, 4}, false)
+	assert.ErrorIs(t, err, quic.ErrUnsupported)
+}
+
+func TestParseLongHeader(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	dcid, scid := []byte{1, 2, 3, 4, 5, 6, 7, 8}, []byte{9, 10}
+
+	keys, err := quic.InitialKeys(quic.Version1, dcid, false)
+	require.NoError(t, err)
+	packet := gen.GenerateQUICInitial(uint32(quic.Version1), dcid, scid, 0, keys.Key, keys.IV, keys.HP, []byte{1})
+
+	h, err := quic.ParseLongHeader(packet)
+	require.NoError(t, err)
+	assert.Equal(t, quic.Version1, h.Version)
+	assert.Equal(t, quic.PacketTypeInitial, h.Type)
+	assert.Equal(t, "0102030405060708", h.DestinationConnectionID.String())
+	assert.Equal(t, "090a", h.SourceConnectionID.String())
+	assert.Empty(t, h.Token)
+	assert.Equal(t, len(packet), h.HeaderLength+h.Length)
+
+	// QUIC v2 encodes Handshake packets with the type bits of v1 Initials.
+	handshake := gen.GenerateQUICLongHeader(uint32(quic.Version2), 3, dcid, scid, make([]byte, 30))
+	h, err = quic.ParseLongHeader(handshake)
+	require.NoError(t, err)
+	assert.Equal(t, quic.PacketTypeHandshake, h.Type)
+
+	_, err = quic.ParseLongHeader(packet[:20])
+	assert.ErrorIs(t, err, quic.ErrTruncated)
+	_, err = quic.ParseLongHeader([]byte{0x40, 0, 0, 0, 1, 0, 0})
+	assert.ErrorIs(t, err, quic.ErrNotQUIC)
+	unknown := gen.GenerateQUICLongHeader(0x1a2a3a4a, 0, dcid, scid, nil)
+	_, err = quic.ParseLongHeader(unknown)
+	assert.ErrorIs(t, err, quic.ErrUnsupported)
+}
+
+func TestOpen_RecoversCryptoFrames(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	dcid := []byte{0x83, 0x94, 0xc8, 0xf0, 0x3e, 0x51, 0x57, 0x08}
+	keys, err := quic.InitialKeys(quic.Version1, dcid, false)
+	require.NoError(t, err)
+
+	var payload []byte
+	payload = append(payload, 0x01)                                     // PING
+	payload = append(payload, 0x02, 0x05, 0x00, 0x01, 0x00, 0x03, 0x01) // ACK with one extra range
+	payload = append(payload, gen.GenerateQUICCryptoFrame(100, []byte("second"))...)
+	payload = append(payload, gen.GenerateQUICCryptoFrame(0, []byte("first"))...)
+	payload = append(payload, make([]byte, 40)...) // PADDING
+	packet := gen.GenerateQUICInitial(uint32(quic.Version1), dcid, nil, 7, keys.Key, keys.IV, keys.HP, payload)
+	original := append([]byte(nil), packet...)
+
+	h, err := quic.ParseLongHeader(packet)
+	require.NoError(t, err)
+	initial, err := keys.Open(packet, h)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(7), initial.PacketNumber)
+	require.Len(t, initial.Crypto, 2)
+	assert.Equal(t, uint64(100), initial.Crypto[0].Offset)
+	assert.Equal(t, []byte("second"), initial.Crypto[0].Data)
+	assert.Equal(t, uint64(0), initial.Crypto[1].Offset)
+	assert.Equal(t, []byte("first"), initial.Crypto[1].Data)
+	assert.Equal(t, original, packet, "the captured packet must not be modified")
+
+	// The server's keys do not open the client's packets.
+	serverKeys, err := quic.InitialKeys(quic.Version1, dcid, true)
+	require.NoError(t, err)
+	_, err = serverKeys.Open(packet, h)
+	assert.ErrorIs(t, err, quic.ErrDecryption)
+}
+
+func TestOpen_RejectsFramesNotAllowedInInitial(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	dcid := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	keys, err := quic.InitialKeys(quic.Version1, dcid, false)
+	require.NoError(t, err)
+
+	// A STREAM frame may not be sent in an Initial packet.
+	packet := gen.GenerateQUICInitial(uint32(quic.Version1), dcid, nil, 0, keys.Key, keys.IV, keys.HP, []byte{0x08, 0x00, 0x61})
+	h, err := quic.ParseLongHeader(packet)
+	require.NoError(t, err)
+	_, err = keys.Open(packet, h)
+	assert.ErrorIs(t, err, quic.ErrBadFrame)
+}
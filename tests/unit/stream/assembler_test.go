@@ -0,0 +1,367 @@
+package stream
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/stream"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	macA       = []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	macB       = []byte{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb}
+	clientIP   = []byte{192, 168, 1, 10}
+	serverIP   = []byte{10, 0, 0, 1}
+	clientPort = uint16(49152)
+	serverPort = uint16(80)
+
+	start = time.Unix(1000, 0)
+)
+
+const (
+	syn    = capture.TCPFlagSYN
+	synAck = capture.TCPFlagSYN | capture.TCPFlagACK
+	ack    = capture.TCPFlagACK
+	psh    = capture.TCPFlagPSH | capture.TCPFlagACK
+	fin    = capture.TCPFlagFIN | capture.TCPFlagACK
+	rst    = capture.TCPFlagRST
+)
+
+type recordingConsumer struct {
+	data   [2][]byte
+	gaps   [2][]int
+	closes []stream.CloseReason
+}
+
+func (r *recordingConsumer) Data(dir stream.Direction, data []byte, timestamp time.Time) {
+	r.data[dir] = append(r.data[dir], data...)
+}
+
+func (r *recordingConsumer) Gap(dir stream.Direction, length int) {
+	r.gaps[dir] = append(r.gaps[dir], length)
+}
+
+func (r *recordingConsumer) Close(reason stream.CloseReason) {
+	r.closes = append(r.closes, reason)
+}
+
+// recordingAssembler returns an assembler that records every connection's
+// streams in the returned map.
+func recordingAssembler(config stream.AssemblerConfig) (*stream.Assembler, map[stream.ConnectionKey]*recordingConsumer) {
+	consumers := make(map[stream.ConnectionKey]*recordingConsumer)
+	assembler := stream.NewAssembler(config)
+	assembler.Register(func(key stream.ConnectionKey) stream.Consumer {
+		consumer := &recordingConsumer{}
+		consumers[key] = consumer
+		return consumer
+	})
+	return assembler, consumers
+}
+
+func segment(t *testing.T, fromClient bool, flags uint8, seq uint32, payload string) *capture.ParsedPacket {
+	t.Helper()
+	return segmentBetween(t, clientIP, clientPort, serverIP, serverPort, fromClient, flags, seq, payload)
+}
+
+func segmentBetween(t *testing.T, cIP []byte, cPort uint16, sIP []byte, sPort uint16, fromClient bool, flags uint8, seq uint32, payload string) *capture.ParsedPacket {
+	t.Helper()
+	gen := mocks.NewPacketGenerator()
+	srcIP, dstIP, srcPort, dstPort, srcMAC, dstMAC := cIP, sIP, cPort, sPort, macA, macB
+	if !fromClient {
+		srcIP, dstIP, srcPort, dstPort, srcMAC, dstMAC = sIP, cIP, sPort, cPort, macB, macA
+	}
+	tcp := gen.GenerateTCPSegmentWithSeq(srcPort, dstPort, flags, seq, 0, []byte(payload))
+	frame := gen.GenerateEthernetFrame(srcMAC, dstMAC, capture.EtherTypeIPv4, gen.GenerateIPv4Packet(srcIP, dstIP, capture.IPProtoTCP, tcp))
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+	require.NotNil(t, packet.TCP)
+	return packet
+}
+
+func testKey() stream.ConnectionKey {
+	return stream.ConnectionKey{
+		ClientIP:   netip.AddrFrom4([4]byte(clientIP)),
+		ClientPort: clientPort,
+		ServerIP:   netip.AddrFrom4([4]byte(serverIP)),
+		ServerPort: serverPort,
+	}
+}
+
+func TestAssembler_BidirectionalConnection(t *testing.T) {
+	assembler, consumers := recordingAssembler(stream.DefaultAssemblerConfig())
+
+	assembler.Assemble(segment(t, true, syn, 100, ""), start)
+	assembler.Assemble(segment(t, false, synAck, 5000, ""), start)
+	assembler.Assemble(segment(t, true, psh, 101, "GET / HTTP/1.1\r\n"), start)
+	assembler.Assemble(segment(t, true, psh, 117, "\r\n"), start)
+	assembler.Assemble(segment(t, false, psh, 5001, "HTTP/1.1 200 OK\r\n"), start)
+	assembler.Assemble(segment(t, true, fin, 119, ""), start)
+	assert.Equal(t, 1, assembler.Len())
+	assembler.Assemble(segment(t, false, fin, 5018, ""), start)
+
+	require.Len(t, consumers, 1)
+	consumer := consumers[testKey()]
+	require.NotNil(t, consumer)
+	assert.Equal(t, "GET / HTTP/1.1\r\n\r\n", string(consumer.data[stream.ClientToServer]))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", string(consumer.data[stream.ServerToClient]))
+	assert.Equal(t, []stream.CloseReason{stream.CloseFIN}, consumer.closes)
+	assert.Equal(t, 0, assembler.Len())
+
+	stats := assembler.GetStatistics()
+	assert.Equal(t, uint64(7), stats.Segments)
+	assert.Equal(t, uint64(35), stats.BytesDelivered)
+	assert.Equal(t, uint64(1), stats.ConnectionsOpened)
+	assert.Equal(t, uint64(1), stats.ConnectionsClosed)
+}
+
+func TestAssembler_OutOfOrder(t *testing.T) {
+	assembler, consumers := recordingAssembler(stream.DefaultAssemblerConfig())
+
+	assembler.Assemble(segment(t, true, syn, 0, ""), start)
+	assembler.Assemble(segment(t, true, psh, 7, "three"), start)
+	assembler.Assemble(segment(t, true, psh, 4, "two"), start)
+	assert.Equal(t, 8, assembler.GetStatistics().BufferedBytes)
+	assembler.Assemble(segment(t, true, psh, 1, "one"), start)
+
+	consumer := consumers[testKey()]
+	assert.Equal(t, "onetwothree", string(consumer.data[stream.ClientToServer]))
+
+	stats := assembler.GetStatistics()
+	assert.Equal(t, uint64(2), stats.OutOfOrder)
+	assert.Equal(t, 0, stats.BufferedBytes)
+}
+
+func TestAssembler_RetransmissionOverlap(t *testing.T) {
+	assembler, consumers := recordingAssembler(stream.DefaultAssemblerConfig())
+
+	assembler.Assemble(segment(t, true, syn, 0, ""), start)
+	assembler.Assemble(segment(t, true, psh, 1, "abcd"), start)
+	// A retransmission that overlaps delivered bytes with different data
+	// and extends past them; the bytes seen first win.
+	assembler.Assemble(segment(t, true, psh, 3, "XXef"), start)
+	assembler.Assemble(segment(t, true, psh, 1, "abcd"), start)
+	// Two buffered segments that overlap each other.
+	assembler.Assemble(segment(t, true, psh, 9, "ijkl"), start)
+	assembler.Assemble(segment(t, true, psh, 11, "YYmn"), start)
+	assembler.Assemble(segment(t, true, psh, 7, "gh"), start)
+
+	consumer := consumers[testKey()]
+	assert.Equal(t, "abcdefghijklmn", string(consumer.data[stream.ClientToServer]))
+
+	stats := assembler.GetStatistics()
+	assert.Equal(t, uint64(2), stats.Retransmissions)
+	assert.Equal(t, uint64(8), stats.OverlapBytes)
+}
+
+func TestAssembler_BufferedDuplicateKeepsFirstCopy(t *testing.T) {
+	assembler, consumers := recordingAssembler(stream.DefaultAssemblerConfig())
+
+	assembler.Assemble(segment(t, true, syn, 0, ""), start)
+	assembler.Assemble(segment(t, true, psh, 7, "gh"), start)
+	// A longer segment at the same sequence number: only the bytes past
+	// the buffered copy are added.
+	assembler.Assemble(segment(t, true, psh, 7, "XXij"), start)
+	assert.Equal(t, 4, assembler.GetStatistics().BufferedBytes)
+	// One entirely covered by what is buffered adds nothing.
+	assembler.Assemble(segment(t, true, psh, 8, "YZ"), start)
+	assert.Equal(t, 4, assembler.GetStatistics().BufferedBytes)
+
+	assembler.Assemble(segment(t, true, psh, 1, "abcdef"), start)
+
+	assert.Equal(t, "abcdefghij", string(consumers[testKey()].data[stream.ClientToServer]))
+	stats := assembler.GetStatistics()
+	assert.Equal(t, 0, stats.BufferedBytes)
+	assert.Equal(t, uint64(2), stats.OutOfOrder)
+	assert.Equal(t, uint64(1), stats.Retransmissions)
+	assert.Equal(t, uint64(4), stats.OverlapBytes)
+}
+
+func TestAssembler_SequenceWraparound(t *testing.T) {
+	assembler, consumers := recordingAssembler(stream.DefaultAssemblerConfig())
+
+	assembler.Assemble(segment(t, true, syn, 0xfffffffa, ""), start)
+	assembler.Assemble(segment(t, true, psh, 0x00000001, "world"), start)
+	assembler.Assemble(segment(t, true, psh, 0xfffffffb, "hello "), start)
+
+	assert.Equal(t, "hello world", string(consumers[testKey()].data[stream.ClientToServer]))
+}
+
+func TestAssembler_ResetClosesConnection(t *testing.T) {
+	assembler, consumers := recordingAssembler(stream.DefaultAssemblerConfig())
+
+	assembler.Assemble(segment(t, true, syn, 0, ""), start)
+	assembler.Assemble(segment(t, true, psh, 1, "abc"), start)
+	assembler.Assemble(segment(t, true, psh, 10, "late"), start)
+	assembler.Assemble(segment(t, false, rst, 0, ""), start)
+
+	consumer := consumers[testKey()]
+	assert.Equal(t, "abclate", string(consumer.data[stream.ClientToServer]))
+	assert.Equal(t, []int{6}, consumer.gaps[stream.ClientToServer])
+	assert.Equal(t, []stream.CloseReason{stream.CloseReset}, consumer.closes)
+	assert.Equal(t, 0, assembler.Len())
+}
+
+func TestAssembler_FINWaitsForMissingData(t *testing.T) {
+	assembler, consumers := recordingAssembler(stream.DefaultAssemblerConfig())
+
+	assembler.Assemble(segment(t, true, syn, 0, ""), start)
+	assembler.Assemble(segment(t, false, synAck, 0, ""), start)
+	assembler.Assemble(segment(t, true, fin, 4, "def"), start)
+	assembler.Assemble(segment(t, false, fin, 1, ""), start)
+	assert.Equal(t, 1, assembler.Len(), "the client's first segment is still missing")
+
+	assembler.Assemble(segment(t, true, psh, 1, "abc"), start)
+
+	consumer := consumers[testKey()]
+	assert.Equal(t, "abcdef", string(consumer.data[stream.ClientToServer]))
+	assert.Equal(t, []stream.CloseReason{stream.CloseFIN}, consumer.closes)
+	assert.Equal(t, 0, assembler.Len())
+}
+
+func TestAssembler_ConnectionBufferLimit(t *testing.T) {
+	assembler, consumers := recordingAssembler(stream.AssemblerConfig{MaxConnectionBuffer: 8})
+
+	assembler.Assemble(segment(t, true, syn, 0, ""), start)
+	assembler.Assemble(segment(t, true, psh, 11, "abcde"), start)
+	assembler.Assemble(segment(t, true, psh, 16, "fghij"), start)
+
+	consumer := consumers[testKey()]
+	assert.Equal(t, []int{10}, consumer.gaps[stream.ClientToServer])
+	assert.Equal(t, "abcdefghij", string(consumer.data[stream.ClientToServer]))
+
+	// Data that was given up on is now a retransmission.
+	assembler.Assemble(segment(t, true, psh, 1, "0123456789"), start)
+	assert.Equal(t, "abcdefghij", string(consumer.data[stream.ClientToServer]))
+
+	stats := assembler.GetStatistics()
+	assert.Equal(t, uint64(10), stats.GapBytes)
+	assert.Equal(t, 0, stats.BufferedBytes)
+}
+
+func TestAssembler_TotalBufferLimitFlushesOldest(t *testing.T) {
+	assembler, consumers := recordingAssembler(stream.AssemblerConfig{MaxTotalBuffer: 10})
+	otherIP := []byte{192, 168, 1, 11}
+
+	assembler.Assemble(segment(t, true, syn, 0, ""), start)
+	assembler.Assemble(segment(t, true, psh, 5, "first"), start)
+	assembler.Assemble(segmentBetween(t, otherIP, clientPort, serverIP, serverPort, true, syn, 0, ""), start.Add(time.Second))
+	assembler.Assemble(segmentBetween(t, otherIP, clientPort, serverIP, serverPort, true, psh, 5, "second"), start.Add(time.Second))
+
+	oldest := consumers[testKey()]
+	assert.Equal(t, []int{4}, oldest.gaps[stream.ClientToServer])
+	assert.Equal(t, "first", string(oldest.data[stream.ClientToServer]))
+	assert.Equal(t, 6, assembler.GetStatistics().BufferedBytes)
+}
+
+func TestAssembler_ExpireIdleConnections(t *testing.T) {
+	assembler, consumers := recordingAssembler(stream.AssemblerConfig{IdleTimeout: time.Minute})
+
+	assembler.Assemble(segment(t, true, syn, 0, ""), start)
+	assembler.Assemble(segment(t, true, psh, 3, "cd"), start)
+
+	assert.Equal(t, 0, assembler.Expire(start.Add(time.Minute)))
+	assert.Equal(t, 1, assembler.Expire(start.Add(time.Minute+time.Second)))
+
+	consumer := consumers[testKey()]
+	assert.Equal(t, []int{2}, consumer.gaps[stream.ClientToServer])
+	assert.Equal(t, "cd", string(consumer.data[stream.ClientToServer]))
+	assert.Equal(t, []stream.CloseReason{stream.CloseTimeout}, consumer.closes)
+	assert.Equal(t, uint64(1), assembler.GetStatistics().Timeouts)
+}
+
+func TestAssembler_MaxConnectionsEvictsLeastRecent(t *testing.T) {
+	assembler, consumers := recordingAssembler(stream.AssemblerConfig{MaxConnections: 2})
+
+	for port := uint16(50000); port < 50003; port++ {
+		assembler.Assemble(segmentBetween(t, clientIP, port, serverIP, serverPort, true, syn, 0, ""), start)
+	}
+
+	assert.Equal(t, 2, assembler.Len())
+	evicted := 0
+	for key, consumer := range consumers {
+		if len(consumer.closes) > 0 {
+			evicted++
+			assert.Equal(t, uint16(50000), key.ClientPort)
+			assert.Equal(t, []stream.CloseReason{stream.CloseEvicted}, consumer.closes)
+		}
+	}
+	assert.Equal(t, 1, evicted)
+	assert.Equal(t, uint64(1), assembler.GetStatistics().Evictions)
+}
+
+func TestAssembler_MidStreamPickup(t *testing.T) {
+	assembler, consumers := recordingAssembler(stream.DefaultAssemblerConfig())
+
+	// The first segment seen comes from the server; the lower port tells
+	// which side that is.
+	assembler.Assemble(segment(t, false, psh, 9000, "response"), start)
+	assembler.Assemble(segment(t, true, psh, 300, "request"), start)
+
+	consumer := consumers[testKey()]
+	require.NotNil(t, consumer)
+	assert.Equal(t, "response", string(consumer.data[stream.ServerToClient]))
+	assert.Equal(t, "request", string(consumer.data[stream.ClientToServer]))
+}
+
+func TestAssembler_IgnoresStraySegments(t *testing.T) {
+	assembler, consumers := recordingAssembler(stream.DefaultAssemblerConfig())
+
+	assembler.Assemble(segment(t, true, ack, 1, ""), start)
+	assembler.Assemble(segment(t, true, rst, 1, ""), start)
+	assembler.Assemble(segment(t, true, fin, 1, ""), start)
+
+	assert.Empty(t, consumers)
+	assert.Equal(t, 0, assembler.Len())
+}
+
+func TestAssembler_UnwantedConnectionsAreNotBuffered(t *testing.T) {
+	assembler := stream.NewAssembler(stream.DefaultAssemblerConfig())
+	assembler.Register(func(key stream.ConnectionKey) stream.Consumer { return nil })
+
+	assembler.Assemble(segment(t, true, syn, 0, ""), start)
+	assembler.Assemble(segment(t, true, psh, 10, "ahead"), start)
+
+	stats := assembler.GetStatistics()
+	assert.Equal(t, 1, stats.Connections)
+	assert.Equal(t, 0, stats.BufferedBytes)
+	assert.Equal(t, uint64(0), stats.BytesDelivered)
+}
+
+func TestAssembler_UnwantedConnectionsCloseOnFIN(t *testing.T) {
+	assembler := stream.NewAssembler(stream.DefaultAssemblerConfig())
+
+	assembler.Assemble(segment(t, true, syn, 0, ""), start)
+	assembler.Assemble(segment(t, false, synAck, 0, ""), start)
+	assembler.Assemble(segment(t, true, psh, 1, "abc"), start)
+	assembler.Assemble(segment(t, false, psh, 1, "defg"), start)
+	assembler.Assemble(segment(t, true, fin, 4, ""), start)
+	assembler.Assemble(segment(t, false, fin, 5, ""), start)
+
+	stats := assembler.GetStatistics()
+	assert.Equal(t, 0, stats.Connections)
+	assert.Equal(t, uint64(1), stats.ConnectionsClosed)
+	assert.Equal(t, uint64(0), stats.BytesDelivered)
+}
+
+func TestAssembler_FlushAll(t *testing.T) {
+	assembler, consumers := recordingAssembler(stream.DefaultAssemblerConfig())
+
+	assembler.Assemble(segment(t, true, syn, 0, ""), start)
+	assembler.Assemble(segment(t, true, psh, 5, "tail"), start)
+	assembler.FlushAll()
+
+	consumer := consumers[testKey()]
+	assert.Equal(t, []int{4}, consumer.gaps[stream.ClientToServer])
+	assert.Equal(t, "tail", string(consumer.data[stream.ClientToServer]))
+	assert.Equal(t, []stream.CloseReason{stream.CloseFlushed}, consumer.closes)
+	assert.Equal(t, 0, assembler.Len())
+}
+
+func TestConnectionKey_String(t *testing.T) {
+	assert.Equal(t, "192.168.1.10:49152-10.0.0.1:80", testKey().String())
+}
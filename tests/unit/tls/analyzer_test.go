@@ -0,0 +1,199 @@
+package tls
+
+import (
+	"log/slog"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/capture"
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/tls"
+	"github.com/Karias-sys/Traffic_Monitor/internal/stream"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	clientMAC = []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	serverMAC = []byte{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb}
+	clientIP  = []byte{192, 168, 1, 10}
+	serverIP  = []byte{10, 0, 0, 1}
+
+	connectionKey = stream.ConnectionKey{
+		ClientIP: netip.MustParseAddr("192.168.1.10"), ClientPort: 49152,
+		ServerIP: netip.MustParseAddr("10.0.0.1"), ServerPort: 443,
+	}
+	start = time.Unix(1000, 0)
+)
+
+const psh = capture.TCPFlagPSH | capture.TCPFlagACK
+
+func createTestLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+}
+
+func segment(t *testing.T, fromClient bool, flags uint8, seq uint32, payload []byte) *capture.ParsedPacket {
+	t.Helper()
+	gen := mocks.NewPacketGenerator()
+	srcIP, dstIP, srcPort, dstPort, srcMAC, dstMAC := clientIP, serverIP, uint16(49152), uint16(443), clientMAC, serverMAC
+	if !fromClient {
+		srcIP, dstIP, srcPort, dstPort, srcMAC, dstMAC = serverIP, clientIP, uint16(443), uint16(49152), serverMAC, clientMAC
+	}
+	tcp := gen.GenerateTCPSegmentWithSeq(srcPort, dstPort, flags, seq, 0, payload)
+	frame := gen.GenerateEthernetFrame(srcMAC, dstMAC, capture.EtherTypeIPv4, gen.GenerateIPv4Packet(srcIP, dstIP, capture.IPProtoTCP, tcp))
+	packet, err := capture.ParsePacket(frame)
+	require.NoError(t, err)
+	return packet
+}
+
+func analyzerWithAssembler() (*tls.Analyzer, *stream.Assembler) {
+	analyzer := tls.NewAnalyzer(createTestLogger())
+	assembler := stream.NewAssembler(stream.DefaultAssemblerConfig())
+	assembler.Register(analyzer.ConsumerFactory)
+	return analyzer, assembler
+}
+
+func serverHelloRecord(random []byte) []byte {
+	gen := mocks.NewPacketGenerator()
+	return gen.GenerateTLSHandshakeRecord(tls.HandshakeTypeServerHello, gen.GenerateTLSServerHello(0x0303, random, 0x1301,
+		gen.GenerateTLSExtension(tls.ExtensionSupportedVersions, []byte{0x03, 0x04}),
+		gen.GenerateTLSALPNExtension("h2")))
+}
+
+func TestAnalyzer_ExtractsHandshakeAcrossSegments(t *testing.T) {
+	analyzer, assembler := analyzerWithAssembler()
+	gen := mocks.NewPacketGenerator()
+	clientHello := gen.GenerateTLSHandshakeRecord(tls.HandshakeTypeClientHello, chromeLikeHello())
+
+	var handled []*tls.Handshake
+	analyzer.OnHandshake(func(key stream.ConnectionKey, handshake *tls.Handshake) {
+		assert.Equal(t, connectionKey, key)
+		handled = append(handled, handshake)
+	})
+
+	assembler.Assemble(segment(t, true, capture.TCPFlagSYN, 100, nil), start)
+	assembler.Assemble(segment(t, false, capture.TCPFlagSYN|capture.TCPFlagACK, 500, nil), start)
+	// The ClientHello is split across two segments, the second arriving
+	// first.
+	split := 60
+	assembler.Assemble(segment(t, true, psh, 101+uint32(split), clientHello[split:]), start.Add(2*time.Millisecond))
+	assembler.Assemble(segment(t, true, psh, 101, clientHello[:split]), start.Add(time.Millisecond))
+	assert.Empty(t, handled, "nothing is reported before the ServerHello")
+	assembler.Assemble(segment(t, false, psh, 501, serverHelloRecord(nil)), start.Add(3*time.Millisecond))
+
+	require.Len(t, handled, 1)
+	hs := handled[0]
+	assert.Equal(t, "www.example.com", hs.ServerName)
+	assert.Equal(t, []string{"h2"}, hs.ALPN, "the server's choice replaces the offer")
+	assert.Equal(t, "t13d1516h2_8daaf6152771_e5627efa2ab1", hs.JA4)
+	assert.Equal(t, tls.FingerprintHash(hs.JA3), hs.JA3Hash)
+	assert.Equal(t, "771,4865,43-16", hs.JA3S)
+	assert.Equal(t, tls.VersionTLS13, hs.Version)
+	assert.Equal(t, tls.CipherSuite(0x1301), hs.Cipher)
+	assert.Equal(t, start.Add(time.Millisecond), hs.Timestamp, "the first data in stream order")
+
+	looked, ok := analyzer.Lookup(connectionKey)
+	require.True(t, ok)
+	assert.Same(t, hs, looked)
+
+	stats := analyzer.GetStatistics()
+	assert.Equal(t, 1, stats.Handshakes)
+	assert.Equal(t, uint64(1), stats.ClientHellos)
+	assert.Equal(t, uint64(1), stats.ServerHellos)
+}
+
+func TestAnalyzer_ReportsClientHelloOnClose(t *testing.T) {
+	analyzer, assembler := analyzerWithAssembler()
+	gen := mocks.NewPacketGenerator()
+	clientHello := gen.GenerateTLSHandshakeRecord(tls.HandshakeTypeClientHello, chromeLikeHello())
+
+	assembler.Assemble(segment(t, true, capture.TCPFlagSYN, 100, nil), start)
+	assembler.Assemble(segment(t, true, capture.TCPFlagPSH|capture.TCPFlagACK, 101, clientHello), start)
+	_, ok := analyzer.Lookup(connectionKey)
+	assert.False(t, ok)
+
+	assembler.Assemble(segment(t, false, capture.TCPFlagRST, 0, nil), start)
+	hs, ok := analyzer.Lookup(connectionKey)
+	require.True(t, ok)
+	assert.Equal(t, "www.example.com", hs.ServerName)
+	assert.Nil(t, hs.Server)
+	assert.Empty(t, hs.JA3S)
+}
+
+func TestAnalyzer_WaitsPastHelloRetryRequest(t *testing.T) {
+	analyzer, assembler := analyzerWithAssembler()
+	gen := mocks.NewPacketGenerator()
+	clientHello := gen.GenerateTLSHandshakeRecord(tls.HandshakeTypeClientHello, chromeLikeHello())
+	retryRandom := []byte{
+		0xCF, 0x21, 0xAD, 0x74, 0xE5, 0x9A, 0x61, 0x11, 0xBE, 0x1D, 0x8C, 0x02, 0x1E, 0x65, 0xB8, 0x91,
+		0xC2, 0xA2, 0x11, 0x16, 0x7A, 0xBB, 0x8C, 0x5E, 0x07, 0x9E, 0x09, 0xE2, 0xC8, 0xA8, 0x33, 0x9C,
+	}
+	retry := append(serverHelloRecord(retryRandom), gen.GenerateTLSRecord(20, []byte{1})...)
+
+	assembler.Assemble(segment(t, true, capture.TCPFlagSYN, 100, nil), start)
+	assembler.Assemble(segment(t, false, capture.TCPFlagSYN|capture.TCPFlagACK, 500, nil), start)
+	assembler.Assemble(segment(t, true, psh, 101, clientHello), start)
+	assembler.Assemble(segment(t, false, psh, 501, retry), start)
+	_, ok := analyzer.Lookup(connectionKey)
+	assert.False(t, ok)
+
+	assembler.Assemble(segment(t, false, psh, 501+uint32(len(retry)), serverHelloRecord(nil)), start)
+	hs, ok := analyzer.Lookup(connectionKey)
+	require.True(t, ok)
+	assert.False(t, hs.Server.HelloRetryRequest)
+	assert.Equal(t, uint64(2), analyzer.GetStatistics().ServerHellos)
+}
+
+func TestAnalyzer_IgnoresNonTLS(t *testing.T) {
+	analyzer, assembler := analyzerWithAssembler()
+
+	assembler.Assemble(segment(t, true, capture.TCPFlagSYN, 100, nil), start)
+	assembler.Assemble(segment(t, true, psh, 101, []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")), start)
+	assembler.FlushAll()
+
+	_, ok := analyzer.Lookup(connectionKey)
+	assert.False(t, ok)
+	stats := analyzer.GetStatistics()
+	assert.Equal(t, uint64(1), stats.NotTLS)
+	assert.Equal(t, uint64(1), stats.Connections)
+}
+
+func TestAnalyzer_GivesUpOnOversizedHello(t *testing.T) {
+	analyzer := tls.NewAnalyzerWithConfig(createTestLogger(), tls.AnalyzerConfig{MaxHelloSize: 64})
+	assembler := stream.NewAssembler(stream.DefaultAssemblerConfig())
+	assembler.Register(analyzer.ConsumerFactory)
+	gen := mocks.NewPacketGenerator()
+
+	assembler.Assemble(segment(t, true, capture.TCPFlagSYN, 100, nil), start)
+	assembler.Assemble(segment(t, true, capture.TCPFlagPSH|capture.TCPFlagACK, 101,
+		gen.GenerateTLSHandshakeRecord(tls.HandshakeTypeClientHello, chromeLikeHello())), start)
+	assembler.FlushAll()
+
+	_, ok := analyzer.Lookup(connectionKey)
+	assert.False(t, ok)
+	assert.Equal(t, uint64(1), analyzer.GetStatistics().Oversized)
+}
+
+func TestAnalyzer_DropsOldestHandshake(t *testing.T) {
+	analyzer := tls.NewAnalyzerWithConfig(createTestLogger(), tls.AnalyzerConfig{MaxHandshakes: 1})
+	gen := mocks.NewPacketGenerator()
+	clientHello := gen.GenerateTLSHandshakeRecord(tls.HandshakeTypeClientHello, chromeLikeHello())
+
+	first := connectionKey
+	second := connectionKey
+	second.ClientPort++
+	for _, key := range []stream.ConnectionKey{first, second} {
+		consumer := analyzer.ConsumerFactory(key)
+		consumer.Data(stream.ClientToServer, clientHello, start)
+		consumer.Close(stream.CloseFIN)
+	}
+
+	_, ok := analyzer.Lookup(first)
+	assert.False(t, ok)
+	_, ok = analyzer.Lookup(second)
+	assert.True(t, ok)
+}
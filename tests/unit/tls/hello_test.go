@@ -0,0 +1,154 @@
+package tls
+
+import (
+	"testing"
+
+	"github.com/Karias-sys/Traffic_Monitor/internal/protocol/tls"
+	"github.com/Karias-sys/Traffic_Monitor/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const grease = 0x2A2A
+
+// chromeLikeHello is the ClientHello from the JA4 specification's worked
+// example: 15 cipher suites and 16 extensions offering TLS 1.3 and h2.
+func chromeLikeHello() []byte {
+	gen := mocks.NewPacketGenerator()
+	ciphers := []uint16{grease, 0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030, 0xcca9, 0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035}
+	return gen.GenerateTLSClientHello(0x0303, ciphers,
+		gen.GenerateTLSExtension(grease, nil),
+		gen.GenerateTLSServerNameExtension("WWW.Example.com"),
+		gen.GenerateTLSExtension(0x0017, nil),
+		gen.GenerateTLSExtension(0xff01, []byte{0}),
+		gen.GenerateTLSUint16ListExtension(tls.ExtensionSupportedGroups, 2, grease, 0x001d, 0x0017, 0x0018),
+		gen.GenerateTLSExtension(tls.ExtensionECPointFormats, []byte{1, 0}),
+		gen.GenerateTLSExtension(0x0023, nil),
+		gen.GenerateTLSALPNExtension("h2", "http/1.1"),
+		gen.GenerateTLSExtension(0x0005, []byte{1, 0, 0, 0, 0}),
+		gen.GenerateTLSUint16ListExtension(tls.ExtensionSignatureAlgorithms, 2, 0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601),
+		gen.GenerateTLSExtension(0x0012, nil),
+		gen.GenerateTLSExtension(0x0033, []byte{0, 0}),
+		gen.GenerateTLSExtension(0x002d, []byte{1, 1}),
+		gen.GenerateTLSUint16ListExtension(tls.ExtensionSupportedVersions, 1, grease, 0x0304, 0x0303),
+		gen.GenerateTLSExtension(0x001b, []byte{2, 0, 2}),
+		gen.GenerateTLSExtension(0x4469, nil),
+		gen.GenerateTLSExtension(0x0015, nil),
+		gen.GenerateTLSExtension(grease, []byte{0}),
+	)
+}
+
+func TestParseClientHello(t *testing.T) {
+	ch, err := tls.ParseClientHello(chromeLikeHello())
+	require.NoError(t, err)
+
+	assert.Equal(t, tls.VersionTLS12, ch.Version)
+	assert.Equal(t, tls.VersionTLS13, ch.MaxVersion())
+	assert.Equal(t, "www.example.com", ch.ServerName)
+	assert.Equal(t, []string{"h2", "http/1.1"}, ch.ALPN)
+	assert.Len(t, ch.CipherSuites, 16)
+	assert.Equal(t, tls.CipherSuite(grease), ch.CipherSuites[0], "GREASE values are kept as sent")
+	assert.Len(t, ch.Extensions, 18)
+	assert.Equal(t, []uint16{grease, 0x001d, 0x0017, 0x0018}, ch.SupportedGroups)
+	assert.Equal(t, []uint8{0}, ch.ECPointFormats)
+	assert.Equal(t, []tls.Version{grease, tls.VersionTLS13, tls.VersionTLS12}, ch.SupportedVersions)
+	assert.Len(t, ch.SignatureAlgorithms, 8)
+	assert.Equal(t, []uint8{0}, ch.CompressionMethods)
+}
+
+func TestJA4_SpecificationExample(t *testing.T) {
+	ch, err := tls.ParseClientHello(chromeLikeHello())
+	require.NoError(t, err)
+
+	assert.Equal(t, "t13d1516h2_8daaf6152771_e5627efa2ab1", tls.JA4(ch, tls.TransportTCP))
+	assert.Equal(t, "q13d1516h2_8daaf6152771_e5627efa2ab1", tls.JA4(ch, tls.TransportQUIC))
+}
+
+func TestJA4_Prefix(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+
+	tests := []struct {
+		name       string
+		version    uint16
+		extensions [][]byte
+		want       string
+	}{
+		{"no SNI or ALPN", 0x0303, nil, "t12i010000_"},
+		{"TLS 1.0 with SNI", 0x0301, [][]byte{gen.GenerateTLSServerNameExtension("a.example")}, "t10d010100_"},
+		{"non-alphanumeric ALPN", 0x0303, [][]byte{gen.GenerateTLSALPNExtension("\x01\x02")}, "t12i010102_"},
+		{"empty ALPN list", 0x0303, [][]byte{gen.GenerateTLSALPNExtension()}, "t12i010100_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, err := tls.ParseClientHello(gen.GenerateTLSClientHello(tt.version, []uint16{0x002f}, tt.extensions...))
+			require.NoError(t, err)
+			assert.Contains(t, tls.JA4(ch, tls.TransportTCP), tt.want)
+		})
+	}
+
+	ch, err := tls.ParseClientHello(gen.GenerateTLSClientHello(0x0303, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "t12i000000_000000000000_000000000000", tls.JA4(ch, tls.TransportTCP))
+}
+
+func TestJA3_ReferenceHash(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	body := gen.GenerateTLSClientHello(0x0301,
+		[]uint16{grease, 47, 53, 5, 10, 49161, 49162, 49171, 49172, 50, 56, 19, 4},
+		gen.GenerateTLSServerNameExtension("example.com"),
+		gen.GenerateTLSUint16ListExtension(tls.ExtensionSupportedGroups, 2, 23, 24, 25),
+		gen.GenerateTLSExtension(tls.ExtensionECPointFormats, []byte{1, 0}),
+		gen.GenerateTLSExtension(grease, nil),
+	)
+	ch, err := tls.ParseClientHello(body)
+	require.NoError(t, err)
+
+	ja3 := tls.JA3(ch)
+	assert.Equal(t, "769,47-53-5-10-49161-49162-49171-49172-50-56-19-4,0-10-11,23-24-25,0", ja3)
+	assert.Equal(t, "ada70206e40642a3e4461f35503241d5", tls.FingerprintHash(ja3))
+}
+
+func TestParseServerHello(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	// The server sends its selected version bare, without a list length.
+	body := gen.GenerateTLSServerHello(0x0303, nil, 0x1301,
+		gen.GenerateTLSExtension(tls.ExtensionSupportedVersions, []byte{0x03, 0x04}),
+		gen.GenerateTLSALPNExtension("h2"),
+	)
+
+	sh, err := tls.ParseServerHello(body)
+	require.NoError(t, err)
+	assert.Equal(t, tls.VersionTLS12, sh.Version)
+	assert.Equal(t, tls.VersionTLS13, sh.NegotiatedVersion())
+	assert.Equal(t, "TLS_AES_128_GCM_SHA256", sh.CipherSuite.String())
+	assert.Equal(t, "h2", sh.ALPN)
+	assert.False(t, sh.HelloRetryRequest)
+	assert.Equal(t, "771,4865,43-16", tls.JA3S(sh))
+}
+
+func TestParseHello_Malformed(t *testing.T) {
+	gen := mocks.NewPacketGenerator()
+	valid := gen.GenerateTLSClientHello(0x0303, []uint16{0x1301}, gen.GenerateTLSServerNameExtension("example.com"))
+
+	_, err := tls.ParseClientHello(valid[:20])
+	assert.ErrorIs(t, err, tls.ErrTruncated)
+
+	_, err = tls.ParseClientHello(valid[:len(valid)-1])
+	assert.ErrorIs(t, err, tls.ErrTruncated)
+
+	badSNI := gen.GenerateTLSClientHello(0x0303, []uint16{0x1301}, gen.GenerateTLSExtension(tls.ExtensionServerName, []byte{0, 9, 0}))
+	_, err = tls.ParseClientHello(badSNI)
+	assert.ErrorIs(t, err, tls.ErrMalformed)
+
+	_, err = tls.ParseServerHello(gen.GenerateTLSServerHello(0x0303, nil, 0x1301)[:35])
+	assert.ErrorIs(t, err, tls.ErrTruncated)
+}
+
+func TestIsGREASE(t *testing.T) {
+	for _, v := range []uint16{0x0A0A, 0x1A1A, 0xFAFA} {
+		assert.True(t, tls.IsGREASE(v), "%#04x", v)
+	}
+	for _, v := range []uint16{0x0A1A, 0x1301, 0x0000} {
+		assert.False(t, tls.IsGREASE(v), "%#04x", v)
+	}
+}